@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+// Principal 目前請求的呼叫者
+type Principal struct {
+	UserID   uint64
+	Username string
+	Role     model.Role
+}
+
+type principalKey struct{}
+
+// WithPrincipal 將呼叫者放入context, 由auth middleware在驗證token後設定
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom 取出呼叫者, 沒有呼叫者(系統排程或未啟用驗證)時ok為false
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal, principal != nil
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+// 支援的簽章演算法
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+const (
+	// minSecretLength HS256的secret至少與hash等長
+	minSecretLength = 32
+	minRSABits      = 2048
+	// clockSkew 容許簽發端與驗證端的時間誤差
+	clockSkew = 30 * time.Second
+)
+
+// Key 簽章金鑰, ID放在token header的kid, 驗證時依kid找回金鑰
+// HS256使用Secret; RS256以PrivateKey簽章、PublicKey驗證, 只有PublicKey的金鑰只能驗證
+type Key struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PrivateKey *rsa.PrivateKey
+	PublicKey  *rsa.PublicKey
+}
+
+// canSign 有簽章用的secret或private key
+func (k Key) canSign() bool {
+	return (k.Algorithm == HS256 && len(k.Secret) > 0) || (k.Algorithm == RS256 && k.PrivateKey != nil)
+}
+
+func (k Key) validate() error {
+	if k.ID == "" {
+		return errors.New("jwt key id is required")
+	}
+	switch k.Algorithm {
+	case HS256:
+		if len(k.Secret) < minSecretLength {
+			return fmt.Errorf("jwt key %s: HS256 secret must be at least %d bytes", k.ID, minSecretLength)
+		}
+	case RS256:
+		if k.PublicKey == nil {
+			return fmt.Errorf("jwt key %s: RS256 requires a private or public key", k.ID)
+		}
+		if k.PublicKey.N.BitLen() < minRSABits {
+			return fmt.Errorf("jwt key %s: RSA key must be at least %d bits", k.ID, minRSABits)
+		}
+	default:
+		return fmt.Errorf("jwt key %s: unsupported algorithm %q, expected %s or %s", k.ID, k.Algorithm, HS256, RS256)
+	}
+	return nil
+}
+
+// Claims access token的內容, Subject為使用者ID
+// 角色不寫入token, 每個請求由auth middleware依使用者讀取, 變更角色立即生效
+type Claims struct {
+	Subject   string `json:"sub"`
+	Username  string `json:"username"`
+	Issuer    string `json:"iss"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+}
+
+// Principal token對應的呼叫者, Role由呼叫端依使用者目前的角色設定
+func (c *Claims) Principal() (*Principal, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return nil, model.NewError(model.ErrUnauthorized, "invalid token subject")
+	}
+	return &Principal{UserID: id, Username: c.Username}, nil
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// JWTConfig
+// ActiveKey: 簽發新token的金鑰, 其他金鑰只用來驗證輪替前簽發、尚未過期的token
+type JWTConfig struct {
+	Keys      []Key
+	ActiveKey string
+	Issuer    string
+	TTL       time.Duration
+}
+
+// JWT 簽發與驗證access token, 支援多把金鑰輪替
+type JWT struct {
+	keys   map[string]Key
+	active Key
+	issuer string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewJWT(cfg JWTConfig) (*JWT, error) {
+	if cfg.TTL <= 0 {
+		return nil, errors.New("jwt token ttl must be positive")
+	}
+	j := &JWT{keys: make(map[string]Key, len(cfg.Keys)), issuer: cfg.Issuer, ttl: cfg.TTL, now: time.Now}
+	for _, key := range cfg.Keys {
+		if key.PrivateKey != nil && key.PublicKey == nil {
+			key.PublicKey = &key.PrivateKey.PublicKey
+		}
+		if err := key.validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := j.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate jwt key id %s", key.ID)
+		}
+		j.keys[key.ID] = key
+	}
+	active, ok := j.keys[cfg.ActiveKey]
+	if !ok {
+		return nil, fmt.Errorf("active jwt key %q is not configured", cfg.ActiveKey)
+	}
+	if !active.canSign() {
+		return nil, fmt.Errorf("active jwt key %s cannot sign, a secret or private key is required", active.ID)
+	}
+	j.active = active
+	return j, nil
+}
+
+// Issue 以active key簽發使用者的access token
+func (j *JWT) Issue(user *model.User) (*model.Token, error) {
+	now := j.now()
+	expiresAt := now.Add(j.ttl)
+	claims := Claims{
+		Subject:   strconv.FormatUint(user.ID, 10),
+		Username:  user.Username,
+		Issuer:    j.issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		ID:        uuid.New().String(),
+	}
+	token, err := j.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(j.ttl / time.Second),
+		ExpiresAt:   time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+func (j *JWT) sign(claims Claims) (string, error) {
+	headerJSON, err := json.Marshal(header{Algorithm: j.active.Algorithm, Type: "JWT", KeyID: j.active.ID})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encodeSegment(headerJSON) + "." + encodeSegment(claimsJSON)
+
+	var signature []byte
+	switch j.active.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, j.active.Secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case RS256:
+		digest := sha256.Sum256([]byte(signingInput))
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, j.active.PrivateKey, crypto.SHA256, digest[:]); err != nil {
+			return "", err
+		}
+	}
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// Verify 驗證簽章、簽發者與有效期間, 失敗時回傳ErrUnauthorized
+// header的alg必須與kid對應金鑰的演算法相同, 不接受none或以public key當HMAC secret
+func (j *JWT) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+	var h header
+	if err := decodeJSONSegment(parts[0], &h); err != nil {
+		return nil, invalidToken("malformed token header")
+	}
+	key, ok := j.keys[h.KeyID]
+	if !ok {
+		return nil, invalidToken("unknown signing key")
+	}
+	if h.Algorithm != key.Algorithm {
+		return nil, invalidToken("unexpected signing algorithm")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed token signature")
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	switch key.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, invalidToken("invalid token signature")
+		}
+	case RS256:
+		digest := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, invalidToken("invalid token signature")
+		}
+	}
+
+	var claims Claims
+	if err := decodeJSONSegment(parts[1], &claims); err != nil {
+		return nil, invalidToken("malformed token claims")
+	}
+	now := j.now()
+	switch {
+	case claims.Issuer != j.issuer:
+		return nil, invalidToken("unexpected token issuer")
+	case claims.ExpiresAt == 0 || now.Add(-clockSkew).Unix() >= claims.ExpiresAt:
+		return nil, invalidToken("token expired")
+	case now.Add(clockSkew).Unix() < claims.IssuedAt:
+		return nil, invalidToken("token used before issued")
+	}
+	return &claims, nil
+}
+
+func invalidToken(message string) error {
+	return model.NewError(model.ErrUnauthorized, message)
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeJSONSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
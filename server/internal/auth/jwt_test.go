@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	testUser   = &model.User{ID: 42, Username: "alice"}
+)
+
+func newTestJWT(t *testing.T, active string, keys ...Key) *JWT {
+	t.Helper()
+	j, err := NewJWT(JWTConfig{Keys: keys, ActiveKey: active, Issuer: "test", TTL: time.Hour})
+	require.NoError(t, err)
+	return j
+}
+
+func generateRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func assertUnauthorized(t *testing.T, err error, message string) {
+	t.Helper()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, model.ErrUnauthorized), err)
+	assert.Contains(t, err.Error(), message)
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	rsaKey := generateRSAKey(t)
+	for _, key := range []Key{
+		{ID: "hs", Algorithm: HS256, Secret: testSecret},
+		{ID: "rs", Algorithm: RS256, PrivateKey: rsaKey},
+	} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			j := newTestJWT(t, key.ID, key)
+			token, err := j.Issue(testUser)
+			require.NoError(t, err)
+			assert.Equal(t, "Bearer", token.TokenType)
+			assert.Equal(t, int64(3600), token.ExpiresIn)
+
+			claims, err := j.Verify(token.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, "42", claims.Subject)
+			assert.Equal(t, "alice", claims.Username)
+			assert.Equal(t, "test", claims.Issuer)
+			assert.NotEmpty(t, claims.ID)
+
+			principal, err := claims.Principal()
+			require.NoError(t, err)
+			assert.Equal(t, &Principal{UserID: 42, Username: "alice"}, principal)
+		})
+	}
+}
+
+// TestJWTKeyRotation 輪替後舊token在過期前仍可驗證, 新token以新金鑰簽發
+func TestJWTKeyRotation(t *testing.T) {
+	oldKey := Key{ID: "2025", Algorithm: HS256, Secret: testSecret}
+	newKey := Key{ID: "2026", Algorithm: RS256, PrivateKey: generateRSAKey(t)}
+
+	before := newTestJWT(t, "2025", oldKey)
+	oldToken, err := before.Issue(testUser)
+	require.NoError(t, err)
+
+	after := newTestJWT(t, "2026", oldKey, newKey)
+	_, err = after.Verify(oldToken.AccessToken)
+	require.NoError(t, err)
+
+	newToken, err := after.Issue(testUser)
+	require.NoError(t, err)
+	var h header
+	require.NoError(t, decodeJSONSegment(strings.Split(newToken.AccessToken, ".")[0], &h))
+	assert.Equal(t, header{Algorithm: RS256, Type: "JWT", KeyID: "2026"}, h)
+
+	// 移除舊金鑰後舊token失效
+	retired := newTestJWT(t, "2026", newKey)
+	_, err = retired.Verify(oldToken.AccessToken)
+	assertUnauthorized(t, err, "unknown signing key")
+
+	// 只有public key的金鑰可以驗證, 不能當active key
+	verifyOnly := Key{ID: "2026", Algorithm: RS256, PublicKey: &newKey.PrivateKey.PublicKey}
+	_, err = newTestJWT(t, "2025", oldKey, verifyOnly).Verify(newToken.AccessToken)
+	require.NoError(t, err)
+	_, err = NewJWT(JWTConfig{Keys: []Key{verifyOnly}, ActiveKey: "2026", TTL: time.Hour})
+	assert.ErrorContains(t, err, "cannot sign")
+}
+
+func TestJWTRejects(t *testing.T) {
+	hs := Key{ID: "hs", Algorithm: HS256, Secret: testSecret}
+	j := newTestJWT(t, "hs", hs)
+	token, err := j.Issue(testUser)
+	require.NoError(t, err)
+	parts := strings.Split(token.AccessToken, ".")
+
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		j.now = func() time.Time { return time.Now().Add(time.Hour + time.Minute) }
+		defer func() { j.now = time.Now }()
+		_, err := j.Verify(token.AccessToken)
+		assertUnauthorized(t, err, "token expired")
+	})
+
+	t.Run("within clock skew", func(t *testing.T) {
+		j.now = func() time.Time { return time.Now().Add(time.Hour + 10*time.Second) }
+		defer func() { j.now = time.Now }()
+		_, err := j.Verify(token.AccessToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("tampered claims", func(t *testing.T) {
+		claims := Claims{Subject: "1", Issuer: "test", IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Hour).Unix()}
+		_, err := j.Verify(parts[0] + "." + encode(claims) + "." + parts[2])
+		assertUnauthorized(t, err, "invalid token signature")
+	})
+
+	t.Run("alg none", func(t *testing.T) {
+		_, err := j.Verify(encode(header{Algorithm: "none", KeyID: "hs"}) + "." + parts[1] + ".")
+		assertUnauthorized(t, err, "unexpected signing algorithm")
+	})
+
+	// RS256的public key不能被當成HS256的secret
+	t.Run("algorithm confusion", func(t *testing.T) {
+		rsaKey := generateRSAKey(t)
+		rs := newTestJWT(t, "hs", Key{ID: "rs", Algorithm: RS256, PublicKey: &rsaKey.PublicKey}, hs)
+		publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})
+		forger := newTestJWT(t, "rs", Key{ID: "rs", Algorithm: HS256, Secret: publicPEM})
+		forged, err := forger.Issue(testUser)
+		require.NoError(t, err)
+		_, err = rs.Verify(forged.AccessToken)
+		assertUnauthorized(t, err, "unexpected signing algorithm")
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		other, err := NewJWT(JWTConfig{Keys: []Key{hs}, ActiveKey: "hs", Issuer: "other", TTL: time.Hour})
+		require.NoError(t, err)
+		_, err = other.Verify(token.AccessToken)
+		assertUnauthorized(t, err, "unexpected token issuer")
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, value := range []string{"", "abc", "a.b", "a.b.c", parts[0] + "." + parts[1] + ".!!"} {
+			_, err := j.Verify(value)
+			assertUnauthorized(t, err, "malformed")
+		}
+	})
+}
+
+func TestNewJWTValidatesKeys(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		keys    []Key
+		active  string
+		message string
+	}{
+		{"short secret", []Key{{ID: "a", Algorithm: HS256, Secret: []byte("short")}}, "a", "at least 32 bytes"},
+		{"weak rsa key", []Key{{ID: "a", Algorithm: RS256, PrivateKey: weak}}, "a", "at least 2048 bits"},
+		{"unknown algorithm", []Key{{ID: "a", Algorithm: "ES256", Secret: testSecret}}, "a", "unsupported algorithm"},
+		{"duplicate id", []Key{{ID: "a", Algorithm: HS256, Secret: testSecret}, {ID: "a", Algorithm: HS256, Secret: testSecret}}, "a", "duplicate"},
+		{"missing active key", []Key{{ID: "a", Algorithm: HS256, Secret: testSecret}}, "b", "not configured"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJWT(JWTConfig{Keys: tt.keys, ActiveKey: tt.active, TTL: time.Hour})
+			assert.ErrorContains(t, err, tt.message)
+		})
+	}
+}
+
+func TestParseRSAKeys(t *testing.T) {
+	key := generateRSAKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	for _, block := range []*pem.Block{
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		{Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		parsed, err := ParseRSAPrivateKey(pem.EncodeToMemory(block))
+		require.NoError(t, err, block.Type)
+		assert.True(t, key.Equal(parsed))
+	}
+	for _, block := range []*pem.Block{
+		{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)},
+		{Type: "PUBLIC KEY", Bytes: pkix},
+	} {
+		parsed, err := ParseRSAPublicKey(pem.EncodeToMemory(block))
+		require.NoError(t, err, block.Type)
+		assert.True(t, key.PublicKey.Equal(parsed))
+	}
+
+	_, err = ParseRSAPrivateKey([]byte("not a key"))
+	assert.Error(t, err)
+}
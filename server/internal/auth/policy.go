@@ -0,0 +1,92 @@
+package auth
+
+import "github.com/kokp520/banking-system/server/internal/model"
+
+// Permission 可授權的操作, 路由與service各自檢查需要的Permission
+type Permission string
+
+const (
+	// AccountCreate 開戶
+	AccountCreate Permission = "account:create"
+	// AccountRead 查詢帳戶、交易、分錄、對帳單、預授權、定期轉帳、限額與計息紀錄
+	AccountRead     Permission = "account:read"
+	AccountDeposit  Permission = "account:deposit"
+	AccountWithdraw Permission = "account:withdraw"
+	// AccountTransfer 轉出與付款: 轉帳、批次轉帳、pain.001、換匯報價、預授權、定期轉帳
+	AccountTransfer Permission = "account:transfer"
+	// TransactionReverse 沖正與退款, 由行員處理, 客戶不能自行扣回入帳的款項
+	TransactionReverse Permission = "transaction:reverse"
+	// AccountManage 帳戶狀態、透支額度、限額與計息產品
+	AccountManage Permission = "account:manage"
+	// LedgerRead 總帳試算表
+	LedgerRead Permission = "ledger:read"
+	// SystemManage 匯率、排程與使用者角色
+	SystemManage Permission = "system:manage"
+)
+
+// Scope 授權範圍
+type Scope int
+
+const (
+	ScopeNone Scope = iota
+	// ScopeOwn 只限呼叫者擁有的帳戶
+	ScopeOwn
+	// ScopeAny 所有帳戶
+	ScopeAny
+)
+
+// grants 各角色的授權, 未列出的Permission為ScopeNone
+var grants = map[model.Role]map[Permission]Scope{
+	model.RoleCustomer: {
+		AccountCreate:   ScopeOwn,
+		AccountRead:     ScopeOwn,
+		AccountDeposit:  ScopeOwn,
+		AccountWithdraw: ScopeOwn,
+		AccountTransfer: ScopeOwn,
+	},
+	model.RoleTeller: {
+		AccountCreate:      ScopeOwn,
+		AccountRead:        ScopeOwn,
+		AccountDeposit:     ScopeAny,
+		AccountWithdraw:    ScopeAny,
+		AccountTransfer:    ScopeOwn,
+		TransactionReverse: ScopeAny,
+	},
+	model.RoleAuditor: {
+		AccountRead: ScopeAny,
+		LedgerRead:  ScopeAny,
+	},
+	model.RoleAdmin: {
+		AccountCreate:      ScopeAny,
+		AccountRead:        ScopeAny,
+		AccountDeposit:     ScopeOwn,
+		AccountWithdraw:    ScopeOwn,
+		AccountTransfer:    ScopeOwn,
+		AccountManage:      ScopeAny,
+		TransactionReverse: ScopeAny,
+		LedgerRead:         ScopeAny,
+		SystemManage:       ScopeAny,
+	},
+}
+
+// Evaluate 呼叫者對permission的授權範圍
+func Evaluate(principal *Principal, permission Permission) Scope {
+	return grants[principal.Role][permission]
+}
+
+// OverrideGrant 暫時調整角色的授權範圍, 回傳還原用的函式
+// 只供測試模擬目前設定沒有的授權(e.g. ScopeOwn的TransactionReverse), 不可與其他測試並行
+func OverrideGrant(role model.Role, permission Permission, scope Scope) (restore func()) {
+	previous, existed := grants[role][permission]
+	if grants[role] == nil {
+		grants[role] = map[Permission]Scope{}
+	}
+	grants[role][permission] = scope
+	return func() {
+		if existed {
+			grants[role][permission] = previous
+		} else {
+			delete(grants[role], permission)
+		}
+	}
+}
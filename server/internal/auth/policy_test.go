@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		role       model.Role
+		permission Permission
+		scope      Scope
+	}{
+		{model.RoleCustomer, AccountTransfer, ScopeOwn},
+		{model.RoleCustomer, AccountManage, ScopeNone},
+		{model.RoleCustomer, LedgerRead, ScopeNone},
+		{model.RoleTeller, AccountDeposit, ScopeAny},
+		{model.RoleTeller, AccountWithdraw, ScopeAny},
+		{model.RoleTeller, AccountRead, ScopeOwn},
+		{model.RoleTeller, TransactionReverse, ScopeAny},
+		{model.RoleCustomer, TransactionReverse, ScopeNone},
+		{model.RoleAuditor, TransactionReverse, ScopeNone},
+		{model.RoleAuditor, AccountRead, ScopeAny},
+		{model.RoleAuditor, LedgerRead, ScopeAny},
+		{model.RoleAuditor, AccountDeposit, ScopeNone},
+		{model.RoleAuditor, AccountCreate, ScopeNone},
+		{model.RoleAdmin, AccountManage, ScopeAny},
+		{model.RoleAdmin, SystemManage, ScopeAny},
+		{model.RoleAdmin, AccountWithdraw, ScopeOwn},
+		{"unknown", AccountRead, ScopeNone},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role)+" "+string(tt.permission), func(t *testing.T) {
+			assert.Equal(t, tt.scope, Evaluate(&Principal{UserID: 1, Role: tt.role}, tt.permission))
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+const camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtGroupHeader struct {
+	XMLName   xml.Name `xml:"GrpHdr"`
+	MessageID string   `xml:"MsgId"`
+	CreatedAt string   `xml:"CreDtTm"`
+}
+
+type camtAccount struct {
+	XMLName  xml.Name `xml:"Acct"`
+	ID       string   `xml:"Id>Othr>Id"`
+	Currency string   `xml:"Ccy"`
+	BIC      string   `xml:"Svcr>FinInstnId>BIC,omitempty"`
+}
+
+type camtBalance struct {
+	XMLName   xml.Name   `xml:"Bal"`
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      string     `xml:"Dt>Dt"`
+}
+
+type camtTotal struct {
+	Count int    `xml:"NbOfNtries"`
+	Sum   string `xml:"Sum"`
+}
+
+type camtSummary struct {
+	XMLName      xml.Name  `xml:"TxsSummry"`
+	Count        int       `xml:"TtlNtries>NbOfNtries"`
+	Sum          string    `xml:"TtlNtries>Sum"`
+	Net          string    `xml:"TtlNtries>TtlNetNtryAmt"`
+	NetIndicator string    `xml:"TtlNtries>CdtDbtInd"`
+	Credit       camtTotal `xml:"TtlCdtNtries"`
+	Debit        camtTotal `xml:"TtlDbtNtries"`
+}
+
+type camtBankTransactionCode struct {
+	Domain    string `xml:"Domn>Cd"`
+	Family    string `xml:"Domn>Fmly>Cd"`
+	SubFamily string `xml:"Domn>Fmly>SubFmlyCd"`
+	Code      string `xml:"Prtry>Cd"`
+}
+
+type camtExchange struct {
+	Amount camtAmount `xml:"Amt"`
+	Source string     `xml:"CcyXchg>SrcCcy"`
+	Target string     `xml:"CcyXchg>TrgtCcy"`
+	Rate   string     `xml:"CcyXchg>XchgRate"`
+}
+
+type camtPartyAccount struct {
+	ID string `xml:"Id>Othr>Id"`
+}
+
+type camtTransactionDetails struct {
+	Reference       string            `xml:"Refs>AcctSvcrRef"`
+	Instructed      *camtExchange     `xml:"AmtDtls>InstdAmt,omitempty"`
+	DebtorAccount   *camtPartyAccount `xml:"RltdPties>DbtrAcct,omitempty"`
+	CreditorAccount *camtPartyAccount `xml:"RltdPties>CdtrAcct,omitempty"`
+	Remittance      string            `xml:"RmtInf>Ustrd,omitempty"`
+}
+
+type camtEntry struct {
+	XMLName     xml.Name                `xml:"Ntry"`
+	Amount      camtAmount              `xml:"Amt"`
+	Indicator   string                  `xml:"CdtDbtInd"`
+	Reversal    bool                    `xml:"RvslInd,omitempty"`
+	Status      string                  `xml:"Sts"`
+	BookingDate string                  `xml:"BookgDt>Dt"`
+	ValueDate   string                  `xml:"ValDt>Dt"`
+	Reference   string                  `xml:"AcctSvcrRef"`
+	Code        camtBankTransactionCode `xml:"BkTxCd"`
+	Details     camtTransactionDetails  `xml:"NtryDtls>TxDtls"`
+}
+
+// writeCamt053 ISO 20022 camt.053.001.02, 一份對帳單一個Stmt
+// 期初(OPBD)與期末(CLBD)餘額, 每筆交易一個已入帳(BOOK)的Ntry, 金額為絕對值以CdtDbtInd表示方向
+func writeCamt053(w io.Writer, statement *model.Statement, opts Options) error {
+	currency, err := model.LookupCurrency(statement.Currency)
+	if err != nil {
+		return err
+	}
+	accountID := strconv.FormatUint(statement.AccountID, 10)
+	statementID := fmt.Sprintf("%d-%s-%s", statement.AccountID,
+		statement.From.Format("20060102"), lastDay(statement).Format("20060102"))
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	document := start("Document")
+	document.Attr = []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: camt053Namespace}}
+	tokens := []xml.Token{
+		xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)},
+		newline,
+		document,
+		start("BkToCstmrStmt"),
+	}
+	if err := encodeTokens(enc, tokens...); err != nil {
+		return err
+	}
+	header := camtGroupHeader{
+		MessageID: fmt.Sprintf("STMT-%d-%s", statement.AccountID, opts.GeneratedAt.Format("20060102150405")),
+		CreatedAt: opts.GeneratedAt.Format(time.RFC3339),
+	}
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	if err := encodeTokens(enc, start("Stmt")); err != nil {
+		return err
+	}
+	if err := encodeElements(enc,
+		element("Id", statementID),
+		element("CreDtTm", opts.GeneratedAt.Format(time.RFC3339)),
+		element("FrToDt", struct {
+			From string `xml:"FrDtTm"`
+			To   string `xml:"ToDtTm"`
+		}{statement.From.Format(time.RFC3339), statement.To.Format(time.RFC3339)}),
+		element("", camtAccount{ID: accountID, Currency: currency.Code, BIC: opts.BIC}),
+		element("", newCamtBalance("OPBD", statement.OpeningBalance, statement.From, currency)),
+		element("", newCamtBalance("CLBD", statement.ClosingBalance, lastDay(statement), currency)),
+		element("", newCamtSummary(statement, currency)),
+	); err != nil {
+		return err
+	}
+	for _, line := range statement.Lines {
+		if err := enc.Encode(newCamtEntry(line, statement.AccountID, currency)); err != nil {
+			return err
+		}
+	}
+	if err := encodeTokens(enc, end("Stmt"), end("BkToCstmrStmt"), end("Document")); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func newCamtBalance(code string, balance decimal.Decimal, date time.Time, currency model.Currency) camtBalance {
+	return camtBalance{
+		Code:      code,
+		Amount:    camtAmount{Currency: currency.Code, Value: currency.Format(balance.Abs())},
+		Indicator: camtIndicator(balance),
+		Date:      date.Format(dateLayout),
+	}
+}
+
+func newCamtSummary(statement *model.Statement, currency model.Currency) camtSummary {
+	summary := camtSummary{Count: len(statement.Lines)}
+	for _, line := range statement.Lines {
+		if line.Amount.IsNegative() {
+			summary.Debit.Count++
+		} else {
+			summary.Credit.Count++
+		}
+	}
+	net := statement.TotalCredit.Sub(statement.TotalDebit)
+	summary.Sum = currency.Format(statement.TotalCredit.Add(statement.TotalDebit))
+	summary.Net = currency.Format(net.Abs())
+	summary.NetIndicator = camtIndicator(net)
+	summary.Credit.Sum = currency.Format(statement.TotalCredit)
+	summary.Debit.Sum = currency.Format(statement.TotalDebit)
+	return summary
+}
+
+func newCamtEntry(line model.StatementLine, accountID uint64, currency model.Currency) camtEntry {
+	transaction := line.Transaction
+	reference := strconv.FormatUint(transaction.ID, 10)
+	date := transaction.CreatedAt.Format(dateLayout)
+	entry := camtEntry{
+		Amount:      camtAmount{Currency: currency.Code, Value: currency.Format(line.Amount.Abs())},
+		Indicator:   camtIndicator(line.Amount),
+		Reversal:    transaction.Type == model.TransactionTypeReversal,
+		Status:      "BOOK",
+		BookingDate: date,
+		ValueDate:   date,
+		Reference:   reference,
+		Code:        camtTransactionCode(transaction.Type, line.Amount),
+		Details: camtTransactionDetails{
+			Reference:  reference,
+			Remittance: truncate(transaction.Description, 140),
+		},
+	}
+	if transaction.FX != nil {
+		entry.Details.Instructed = &camtExchange{
+			Amount: camtAmount{Currency: transaction.Currency, Value: formatAmount(transaction.Currency, transaction.Amount)},
+			Source: transaction.Currency,
+			Target: transaction.FX.DestinationCurrency,
+			Rate:   transaction.FX.Rate.String(),
+		}
+	}
+	if id, ok := counterparty(transaction, accountID); ok {
+		party := &camtPartyAccount{ID: strconv.FormatUint(id, 10)}
+		if line.Amount.IsNegative() {
+			entry.Details.CreditorAccount = party
+		} else {
+			entry.Details.DebtorAccount = party
+		}
+	}
+	return entry
+}
+
+func camtIndicator(amount decimal.Decimal) string {
+	if amount.IsNegative() {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+// camtTransactionCode ISO bank transaction code, 另以proprietary code帶交易類型
+func camtTransactionCode(transactionType model.TransactionType, amount decimal.Decimal) camtBankTransactionCode {
+	code := camtBankTransactionCode{Code: string(transactionType)}
+	switch transactionType {
+	case model.TransactionTypeDeposit:
+		code.Domain, code.Family, code.SubFamily = "PMNT", "CNTR", "CDPT"
+	case model.TransactionTypeWithdraw:
+		code.Domain, code.Family, code.SubFamily = "PMNT", "CNTR", "CWDL"
+	case model.TransactionTypeTransfer:
+		code.Domain, code.Family, code.SubFamily = "PMNT", "RCDT", "BOOK"
+		if amount.IsNegative() {
+			code.Family = "ICDT"
+		}
+	case model.TransactionTypeInterest:
+		code.Domain, code.Family, code.SubFamily = "ACMT", "MCOP", "INTR"
+	case model.TransactionTypeFee:
+		code.Domain, code.Family, code.SubFamily = "ACMT", "MDOP", "CHRG"
+	default:
+		code.Domain, code.Family, code.SubFamily = "ACMT", "MCOP", "OTHR"
+		if amount.IsNegative() {
+			code.Family = "MDOP"
+		}
+	}
+	return code
+}
@@ -0,0 +1,65 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+var csvHeader = []string{
+	"booking_date", "posted_at", "transaction_id", "type", "description",
+	"counterparty_account_id", "amount", "currency", "balance", "reference",
+}
+
+// writeCSV 每筆交易一列, amount入帳為正扣款為負, balance為入帳後餘額
+func writeCSV(w io.Writer, statement *model.Statement, _ Options) error {
+	currency, err := model.LookupCurrency(statement.Currency)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, line := range statement.Lines {
+		transaction := line.Transaction
+		other := ""
+		if id, ok := counterparty(transaction, statement.AccountID); ok {
+			other = strconv.FormatUint(id, 10)
+		}
+		record := []string{
+			transaction.CreatedAt.Format(dateLayout),
+			transaction.CreatedAt.Format(time.RFC3339),
+			strconv.FormatUint(transaction.ID, 10),
+			string(transaction.Type),
+			csvText(transaction.Description),
+			other,
+			currency.Format(line.Amount),
+			currency.Code,
+			currency.Format(line.RunningBalance),
+			transaction.TraceID,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		writer.Flush()
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvText 避免試算表把使用者輸入的文字當成公式執行
+func csvText(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + s
+	}
+	return s
+}
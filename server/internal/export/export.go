@@ -0,0 +1,107 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+const dateLayout = "2006-01-02"
+
+// Options 匯出時的銀行資訊與產生時間
+// BIC為OFX的BANKID、camt.053的帳戶服務機構與MT940 :25:的銀行代碼, GeneratedAt為檔案產生時間
+type Options struct {
+	BIC         string
+	GeneratedAt time.Time
+}
+
+// Format 對帳單匯出格式
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	write       func(w io.Writer, statement *model.Statement, opts Options) error
+}
+
+var formats = []Format{
+	{Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv", write: writeCSV},
+	{Name: "ofx", ContentType: "application/x-ofx", Extension: "ofx", write: writeOFX},
+	{Name: "camt053", ContentType: "application/xml", Extension: "xml", write: writeCamt053},
+	{Name: "mt940", ContentType: "text/plain; charset=us-ascii", Extension: "sta", write: writeMT940},
+}
+
+// FormatNames 支援的格式, 依formats的順序
+func FormatNames() []string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Lookup 依名稱取得格式, 不支援時回傳ErrInvalidRequest
+func Lookup(name string) (Format, error) {
+	for _, f := range formats {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return Format{}, model.NewError(model.ErrInvalidRequest,
+		fmt.Sprintf("unknown format %q, available formats: %s", name, strings.Join(FormatNames(), ", ")))
+}
+
+// File 已通過對帳的對帳單, 由handler設定header後寫出
+type File struct {
+	Format    Format
+	Statement *model.Statement
+	Options   Options
+}
+
+// Name 下載檔名, 日期為期間的第一天與最後一天
+func (f *File) Name() string {
+	return fmt.Sprintf("statement-%d-%s-%s.%s", f.Statement.AccountID,
+		f.Statement.From.Format("20060102"), lastDay(f.Statement).Format("20060102"), f.Format.Extension)
+}
+
+// Write 依格式寫出, 每筆交易寫完即送出不會整份暫存
+func (f *File) Write(w io.Writer) error {
+	return f.Format.write(w, f.Statement, f.Options)
+}
+
+// lastDay 期間為[From, To), 最後一天是To的前一刻
+func lastDay(statement *model.Statement) time.Time {
+	return statement.To.Add(-time.Nanosecond)
+}
+
+// counterparty 轉帳與沖正轉帳的對方帳戶, 存提款、計息與手續費沒有對方帳戶
+func counterparty(transaction *model.Transaction, accountID uint64) (uint64, bool) {
+	if transaction.FromAccountID == nil {
+		return 0, false
+	}
+	if *transaction.FromAccountID == accountID {
+		return transaction.ToAccountID, true
+	}
+	return *transaction.FromAccountID, true
+}
+
+// truncate 依各格式欄位長度上限截斷, 以rune計算避免切斷中文
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
+
+// formatAmount 依幣別小數位數輸出, 未知幣別時原樣輸出
+func formatAmount(code string, amount decimal.Decimal) string {
+	currency, err := model.LookupCurrency(code)
+	if err != nil {
+		return amount.String()
+	}
+	return currency.Format(amount)
+}
@@ -0,0 +1,150 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test ./internal/export -update 重新產生testdata下的golden files
+var update = flag.Bool("update", false, "update golden files")
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
+
+// testStatement 帳戶1在2024-03-01~2024-03-31的對帳單, 期間前後各有交易
+func testStatement(t *testing.T) *model.Statement {
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, time.March, day, hour, 30, 0, 0, time.UTC)
+	}
+	history := []*model.Transaction{
+		{ID: 1, Type: model.TransactionTypeDeposit, ToAccountID: 1, Amount: decimal.NewFromInt(1000), Currency: "TWD",
+			Description: "Initial deposit", CreatedAt: time.Date(2024, time.February, 20, 9, 0, 0, 0, time.UTC), TraceID: "trace-1"},
+		{ID: 2, Type: model.TransactionTypeTransfer, FromAccountID: uint64Ptr(1), ToAccountID: 2, Amount: decimal.RequireFromString("250.5"), Currency: "TWD",
+			Description: `Rent, March "A&B" <unit 3>`, CreatedAt: at(1, 0), TraceID: "trace-2"},
+		{ID: 3, Type: model.TransactionTypeFee, ToAccountID: 1, Amount: decimal.NewFromInt(10), Currency: "TWD",
+			Description: "Fee for transfer", CreatedAt: at(1, 0), TraceID: "trace-2", FeeFor: uint64Ptr(2)},
+		{ID: 4, Type: model.TransactionTypeTransfer, FromAccountID: uint64Ptr(3), ToAccountID: 1, Amount: decimal.NewFromInt(100), Currency: "USD",
+			Description: "=SUM(A1:A2) 貨款", CreatedAt: at(10, 8), TraceID: "trace-4",
+			FX: &model.FXConversion{QuoteID: "q-1", DestinationAmount: decimal.NewFromInt(3150), DestinationCurrency: "TWD",
+				Rate: decimal.RequireFromString("31.5"), MidRate: decimal.RequireFromString("31.58")}},
+		{ID: 5, Type: model.TransactionTypeWithdraw, ToAccountID: 1, Amount: decimal.NewFromInt(4000), Currency: "TWD",
+			Description: "ATM", CreatedAt: at(15, 23), TraceID: "trace-5"},
+		{ID: 6, Type: model.TransactionTypeReversal, FromAccountID: uint64Ptr(2), ToAccountID: 1, Amount: decimal.RequireFromString("50.5"), Currency: "TWD",
+			Description: "Reversal of transaction 2", CreatedAt: at(20, 12), TraceID: "trace-6", ReversalOf: uint64Ptr(2)},
+		{ID: 7, Type: model.TransactionTypeInterest, ToAccountID: 1, Amount: decimal.RequireFromString("1.25"), Currency: "TWD",
+			Description: "Interest for 2024-03", CreatedAt: at(31, 23), TraceID: "trace-7"},
+		{ID: 8, Type: model.TransactionTypeDeposit, ToAccountID: 1, Amount: decimal.NewFromInt(500), Currency: "TWD",
+			Description: "After the period", CreatedAt: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), TraceID: "trace-8"},
+	}
+	account := &model.Account{ID: 1, Balance: decimal.RequireFromString("441.25"), Currency: "TWD",
+		CreatedAt: time.Date(2024, time.February, 20, 9, 0, 0, 0, time.UTC)}
+
+	statement, err := model.NewStatement(account, history,
+		time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	return statement
+}
+
+func TestExportGolden(t *testing.T) {
+	statement := testStatement(t)
+	// 期末餘額為透支
+	require.True(t, decimal.RequireFromString("-58.75").Equal(statement.ClosingBalance), statement.ClosingBalance.String())
+	opts := Options{BIC: "KOKPTWTP", GeneratedAt: time.Date(2024, time.April, 1, 6, 0, 0, 0, time.UTC)}
+
+	for _, name := range FormatNames() {
+		t.Run(name, func(t *testing.T) {
+			format, err := Lookup(name)
+			require.NoError(t, err)
+			file := &File{Format: format, Statement: statement, Options: opts}
+			var buf bytes.Buffer
+			require.NoError(t, file.Write(&buf))
+
+			golden := filepath.Join("testdata", "statement."+name+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, buf.Bytes(), 0644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), buf.String())
+		})
+	}
+}
+
+func TestExportFile(t *testing.T) {
+	format, err := Lookup("camt053")
+	require.NoError(t, err)
+	file := &File{Format: format, Statement: testStatement(t)}
+	assert.Equal(t, "statement-1-20240301-20240331.xml", file.Name())
+
+	_, err = Lookup("pdf")
+	assert.ErrorIs(t, err, model.ErrInvalidRequest)
+}
+
+func TestOFXTime(t *testing.T) {
+	taipei := time.FixedZone("CST", 8*3600)
+	india := time.FixedZone("", 5*3600+1800)
+	at := time.Date(2024, time.March, 1, 9, 5, 3, 120000000, time.UTC)
+	assert.Equal(t, "20240301090503.120[0:UTC]", ofxTime(at))
+	assert.Equal(t, "20240301170503.120[8:CST]", ofxTime(at.In(taipei)))
+	assert.Equal(t, "20240301143503.120[5.5]", ofxTime(at.In(india)))
+}
+
+func TestMT940Split(t *testing.T) {
+	statement := testStatement(t)
+	opts := Options{BIC: "KOKPTWTP", GeneratedAt: time.Date(2024, time.April, 1, 6, 0, 0, 0, time.UTC)}
+	var buf bytes.Buffer
+	require.NoError(t, writeMT940Messages(&buf, statement, opts, 300))
+
+	messages := strings.SplitAfter(strings.TrimSuffix(buf.String(), "-\r\n"), "-\r\n")
+	require.Greater(t, len(messages), 1)
+	entries := 0
+	for i, message := range messages {
+		assert.LessOrEqual(t, len(message), 300)
+		assert.Contains(t, message, fmt.Sprintf(":28C:24061/%d\r\n", i+1))
+		// 第一份與最後一份分別為:60F:與:62F:, 中間為:60M:/:62M:
+		opening, closing := ":60M:", ":62M:"
+		if i == 0 {
+			opening = ":60F:"
+		}
+		if i == len(messages)-1 {
+			closing = ":62F:"
+		}
+		assert.Contains(t, message, opening, message)
+		assert.Contains(t, message, closing, message)
+		entries += strings.Count(message, ":61:")
+		for _, line := range strings.Split(message, "\r\n") {
+			assert.LessOrEqual(t, len(line), 65, line)
+		}
+		// 下一份的期初等於這一份的期末
+		if i+1 < len(messages) {
+			balance := message[strings.Index(message, ":62M:")+5:]
+			assert.Contains(t, messages[i+1], ":60M:"+balance[:strings.Index(balance, "\r\n")])
+		}
+	}
+	assert.Equal(t, len(statement.Lines), entries)
+	assert.Contains(t, messages[len(messages)-1], ":62F:D240331TWD58,75\r\n")
+}
+
+func TestMT940Wrap(t *testing.T) {
+	text := strings.Repeat("word ", 20) + "-dash :colon " + strings.Repeat("x", 70)
+	lines := mt940Wrap(text, 20, 10)
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), 20, line)
+		assert.NotRegexp(t, `^[:-]`, line)
+	}
+	assert.Len(t, mt940Wrap(text, 20, 3), 3)
+	assert.Equal(t, []string{"a b"}, mt940Wrap("a b", 65, 6))
+	assert.Equal(t, "Rent, March .A.B. .unit 3.", mt940Text(`Rent, March "A&B" <unit 3>`))
+}
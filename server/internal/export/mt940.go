@@ -0,0 +1,221 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// mt940MessageLength 單一MT940訊息(SWIFT text block)的字元上限, 超過時拆成多份
+	mt940MessageLength = 2000
+	// mt940InfoWidth, mt940InfoLines :86:為6*65x
+	mt940InfoWidth = 65
+	mt940InfoLines = 6
+	// mt940AmountLength 金額為15d, 含小數逗號
+	mt940AmountLength = 15
+	mt940Newline      = "\r\n"
+)
+
+// writeMT940 SWIFT MT940, 一份對帳單依長度拆成一或多份訊息, 以:28C:的序號區分
+// 第一份的期初為:60F:, 最後一份的期末為:62F:, 中間以:60M:/:62M:帶當時的餘額
+func writeMT940(w io.Writer, statement *model.Statement, opts Options) error {
+	return writeMT940Messages(w, statement, opts, mt940MessageLength)
+}
+
+// writeMT940Messages limit為單一訊息的字元上限, 測試時以較小的值驗證拆分
+func writeMT940Messages(w io.Writer, statement *model.Statement, opts Options, limit int) error {
+	currency, err := model.LookupCurrency(statement.Currency)
+	if err != nil {
+		return err
+	}
+	account := strconv.FormatUint(statement.AccountID, 10)
+	if opts.BIC != "" {
+		account = opts.BIC + "/" + account
+	}
+	// :28C:的對帳單編號為期間起日的年(2位)+年中第幾天, 同一期間重複匯出編號相同
+	number := fmt.Sprintf("%02d%03d", statement.From.Year()%100, statement.From.YearDay())
+	reference := "STMT" + opts.GeneratedAt.Format("060102150405")
+
+	sequence := 1
+	header := func() string {
+		return mt940Field("20", reference) + mt940Field("25", account) + mt940Field("28C", fmt.Sprintf("%s/%d", number, sequence))
+	}
+	opening, err := mt940Balance("60F", statement.OpeningBalance, statement.From, currency)
+	if err != nil {
+		return err
+	}
+	var entries strings.Builder
+	// closing 在目前這筆之後拆分時的:62M:
+	closing := ""
+	for _, line := range statement.Lines {
+		entry, err := mt940Entry(line, statement.AccountID, currency)
+		if err != nil {
+			return err
+		}
+		next, err := mt940Balance("62M", line.RunningBalance, line.Transaction.CreatedAt, currency)
+		if err != nil {
+			return err
+		}
+		if entries.Len() > 0 && mt940Length(header(), opening, entries.String(), entry, next) > limit {
+			if err := writeMT940Message(w, header(), opening, entries.String(), closing); err != nil {
+				return err
+			}
+			sequence++
+			opening = ":60M:" + strings.TrimPrefix(closing, ":62M:")
+			entries.Reset()
+		}
+		entries.WriteString(entry)
+		closing = next
+	}
+	final, err := mt940Balance("62F", statement.ClosingBalance, lastDay(statement), currency)
+	if err != nil {
+		return err
+	}
+	return writeMT940Message(w, header(), opening, entries.String(), final)
+}
+
+// writeMT940Message 訊息以單獨一行的'-'結束
+func writeMT940Message(w io.Writer, parts ...string) error {
+	for _, part := range parts {
+		if _, err := io.WriteString(w, part); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "-"+mt940Newline)
+	return err
+}
+
+// mt940Length 訊息長度, 含結尾的'-'
+func mt940Length(parts ...string) int {
+	length := len("-")
+	for _, part := range parts {
+		length += len(part)
+	}
+	return length
+}
+
+func mt940Field(tag, value string) string {
+	return ":" + tag + ":" + value + mt940Newline
+}
+
+// mt940Balance 餘額欄位: 借貸記號(D/C)+日期(YYMMDD)+幣別+金額
+func mt940Balance(tag string, balance decimal.Decimal, date time.Time, currency model.Currency) (string, error) {
+	amount, err := mt940Amount(balance.Abs(), currency)
+	if err != nil {
+		return "", err
+	}
+	return mt940Field(tag, mt940Mark(balance)+date.Format("060102")+currency.Code+amount), nil
+}
+
+// mt940Entry :61:與:86:
+// :61: 起息日(YYMMDD)+入帳日(MMDD)+借貸記號+金額+交易類型+交易ID, 下一行為對方帳戶或交易類型
+// 沖正交易以RC/RD表示沖回原本的貸方/借方
+func mt940Entry(line model.StatementLine, accountID uint64, currency model.Currency) (string, error) {
+	transaction := line.Transaction
+	amount, err := mt940Amount(line.Amount.Abs(), currency)
+	if err != nil {
+		return "", err
+	}
+	mark := mt940Mark(line.Amount)
+	if transaction.Type == model.TransactionTypeReversal {
+		// 扣款的沖正是沖回貸方(RC), 入帳的沖正是沖回借方(RD)
+		mark = "RD"
+		if line.Amount.IsNegative() {
+			mark = "RC"
+		}
+	}
+	details := string(transaction.Type)
+	if id, ok := counterparty(transaction, accountID); ok {
+		details = "ACCOUNT " + strconv.FormatUint(id, 10)
+	}
+
+	var b strings.Builder
+	b.WriteString(mt940Field("61", transaction.CreatedAt.Format("060102")+transaction.CreatedAt.Format("0102")+
+		mark+amount+"N"+mt940TransactionCode(transaction.Type)+truncate(strconv.FormatUint(transaction.ID, 10), 16)+
+		mt940Newline+truncate(details, 34)))
+	info := mt940Wrap(mt940Text(transaction.Description), mt940InfoWidth, mt940InfoLines)
+	if len(info) > 0 {
+		b.WriteString(mt940Field("86", strings.Join(info, mt940Newline)))
+	}
+	return b.String(), nil
+}
+
+// mt940Amount 小數點為逗號, 沒有小數位數的幣別仍需以逗號結尾
+func mt940Amount(amount decimal.Decimal, currency model.Currency) (string, error) {
+	value := strings.Replace(currency.Format(amount), ".", ",", 1)
+	if !strings.Contains(value, ",") {
+		value += ","
+	}
+	if len(value) > mt940AmountLength {
+		return "", fmt.Errorf("amount %s exceeds %d characters allowed by MT940", value, mt940AmountLength)
+	}
+	return value, nil
+}
+
+func mt940Mark(amount decimal.Decimal) string {
+	if amount.IsNegative() {
+		return "D"
+	}
+	return "C"
+}
+
+// mt940TransactionCode SWIFT交易類型代碼, 前面加上N
+func mt940TransactionCode(transactionType model.TransactionType) string {
+	switch transactionType {
+	case model.TransactionTypeTransfer:
+		return "TRF"
+	case model.TransactionTypeInterest:
+		return "INT"
+	case model.TransactionTypeFee:
+		return "CHG"
+	}
+	return "MSC"
+}
+
+// mt940Text 只保留SWIFT X字元集, 其他字元(含中文)以'.'取代, 連續空白合併
+func mt940Text(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("/-?:().,'+", r):
+			b.WriteRune(r)
+		case r == ' ', r == '\t', r == '\r', r == '\n':
+			b.WriteRune(' ')
+		default:
+			b.WriteRune('.')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// mt940Wrap 依行寬拆行, 盡量在空白處斷行, 超過行數的部分截斷
+// 續行不能以':'或'-'開頭(會被當成欄位或訊息結尾), 此時前面補一個空白
+func mt940Wrap(text string, width, lines int) []string {
+	var result []string
+	rest := []rune(text)
+	for len(rest) > 0 && len(result) < lines {
+		if len(result) > 0 && (rest[0] == ':' || rest[0] == '-') {
+			rest = append([]rune{' '}, rest...)
+		}
+		if len(rest) <= width {
+			result = append(result, string(rest))
+			break
+		}
+		cut := width
+		for i := width; i > 0; i-- {
+			if rest[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		result = append(result, strings.TrimRight(string(rest[:cut]), " "))
+		rest = []rune(strings.TrimLeft(string(rest[cut:]), " "))
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+var ofxOK = ofxStatus{Code: 0, Severity: "INFO"}
+
+type ofxSignon struct {
+	XMLName  xml.Name  `xml:"SIGNONMSGSRSV1"`
+	Status   ofxStatus `xml:"SONRS>STATUS"`
+	Server   string    `xml:"SONRS>DTSERVER"`
+	Language string    `xml:"SONRS>LANGUAGE"`
+}
+
+type ofxAccount struct {
+	XMLName xml.Name `xml:"BANKACCTFROM"`
+	BankID  string   `xml:"BANKID"`
+	ID      string   `xml:"ACCTID"`
+	Type    string   `xml:"ACCTTYPE"`
+}
+
+type ofxTransaction struct {
+	XMLName xml.Name `xml:"STMTTRN"`
+	Type    string   `xml:"TRNTYPE"`
+	Posted  string   `xml:"DTPOSTED"`
+	Amount  string   `xml:"TRNAMT"`
+	ID      string   `xml:"FITID"`
+	Name    string   `xml:"NAME,omitempty"`
+	Memo    string   `xml:"MEMO,omitempty"`
+}
+
+type ofxBalance struct {
+	Amount string `xml:"BALAMT"`
+	AsOf   string `xml:"DTASOF"`
+}
+
+// writeOFX OFX 2.2 銀行對帳單(STMTRS), TRNAMT入帳為正扣款為負, LEDGERBAL為期末餘額
+func writeOFX(w io.Writer, statement *model.Statement, opts Options) error {
+	currency, err := model.LookupCurrency(statement.Currency)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	tokens := []xml.Token{
+		xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8" standalone="no"`)},
+		newline,
+		xml.ProcInst{Target: "OFX", Inst: []byte(`OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"`)},
+		newline,
+		start("OFX"),
+	}
+	if err := encodeTokens(enc, tokens...); err != nil {
+		return err
+	}
+	signon := ofxSignon{Status: ofxOK, Server: ofxTime(opts.GeneratedAt), Language: "ENG"}
+	if err := enc.Encode(signon); err != nil {
+		return err
+	}
+	if err := encodeTokens(enc, start("BANKMSGSRSV1"), start("STMTTRNRS")); err != nil {
+		return err
+	}
+	if err := encodeElements(enc,
+		element("TRNUID", "0"),
+		element("STATUS", ofxOK),
+	); err != nil {
+		return err
+	}
+	if err := encodeTokens(enc, start("STMTRS")); err != nil {
+		return err
+	}
+	account := ofxAccount{BankID: opts.BIC, ID: strconv.FormatUint(statement.AccountID, 10), Type: "CHECKING"}
+	if err := encodeElements(enc, element("CURDEF", currency.Code), element("", account)); err != nil {
+		return err
+	}
+	if err := encodeTokens(enc, start("BANKTRANLIST")); err != nil {
+		return err
+	}
+	if err := encodeElements(enc,
+		element("DTSTART", ofxTime(statement.From)),
+		element("DTEND", ofxTime(statement.To)),
+	); err != nil {
+		return err
+	}
+	for _, line := range statement.Lines {
+		if err := enc.Encode(newOFXTransaction(line, statement.AccountID, currency)); err != nil {
+			return err
+		}
+	}
+	if err := encodeTokens(enc, end("BANKTRANLIST")); err != nil {
+		return err
+	}
+	ledger := ofxBalance{Amount: currency.Format(statement.ClosingBalance), AsOf: ofxTime(statement.To)}
+	if err := encodeElements(enc, element("LEDGERBAL", ledger)); err != nil {
+		return err
+	}
+	if err := encodeTokens(enc, end("STMTRS"), end("STMTTRNRS"), end("BANKMSGSRSV1"), end("OFX")); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func newOFXTransaction(line model.StatementLine, accountID uint64, currency model.Currency) ofxTransaction {
+	transaction := line.Transaction
+	t := ofxTransaction{
+		Type:   ofxTransactionType(transaction.Type, line.Amount),
+		Posted: ofxTime(transaction.CreatedAt),
+		Amount: currency.Format(line.Amount),
+		ID:     strconv.FormatUint(transaction.ID, 10),
+		Memo:   truncate(transaction.Description, 255),
+	}
+	if id, ok := counterparty(transaction, accountID); ok {
+		t.Name = fmt.Sprintf("Account %d", id)
+	}
+	return t
+}
+
+// ofxTransactionType 沖正依方向記為CREDIT或DEBIT
+func ofxTransactionType(transactionType model.TransactionType, amount decimal.Decimal) string {
+	switch transactionType {
+	case model.TransactionTypeDeposit:
+		return "DEP"
+	case model.TransactionTypeWithdraw:
+		return "CASH"
+	case model.TransactionTypeTransfer:
+		return "XFER"
+	case model.TransactionTypeInterest:
+		return "INT"
+	case model.TransactionTypeFee:
+		return "FEE"
+	}
+	if amount.IsNegative() {
+		return "DEBIT"
+	}
+	return "CREDIT"
+}
+
+// ofxTime YYYYMMDDHHMMSS.XXX[gmt offset:tz name], 時區沿用時間本身的時區
+func ofxTime(t time.Time) string {
+	name, offset := t.Zone()
+	hours := decimal.New(int64(offset), 0).Div(decimal.NewFromInt(3600)).String()
+	if name == "" || name[0] == '+' || name[0] == '-' {
+		return fmt.Sprintf("%s[%s]", t.Format("20060102150405.000"), hours)
+	}
+	return fmt.Sprintf("%s[%s:%s]", t.Format("20060102150405.000"), hours, name)
+}
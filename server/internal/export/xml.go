@@ -0,0 +1,48 @@
+package export
+
+import "encoding/xml"
+
+// newline 宣告與根元素之間換行, Indent只處理元素
+var newline = xml.CharData("\n")
+
+func start(name string) xml.StartElement {
+	return xml.StartElement{Name: xml.Name{Local: name}}
+}
+
+func end(name string) xml.EndElement {
+	return xml.EndElement{Name: xml.Name{Local: name}}
+}
+
+// xmlElement name為空時用值本身的XMLName
+type xmlElement struct {
+	name  string
+	value interface{}
+}
+
+func element(name string, value interface{}) xmlElement {
+	return xmlElement{name: name, value: value}
+}
+
+func encodeElements(enc *xml.Encoder, elements ...xmlElement) error {
+	for _, e := range elements {
+		var err error
+		if e.name == "" {
+			err = enc.Encode(e.value)
+		} else {
+			err = enc.EncodeElement(e.value, start(e.name))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeTokens(enc *xml.Encoder, tokens ...xml.Token) error {
+	for _, token := range tokens {
+		if err := enc.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+	return enc.Flush()
+}
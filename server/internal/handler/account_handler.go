@@ -1,7 +1,12 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/model"
 	"github.com/kokp520/banking-system/server/internal/service"
 	"github.com/kokp520/banking-system/server/pkg/response"
 	"github.com/shopspring/decimal"
@@ -22,24 +27,145 @@ func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
 
 type CreateAccountRequest struct {
 	Name           string          `json:"name" binding:"required"`
+	Currency       string          `json:"currency"` // ISO 4217, 預設TWD
 	InitialBalance decimal.Decimal `json:"initial_balance"`
+	OverdraftLimit decimal.Decimal `json:"overdraft_limit"` // 可透支額度, 預設0
+	Tier           string          `json:"tier"`            // 帳戶等級, 決定預設限額
+	OwnerID        uint64          `json:"owner_id"`        // 帳戶持有人, 預設為呼叫者; 只有admin可替他人開戶
 }
 
 type GetAccountRequest struct {
 	ID uint64 `uri:"id" binging:"required"`
 }
 
+// Currency 選填, 有帶時需與帳戶幣別一致
 type DepositRequest struct {
-	Amount decimal.Decimal `json:"amount" binding:"required"`
+	Amount   decimal.Decimal `json:"amount" binding:"required"`
+	Currency string          `json:"currency"`
 }
 
 type WithdrawRequest struct {
-	Amount decimal.Decimal `json:"amount" binding:"required"`
+	Amount   decimal.Decimal `json:"amount" binding:"required"`
+	Currency string          `json:"currency"`
 }
 
+// TransferRequest 跨幣別轉帳帶quote_id成交報價, 或convert以即時匯率換匯
 type TransferRequest struct {
 	ToAccountID uint64          `json:"to_account_id" binding:"required"`
 	Amount      decimal.Decimal `json:"amount" binding:"required"`
+	Currency    string          `json:"currency"`
+	QuoteID     string          `json:"quote_id"`
+	Convert     bool            `json:"convert"`
+}
+
+// BatchTransferRequest mode: atomic(預設) | best_effort
+// from_account_id為各筆未指定轉出帳戶時的預設, e.g. 薪資由同一個帳戶轉出
+type BatchTransferRequest struct {
+	Mode          string                     `json:"mode"` // atomic(預設), best_effort
+	FromAccountID uint64                     `json:"from_account_id"`
+	Transfers     []BatchTransferRequestItem `json:"transfers" binding:"required,min=1,dive"`
+}
+
+type BatchTransferRequestItem struct {
+	FromAccountID uint64          `json:"from_account_id"`
+	ToAccountID   uint64          `json:"to_account_id" binding:"required"`
+	Amount        decimal.Decimal `json:"amount" binding:"required"`
+	Currency      string          `json:"currency"`
+	Description   string          `json:"description"`
+}
+
+type ChangeStatusRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// SetOverdraftRequest limit為0代表不可透支
+type SetOverdraftRequest struct {
+	Limit *decimal.Decimal `json:"limit" binding:"required"`
+}
+
+type GetTransactionsRequest struct {
+	Limit     int    `form:"limit" binding:"omitempty,min=1,max=200"`
+	Cursor    string `form:"cursor"`
+	Direction string `form:"direction" binding:"omitempty,oneof=asc desc"`
+
+	// filter
+	Type           string `form:"type" binding:"omitempty,oneof=deposit withdraw transfer reversal interest fee"`
+	From           string `form:"from"`
+	To             string `form:"to"`
+	MinAmount      string `form:"min_amount"`
+	MaxAmount      string `form:"max_amount"`
+	CounterpartyID uint64 `form:"counterparty_id"`
+	TraceID        string `form:"trace_id"`
+}
+
+// filter 驗證並轉成storage查詢條件
+// from/to 接受RFC3339或YYYY-MM-DD, 只給日期時to包含當天整天
+func (r GetTransactionsRequest) filter(accountID uint64) (model.TransactionFilter, error) {
+	filter := model.TransactionFilter{
+		Type:           model.TransactionType(r.Type),
+		CounterpartyID: r.CounterpartyID,
+		TraceID:        r.TraceID,
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam("from", r.From, false); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam("to", r.To, true); err != nil {
+		return filter, err
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, errors.New("from must be before to")
+	}
+
+	if filter.MinAmount, err = parseAmountParam("min_amount", r.MinAmount); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = parseAmountParam("max_amount", r.MaxAmount); err != nil {
+		return filter, err
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && filter.MinAmount.GreaterThan(*filter.MaxAmount) {
+		return filter, errors.New("min_amount cannot be greater than max_amount")
+	}
+
+	if filter.CounterpartyID != 0 && filter.CounterpartyID == accountID {
+		return filter, errors.New("counterparty_id cannot be the account itself")
+	}
+	return filter, nil
+}
+
+const dateLayout = "2006-01-02"
+
+// parseTimeParam endOfRange: 只給日期時回傳隔天0點, 讓to(不包含)涵蓋整天
+func parseTimeParam(name, value string, endOfRange bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: must be RFC3339 or YYYY-MM-DD", name)
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func parseAmountParam(name, value string) (*decimal.Decimal, error) {
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	if amount.IsNegative() {
+		return nil, fmt.Errorf("%s cannot be negative", name)
+	}
+	return &amount, nil
 }
 
 // API
@@ -65,10 +191,14 @@ func (h *AccountHandler) CreateAccount(c *gin.Context) {
 
 	account, err := h.accountService.CreateAccount(c.Request.Context(), service.CreateAccountInput{
 		Name:           req.Name,
+		Currency:       req.Currency,
 		InitialBalance: req.InitialBalance,
+		OverdraftLimit: req.OverdraftLimit,
+		Tier:           req.Tier,
+		OwnerID:        req.OwnerID,
 	})
 	if err != nil {
-		response.InternalError(c, err.Error())
+		respondError(c, err)
 		return
 	}
 
@@ -91,7 +221,7 @@ func (h *AccountHandler) GetAccount(c *gin.Context) {
 
 	account, err := h.accountService.GetAccount(c.Request.Context(), req.ID)
 	if err != nil {
-		response.BadRequest(c, err.Error())
+		respondError(c, err)
 		return
 	}
 
@@ -117,9 +247,9 @@ func (h *AccountHandler) Deposit(c *gin.Context) {
 		return
 	}
 
-	err = h.accountService.Deposit(c.Request.Context(), id, service.DepositInput{Amount: req.Amount})
+	err = h.accountService.Deposit(c.Request.Context(), id, service.DepositInput{Amount: req.Amount, Currency: req.Currency})
 	if err != nil {
-		response.InternalError(c, err.Error())
+		respondError(c, err)
 		return
 	}
 
@@ -136,6 +266,8 @@ func (h *AccountHandler) Deposit(c *gin.Context) {
 // @Param withdraw body WithdrawRequest true "提款信息"
 // @Success 200 {object} response.SuccessResponse
 // @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Router /v1/accounts/{id}/withdraw [post]
 func (h *AccountHandler) Withdraw(c *gin.Context) {
@@ -158,9 +290,9 @@ func (h *AccountHandler) Withdraw(c *gin.Context) {
 		return
 	}
 
-	err = h.accountService.Withdraw(c.Request.Context(), id, service.WithdrawInput{Amount: req.Amount})
+	err = h.accountService.Withdraw(c.Request.Context(), id, service.WithdrawInput{Amount: req.Amount, Currency: req.Currency})
 	if err != nil {
-		response.InternalError(c, err.Error())
+		respondError(c, err)
 		return
 	}
 
@@ -177,6 +309,8 @@ func (h *AccountHandler) Withdraw(c *gin.Context) {
 // @Param transfer body TransferRequest true "轉帳信息"
 // @Success 200 {object} response.SuccessResponse
 // @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Router /v1/accounts/{id}/transfer [post]
 func (h *AccountHandler) Transfer(c *gin.Context) {
@@ -205,24 +339,256 @@ func (h *AccountHandler) Transfer(c *gin.Context) {
 		return
 	}
 
-	err = h.accountService.Transfer(c.Request.Context(), service.TransferInput{
+	transfer, err := h.accountService.Transfer(c.Request.Context(), service.TransferInput{
 		FromAccountID: fromID,
 		ToAccountID:   req.ToAccountID,
 		Amount:        req.Amount,
+		Currency:      req.Currency,
+		QuoteID:       req.QuoteID,
+		Convert:       req.Convert,
 	})
 	if err != nil {
-		response.InternalError(c, err.Error())
+		respondError(c, err)
 		return
 	}
 
-	response.Success(c, gin.H{
+	data := gin.H{
 		"message":      "transfer successful",
 		"from_account": fromID,
 		"to_account":   req.ToAccountID,
 		"amount":       req.Amount.String(),
+	}
+	if transfer.FX != nil {
+		data["fx"] = transfer.FX
+	}
+	if transfer.Fee != nil {
+		data["fee"] = transfer.Fee
+	}
+	response.Success(c, data)
+}
+
+// TransferBatch 批次轉帳 API
+// @Summary 批次轉帳
+// @Description atomic全部成功或全部不異動, best_effort逐筆執行並回傳每筆結果
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param batch body BatchTransferRequest true "轉帳清單"
+// @Success 200 {object} model.BatchTransferResult
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Router /v1/transfers/batch [post]
+func (h *AccountHandler) TransferBatch(c *gin.Context) {
+	var req BatchTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if len(req.Transfers) > model.MaxBatchTransfers {
+		response.BadRequest(c, fmt.Sprintf("batch cannot contain more than %d transfers", model.MaxBatchTransfers))
+		return
+	}
+
+	// 每一筆都先驗證, 任一筆不合法整批不執行
+	in := service.BatchTransferInput{Mode: model.BatchMode(req.Mode), Transfers: make([]service.TransferInput, len(req.Transfers))}
+	for i, item := range req.Transfers {
+		fromID := item.FromAccountID
+		if fromID == 0 {
+			fromID = req.FromAccountID
+		}
+		switch {
+		case fromID == 0:
+			response.BadRequest(c, fmt.Sprintf("transfer %d: from_account_id is required", i))
+			return
+		case item.Amount.LessThanOrEqual(decimal.Zero):
+			response.BadRequest(c, fmt.Sprintf("transfer %d: amount must be greater than 0", i))
+			return
+		case fromID == item.ToAccountID:
+			response.BadRequest(c, fmt.Sprintf("transfer %d: cannot transfer to the same account", i))
+			return
+		}
+		in.Transfers[i] = service.TransferInput{
+			FromAccountID: fromID,
+			ToAccountID:   item.ToAccountID,
+			Amount:        item.Amount,
+			Currency:      item.Currency,
+			Description:   item.Description,
+		}
+	}
+
+	result, err := h.accountService.TransferBatch(c.Request.Context(), in)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	for i := range result.Items {
+		item := &result.Items[i]
+		if item.Err != nil {
+			_, code := lookupError(item.Err)
+			item.Error = &model.BatchItemError{Code: code, Message: item.Err.Error()}
+		}
+	}
+
+	response.Success(c, result)
+}
+
+// FreezeAccount 凍結帳戶 API
+// @Summary 凍結帳戶
+// @Description 凍結後只能入帳, 不能提款或轉出
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Param body body ChangeStatusRequest true "凍結原因"
+// @Success 200 {object} model.Account
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Router /v1/account/{id}/freeze [post]
+func (h *AccountHandler) FreezeAccount(c *gin.Context) {
+	h.changeStatus(c, model.AccountStatusFrozen)
+}
+
+// UnfreezeAccount 解凍帳戶 API
+// @Summary 解凍帳戶
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Param body body ChangeStatusRequest true "解凍原因"
+// @Success 200 {object} model.Account
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Router /v1/account/{id}/unfreeze [post]
+func (h *AccountHandler) UnfreezeAccount(c *gin.Context) {
+	h.changeStatus(c, model.AccountStatusActive)
+}
+
+// CloseAccount 結清帳戶 API
+// @Summary 結清帳戶
+// @Description 餘額需為0, 結清後拒絕所有交易且不能再變更狀態
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Param body body ChangeStatusRequest true "結清原因"
+// @Success 200 {object} model.Account
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Router /v1/account/{id}/close [post]
+func (h *AccountHandler) CloseAccount(c *gin.Context) {
+	h.changeStatus(c, model.AccountStatusClosed)
+}
+
+func (h *AccountHandler) changeStatus(c *gin.Context, status model.AccountStatus) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	var req ChangeStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	account, err := h.accountService.ChangeAccountStatus(c.Request.Context(), id, service.ChangeStatusInput{
+		Status: status,
+		Reason: req.Reason,
 	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, account)
+}
+
+// SetOverdraftLimit 透支額度 API
+// @Summary 設定透支額度
+// @Description 餘額最低可到 -limit, 調降到低於已動用金額時只是不能再扣款
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Param body body SetOverdraftRequest true "透支額度"
+// @Success 200 {object} model.Account
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Router /v1/account/{id}/overdraft [put]
+func (h *AccountHandler) SetOverdraftLimit(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	var req SetOverdraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	account, err := h.accountService.SetOverdraftLimit(c.Request.Context(), id, *req.Limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, account)
+}
+
+// GetOverdraftEvents 透支事件 API
+// @Summary 帳戶透支進出事件
+// @Description 餘額由非負變為負數(entered)或由負數回到非負(exited)時, 與觸發的交易一起記錄
+// @Tags accounts
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Success 200 {array} model.OverdraftEvent
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/overdraft/events [get]
+func (h *AccountHandler) GetOverdraftEvents(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	events, err := h.accountService.GetOverdraftEvents(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, events)
 }
 
+// GetTransactions 交易紀錄 API
+// @Summary 查詢帳戶交易紀錄
+// @Description 依交易ID(入帳順序)排序, cursor分頁, next_cursor為空代表沒有下一頁
+// @Tags accounts
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Param limit query int false "每頁筆數, 預設50, 最大200"
+// @Param cursor query string false "上一頁回傳的next_cursor"
+// @Param direction query string false "asc | desc, 預設desc(新到舊)"
+// @Param type query string false "deposit | withdraw | transfer | reversal | interest | fee"
+// @Param from query string false "起始時間(包含), RFC3339或YYYY-MM-DD"
+// @Param to query string false "結束時間(不包含), 只給日期時包含當天"
+// @Param min_amount query string false "最小金額(包含)"
+// @Param max_amount query string false "最大金額(包含)"
+// @Param counterparty_id query uint64 false "轉帳對手方帳戶ID"
+// @Param trace_id query string false "trace id"
+// @Success 200 {object} model.TransactionPage
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /v1/account/{id}/transactions [get]
 func (h *AccountHandler) GetTransactions(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 64)
@@ -231,11 +597,35 @@ func (h *AccountHandler) GetTransactions(c *gin.Context) {
 		return
 	}
 
-	transactions, err := h.accountService.GetTransactions(c.Request.Context(), id)
+	var req GetTransactionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	cursor, err := model.DecodeCursor(req.Cursor)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	filter, err := req.filter(id)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	page, err := h.accountService.GetTransactions(c.Request.Context(), model.TransactionQuery{
+		AccountID: id,
+		Cursor:    cursor,
+		Limit:     req.Limit,
+		Direction: model.SortDirection(req.Direction),
+		Filter:    filter,
+	})
 	if err != nil {
-		response.InternalError(c, err.Error())
+		respondError(c, err)
 		return
 	}
 
-	response.Success(c, transactions)
+	response.Success(c, page)
 }
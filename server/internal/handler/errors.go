@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/pkg/response"
+)
+
+// errorMappings 業務錯誤 -> http status / 錯誤碼, 依序比對errors.Is
+var errorMappings = []struct {
+	err      error
+	httpCode int
+	code     int
+}{
+	{model.ErrAccountNotFound, http.StatusNotFound, response.AccountNotFound},
+	{model.ErrInsufficientBalance, http.StatusUnprocessableEntity, response.InsufficientBalance},
+	{model.ErrInvalidAmount, http.StatusBadRequest, response.InvalidAmount},
+	{model.ErrSameAccount, http.StatusBadRequest, response.InvalidParams},
+	{model.ErrInvalidRequest, http.StatusBadRequest, response.InvalidParams},
+	{model.ErrAccountFrozen, http.StatusUnprocessableEntity, response.AccountFrozen},
+	{model.ErrAccountClosed, http.StatusUnprocessableEntity, response.AccountClosed},
+	{model.ErrInvalidStatusTransition, http.StatusConflict, response.InvalidStatusChange},
+	{model.ErrBalanceNotZero, http.StatusUnprocessableEntity, response.BalanceNotZero},
+	{model.ErrUnsupportedCurrency, http.StatusBadRequest, response.UnsupportedCurrency},
+	{model.ErrCurrencyMismatch, http.StatusUnprocessableEntity, response.CurrencyMismatch},
+	{model.ErrFXRateUnavailable, http.StatusUnprocessableEntity, response.FXRateUnavailable},
+	{model.ErrQuoteNotFound, http.StatusNotFound, response.QuoteNotFound},
+	{model.ErrQuoteExpired, http.StatusUnprocessableEntity, response.QuoteExpired},
+	{model.ErrHoldNotFound, http.StatusNotFound, response.HoldNotFound},
+	{model.ErrHoldNotActive, http.StatusConflict, response.HoldNotActive},
+	{model.ErrLimitExceeded, http.StatusUnprocessableEntity, response.LimitExceeded},
+	{model.ErrTransactionNotFound, http.StatusNotFound, response.TransactionNotFound},
+	{model.ErrAlreadyReversed, http.StatusConflict, response.AlreadyReversed},
+	{model.ErrStandingOrderNotFound, http.StatusNotFound, response.StandingOrderNotFound},
+	{model.ErrStandingOrderNotActive, http.StatusConflict, response.StandingOrderNotActive},
+	{model.ErrUnauthorized, http.StatusUnauthorized, response.Unauthorized},
+	{model.ErrForbidden, http.StatusForbidden, response.Forbidden},
+	{model.ErrUserNotFound, http.StatusNotFound, response.NotFound},
+	{model.ErrUsernameTaken, http.StatusConflict, response.UsernameTaken},
+}
+
+// respondError service回傳的錯誤統一在這裡轉成回應, 未分類的錯誤回500
+func respondError(c *gin.Context, err error) {
+	httpCode, code := lookupError(err)
+	response.Error(c, httpCode, code, err.Error())
+}
+
+// lookupError 錯誤對應的http status與錯誤碼
+func lookupError(err error) (int, int) {
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			return mapping.httpCode, mapping.code
+		}
+	}
+	return http.StatusInternalServerError, response.ServerError
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/response"
+)
+
+type FeeHandler struct {
+	feeService *service.FeeService
+}
+
+func NewFeeHandler(feeService *service.FeeService) *FeeHandler {
+	return &FeeHandler{
+		feeService: feeService,
+	}
+}
+
+// FeeQuoteRequest operation: withdraw | transfer
+type FeeQuoteRequest struct {
+	Operation string `form:"operation" binding:"required"`
+	Amount    string `form:"amount" binding:"required"`
+}
+
+// GetSchedules 手續費設定 API
+// @Summary 手續費設定
+// @Description 只列出有收費的操作, 金額為帳戶幣別
+// @Tags fees
+// @Produce json
+// @Success 200 {array} model.FeeSchedule
+// @Router /v1/fees [get]
+func (h *FeeHandler) GetSchedules(c *gin.Context) {
+	response.Success(c, h.feeService.Schedules())
+}
+
+// Quote 手續費試算 API
+// @Summary 試算提款或轉帳的手續費
+// @Description 不會扣款, 實際扣款時依當下的設定重新計算; total為帳戶需扣除的金額
+// @Tags fees
+// @Produce json
+// @Param id path uint64 true "扣款帳戶ID"
+// @Param operation query string true "withdraw | transfer"
+// @Param amount query string true "交易金額"
+// @Success 200 {object} model.FeeQuote
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/fees/quote [get]
+func (h *FeeHandler) Quote(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	var req FeeQuoteRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	amount, err := parseAmountParam("amount", req.Amount)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	quote, err := h.feeService.Quote(c.Request.Context(), id, model.TransactionType(req.Operation), *amount)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, quote)
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/response"
+	"github.com/shopspring/decimal"
+)
+
+type FXHandler struct {
+	fxService *service.FXService
+}
+
+func NewFXHandler(fxService *service.FXService) *FXHandler {
+	return &FXHandler{
+		fxService: fxService,
+	}
+}
+
+type QuoteRequest struct {
+	SourceAccountID     uint64          `json:"source_account_id" binding:"required"`
+	SourceCurrency      string          `json:"source_currency" binding:"required"`
+	DestinationCurrency string          `json:"destination_currency" binding:"required"`
+	Amount              decimal.Decimal `json:"amount" binding:"required"`
+}
+
+// GetRates 匯率表 API
+// @Summary 匯率表
+// @Description 目前的中間價, 反向幣別對以倒數計算
+// @Tags fx
+// @Produce json
+// @Success 200 {object} service.FXRateTable
+// @Router /v1/fx/rates [get]
+func (h *FXHandler) GetRates(c *gin.Context) {
+	response.Success(c, service.FXRateTable{Rates: h.fxService.Rates()})
+}
+
+// SetRates 更新匯率表 API
+// @Summary 更新匯率表
+// @Description 整批替換匯率表, 已發出的報價不受影響
+// @Tags fx
+// @Accept json
+// @Produce json
+// @Param rates body service.FXRateTable true "匯率表"
+// @Success 200 {object} service.FXRateTable
+// @Failure 400 {object} response.ErrorResponse
+// @Router /v1/admin/fx/rates [put]
+func (h *FXHandler) SetRates(c *gin.Context) {
+	var req service.FXRateTable
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	rates, err := h.fxService.SetRates(c.Request.Context(), req.Rates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	response.Success(c, service.FXRateTable{Rates: rates})
+}
+
+// CreateQuote 換匯報價 API
+// @Summary 換匯報價
+// @Description 以目前匯率與spread報價, 在expires_at前可由同一個使用者帶quote_id從source_account_id轉帳一次
+// @Tags fx
+// @Accept json
+// @Produce json
+// @Param quote body QuoteRequest true "報價條件"
+// @Success 200 {object} model.FXQuote
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Router /v1/fx/quotes [post]
+func (h *FXHandler) CreateQuote(c *gin.Context) {
+	var req QuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	quote, err := h.fxService.Quote(c.Request.Context(), req.SourceAccountID, req.SourceCurrency, req.DestinationCurrency, req.Amount)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	response.Success(c, quote)
+}
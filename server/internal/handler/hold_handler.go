@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/response"
+	"github.com/shopspring/decimal"
+)
+
+type HoldHandler struct {
+	holdService *service.HoldService
+}
+
+func NewHoldHandler(holdService *service.HoldService) *HoldHandler {
+	return &HoldHandler{
+		holdService: holdService,
+	}
+}
+
+// PlaceHoldRequest expires_at選填, 預設依設定保留
+type PlaceHoldRequest struct {
+	Amount      decimal.Decimal `json:"amount" binding:"required"`
+	Currency    string          `json:"currency"`
+	Description string          `json:"description"`
+	ExpiresAt   *time.Time      `json:"expires_at"`
+}
+
+// CaptureHoldRequest amount選填, 不帶時請款全部剩餘金額
+type CaptureHoldRequest struct {
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// PlaceHold 預授權圈存 API
+// @Summary 預授權圈存
+// @Description 圈存金額降低可用餘額但不影響帳上餘額, 到期自動解除
+// @Tags holds
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Param hold body PlaceHoldRequest true "圈存金額"
+// @Success 200 {object} model.Hold
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Router /v1/account/{id}/holds [post]
+func (h *HoldHandler) PlaceHold(c *gin.Context) {
+	accountID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid account id")
+		return
+	}
+
+	var req PlaceHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		response.BadRequest(c, "amount must be greater than 0")
+		return
+	}
+
+	in := service.PlaceHoldInput{
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Description: req.Description,
+	}
+	if req.ExpiresAt != nil {
+		in.ExpiresAt = *req.ExpiresAt
+	}
+	hold, err := h.holdService.PlaceHold(c.Request.Context(), accountID, in)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, hold)
+}
+
+// GetHolds 帳戶預授權列表 API
+// @Summary 帳戶預授權列表
+// @Tags holds
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Success 200 {array} model.Hold
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/holds [get]
+func (h *HoldHandler) GetHolds(c *gin.Context) {
+	accountID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid account id")
+		return
+	}
+
+	holds, err := h.holdService.GetHolds(c.Request.Context(), accountID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, holds)
+}
+
+// GetHold 預授權 API
+// @Summary 查詢預授權
+// @Tags holds
+// @Produce json
+// @Param id path uint64 true "預授權ID"
+// @Success 200 {object} model.Hold
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/holds/{id} [get]
+func (h *HoldHandler) GetHold(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid hold id")
+		return
+	}
+
+	hold, err := h.holdService.GetHold(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, hold)
+}
+
+// CaptureHold 預授權請款 API
+// @Summary 預授權請款
+// @Description 可部分請款, 請款以提款交易扣帳, 剩餘金額仍圈存到解除或到期
+// @Tags holds
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "預授權ID"
+// @Param capture body CaptureHoldRequest false "請款金額"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Router /v1/holds/{id}/capture [post]
+func (h *HoldHandler) CaptureHold(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid hold id")
+		return
+	}
+
+	var req CaptureHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if req.Amount.IsNegative() {
+		response.BadRequest(c, "amount cannot be negative")
+		return
+	}
+
+	hold, capture, err := h.holdService.CaptureHold(c.Request.Context(), id, service.CaptureHoldInput{Amount: req.Amount})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{
+		"hold":        hold,
+		"transaction": capture,
+	})
+}
+
+// ReleaseHold 解除預授權 API
+// @Summary 解除預授權
+// @Description 解除剩餘圈存, 已請款的部分不受影響
+// @Tags holds
+// @Produce json
+// @Param id path uint64 true "預授權ID"
+// @Success 200 {object} model.Hold
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Router /v1/holds/{id}/release [post]
+func (h *HoldHandler) ReleaseHold(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid hold id")
+		return
+	}
+
+	hold, err := h.holdService.ReleaseHold(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, hold)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/response"
+)
+
+type InterestHandler struct {
+	interestService *service.InterestService
+}
+
+func NewInterestHandler(interestService *service.InterestService) *InterestHandler {
+	return &InterestHandler{
+		interestService: interestService,
+	}
+}
+
+type SetProductRequest struct {
+	Product string `json:"product" binding:"required"`
+}
+
+// GetProducts 計息產品 API
+// @Summary 計息產品列表
+// @Tags interest
+// @Produce json
+// @Success 200 {array} model.Product
+// @Router /v1/interest/products [get]
+func (h *InterestHandler) GetProducts(c *gin.Context) {
+	response.Success(c, h.interestService.Products())
+}
+
+// SetProduct 設定計息產品 API
+// @Summary 設定帳戶計息產品
+// @Description 第一次設定時從當天開始計息, 更換產品時已計提的利息保留
+// @Tags interest
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Param body body SetProductRequest true "計息產品"
+// @Success 200 {object} model.Account
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/product [put]
+func (h *InterestHandler) SetProduct(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	var req SetProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	account, err := h.interestService.SetProduct(c.Request.Context(), id, req.Product)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, account)
+}
+
+// GetAccruals 計息紀錄 API
+// @Summary 帳戶每日計息紀錄
+// @Description 每個計息日一筆, 月底一筆帶入帳的利息交易
+// @Tags interest
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Success 200 {array} model.InterestAccrual
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/interest [get]
+func (h *InterestHandler) GetAccruals(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	accruals, err := h.interestService.GetAccruals(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, accruals)
+}
+
+// RunAccrual 立即計息 API
+// @Summary 立即執行計息
+// @Description 與背景排程相同, 計息到前一天, 錯過的日子逐日補算; 回傳本次新增的計息紀錄
+// @Tags interest
+// @Produce json
+// @Success 200 {array} model.InterestAccrual
+// @Router /v1/admin/interest/run [post]
+func (h *InterestHandler) RunAccrual(c *gin.Context) {
+	accruals, err := h.interestService.RunAccrual(c.Request.Context(), time.Now())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, accruals)
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/response"
+)
+
+type LedgerHandler struct {
+	ledgerService *service.LedgerService
+}
+
+func NewLedgerHandler(ledgerService *service.LedgerService) *LedgerHandler {
+	return &LedgerHandler{
+		ledgerService: ledgerService,
+	}
+}
+
+// TrialBalance 試算表 API
+// @Summary 試算表
+// @Description 彙總所有分錄, 檢查借貸總額相等且客戶帳戶餘額與分錄一致
+// @Tags ledger
+// @Produce json
+// @Success 200 {object} model.TrialBalance
+// @Failure 500 {object} response.ErrorResponse
+// @Router /v1/ledger/trial-balance [get]
+func (h *LedgerHandler) TrialBalance(c *gin.Context) {
+	trial, err := h.ledgerService.TrialBalance(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, trial)
+}
+
+// GetEntries 交易分錄 API
+// @Summary 查詢交易的借貸分錄
+// @Tags ledger
+// @Produce json
+// @Param id path uint64 true "交易ID"
+// @Success 200 {array} model.LedgerEntry
+// @Failure 400 {object} response.ErrorResponse
+// @Router /v1/transactions/{id}/entries [get]
+func (h *LedgerHandler) GetEntries(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid transaction id")
+		return
+	}
+
+	entries, err := h.ledgerService.GetEntries(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, entries)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/response"
+)
+
+type LimitHandler struct {
+	limitService *service.LimitService
+}
+
+func NewLimitHandler(limitService *service.LimitService) *LimitHandler {
+	return &LimitHandler{
+		limitService: limitService,
+	}
+}
+
+// SetLimitsRequest tier不帶時維持目前等級; limits整組替換帳戶個別限額, 不帶時全部沿用等級設定
+type SetLimitsRequest struct {
+	Tier   string        `json:"tier"`
+	Limits *model.Limits `json:"limits"`
+}
+
+// GetLimits 限額 API
+// @Summary 帳戶限額與剩餘額度
+// @Description 提款與轉出合併計算, 用量以滾動視窗內的交易紀錄計算, null代表不限制
+// @Tags limits
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Success 200 {object} model.LimitUsage
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/limits [get]
+func (h *LimitHandler) GetLimits(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	usage, err := h.limitService.Usage(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, usage)
+}
+
+// SetLimits 設定限額 API
+// @Summary 設定帳戶等級與個別限額
+// @Description 個別限額有設定的欄位覆蓋等級設定
+// @Tags limits
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Param body body SetLimitsRequest true "等級與限額"
+// @Success 200 {object} model.LimitUsage
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/limits [put]
+func (h *LimitHandler) SetLimits(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	var req SetLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if _, err := h.limitService.SetLimits(c.Request.Context(), id, req.Tier, req.Limits); err != nil {
+		respondError(c, err)
+		return
+	}
+	usage, err := h.limitService.Usage(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, usage)
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/kokp520/banking-system/server/pkg/response"
+	"go.uber.org/zap"
+)
+
+// maxPain001Size 上傳的pain.001檔案大小上限
+const maxPain001Size = 10 << 20
+
+type PaymentHandler struct {
+	paymentImportService *service.PaymentImportService
+}
+
+func NewPaymentHandler(paymentImportService *service.PaymentImportService) *PaymentHandler {
+	return &PaymentHandler{
+		paymentImportService: paymentImportService,
+	}
+}
+
+// ImportPain001 匯入批次付款 API
+// @Summary 匯入ISO 20022 pain.001批次付款
+// @Description body為pain.001.001.03 XML, 每筆付款以轉帳執行; 回傳pain.002付款狀態報告, Accept: application/json時回傳JSON
+// @Description 欄位不符規則或MsgId重複時整份退回, 不執行任何付款
+// @Tags payments
+// @Accept xml
+// @Produce xml,json
+// @Param file body string true "pain.001.001.03 XML"
+// @Success 200 {object} model.PaymentImport
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Router /v1/payments/pain001 [post]
+func (h *PaymentHandler) ImportPain001(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPain001Size))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		response.Error(c, http.StatusRequestEntityTooLarge, response.InvalidParams,
+			fmt.Sprintf("file cannot be larger than %d bytes", maxPain001Size))
+		return
+	}
+	if err != nil {
+		response.BadRequest(c, "failed to read request body")
+		return
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		response.BadRequest(c, "pain.001 file is required")
+		return
+	}
+
+	result, err := h.paymentImportService.Import(c.Request.Context(), data)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if c.NegotiateFormat(binding.MIMEXML, binding.MIMEJSON) == binding.MIMEJSON {
+		response.Success(c, result)
+		return
+	}
+	c.Header("Content-Type", binding.MIMEXML+"; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="pain002-%s.xml"`, result.CreatedAt.Format("20060102150405")))
+	c.Status(http.StatusOK)
+	// header已送出, 寫出失敗只能記錄
+	if err := h.paymentImportService.WriteReport(c.Writer, result); err != nil {
+		logger.WithTraceID(c.Request.Context()).Error("failed to write pain.002",
+			zap.Error(err),
+			zap.String("messageId", result.MessageID),
+		)
+	}
+}
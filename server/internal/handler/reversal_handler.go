@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/response"
+	"github.com/shopspring/decimal"
+)
+
+type ReversalHandler struct {
+	reversalService *service.ReversalService
+}
+
+func NewReversalHandler(reversalService *service.ReversalService) *ReversalHandler {
+	return &ReversalHandler{
+		reversalService: reversalService,
+	}
+}
+
+// ReverseRequest amount選填, 不帶時沖正剩餘全額
+type ReverseRequest struct {
+	Amount *decimal.Decimal `json:"amount"`
+	Reason string           `json:"reason"`
+}
+
+// Reverse 交易沖正 API
+// @Summary 沖正或部分退款
+// @Description 以反向交易退回存款或轉帳, 可分次部分退款, 累計不超過原交易金額
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "原交易ID"
+// @Param reversal body ReverseRequest false "退款金額與原因"
+// @Success 200 {object} model.Reversal
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Router /v1/transactions/{id}/reverse [post]
+func (h *ReversalHandler) Reverse(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid transaction id")
+		return
+	}
+
+	var req ReverseRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	in := service.ReverseInput{Reason: req.Reason}
+	if req.Amount != nil {
+		if req.Amount.LessThanOrEqual(decimal.Zero) {
+			response.BadRequest(c, "amount must be greater than 0")
+			return
+		}
+		in.Amount = *req.Amount
+	}
+
+	reversal, err := h.reversalService.Reverse(c.Request.Context(), id, in)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, reversal)
+}
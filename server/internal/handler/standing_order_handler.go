@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/response"
+	"github.com/shopspring/decimal"
+)
+
+type StandingOrderHandler struct {
+	standingOrderService *service.StandingOrderService
+}
+
+func NewStandingOrderHandler(standingOrderService *service.StandingOrderService) *StandingOrderHandler {
+	return &StandingOrderHandler{
+		standingOrderService: standingOrderService,
+	}
+}
+
+// CreateStandingOrderRequest start_at選填, 預設立即開始; end_at選填; retry_policy選填, 預設依設定
+type CreateStandingOrderRequest struct {
+	ToAccountID uint64             `json:"to_account_id" binding:"required"`
+	Amount      decimal.Decimal    `json:"amount" binding:"required"`
+	Currency    string             `json:"currency"`
+	Description string             `json:"description"`
+	Schedule    model.Schedule     `json:"schedule"`
+	StartAt     *time.Time         `json:"start_at"`
+	EndAt       *time.Time         `json:"end_at"`
+	RetryPolicy *model.RetryPolicy `json:"retry_policy"`
+}
+
+// CreateStandingOrder 建立定期轉帳 API
+// @Summary 建立定期轉帳
+// @Description 預約單次轉帳, 或每天/每週/每月第N天/每月月底定期轉帳, 到期由排程執行
+// @Tags standing-orders
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "轉出帳戶ID"
+// @Param order body CreateStandingOrderRequest true "定期轉帳"
+// @Success 200 {object} model.StandingOrder
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Router /v1/account/{id}/standing-orders [post]
+func (h *StandingOrderHandler) CreateStandingOrder(c *gin.Context) {
+	accountID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid account id")
+		return
+	}
+
+	var req CreateStandingOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		response.BadRequest(c, "amount must be greater than 0")
+		return
+	}
+
+	in := service.CreateStandingOrderInput{
+		ToAccountID: req.ToAccountID,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Description: req.Description,
+		Schedule:    req.Schedule,
+		Retry:       req.RetryPolicy,
+	}
+	if req.StartAt != nil {
+		in.StartAt = *req.StartAt
+	}
+	if req.EndAt != nil {
+		in.EndAt = *req.EndAt
+	}
+	order, err := h.standingOrderService.CreateStandingOrder(c.Request.Context(), accountID, in)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, order)
+}
+
+// GetStandingOrders 帳戶定期轉帳列表 API
+// @Summary 帳戶定期轉帳列表
+// @Tags standing-orders
+// @Produce json
+// @Param id path uint64 true "轉出帳戶ID"
+// @Success 200 {array} model.StandingOrder
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/standing-orders [get]
+func (h *StandingOrderHandler) GetStandingOrders(c *gin.Context) {
+	accountID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid account id")
+		return
+	}
+
+	orders, err := h.standingOrderService.GetStandingOrders(c.Request.Context(), accountID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, orders)
+}
+
+// GetStandingOrder 定期轉帳 API
+// @Summary 查詢定期轉帳
+// @Tags standing-orders
+// @Produce json
+// @Param id path uint64 true "定期轉帳ID"
+// @Success 200 {object} model.StandingOrder
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/standing-orders/{id} [get]
+func (h *StandingOrderHandler) GetStandingOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid standing order id")
+		return
+	}
+
+	order, err := h.standingOrderService.GetStandingOrder(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, order)
+}
+
+// GetRuns 定期轉帳執行紀錄 API
+// @Summary 定期轉帳執行紀錄
+// @Description 每次執行(含失敗與重試)一筆, trace_id可對應到該次轉帳的log
+// @Tags standing-orders
+// @Produce json
+// @Param id path uint64 true "定期轉帳ID"
+// @Success 200 {array} model.StandingOrderRun
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/standing-orders/{id}/runs [get]
+func (h *StandingOrderHandler) GetRuns(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid standing order id")
+		return
+	}
+
+	runs, err := h.standingOrderService.GetRuns(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, runs)
+}
+
+// Pause 暫停定期轉帳 API
+// @Summary 暫停定期轉帳
+// @Tags standing-orders
+// @Produce json
+// @Param id path uint64 true "定期轉帳ID"
+// @Success 200 {object} model.StandingOrder
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Router /v1/standing-orders/{id}/pause [post]
+func (h *StandingOrderHandler) Pause(c *gin.Context) {
+	h.transition(c, h.standingOrderService.Pause)
+}
+
+// Resume 恢復定期轉帳 API
+// @Summary 恢復定期轉帳
+// @Description 暫停期間已過的期數不補執行
+// @Tags standing-orders
+// @Produce json
+// @Param id path uint64 true "定期轉帳ID"
+// @Success 200 {object} model.StandingOrder
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Router /v1/standing-orders/{id}/resume [post]
+func (h *StandingOrderHandler) Resume(c *gin.Context) {
+	h.transition(c, h.standingOrderService.Resume)
+}
+
+// Cancel 取消定期轉帳 API
+// @Summary 取消定期轉帳
+// @Tags standing-orders
+// @Produce json
+// @Param id path uint64 true "定期轉帳ID"
+// @Success 200 {object} model.StandingOrder
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Router /v1/standing-orders/{id}/cancel [post]
+func (h *StandingOrderHandler) Cancel(c *gin.Context) {
+	h.transition(c, h.standingOrderService.Cancel)
+}
+
+func (h *StandingOrderHandler) transition(c *gin.Context, apply func(ctx context.Context, id uint64) (*model.StandingOrder, error)) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid standing order id")
+		return
+	}
+
+	order, err := apply(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, order)
+}
+
+// RunDue 立即執行到期定期轉帳 API
+// @Summary 立即執行到期的定期轉帳
+// @Description 與背景排程相同, 供維運補跑; 回傳本次的執行紀錄
+// @Tags standing-orders
+// @Produce json
+// @Success 200 {array} model.StandingOrderRun
+// @Router /v1/admin/standing-orders/run [post]
+func (h *StandingOrderHandler) RunDue(c *gin.Context) {
+	runs, err := h.standingOrderService.RunDue(c.Request.Context(), time.Now())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, runs)
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/kokp520/banking-system/server/pkg/response"
+	"go.uber.org/zap"
+)
+
+type StatementHandler struct {
+	statementService *service.StatementService
+}
+
+func NewStatementHandler(statementService *service.StatementService) *StatementHandler {
+	return &StatementHandler{
+		statementService: statementService,
+	}
+}
+
+// StatementRequest from/to 接受RFC3339或YYYY-MM-DD, 只給日期時to包含當天整天
+type StatementRequest struct {
+	From string `form:"from"`
+	To   string `form:"to"`
+}
+
+// GetStatement 對帳單 API
+// @Summary 帳戶對帳單
+// @Description 期初餘額、期間每筆交易與入帳後餘額、各類型合計與期末餘額; from不帶時從開戶開始, to不帶時到現在
+// @Tags statements
+// @Produce json
+// @Param id path uint64 true "帳戶ID"
+// @Param from query string false "起始時間(含)"
+// @Param to query string false "結束時間(不含)"
+// @Success 200 {object} model.Statement
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/statement [get]
+func (h *StatementHandler) GetStatement(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	var req StatementRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	from, err := parseTimeParam("from", req.From, false)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	to, err := parseTimeParam("to", req.To, true)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	statement, err := h.statementService.GetStatement(c.Request.Context(), id, from, to)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, statement)
+}
+
+// ExportStatementRequest format: csv | ofx | camt053 | mt940
+type ExportStatementRequest struct {
+	StatementRequest
+	Format string `form:"format" binding:"required"`
+}
+
+// ExportStatement 對帳單匯出 API
+// @Summary 匯出帳戶對帳單
+// @Description 以CSV、OFX 2.2、ISO 20022 camt.053或SWIFT MT940匯出期間內的交易與期初期末餘額, 以附件下載
+// @Tags statements
+// @Produce text/csv,application/x-ofx,application/xml,text/plain
+// @Param id path uint64 true "帳戶ID"
+// @Param format query string true "csv | ofx | camt053 | mt940"
+// @Param from query string false "起始時間(含)"
+// @Param to query string false "結束時間(不含)"
+// @Success 200 {file} file
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/account/{id}/statement/export [get]
+func (h *StatementHandler) ExportStatement(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id")
+		return
+	}
+
+	var req ExportStatementRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	from, err := parseTimeParam("from", req.From, false)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	to, err := parseTimeParam("to", req.To, true)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	file, err := h.statementService.Export(c.Request.Context(), id, from, to, req.Format)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", file.Format.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Name()))
+	c.Status(http.StatusOK)
+	// header已送出, 寫出失敗只能記錄
+	if err := file.Write(c.Writer); err != nil {
+		logger.WithTraceID(c.Request.Context()).Error("failed to write statement export",
+			zap.Error(err),
+			zap.Uint64("accountId", id),
+			zap.String("format", req.Format),
+		)
+	}
+}
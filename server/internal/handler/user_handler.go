@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/service"
+	"github.com/kokp520/banking-system/server/pkg/response"
+)
+
+type UserHandler struct {
+	userService *service.UserService
+}
+
+func NewUserHandler(userService *service.UserService) *UserHandler {
+	return &UserHandler{
+		userService: userService,
+	}
+}
+
+// CredentialsRequest 註冊與登入共用
+type CredentialsRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Register 註冊 API
+// @Summary 註冊使用者
+// @Description username 3-32字元(英數字與._-), 不分大小寫; password 8-72 bytes
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body CredentialsRequest true "帳號密碼"
+// @Success 200 {object} model.User
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Router /v1/users [post]
+func (h *UserHandler) Register(c *gin.Context) {
+	var req CredentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	user, err := h.userService.Register(c.Request.Context(), req.Username, req.Password)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, user)
+}
+
+// Login 登入 API
+// @Summary 登入取得access token
+// @Description 之後的請求帶 Authorization: Bearer <access_token>
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body CredentialsRequest true "帳號密碼"
+// @Success 200 {object} model.Token
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Router /v1/auth/login [post]
+func (h *UserHandler) Login(c *gin.Context) {
+	var req CredentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	token, err := h.userService.Login(c.Request.Context(), req.Username, req.Password)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, token)
+}
+
+// Me 目前使用者 API
+// @Summary 目前登入的使用者
+// @Tags auth
+// @Produce json
+// @Success 200 {object} model.User
+// @Failure 401 {object} response.ErrorResponse
+// @Router /v1/users/me [get]
+func (h *UserHandler) Me(c *gin.Context) {
+	user, err := h.userService.Me(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, user)
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required"` // customer, teller, auditor, admin
+}
+
+// SetRole 變更角色 API
+// @Summary 變更使用者角色(admin)
+// @Description 角色每個請求依使用者讀取, 已簽發的token立即套用新角色
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "使用者ID"
+// @Param body body SetRoleRequest true "角色"
+// @Success 200 {object} model.User
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /v1/admin/users/{id}/role [put]
+func (h *UserHandler) SetRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid user id")
+		return
+	}
+	var req SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	user, err := h.userService.SetRole(c.Request.Context(), id, req.Role)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response.Success(c, user)
+}
@@ -0,0 +1,136 @@
+package iso20022
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test ./internal/iso20022 -update 重新產生testdata下的golden files
+var update = flag.Bool("update", false, "update golden files")
+
+func readPain001(t *testing.T) *Pain001 {
+	f, err := os.Open(filepath.Join("testdata", "pain001.xml"))
+	require.NoError(t, err)
+	defer f.Close()
+	message, err := ParsePain001(f)
+	require.NoError(t, err)
+	return message
+}
+
+func TestParsePain001(t *testing.T) {
+	message := readPain001(t)
+	require.NoError(t, message.Validate())
+	assert.Equal(t, "PAYROLL-2024-03", message.GroupHeader.MessageID)
+	assert.Equal(t, 3, message.Count())
+	require.Len(t, message.PaymentInfos, 2)
+
+	info := message.PaymentInfos[0]
+	assert.Equal(t, time.Date(2024, time.March, 25, 0, 0, 0, 0, time.Local), info.ExecutionDay())
+	id, err := info.DebtorAccount.AccountID()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), id)
+	assert.Equal(t, "Salary March", info.Transactions[0].Description())
+	assert.Equal(t, "Payment E2E-2", info.Transactions[1].Description())
+
+	// IBAN不是本行帳戶
+	_, err = info.Transactions[1].CreditorAccount.AccountID()
+	assert.Error(t, err)
+	assert.Equal(t, "DE89370400440532013000", info.Transactions[1].CreditorAccount.String())
+
+	for _, data := range []string{
+		"<Document>",
+		`<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.008.001.02"></Document>`,
+	} {
+		_, err := ParsePain001(strings.NewReader(data))
+		assert.ErrorIs(t, err, model.ErrInvalidRequest, data)
+	}
+}
+
+func TestValidatePain001(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *Pain001)
+		code   string
+		reason string
+	}{
+		{"missing message id", func(m *Pain001) { m.GroupHeader.MessageID = "" }, ReasonInvalidFileFormat, "GrpHdr/MsgId is required"},
+		{"long end to end id", func(m *Pain001) {
+			m.PaymentInfos[0].Transactions[0].EndToEndID = strings.Repeat("E", 36)
+		}, ReasonInvalidFileFormat, "EndToEndId exceeds 35 characters"},
+		{"direct debit", func(m *Pain001) { m.PaymentInfos[1].Method = "DD" }, ReasonInvalidFileFormat, "PmtMtd must be TRF"},
+		{"bad amount", func(m *Pain001) {
+			m.PaymentInfos[1].Transactions[0].Amount.Value = "1.123456"
+		}, ReasonInvalidFileFormat, "is not a valid amount"},
+		{"bad currency", func(m *Pain001) {
+			m.PaymentInfos[1].Transactions[0].Amount.Currency = "twd"
+		}, ReasonInvalidFileFormat, "3-letter currency code"},
+		{"bad date", func(m *Pain001) { m.PaymentInfos[0].ExecutionDate = "25/03/2024" }, ReasonInvalidFileFormat, "must be an ISO date"},
+		{"number of transactions", func(m *Pain001) { m.GroupHeader.NumberOfTransactions = "4" }, ReasonInvalidNumberOfTransactions,
+			"GrpHdr/NbOfTxs is 4, found 3 transactions"},
+		{"control sum", func(m *Pain001) { m.PaymentInfos[0].ControlSum = "1250" }, ReasonInvalidControlSum,
+			"PmtInf[0]/CtrlSum is 1250, transactions sum to 1250.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := readPain001(t)
+			tt.modify(message)
+			err := message.Validate()
+			var invalid *ValidationError
+			require.ErrorAs(t, err, &invalid)
+			assert.ErrorIs(t, err, model.ErrInvalidRequest)
+			assert.Equal(t, tt.code, invalid.Code())
+			assert.Contains(t, err.Error(), tt.reason)
+		})
+	}
+}
+
+func TestPain002Golden(t *testing.T) {
+	createdAt := time.Date(2024, time.March, 25, 9, 30, 0, 0, time.UTC)
+	result := &model.PaymentImport{
+		MessageID:            "PAYROLL-2024-03",
+		NumberOfTransactions: 3,
+		ControlSum:           decimal.RequireFromString("1750.5"),
+		CreatedAt:            createdAt,
+	}
+	result.Add(model.PaymentInfoResult{ID: "PAYROLL-1", Payments: []model.PaymentResult{
+		{InstructionID: "I-1", EndToEndID: "E2E-1", Amount: decimal.RequireFromString("1000.5"), Currency: "TWD",
+			Status: model.PaymentStatusSettled, Transaction: &model.Transaction{ID: 42}},
+		{EndToEndID: "E2E-2", Amount: decimal.NewFromInt(250), Currency: "TWD", Status: model.PaymentStatusRejected,
+			Reason: ReasonInvalidCreditorAccount, Message: "account DE89370400440532013000 is not held with us, " + strings.Repeat("x", 100)},
+	}})
+	result.Add(model.PaymentInfoResult{ID: "PAYROLL-2", Payments: []model.PaymentResult{
+		{EndToEndID: "E2E-3", Amount: decimal.NewFromInt(500), Currency: "TWD", Status: model.PaymentStatusRejected,
+			Reason: ReasonInsufficientFunds, Message: "insufficient balance"},
+	}})
+	assert.Equal(t, model.PaymentStatusPartial, result.Status)
+	assert.Equal(t, model.PaymentStatusPartial, result.PaymentInfos[0].Status)
+	assert.Equal(t, model.PaymentStatusRejected, result.PaymentInfos[1].Status)
+
+	rejected := &model.PaymentImport{MessageID: "PAYROLL-2024-03", NumberOfTransactions: 3, CreatedAt: createdAt}
+	rejected.Reject(ReasonDuplicateMessage, "message PAYROLL-2024-03 has already been imported")
+
+	for name, result := range map[string]*model.PaymentImport{"partial": result, "rejected": rejected} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, WritePain002(&buf, result, Options{BIC: "KOKPTWTP", GeneratedAt: createdAt}))
+
+			golden := filepath.Join("testdata", "pain002."+name+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, buf.Bytes(), 0644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), buf.String())
+		})
+	}
+}
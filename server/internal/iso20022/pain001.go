@@ -0,0 +1,309 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	Pain001Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"
+	Pain001Name      = "pain.001.001.03"
+)
+
+// Pain001 客戶轉帳指示(CstmrCdtTrfInitn), 只解析執行轉帳需要的欄位
+type Pain001 struct {
+	XMLName      xml.Name      `xml:"Document"`
+	GroupHeader  GroupHeader   `xml:"CstmrCdtTrfInitn>GrpHdr"`
+	PaymentInfos []PaymentInfo `xml:"CstmrCdtTrfInitn>PmtInf"`
+}
+
+type GroupHeader struct {
+	MessageID            string `xml:"MsgId"`
+	CreatedAt            string `xml:"CreDtTm"`
+	NumberOfTransactions string `xml:"NbOfTxs"`
+	ControlSum           string `xml:"CtrlSum"`
+	InitiatingParty      string `xml:"InitgPty>Nm"`
+}
+
+// PaymentInfo 同一個扣款帳戶與執行日的一組付款
+type PaymentInfo struct {
+	ID                   string           `xml:"PmtInfId"`
+	Method               string           `xml:"PmtMtd"`
+	NumberOfTransactions string           `xml:"NbOfTxs"`
+	ControlSum           string           `xml:"CtrlSum"`
+	ExecutionDate        string           `xml:"ReqdExctnDt"`
+	Debtor               string           `xml:"Dbtr>Nm"`
+	DebtorAccount        Account          `xml:"DbtrAcct"`
+	Transactions         []CreditTransfer `xml:"CdtTrfTxInf"`
+}
+
+// Account 帳號為IBAN或Othr/Id, 本行帳戶以Othr/Id帶帳戶ID
+type Account struct {
+	IBAN  string `xml:"Id>IBAN"`
+	Other string `xml:"Id>Othr>Id"`
+}
+
+type CreditTransfer struct {
+	InstructionID   string   `xml:"PmtId>InstrId"`
+	EndToEndID      string   `xml:"PmtId>EndToEndId"`
+	Amount          *Amount  `xml:"Amt>InstdAmt"`
+	Creditor        string   `xml:"Cdtr>Nm"`
+	CreditorAccount Account  `xml:"CdtrAcct"`
+	Remittance      []string `xml:"RmtInf>Ustrd"`
+}
+
+type Amount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// ParsePain001 解析XML, 格式錯誤或不是pain.001.001.03時回傳ErrInvalidRequest
+// 欄位規則由Validate檢查
+func ParsePain001(r io.Reader) (*Pain001, error) {
+	var message Pain001
+	if err := xml.NewDecoder(r).Decode(&message); err != nil {
+		return nil, model.NewError(model.ErrInvalidRequest, fmt.Sprintf("malformed XML: %s", err.Error()))
+	}
+	if message.XMLName.Space != Pain001Namespace {
+		return nil, model.NewError(model.ErrInvalidRequest,
+			fmt.Sprintf("unsupported message %q, expected %s", message.XMLName.Space, Pain001Namespace))
+	}
+	return &message, nil
+}
+
+// Problem 不符合規則的欄位, Code為pain.002的原因代碼
+type Problem struct {
+	Code    string
+	Message string
+}
+
+// ValidationError 檔案不符合規則, 整份退回不執行任何付款
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		messages[i] = p.Message
+	}
+	return "invalid pain.001: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return model.ErrInvalidRequest
+}
+
+// Code 第一個問題的原因代碼
+func (e *ValidationError) Code() string {
+	return e.Problems[0].Code
+}
+
+var (
+	numericText = regexp.MustCompile(`^[0-9]{1,15}$`)
+	currency    = regexp.MustCompile(`^[A-Z]{3}$`)
+	// amount ActiveOrHistoricCurrencyAndAmount: 最多18位數, 小數最多5位
+	amount     = regexp.MustCompile(`^[0-9]{1,18}(\.[0-9]{1,5})?$`)
+	controlSum = regexp.MustCompile(`^[0-9]{1,18}(\.[0-9]{1,17})?$`)
+)
+
+// Validate 依pain.001.001.03的schema檢查我們需要的欄位
+// 必填欄位、長度、格式, NbOfTxs與CtrlSum需與實際內容一致, 只支援轉帳(TRF)與InstdAmt
+func (m *Pain001) Validate() error {
+	v := &validator{}
+	header := m.GroupHeader
+	v.text("GrpHdr/MsgId", header.MessageID, 35)
+	v.dateTime("GrpHdr/CreDtTm", header.CreatedAt)
+
+	count, sum := 0, decimal.Zero
+	if len(m.PaymentInfos) == 0 {
+		v.fail(ReasonInvalidFileFormat, "PmtInf is required")
+	}
+	ids := make(map[string]bool)
+	for i, info := range m.PaymentInfos {
+		path := fmt.Sprintf("PmtInf[%d]", i)
+		v.text(path+"/PmtInfId", info.ID, 35)
+		if ids[info.ID] {
+			v.fail(ReasonInvalidFileFormat, fmt.Sprintf("%s/PmtInfId %q is duplicated", path, info.ID))
+		}
+		ids[info.ID] = true
+		if info.Method != "TRF" {
+			v.fail(ReasonInvalidFileFormat, fmt.Sprintf("%s/PmtMtd must be TRF", path))
+		}
+		v.date(path+"/ReqdExctnDt", info.ExecutionDate)
+		v.account(path+"/DbtrAcct", info.DebtorAccount)
+		if len(info.Transactions) == 0 {
+			v.fail(ReasonInvalidFileFormat, path+"/CdtTrfTxInf is required")
+		}
+
+		infoSum := decimal.Zero
+		for j, transfer := range info.Transactions {
+			txPath := fmt.Sprintf("%s/CdtTrfTxInf[%d]", path, j)
+			if transfer.InstructionID != "" {
+				v.text(txPath+"/PmtId/InstrId", transfer.InstructionID, 35)
+			}
+			v.text(txPath+"/PmtId/EndToEndId", transfer.EndToEndID, 35)
+			infoSum = infoSum.Add(v.amount(txPath+"/Amt/InstdAmt", transfer.Amount))
+			v.account(txPath+"/CdtrAcct", transfer.CreditorAccount)
+			for _, line := range transfer.Remittance {
+				v.text(txPath+"/RmtInf/Ustrd", line, 140)
+			}
+		}
+		v.totals(path, info.NumberOfTransactions, info.ControlSum, len(info.Transactions), infoSum)
+		count += len(info.Transactions)
+		sum = sum.Add(infoSum)
+	}
+	if count > model.MaxBatchTransfers {
+		v.fail(ReasonInvalidNumberOfTransactions, fmt.Sprintf("file cannot contain more than %d transactions", model.MaxBatchTransfers))
+	}
+	v.required("GrpHdr/NbOfTxs", header.NumberOfTransactions)
+	v.totals("GrpHdr", header.NumberOfTransactions, header.ControlSum, count, sum)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// Count 所有付款的筆數
+func (m *Pain001) Count() int {
+	count := 0
+	for _, info := range m.PaymentInfos {
+		count += len(info.Transactions)
+	}
+	return count
+}
+
+// AccountID 本行帳戶ID, 只接受Othr/Id為正整數
+func (a Account) AccountID() (uint64, error) {
+	if a.Other == "" {
+		return 0, fmt.Errorf("account %s is not held with us, only Othr/Id with the account ID is supported", a.IBAN)
+	}
+	id, err := strconv.ParseUint(a.Other, 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("account %q is not a valid account ID", a.Other)
+	}
+	return id, nil
+}
+
+// String 檔案中的帳號
+func (a Account) String() string {
+	if a.Other != "" {
+		return a.Other
+	}
+	return a.IBAN
+}
+
+// ExecutionDay 指定的執行日, 格式已由Validate檢查
+func (p PaymentInfo) ExecutionDay() time.Time {
+	day, _ := time.ParseInLocation(dateLayout, p.ExecutionDate, time.Local)
+	return day
+}
+
+// Description 付款附言, 多行以空白串接; 沒有時以EndToEndId作為描述
+func (t CreditTransfer) Description() string {
+	if len(t.Remittance) > 0 {
+		return strings.Join(t.Remittance, " ")
+	}
+	return "Payment " + t.EndToEndID
+}
+
+const dateLayout = "2006-01-02"
+
+// validator 收集所有問題, 一次回報
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) fail(code, message string) {
+	v.problems = append(v.problems, Problem{Code: code, Message: message})
+}
+
+func (v *validator) required(path, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.fail(ReasonInvalidFileFormat, path+" is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) text(path, value string, max int) {
+	if v.required(path, value) && len([]rune(value)) > max {
+		v.fail(ReasonInvalidFileFormat, fmt.Sprintf("%s exceeds %d characters", path, max))
+	}
+}
+
+func (v *validator) date(path, value string) {
+	if !v.required(path, value) {
+		return
+	}
+	if _, err := time.Parse(dateLayout, value); err != nil {
+		v.fail(ReasonInvalidFileFormat, path+" must be an ISO date (YYYY-MM-DD)")
+	}
+}
+
+// dateTime ISODateTime, 時區可省略
+func (v *validator) dateTime(path, value string) {
+	if !v.required(path, value) {
+		return
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if _, err := time.Parse(layout, value); err == nil {
+			return
+		}
+	}
+	v.fail(ReasonInvalidFileFormat, path+" must be an ISO date time")
+}
+
+func (v *validator) account(path string, account Account) {
+	if account.IBAN == "" && account.Other == "" {
+		v.fail(ReasonInvalidFileFormat, path+"/Id is required")
+	}
+}
+
+// amount 回傳金額供加總, 格式錯誤時為zero
+func (v *validator) amount(path string, a *Amount) decimal.Decimal {
+	if a == nil {
+		v.fail(ReasonInvalidFileFormat, path+" is required, EqvtAmt is not supported")
+		return decimal.Zero
+	}
+	if !currency.MatchString(a.Currency) {
+		v.fail(ReasonInvalidFileFormat, path+"/@Ccy must be a 3-letter currency code")
+	}
+	value := strings.TrimSpace(a.Value)
+	if !amount.MatchString(value) || len(strings.Replace(value, ".", "", 1)) > 18 {
+		v.fail(ReasonInvalidFileFormat, fmt.Sprintf("%s %q is not a valid amount", path, a.Value))
+		return decimal.Zero
+	}
+	d := decimal.RequireFromString(value)
+	if !d.IsPositive() {
+		v.fail(ReasonInvalidFileFormat, path+" must be greater than 0")
+	}
+	return d
+}
+
+// totals NbOfTxs與CtrlSum(選填)需與實際內容一致
+func (v *validator) totals(path, numberOfTransactions, sum string, count int, actual decimal.Decimal) {
+	if numberOfTransactions != "" {
+		if !numericText.MatchString(numberOfTransactions) {
+			v.fail(ReasonInvalidFileFormat, path+"/NbOfTxs must be numeric")
+		} else if n, _ := strconv.Atoi(numberOfTransactions); n != count {
+			v.fail(ReasonInvalidNumberOfTransactions, fmt.Sprintf("%s/NbOfTxs is %s, found %d transactions", path, numberOfTransactions, count))
+		}
+	}
+	if sum != "" {
+		if !controlSum.MatchString(sum) {
+			v.fail(ReasonInvalidFileFormat, path+"/CtrlSum is not a valid decimal")
+		} else if !decimal.RequireFromString(sum).Equal(actual) {
+			v.fail(ReasonInvalidControlSum, fmt.Sprintf("%s/CtrlSum is %s, transactions sum to %s", path, sum, actual.String()))
+		}
+	}
+}
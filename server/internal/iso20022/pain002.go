@@ -0,0 +1,166 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+const Pain002Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.002.001.03"
+
+// pain.002的原因代碼(ExternalStatusReason1Code)
+const (
+	ReasonInvalidFileFormat           = "FF01"
+	ReasonDuplicateMessage            = "DU01"
+	ReasonInvalidNumberOfTransactions = "AM18"
+	ReasonInvalidControlSum           = "AM10"
+	ReasonIncorrectAccount            = "AC01"
+	ReasonInvalidDebtorAccount        = "AC02"
+	ReasonInvalidCreditorAccount      = "AC03"
+	ReasonClosedAccount               = "AC04"
+	ReasonBlockedAccount              = "AC06"
+	ReasonNotAllowedAmount            = "AM02"
+	ReasonNotAllowedCurrency          = "AM03"
+	ReasonInsufficientFunds           = "AM04"
+	ReasonInvalidAmount               = "AM12"
+	ReasonExecutionDateInFuture       = "CH03"
+	ReasonTransactionForbidden        = "AG01"
+	ReasonNarrative                   = "NARR"
+)
+
+// maxAdditionalInfo StsRsnInf/AddtlInf為Max105Text
+const maxAdditionalInfo = 105
+
+type pain002Document struct {
+	XMLName     xml.Name              `xml:"Document"`
+	Namespace   string                `xml:"xmlns,attr"`
+	Header      pain002GroupHeader    `xml:"CstmrPmtStsRpt>GrpHdr"`
+	Group       pain002GroupStatus    `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts"`
+	PaymentInfo []pain002PaymentInfos `xml:"CstmrPmtStsRpt>OrgnlPmtInfAndSts"`
+}
+
+type pain002GroupHeader struct {
+	MessageID string `xml:"MsgId"`
+	CreatedAt string `xml:"CreDtTm"`
+	BIC       string `xml:"DbtrAgt>FinInstnId>BIC,omitempty"`
+}
+
+type pain002Reason struct {
+	Code           string   `xml:"Rsn>Cd"`
+	AdditionalInfo []string `xml:"AddtlInf,omitempty"`
+}
+
+type pain002GroupStatus struct {
+	MessageID            string          `xml:"OrgnlMsgId"`
+	MessageName          string          `xml:"OrgnlMsgNmId"`
+	NumberOfTransactions int             `xml:"OrgnlNbOfTxs"`
+	ControlSum           string          `xml:"OrgnlCtrlSum,omitempty"`
+	Status               string          `xml:"GrpSts"`
+	Reason               *pain002Reason  `xml:"StsRsnInf,omitempty"`
+	PerStatus            []pain002Counts `xml:"NbOfTxsPerSts,omitempty"`
+}
+
+type pain002Counts struct {
+	Count  int    `xml:"DtldNbOfTxs"`
+	Status string `xml:"DtldSts"`
+}
+
+type pain002PaymentInfos struct {
+	ID           string               `xml:"OrgnlPmtInfId"`
+	Status       string               `xml:"PmtInfSts"`
+	Transactions []pain002Transaction `xml:"TxInfAndSts"`
+}
+
+type pain002Transaction struct {
+	InstructionID string         `xml:"OrgnlInstrId,omitempty"`
+	EndToEndID    string         `xml:"OrgnlEndToEndId"`
+	Status        string         `xml:"TxSts"`
+	Reason        *pain002Reason `xml:"StsRsnInf,omitempty"`
+	Reference     string         `xml:"AcctSvcrRef,omitempty"`
+}
+
+// Options pain.002的產生時間與本行BIC(空字串代表不帶)
+type Options struct {
+	BIC         string
+	GeneratedAt time.Time
+}
+
+// WritePain002 依匯入結果產生pain.002.001.03付款狀態報告
+// 每筆付款回報ACSC或RJCT與原因代碼, 成功的AcctSvcrRef為入帳的交易ID
+func WritePain002(w io.Writer, result *model.PaymentImport, opts Options) error {
+	document := pain002Document{
+		Namespace: Pain002Namespace,
+		Header: pain002GroupHeader{
+			MessageID: "STS-" + opts.GeneratedAt.Format("20060102150405.000000"),
+			CreatedAt: opts.GeneratedAt.Format(time.RFC3339),
+			BIC:       opts.BIC,
+		},
+		Group: pain002GroupStatus{
+			MessageID:            result.MessageID,
+			MessageName:          Pain001Name,
+			NumberOfTransactions: result.NumberOfTransactions,
+			Status:               string(result.Status),
+			Reason:               newPain002Reason(result.Reason, result.Messages...),
+		},
+	}
+	// 整份退回時不一定能計算合計
+	if !result.ControlSum.IsZero() {
+		document.Group.ControlSum = result.ControlSum.String()
+	}
+	if result.Settled > 0 {
+		document.Group.PerStatus = append(document.Group.PerStatus, pain002Counts{Count: result.Settled, Status: string(model.PaymentStatusSettled)})
+	}
+	if result.Rejected > 0 {
+		document.Group.PerStatus = append(document.Group.PerStatus, pain002Counts{Count: result.Rejected, Status: string(model.PaymentStatusRejected)})
+	}
+
+	for _, info := range result.PaymentInfos {
+		infos := pain002PaymentInfos{ID: info.ID, Status: string(info.Status)}
+		for _, payment := range info.Payments {
+			transaction := pain002Transaction{
+				InstructionID: payment.InstructionID,
+				EndToEndID:    payment.EndToEndID,
+				Status:        string(payment.Status),
+				Reason:        newPain002Reason(payment.Reason, payment.Message),
+			}
+			if payment.Transaction != nil {
+				transaction.Reference = strconv.FormatUint(payment.Transaction.ID, 10)
+			}
+			infos.Transactions = append(infos.Transactions, transaction)
+		}
+		document.PaymentInfo = append(document.PaymentInfo, infos)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// newPain002Reason 沒有原因代碼時不帶StsRsnInf, 說明依Max105Text截斷
+func newPain002Reason(code string, messages ...string) *pain002Reason {
+	if code == "" {
+		return nil
+	}
+	reason := &pain002Reason{Code: code}
+	for _, message := range messages {
+		if message == "" {
+			continue
+		}
+		runes := []rune(message)
+		if len(runes) > maxAdditionalInfo {
+			runes = runes[:maxAdditionalInfo]
+		}
+		reason.AdditionalInfo = append(reason.AdditionalInfo, string(runes))
+	}
+	return reason
+}
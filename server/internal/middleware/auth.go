@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/kokp520/banking-system/server/pkg/response"
+	"go.uber.org/zap"
+)
+
+const bearerPrefix = "Bearer "
+
+// UserStore Auth依token的使用者ID讀取目前的角色
+type UserStore interface {
+	GetUserByID(id uint64) (*model.User, error)
+}
+
+// Auth 驗證Authorization: Bearer <token>, 通過後將呼叫者放入request context
+// 沒有token, token無效或使用者已不存在時回傳401
+// 角色每個請求由users讀取, 變更角色後已簽發的token立即套用新角色
+func Auth(jwt *auth.JWT, users UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+			unauthorized(c, "missing bearer token")
+			return
+		}
+
+		claims, err := jwt.Verify(strings.TrimSpace(header[len(bearerPrefix):]))
+		if err != nil {
+			logger.WithTraceID(c.Request.Context()).Warn("invalid access token", zap.Error(err))
+			unauthorized(c, err.Error())
+			return
+		}
+		principal, err := claims.Principal()
+		if err != nil {
+			unauthorized(c, err.Error())
+			return
+		}
+		user, err := users.GetUserByID(principal.UserID)
+		if errors.Is(err, model.ErrUserNotFound) {
+			unauthorized(c, "user no longer exists")
+			return
+		}
+		if err != nil {
+			logger.WithTraceID(c.Request.Context()).Error("failed to load user", zap.Error(err), zap.Uint64("userId", principal.UserID))
+			response.InternalError(c, "failed to load user")
+			c.Abort()
+			return
+		}
+		// 新增角色前建立的使用者沒有角色, 視為customer
+		principal.Role = user.Role
+		if principal.Role == "" {
+			principal.Role = model.RoleCustomer
+		}
+
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="banking"`)
+	response.Error(c, http.StatusUnauthorized, response.Unauthorized, message)
+	c.Abort()
+}
+
+// Require 呼叫者的角色需有permission, 否則回傳403
+// 這裡只檢查角色, 只限自己帳戶(ScopeOwn)的授權由service依帳戶擁有者檢查
+func Require(permission auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.PrincipalFrom(c.Request.Context())
+		if !ok {
+			unauthorized(c, "missing bearer token")
+			return
+		}
+		if auth.Evaluate(principal, permission) == auth.ScopeNone {
+			logger.WithTraceID(c.Request.Context()).Warn("access denied",
+				zap.Uint64("userId", principal.UserID),
+				zap.String("role", string(principal.Role)),
+				zap.String("permission", string(permission)),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.FullPath()),
+			)
+			response.Error(c, http.StatusForbidden, response.Forbidden,
+				"role "+string(principal.Role)+" is not allowed to "+string(permission))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
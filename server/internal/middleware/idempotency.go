@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/kokp520/banking-system/server/pkg/response"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+	ClientIDHeader            = "Client-Id"
+)
+
+// responseRecorder 保留寫出的body, 請求結束後存入IdempotencyStore
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Idempotency 帶有Idempotency-Key的請求只會執行一次
+// 同一個client(登入的使用者, 其次Client-Id header, 沒有則用client ip)同一個key:
+//   - 第一次: 執行handler並保存回應, 5xx或panic不保存讓client可以重試
+//   - 重試且payload相同: 直接重放保存的回應
+//   - payload不同: 422
+//   - 第一次還在處理中: 409
+func Idempotency(store storage.IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		body, err := c.GetRawData()
+		if err != nil {
+			response.BadRequest(c, "failed to read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := clientScope(c)
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		log := logger.WithTraceID(c.Request.Context()).With(
+			zap.String("idempotencyKey", key),
+			zap.String("scope", scope),
+		)
+
+		record, err := store.Begin(scope, key, fingerprint, ttl)
+		switch {
+		case errors.Is(err, storage.ErrIdempotencyKeyMismatch):
+			log.Warn("idempotency key reused with different payload")
+			response.Result(c, http.StatusUnprocessableEntity, response.IdempotencyMismatch, nil)
+			c.Abort()
+			return
+		case errors.Is(err, storage.ErrIdempotencyKeyInProgress):
+			response.Result(c, http.StatusConflict, response.RequestInProgress, nil)
+			c.Abort()
+			return
+		case err != nil:
+			log.Error("failed to begin idempotent request", zap.Error(err))
+			response.InternalError(c, err.Error())
+			c.Abort()
+			return
+		}
+
+		if record != nil {
+			log.Info("replay idempotent response", zap.Int("status", record.StatusCode))
+			c.Header(IdempotencyReplayedHeader, "true")
+			c.Data(record.StatusCode, "application/json; charset=utf-8", record.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		release := func() {
+			if err := store.Release(scope, key); err != nil {
+				log.Error("failed to release idempotency key", zap.Error(err))
+			}
+		}
+		// handler panic時c.Next不會返回, 先放掉key讓client可以重試, 再交給上層Recovery
+		finished := false
+		defer func() {
+			if !finished {
+				log.Error("request panicked, idempotency key released")
+				release()
+			}
+		}()
+
+		c.Next()
+		finished = true
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			release()
+			return
+		}
+
+		if err := store.Complete(scope, key, status, recorder.body.Bytes()); err != nil {
+			log.Error("failed to save idempotent response", zap.Error(err))
+		}
+	}
+}
+
+// clientScope idempotency key的隔離範圍
+func clientScope(c *gin.Context) string {
+	if principal, ok := auth.PrincipalFrom(c.Request.Context()); ok {
+		return "user:" + strconv.FormatUint(principal.UserID, 10)
+	}
+	if clientID := c.GetHeader(ClientIDHeader); clientID != "" {
+		return "client:" + clientID
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -2,25 +2,203 @@ package model
 
 import (
 	"encoding/json"
-	"github.com/shopspring/decimal"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// AccountStatus 帳戶狀態
+// active: 正常; frozen: 只能入帳不能轉出; closed: 拒絕所有交易, 不可再變更
+type AccountStatus string
+
+const (
+	AccountStatusActive AccountStatus = "active"
+	AccountStatusFrozen AccountStatus = "frozen"
+	AccountStatusClosed AccountStatus = "closed"
 )
 
+// accountTransitions 允許的狀態轉換
+var accountTransitions = map[AccountStatus][]AccountStatus{
+	AccountStatusActive: {AccountStatusFrozen, AccountStatusClosed},
+	AccountStatusFrozen: {AccountStatusActive, AccountStatusClosed},
+}
+
 type Account struct {
-	ID        uint64          `json:"id"`         // autoincr
-	Name      string          `json:"name"`       // 用戶名
-	Balance   decimal.Decimal `json:"balance"`    // 餘額
-	CreatedAt time.Time       `json:"created_at"` // 創建時間
-	UpdatedAt time.Time       `json:"updated_at"` // 最近更新時間
+	ID           uint64          `json:"id"`                      // autoincr
+	Name         string          `json:"name"`                    // 用戶名
+	OwnerID      uint64          `json:"owner_id"`                // 持有帳戶的使用者, 0為啟用登入前開立的帳戶
+	Balance      decimal.Decimal `json:"balance"`                 // 餘額
+	Currency     string          `json:"currency"`                // ISO 4217幣別, 開戶後不可變更
+	Status       AccountStatus   `json:"status"`                  // 帳戶狀態
+	StatusReason string          `json:"status_reason,omitempty"` // 最近一次狀態變更原因
+	CreatedAt    time.Time       `json:"created_at"`              // 創建時間
+	UpdatedAt    time.Time       `json:"updated_at"`              // 最近更新時間
+	// OverdraftLimit 可透支額度, 餘額最低可到 -OverdraftLimit
+	OverdraftLimit decimal.Decimal `json:"overdraft_limit"`
+	// Tier 帳戶等級, 決定預設限額; Limits 帳戶個別的限額, 覆蓋等級設定
+	Tier   string  `json:"tier"`
+	Limits *Limits `json:"limits,omitempty"`
+	// Product 計息產品; AccruedInterest 已計提未入帳的利息, 保留InterestPrecision位不捨入
+	// AccruedThrough 已計息到哪一天(含), zero代表未曾指定產品
+	Product         string          `json:"product,omitempty"`
+	AccruedInterest decimal.Decimal `json:"accrued_interest"`
+	AccruedThrough  time.Time       `json:"-"`
+	// Held 有效預授權的圈存合計, 讀取時由storage計算, 不落地
+	Held decimal.Decimal `json:"held_balance"`
+}
+
+// CurrencyInfo 帳戶幣別, 舊資料沒有幣別時為DefaultCurrency
+func (a *Account) CurrencyInfo() Currency {
+	return currencyOf(a.Currency)
+}
+
+// AvailableBalance 可用餘額, 帳上餘額加上透支額度再扣除預授權圈存
+func (a *Account) AvailableBalance() decimal.Decimal {
+	return a.Balance.Add(a.OverdraftLimit).Sub(a.Held)
+}
+
+// OverdraftUsed 已動用的透支金額, 餘額為負時才有
+func (a *Account) OverdraftUsed() decimal.Decimal {
+	if a.Balance.IsNegative() {
+		return a.Balance.Neg()
+	}
+	return decimal.Zero
+}
+
+// SetOverdraftLimit 透支額度不可為負數且需符合幣別精度
+// 調降到低於已動用金額是允許的, 之後只是不能再扣款直到餘額回升
+func (a *Account) SetOverdraftLimit(limit decimal.Decimal) error {
+	if limit.IsNegative() {
+		return NewError(ErrInvalidAmount, "overdraft limit cannot be negative")
+	}
+	if err := a.CurrencyInfo().CheckAmount(limit); err != nil {
+		return err
+	}
+	if err := a.CheckCredit(); err != nil {
+		return err
+	}
+	a.OverdraftLimit = limit
+	a.UpdatedAt = time.Now()
+	return nil
 }
 
+// CurrentTier 沒有指定等級時為DefaultTier
+func (a *Account) CurrentTier() string {
+	if a.Tier == "" {
+		return DefaultTier
+	}
+	return a.Tier
+}
+
+// CurrentStatus 舊資料沒有status時視為active
+func (a *Account) CurrentStatus() AccountStatus {
+	if a.Status == "" {
+		return AccountStatusActive
+	}
+	return a.Status
+}
+
+// CheckDebit 帳戶可否提款/轉出, 只有active可以
+func (a *Account) CheckDebit() error {
+	switch a.CurrentStatus() {
+	case AccountStatusFrozen:
+		return NewError(ErrAccountFrozen, fmt.Sprintf("account %d is frozen", a.ID))
+	case AccountStatusClosed:
+		return NewError(ErrAccountClosed, fmt.Sprintf("account %d is closed", a.ID))
+	}
+	return nil
+}
+
+// CheckCredit 帳戶可否入帳, frozen仍可入帳
+func (a *Account) CheckCredit() error {
+	if a.CurrentStatus() == AccountStatusClosed {
+		return NewError(ErrAccountClosed, fmt.Sprintf("account %d is closed", a.ID))
+	}
+	return nil
+}
+
+// Transition 驗證並套用狀態轉換, 結清需要餘額為0且沒有未入帳的利息
+func (a *Account) Transition(to AccountStatus, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return NewError(ErrInvalidRequest, "reason is required")
+	}
+
+	from := a.CurrentStatus()
+	allowed := false
+	for _, next := range accountTransitions[from] {
+		if next == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return NewError(ErrInvalidStatusTransition, fmt.Sprintf("cannot change account status from %s to %s", from, to))
+	}
+	if to == AccountStatusClosed && !a.Balance.IsZero() {
+		return NewError(ErrBalanceNotZero, fmt.Sprintf("account balance must be zero to close, current balance %s", a.Balance.String()))
+	}
+	// closed帳戶月底不再入帳, 未入帳的利息需等入帳提領後才能結清; 不足幣別最小單位的餘數本來就不會入帳
+	if accrued := a.AccruedInterest.Truncate(a.CurrencyInfo().MinorUnits); to == AccountStatusClosed && accrued.IsPositive() {
+		return NewError(ErrBalanceNotZero, fmt.Sprintf("account has accrued interest %s not yet posted, close after it is posted and withdrawn", accrued.String()))
+	}
+
+	a.Status = to
+	a.StatusReason = reason
+	a.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetLimits 調整帳戶等級與個別限額, tier空字串代表維持目前等級, limits為nil代表全部沿用等級設定
+func (a *Account) SetLimits(tier string, limits *Limits) error {
+	if limits != nil {
+		if err := limits.Validate(a.CurrencyInfo()); err != nil {
+			return err
+		}
+	}
+	if err := a.CheckCredit(); err != nil {
+		return err
+	}
+	if tier != "" {
+		a.Tier = tier
+	}
+	a.Limits = limits
+	a.UpdatedAt = time.Now()
+	return nil
+}
+
+// MarshalJSON 餘額依幣別小數位數輸出
 func (a Account) MarshalJSON() ([]byte, error) {
 	type Alias Account
+	currency := a.CurrencyInfo()
 	return json.Marshal(&struct {
-		Balance string `json:"balance"`
+		Balance          string `json:"balance"`
+		AvailableBalance string `json:"available_balance"`
+		Held             string `json:"held_balance"`
+		OverdraftLimit   string `json:"overdraft_limit"`
+		OverdraftUsed    string `json:"overdraft_used"`
+		Currency         string `json:"currency"`
+		Tier             string `json:"tier"`
+		AccruedThrough   string `json:"accrued_through,omitempty"`
 		*Alias
 	}{
-		Balance: a.Balance.StringFixed(2),
-		Alias:   (*Alias)(&a),
+		Balance:          currency.Format(a.Balance),
+		AvailableBalance: currency.Format(a.AvailableBalance()),
+		Held:             currency.Format(a.Held),
+		OverdraftLimit:   currency.Format(a.OverdraftLimit),
+		OverdraftUsed:    currency.Format(a.OverdraftUsed()),
+		Currency:         currency.Code,
+		Tier:             a.CurrentTier(),
+		AccruedThrough:   optionalDate(a.AccruedThrough),
+		Alias:            (*Alias)(&a),
 	})
 }
+
+// optionalDate zero time輸出空字串
+func optionalDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxBatchTransfers 單一批次的轉帳筆數上限
+const MaxBatchTransfers = 1000
+
+// BatchMode 批次轉帳的執行方式
+// atomic: 全部成功或全部不異動
+// best_effort: 逐筆執行, 各筆成功與否互不影響
+type BatchMode string
+
+const (
+	BatchModeAtomic     BatchMode = "atomic"
+	BatchModeBestEffort BatchMode = "best_effort"
+)
+
+// ParseBatchMode 空字串為atomic
+func ParseBatchMode(mode string) (BatchMode, error) {
+	switch BatchMode(strings.ToLower(mode)) {
+	case "", BatchModeAtomic:
+		return BatchModeAtomic, nil
+	case BatchModeBestEffort:
+		return BatchModeBestEffort, nil
+	}
+	return "", NewError(ErrInvalidRequest, fmt.Sprintf("unknown batch mode %q, must be atomic or best_effort", mode))
+}
+
+// BatchError 批次中第Index筆(由0開始)失敗, errors.Is可判斷原因的分類
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func NewBatchError(index int, err error) *BatchError {
+	return &BatchError{Index: index, Err: err}
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("transfer %d: %s", e.Index, e.Err.Error())
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+type BatchItemStatus string
+
+const (
+	BatchItemSucceeded BatchItemStatus = "succeeded"
+	BatchItemFailed    BatchItemStatus = "failed"
+)
+
+// BatchItemError 單筆失敗原因, Code為API錯誤碼, 由handler依Err填入
+type BatchItemError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchItemResult 單筆轉帳結果, 成功時帶入帳的交易
+type BatchItemResult struct {
+	Index       int             `json:"index"`
+	Status      BatchItemStatus `json:"status"`
+	Transaction *Transaction    `json:"transaction,omitempty"`
+	Error       *BatchItemError `json:"error,omitempty"`
+	Err         error           `json:"-"`
+}
+
+// BatchTransferResult 各筆結果依請求順序
+type BatchTransferResult struct {
+	Mode      BatchMode         `json:"mode"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Items     []BatchItemResult `json:"items"`
+}
+
+// Add 依序加入一筆結果
+func (r *BatchTransferResult) Add(transaction *Transaction, err error) {
+	item := BatchItemResult{Index: len(r.Items), Status: BatchItemSucceeded, Transaction: transaction}
+	if err != nil {
+		item.Status, item.Transaction, item.Err = BatchItemFailed, nil, err
+		r.Failed++
+	} else {
+		r.Succeeded++
+	}
+	r.Items = append(r.Items, item)
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultCurrency 未指定幣別的帳戶(含舊資料)
+const DefaultCurrency = "TWD"
+
+// Currency ISO 4217幣別, MinorUnits為小數位數
+type Currency struct {
+	Code       string `json:"code"`
+	MinorUnits int32  `json:"minor_units"`
+}
+
+// currencies 支援的幣別
+var currencies = map[string]Currency{
+	"TWD": {Code: "TWD", MinorUnits: 2},
+	"USD": {Code: "USD", MinorUnits: 2},
+	"EUR": {Code: "EUR", MinorUnits: 2},
+	"GBP": {Code: "GBP", MinorUnits: 2},
+	"CNY": {Code: "CNY", MinorUnits: 2},
+	"HKD": {Code: "HKD", MinorUnits: 2},
+	"SGD": {Code: "SGD", MinorUnits: 2},
+	"AUD": {Code: "AUD", MinorUnits: 2},
+	"JPY": {Code: "JPY", MinorUnits: 0},
+	"KRW": {Code: "KRW", MinorUnits: 0},
+	"KWD": {Code: "KWD", MinorUnits: 3},
+	"BHD": {Code: "BHD", MinorUnits: 3},
+}
+
+// LookupCurrency code不分大小寫, 空字串視為DefaultCurrency
+func LookupCurrency(code string) (Currency, error) {
+	if code == "" {
+		code = DefaultCurrency
+	}
+	currency, ok := currencies[strings.ToUpper(code)]
+	if !ok {
+		return Currency{}, NewError(ErrUnsupportedCurrency, fmt.Sprintf("unsupported currency: %s", code))
+	}
+	return currency, nil
+}
+
+// currencyOf 已存在的資料只會是支援的幣別, 查不到時退回DefaultCurrency的精度
+func currencyOf(code string) Currency {
+	currency, err := LookupCurrency(code)
+	if err != nil {
+		return currencies[DefaultCurrency]
+	}
+	return currency
+}
+
+// CheckAmount 金額小數位數不能超過幣別的minor units, e.g. JPY不能有小數
+func (c Currency) CheckAmount(amount decimal.Decimal) error {
+	if !amount.Equal(amount.Truncate(c.MinorUnits)) {
+		return NewError(ErrInvalidAmount, fmt.Sprintf("amount %s exceeds %s precision of %d decimal places", amount.String(), c.Code, c.MinorUnits))
+	}
+	return nil
+}
+
+// Format 依幣別小數位數輸出
+func (c Currency) Format(amount decimal.Decimal) string {
+	return amount.StringFixed(c.MinorUnits)
+}
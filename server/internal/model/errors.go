@@ -0,0 +1,59 @@
+package model
+
+import "errors"
+
+// 業務錯誤分類, storage / service 回傳, handler統一對應http status與錯誤碼
+// 以errors.Is判斷分類, 實際訊息可能更具體(e.g. "source account not found")
+var (
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrSameAccount         = errors.New("cannot transfer to the same account")
+	ErrInvalidRequest      = errors.New("invalid request")
+
+	ErrAccountFrozen           = errors.New("account is frozen")
+	ErrAccountClosed           = errors.New("account is closed")
+	ErrInvalidStatusTransition = errors.New("invalid account status transition")
+	ErrBalanceNotZero          = errors.New("account balance must be zero to close")
+
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrCurrencyMismatch    = errors.New("currency mismatch")
+
+	ErrFXRateUnavailable = errors.New("fx rate unavailable")
+	ErrQuoteNotFound     = errors.New("fx quote not found")
+	ErrQuoteExpired      = errors.New("fx quote expired")
+
+	ErrHoldNotFound  = errors.New("hold not found")
+	ErrHoldNotActive = errors.New("hold is not active")
+
+	ErrLimitExceeded = errors.New("transaction limit exceeded")
+
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrAlreadyReversed     = errors.New("transaction already reversed")
+
+	ErrStandingOrderNotFound  = errors.New("standing order not found")
+	ErrStandingOrderNotActive = errors.New("standing order is not active")
+
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrUsernameTaken = errors.New("username already taken")
+)
+
+// DomainError 帶分類的業務錯誤, Message為回給呼叫端的訊息
+type DomainError struct {
+	Kind    error
+	Message string
+}
+
+func NewError(kind error, message string) *DomainError {
+	return &DomainError{Kind: kind, Message: message}
+}
+
+func (e *DomainError) Error() string {
+	return e.Message
+}
+
+func (e *DomainError) Unwrap() error {
+	return e.Kind
+}
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// FeeType 手續費計算方式
+type FeeType string
+
+const (
+	FeeTypeFlat       FeeType = "flat"       // 每筆固定金額
+	FeeTypePercentage FeeType = "percentage" // 交易金額乘上費率
+	FeeTypeTiered     FeeType = "tiered"     // 依交易金額落在的級距, 固定金額加費率
+)
+
+// FeeOperations 可收手續費的操作
+var FeeOperations = []TransactionType{TransactionTypeWithdraw, TransactionTypeTransfer}
+
+// FeeTier 級距, UpTo為級距上限(含), nil代表沒有上限只能是最後一級
+type FeeTier struct {
+	UpTo   *decimal.Decimal `json:"up_to,omitempty"`
+	Amount decimal.Decimal  `json:"amount"`
+	Rate   decimal.Decimal  `json:"rate"`
+}
+
+// FeeSchedule 單一操作的手續費設定, 金額為帳戶幣別
+// Min/Max為計算後的上下限, nil代表不限制
+type FeeSchedule struct {
+	Operation TransactionType  `json:"operation"`
+	Type      FeeType          `json:"type"`
+	Amount    decimal.Decimal  `json:"amount"`
+	Rate      decimal.Decimal  `json:"rate"`
+	Tiers     []FeeTier        `json:"tiers,omitempty"`
+	Min       *decimal.Decimal `json:"min,omitempty"`
+	Max       *decimal.Decimal `json:"max,omitempty"`
+}
+
+// Validate 金額與費率不可為負數, 級距上限需遞增, 下限不可大於上限
+func (f FeeSchedule) Validate() error {
+	if !IsFeeOperation(f.Operation) {
+		return NewError(ErrInvalidRequest, fmt.Sprintf("fees are not supported for %s", f.Operation))
+	}
+	if f.Amount.IsNegative() || f.Rate.IsNegative() {
+		return NewError(ErrInvalidRequest, "fee amount and rate cannot be negative")
+	}
+	switch f.Type {
+	case FeeTypeFlat, FeeTypePercentage:
+	case FeeTypeTiered:
+		if len(f.Tiers) == 0 {
+			return NewError(ErrInvalidRequest, "tiered fee must have at least one tier")
+		}
+		for i, tier := range f.Tiers {
+			if tier.Amount.IsNegative() || tier.Rate.IsNegative() {
+				return NewError(ErrInvalidRequest, "fee amount and rate cannot be negative")
+			}
+			if tier.UpTo == nil {
+				if i != len(f.Tiers)-1 {
+					return NewError(ErrInvalidRequest, "only the last fee tier can be unbounded")
+				}
+				continue
+			}
+			if i > 0 && !tier.UpTo.GreaterThan(*f.Tiers[i-1].UpTo) {
+				return NewError(ErrInvalidRequest, "fee tiers must be in ascending order of up_to")
+			}
+		}
+	default:
+		return NewError(ErrInvalidRequest, fmt.Sprintf("unknown fee type %q, available types: flat, percentage, tiered", f.Type))
+	}
+	for _, limit := range []*decimal.Decimal{f.Min, f.Max} {
+		if limit != nil && limit.IsNegative() {
+			return NewError(ErrInvalidRequest, "fee min and max cannot be negative")
+		}
+	}
+	if f.Min != nil && f.Max != nil && f.Min.GreaterThan(*f.Max) {
+		return NewError(ErrInvalidRequest, "fee min cannot be greater than max")
+	}
+	return nil
+}
+
+// Compute 交易金額的手續費, 先套用上下限再四捨五入到幣別小數位數
+// 級距不是累進計算, 整筆金額套用所在級距; 超過所有級距上限時用最後一級
+func (f FeeSchedule) Compute(amount decimal.Decimal, currency Currency) decimal.Decimal {
+	var fee decimal.Decimal
+	switch f.Type {
+	case FeeTypeFlat:
+		fee = f.Amount
+	case FeeTypePercentage:
+		fee = amount.Mul(f.Rate)
+	case FeeTypeTiered:
+		tier := f.Tiers[len(f.Tiers)-1]
+		for _, t := range f.Tiers {
+			if t.UpTo == nil || amount.LessThanOrEqual(*t.UpTo) {
+				tier = t
+				break
+			}
+		}
+		fee = tier.Amount.Add(amount.Mul(tier.Rate))
+	}
+	if f.Min != nil && fee.LessThan(*f.Min) {
+		fee = *f.Min
+	}
+	if f.Max != nil && fee.GreaterThan(*f.Max) {
+		fee = *f.Max
+	}
+	return fee.Round(currency.MinorUnits)
+}
+
+// IsFeeOperation operation是否為可收手續費的操作
+func IsFeeOperation(operation TransactionType) bool {
+	for _, op := range FeeOperations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// FeeQuote 手續費試算, Total為扣款帳戶實際扣除的金額
+// Schedule為nil代表該操作不收費
+type FeeQuote struct {
+	AccountID uint64          `json:"account_id"`
+	Operation TransactionType `json:"operation"`
+	Amount    decimal.Decimal `json:"amount"`
+	Currency  string          `json:"currency"`
+	Fee       decimal.Decimal `json:"fee"`
+	Total     decimal.Decimal `json:"total"`
+	Schedule  *FeeSchedule    `json:"schedule,omitempty"`
+}
+
+// MarshalJSON 金額依幣別小數位數輸出
+func (q FeeQuote) MarshalJSON() ([]byte, error) {
+	type Alias FeeQuote
+	currency := currencyOf(q.Currency)
+	return json.Marshal(&struct {
+		Amount string `json:"amount"`
+		Fee    string `json:"fee"`
+		Total  string `json:"total"`
+		*Alias
+	}{
+		Amount: currency.Format(q.Amount),
+		Fee:    currency.Format(q.Fee),
+		Total:  currency.Format(q.Total),
+		Alias:  (*Alias)(&q),
+	})
+}
+
+// NewFee 手續費交易, 由扣款帳戶(ToAccountID)付給system:fees
+// FeeFor在主交易取得ID後由LinkFee設定
+func NewFee(accountID uint64, amount decimal.Decimal, currency string, operation TransactionType, traceID string) *Transaction {
+	return &Transaction{
+		Type:        TransactionTypeFee,
+		ToAccountID: accountID,
+		Amount:      amount,
+		Currency:    currency,
+		Description: fmt.Sprintf("Fee for %s", operation),
+		CreatedAt:   time.Now(),
+		TraceID:     traceID,
+	}
+}
+
+// FeeAmount 附加的手續費, 沒有手續費時為zero
+func (t *Transaction) FeeAmount() decimal.Decimal {
+	if t.Fee == nil {
+		return decimal.Zero
+	}
+	return t.Fee.Amount
+}
+
+// LinkFee 主交易取得ID後, 手續費交易指向主交易
+func (t *Transaction) LinkFee() {
+	if t.Fee == nil {
+		return
+	}
+	id := t.ID
+	t.Fee.FeeFor = &id
+}
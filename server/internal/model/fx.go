@@ -0,0 +1,126 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// RatePrecision 套用spread後的匯率保留小數位數
+const RatePrecision = 10
+
+// RoundingPolicy 換算後的轉入金額如何捨入到轉入幣別的小數位數
+type RoundingPolicy string
+
+const (
+	RoundDown     RoundingPolicy = "down"      // 無條件捨去, 不會多付給客戶
+	RoundHalfUp   RoundingPolicy = "half_up"   // 四捨五入
+	RoundHalfEven RoundingPolicy = "half_even" // 銀行家捨入
+)
+
+// ParseRoundingPolicy 空字串為RoundDown
+func ParseRoundingPolicy(policy string) (RoundingPolicy, error) {
+	switch RoundingPolicy(strings.ToLower(policy)) {
+	case "", RoundDown:
+		return RoundDown, nil
+	case RoundHalfUp:
+		return RoundHalfUp, nil
+	case RoundHalfEven:
+		return RoundHalfEven, nil
+	}
+	return "", fmt.Errorf("unknown rounding policy: %s", policy)
+}
+
+// Round 依policy捨入到places位小數
+func (p RoundingPolicy) Round(amount decimal.Decimal, places int32) decimal.Decimal {
+	switch p {
+	case RoundHalfUp:
+		return amount.Round(places)
+	case RoundHalfEven:
+		return amount.RoundBank(places)
+	default:
+		return amount.Truncate(places)
+	}
+}
+
+// FXRate 中間價, 1單位Base可換Rate單位Quote
+type FXRate struct {
+	Base      string          `json:"base"`
+	Quote     string          `json:"quote"`
+	Rate      decimal.Decimal `json:"rate"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// FXQuote 報價, 在ExpiresAt前可用於一次轉帳
+// Rate為套用spread後的成交匯率, DestinationAmount已依rounding捨入
+// 報價綁定申請的使用者與轉出帳戶, 只能由同一個使用者從該帳戶成交
+type FXQuote struct {
+	ID              string `json:"id"`
+	SourceAccountID uint64 `json:"source_account_id"`
+	// UserID 申請報價的使用者, 系統作業為0
+	UserID              uint64          `json:"-"`
+	SourceCurrency      string          `json:"source_currency"`
+	DestinationCurrency string          `json:"destination_currency"`
+	SourceAmount        decimal.Decimal `json:"source_amount"`
+	DestinationAmount   decimal.Decimal `json:"destination_amount"`
+	MidRate             decimal.Decimal `json:"mid_rate"`
+	Rate                decimal.Decimal `json:"rate"`
+	Spread              decimal.Decimal `json:"spread"`
+	Rounding            RoundingPolicy  `json:"rounding"`
+	ExpiresAt           time.Time       `json:"expires_at"`
+}
+
+// MarshalJSON 金額依各自幣別小數位數輸出
+func (q FXQuote) MarshalJSON() ([]byte, error) {
+	type Alias FXQuote
+	return json.Marshal(&struct {
+		SourceAmount      string `json:"source_amount"`
+		DestinationAmount string `json:"destination_amount"`
+		*Alias
+	}{
+		SourceAmount:      currencyOf(q.SourceCurrency).Format(q.SourceAmount),
+		DestinationAmount: currencyOf(q.DestinationCurrency).Format(q.DestinationAmount),
+		Alias:             (*Alias)(&q),
+	})
+}
+
+// Expired at時間點報價是否已失效
+func (q *FXQuote) Expired(at time.Time) bool {
+	return !at.Before(q.ExpiresAt)
+}
+
+// Conversion 報價成交後記錄在交易上的換匯資訊
+func (q *FXQuote) Conversion() *FXConversion {
+	return &FXConversion{
+		QuoteID:             q.ID,
+		DestinationAmount:   q.DestinationAmount,
+		DestinationCurrency: q.DestinationCurrency,
+		Rate:                q.Rate,
+		MidRate:             q.MidRate,
+	}
+}
+
+// FXConversion 跨幣別轉帳的換匯紀錄
+// 轉出金額/幣別即Transaction.Amount/Currency, 轉入帳戶入帳DestinationAmount
+type FXConversion struct {
+	QuoteID             string          `json:"quote_id"`
+	DestinationAmount   decimal.Decimal `json:"destination_amount"`
+	DestinationCurrency string          `json:"destination_currency"`
+	Rate                decimal.Decimal `json:"rate"`
+	MidRate             decimal.Decimal `json:"mid_rate"`
+}
+
+// MarshalJSON 轉入金額依轉入幣別小數位數輸出
+func (c FXConversion) MarshalJSON() ([]byte, error) {
+	type Alias FXConversion
+	return json.Marshal(&struct {
+		DestinationAmount string `json:"destination_amount"`
+		*Alias
+	}{
+		DestinationAmount: currencyOf(c.DestinationCurrency).Format(c.DestinationAmount),
+		Alias:             (*Alias)(&c),
+	})
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// HoldStatus 預授權狀態
+// active: 圈存中, 可請款或解除; captured: 已全額請款; released: 已解除; expired: 逾期自動解除
+type HoldStatus string
+
+const (
+	HoldStatusActive   HoldStatus = "active"
+	HoldStatusCaptured HoldStatus = "captured"
+	HoldStatusReleased HoldStatus = "released"
+	HoldStatusExpired  HoldStatus = "expired"
+)
+
+// Hold 預授權圈存, 降低可用餘額但不影響帳上餘額
+// 可分次請款, 每次請款以提款入帳, Captured為已請款金額
+type Hold struct {
+	ID          uint64          `json:"id"`
+	AccountID   uint64          `json:"account_id"`
+	Amount      decimal.Decimal `json:"amount"`
+	Captured    decimal.Decimal `json:"captured_amount"`
+	Currency    string          `json:"currency"`
+	Status      HoldStatus      `json:"status"`
+	Description string          `json:"description"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	TraceID     string          `json:"trace_id"`
+}
+
+// StatusAt 過了ExpiresAt的active視為expired, 不需等排程標記
+func (h *Hold) StatusAt(now time.Time) HoldStatus {
+	if h.Status == HoldStatusActive && !now.Before(h.ExpiresAt) {
+		return HoldStatusExpired
+	}
+	return h.Status
+}
+
+// Remaining 尚未請款的圈存金額
+func (h *Hold) Remaining() decimal.Decimal {
+	return h.Amount.Sub(h.Captured)
+}
+
+// HeldAt now時仍佔用可用餘額的金額
+func (h *Hold) HeldAt(now time.Time) decimal.Decimal {
+	if h.StatusAt(now) != HoldStatusActive {
+		return decimal.Zero
+	}
+	return h.Remaining()
+}
+
+// CheckActive 只有圈存中的hold可以請款或解除
+func (h *Hold) CheckActive(now time.Time) error {
+	if status := h.StatusAt(now); status != HoldStatusActive {
+		return NewError(ErrHoldNotActive, fmt.Sprintf("hold %d is %s", h.ID, status))
+	}
+	return nil
+}
+
+// Capture 請款amount, 請滿後狀態為captured
+func (h *Hold) Capture(amount decimal.Decimal, now time.Time) error {
+	if err := h.CheckActive(now); err != nil {
+		return err
+	}
+	if !amount.IsPositive() || amount.GreaterThan(h.Remaining()) {
+		return NewError(ErrInvalidAmount, fmt.Sprintf("capture amount must be between 0 and %s", h.Remaining().String()))
+	}
+	h.Captured = h.Captured.Add(amount)
+	if h.Remaining().IsZero() {
+		h.Status = HoldStatusCaptured
+	}
+	h.UpdatedAt = now
+	return nil
+}
+
+// Release 解除剩餘圈存
+func (h *Hold) Release(now time.Time) error {
+	if err := h.CheckActive(now); err != nil {
+		return err
+	}
+	h.Status = HoldStatusReleased
+	h.UpdatedAt = now
+	return nil
+}
+
+// MarshalJSON 金額依幣別小數位數輸出, status為當下的有效狀態
+func (h Hold) MarshalJSON() ([]byte, error) {
+	type Alias Hold
+	currency := currencyOf(h.Currency)
+	return json.Marshal(&struct {
+		Amount    string     `json:"amount"`
+		Captured  string     `json:"captured_amount"`
+		Remaining string     `json:"remaining_amount"`
+		Currency  string     `json:"currency"`
+		Status    HoldStatus `json:"status"`
+		*Alias
+	}{
+		Amount:    currency.Format(h.Amount),
+		Captured:  currency.Format(h.Captured),
+		Remaining: currency.Format(h.HeldAt(time.Now())),
+		Currency:  currency.Code,
+		Status:    h.StatusAt(time.Now()),
+		Alias:     (*Alias)(&h),
+	})
+}
+
+// NewCapture 請款以提款入帳, HoldID對應預授權
+func NewCapture(hold *Hold, amount decimal.Decimal, traceID string) *Transaction {
+	holdID := hold.ID
+	return &Transaction{
+		Type:        TransactionTypeWithdraw,
+		ToAccountID: hold.AccountID,
+		Amount:      amount,
+		Currency:    hold.Currency,
+		Description: fmt.Sprintf("Capture of hold %d", hold.ID),
+		CreatedAt:   time.Now(),
+		TraceID:     traceID,
+		HoldID:      &holdID,
+	}
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// IdempotencyRecord 同一個client + Idempotency-Key 第一次請求的結果
+// Completed為false代表第一次請求還在處理中
+type IdempotencyRecord struct {
+	Scope       string
+	Key         string
+	Fingerprint string // method + path + body 的hash, 用來判斷是否為同一個請求
+	StatusCode  int
+	Body        []byte
+	Completed   bool
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
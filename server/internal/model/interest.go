@@ -0,0 +1,230 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// InterestPrecision 每日利息與累計未入帳利息保留的小數位數, 月底入帳時才捨去到幣別精度
+const InterestPrecision = 16
+
+// DayCount 計息天數慣例
+// ACT/365, ACT/360: 每個日曆天計1天, 分母365/360
+// 30/360: bond basis, 每月視為30天, 分母360
+type DayCount string
+
+const (
+	DayCountAct365 DayCount = "ACT/365"
+	DayCountAct360 DayCount = "ACT/360"
+	DayCount30360  DayCount = "30/360"
+)
+
+func (d DayCount) Validate() error {
+	switch d {
+	case DayCountAct365, DayCountAct360, DayCount30360:
+		return nil
+	}
+	return NewError(ErrInvalidRequest, fmt.Sprintf("unsupported day count convention %q, supported: ACT/365, ACT/360, 30/360", d))
+}
+
+// Days from到to(不含)的計息天數
+// 30/360: D1為31時視為30, D1為30(含調整後)且D2為31時D2視為30
+func (d DayCount) Days(from, to time.Time) int {
+	if d != DayCount30360 {
+		return int(startOfDay(to).Sub(startOfDay(from)).Round(time.Hour).Hours() / 24)
+	}
+	y1, m1, d1 := from.Date()
+	y2, m2, d2 := to.Date()
+	if d1 == 31 {
+		d1 = 30
+	}
+	if d2 == 31 && d1 == 30 {
+		d2 = 30
+	}
+	return 360*(y2-y1) + 30*int(m2-m1) + d2 - d1
+}
+
+// Basis 一年的計息天數
+func (d DayCount) Basis() int64 {
+	if d == DayCountAct365 {
+		return 365
+	}
+	return 360
+}
+
+// Product 帳戶計息產品
+// Rate: 年利率, 0.015代表1.5%
+type Product struct {
+	Name     string          `json:"name"`
+	Rate     decimal.Decimal `json:"rate"`
+	DayCount DayCount        `json:"day_count"`
+}
+
+func (p Product) Validate() error {
+	if p.Rate.IsNegative() {
+		return NewError(ErrInvalidRequest, fmt.Sprintf("product %s: rate cannot be negative", p.Name))
+	}
+	return p.DayCount.Validate()
+}
+
+// Interest balance在from到to(不含)期間的利息, 不捨入
+func (p Product) Interest(balance decimal.Decimal, from, to time.Time) decimal.Decimal {
+	days := p.DayCount.Days(from, to)
+	return balance.Mul(p.Rate).Mul(decimal.NewFromInt(int64(days))).
+		DivRound(decimal.NewFromInt(p.DayCount.Basis()), InterestPrecision)
+}
+
+// InterestAccrual 一個帳戶一天的計息紀錄
+// Balance: 當天日終餘額, 為負數時不計息; Accrued: 計入當天並扣除入帳後的未入帳利息
+// Posted / TransactionID: 當天為月底時入帳的金額與利息交易
+type InterestAccrual struct {
+	AccountID     uint64          `json:"account_id"`
+	Date          time.Time       `json:"-"`
+	Balance       decimal.Decimal `json:"balance"`
+	Product       string          `json:"product"`
+	Rate          decimal.Decimal `json:"rate"`
+	DayCount      DayCount        `json:"day_count"`
+	Days          int             `json:"days"`
+	Amount        decimal.Decimal `json:"amount"`
+	Accrued       decimal.Decimal `json:"accrued"`
+	Posted        decimal.Decimal `json:"posted"`
+	TransactionID *uint64         `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// MarshalJSON 計息日只輸出日期
+func (a InterestAccrual) MarshalJSON() ([]byte, error) {
+	type Alias InterestAccrual
+	return json.Marshal(&struct {
+		Date string `json:"date"`
+		*Alias
+	}{
+		Date:  a.Date.Format(time.DateOnly),
+		Alias: (*Alias)(&a),
+	})
+}
+
+// SetProduct 指定計息產品, 第一次指定時從當天開始計息
+// 更換產品時已計提的利息保留, 之後未計息的日子(含補算)都以新產品計算
+func (a *Account) SetProduct(product string, now time.Time) error {
+	if err := a.CheckCredit(); err != nil {
+		return err
+	}
+	if a.AccruedThrough.IsZero() {
+		a.AccruedThrough = startOfDay(now).AddDate(0, 0, -1)
+	}
+	a.Product = product
+	a.UpdatedAt = now
+	return nil
+}
+
+// AccrueInterest 從AccruedThrough隔天逐日計息到through(含), 回傳每日計息紀錄與月底的利息入帳交易
+// 日終餘額由目前餘額扣掉當天結束後的交易倒推, history為帳戶的交易(至少含第一個計息日結束後的所有交易)
+// 排程停擺錯過的日子一次補算, 結果與每天準時執行相同: 補算期間月底入帳的利息計入之後的日終餘額
+// 入帳金額捨去到幣別精度, 餘數留在AccruedInterest下個月一起入帳; 未曾指定產品的帳戶不計息
+func (a *Account) AccrueInterest(product Product, through time.Time, history []*Transaction) ([]InterestAccrual, []*Transaction) {
+	if a.AccruedThrough.IsZero() {
+		return nil, nil
+	}
+	through = startOfDay(through)
+	currency := a.CurrencyInfo()
+
+	var (
+		accruals []InterestAccrual
+		postings []*Transaction
+	)
+	for date := startOfDay(a.AccruedThrough).AddDate(0, 0, 1); !date.After(through); date = date.AddDate(0, 0, 1) {
+		next := date.AddDate(0, 0, 1)
+		// a.Balance已含本次補算先前入帳的利息, 這些交易不在history內
+		balance := a.Balance
+		for _, transaction := range history {
+			if !transaction.CreatedAt.Before(next) {
+				balance = balance.Sub(transaction.BalanceChange(a.ID))
+			}
+		}
+
+		accrual := InterestAccrual{
+			AccountID: a.ID,
+			Date:      date,
+			Balance:   balance,
+			Product:   product.Name,
+			Rate:      product.Rate,
+			DayCount:  product.DayCount,
+			Days:      product.DayCount.Days(date, next),
+			Amount:    decimal.Zero,
+			Posted:    decimal.Zero,
+		}
+		if balance.IsPositive() {
+			accrual.Amount = product.Interest(balance, date, next)
+		}
+		a.AccruedInterest = a.AccruedInterest.Add(accrual.Amount)
+		a.AccruedThrough = date
+
+		// 月底入帳, closed帳戶不再入帳
+		if next.Day() == 1 && a.CheckCredit() == nil {
+			if amount := a.AccruedInterest.Truncate(currency.MinorUnits); amount.IsPositive() {
+				posting := NewInterest(a.ID, amount, currency.Code, date)
+				before := a.Balance
+				a.Balance = a.Balance.Add(amount)
+				a.AccruedInterest = a.AccruedInterest.Sub(amount)
+				posting.TrackOverdraft(a, before)
+				accrual.Posted = amount
+				postings = append(postings, posting)
+			}
+		}
+		accrual.Accrued = a.AccruedInterest
+		accruals = append(accruals, accrual)
+	}
+	return accruals, postings
+}
+
+// BindInterestPostings 入帳交易取得ID後回填到對應的計息紀錄, postings為AccrueInterest回傳的順序
+func BindInterestPostings(accruals []InterestAccrual, postings []*Transaction) {
+	next := 0
+	for i := range accruals {
+		if accruals[i].Posted.IsPositive() && next < len(postings) {
+			id := postings[next].ID
+			accruals[i].TransactionID = &id
+			next++
+		}
+	}
+}
+
+// NewInterest 利息入帳交易, period為計息月份內的任一天
+func NewInterest(accountID uint64, amount decimal.Decimal, currency string, period time.Time) *Transaction {
+	return &Transaction{
+		Type:        TransactionTypeInterest,
+		ToAccountID: accountID,
+		Amount:      amount,
+		Currency:    currency,
+		Description: fmt.Sprintf("Interest for %s", period.Format("2006-01")),
+		CreatedAt:   time.Now(),
+	}
+}
+
+// BalanceChange 交易對accountID餘額的影響, 由分錄計算
+func (t *Transaction) BalanceChange(accountID uint64) decimal.Decimal {
+	account := CustomerLedgerAccount(accountID)
+	change := decimal.Zero
+	for _, entry := range t.Entries() {
+		if entry.Account != account {
+			continue
+		}
+		if entry.Side == EntryCredit {
+			change = change.Add(entry.Amount)
+		} else {
+			change = change.Sub(entry.Amount)
+		}
+	}
+	return change
+}
+
+// startOfDay 伺服器時區當天00:00
+func startOfDay(t time.Time) time.Time {
+	t = t.Local()
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type EntrySide string
+
+const (
+	EntryDebit  EntrySide = "debit"
+	EntryCredit EntrySide = "credit"
+)
+
+// 系統帳戶, 存提款等沒有客戶對手方的交易由系統帳戶承接
+const (
+	SystemAccountCashIn   = "system:cash_in"  // 現金存入
+	SystemAccountCashOut  = "system:cash_out" // 現金提出
+	SystemAccountFees     = "system:fees"     // 手續費收入
+	SystemAccountFX       = "system:fx"       // 換匯部位, 各幣別分開軋平
+	SystemAccountInterest = "system:interest" // 利息支出
+)
+
+// CustomerLedgerAccount 客戶帳戶在總帳上的代碼
+func CustomerLedgerAccount(accountID uint64) string {
+	return fmt.Sprintf("customer:%d", accountID)
+}
+
+// LedgerEntry 複式記帳分錄
+// 客戶帳戶為銀行負債, credit增加餘額 debit減少餘額
+type LedgerEntry struct {
+	ID            uint64          `json:"id"`
+	TransactionID uint64          `json:"transaction_id"`
+	Account       string          `json:"account"`
+	Side          EntrySide       `json:"side"`
+	Amount        decimal.Decimal `json:"amount"`
+	Currency      string          `json:"currency"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// Entries 依交易類型產生一借一貸的分錄, 借貸金額必定相等
+// deposit:  借 cash_in      貸 customer
+// withdraw: 借 customer     貸 cash_out
+// transfer: 借 customer(from) 貸 customer(to)
+// reversal: 存款沖正 借 customer 貸 cash_in, 轉帳沖正同transfer
+// interest: 借 interest     貸 customer
+// fee:      借 customer     貸 fees
+// 換匯轉帳拆成兩組, 經由system:fx讓每個幣別各自借貸相等
+func (t *Transaction) Entries() []LedgerEntry {
+	if t.Type == TransactionTypeTransfer && t.FX != nil {
+		return t.fxEntries()
+	}
+
+	var debit, credit string
+	switch t.Type {
+	case TransactionTypeDeposit:
+		debit, credit = SystemAccountCashIn, CustomerLedgerAccount(t.ToAccountID)
+	case TransactionTypeWithdraw:
+		debit, credit = CustomerLedgerAccount(t.ToAccountID), SystemAccountCashOut
+	case TransactionTypeTransfer:
+		debit, credit = CustomerLedgerAccount(*t.FromAccountID), CustomerLedgerAccount(t.ToAccountID)
+	case TransactionTypeReversal:
+		if t.FromAccountID == nil {
+			debit, credit = CustomerLedgerAccount(t.ToAccountID), SystemAccountCashIn
+		} else {
+			debit, credit = CustomerLedgerAccount(*t.FromAccountID), CustomerLedgerAccount(t.ToAccountID)
+		}
+	case TransactionTypeInterest:
+		debit, credit = SystemAccountInterest, CustomerLedgerAccount(t.ToAccountID)
+	case TransactionTypeFee:
+		debit, credit = CustomerLedgerAccount(t.ToAccountID), SystemAccountFees
+	default:
+		return nil
+	}
+
+	currency := currencyOf(t.Currency).Code
+	return []LedgerEntry{
+		{TransactionID: t.ID, Account: debit, Side: EntryDebit, Amount: t.Amount, Currency: currency, CreatedAt: t.CreatedAt},
+		{TransactionID: t.ID, Account: credit, Side: EntryCredit, Amount: t.Amount, Currency: currency, CreatedAt: t.CreatedAt},
+	}
+}
+
+// fxEntries 轉出幣別: 借 customer(from) 貸 system:fx
+// 轉入幣別: 借 system:fx 貸 customer(to)
+func (t *Transaction) fxEntries() []LedgerEntry {
+	source := currencyOf(t.Currency).Code
+	destination := currencyOf(t.FX.DestinationCurrency).Code
+	from, to := CustomerLedgerAccount(*t.FromAccountID), CustomerLedgerAccount(t.ToAccountID)
+	return []LedgerEntry{
+		{TransactionID: t.ID, Account: from, Side: EntryDebit, Amount: t.Amount, Currency: source, CreatedAt: t.CreatedAt},
+		{TransactionID: t.ID, Account: SystemAccountFX, Side: EntryCredit, Amount: t.Amount, Currency: source, CreatedAt: t.CreatedAt},
+		{TransactionID: t.ID, Account: SystemAccountFX, Side: EntryDebit, Amount: t.FX.DestinationAmount, Currency: destination, CreatedAt: t.CreatedAt},
+		{TransactionID: t.ID, Account: to, Side: EntryCredit, Amount: t.FX.DestinationAmount, Currency: destination, CreatedAt: t.CreatedAt},
+	}
+}
+
+// LedgerAccountBalance 單一總帳帳戶在單一幣別的借貸合計
+type LedgerAccountBalance struct {
+	Account  string          `json:"account"`
+	Currency string          `json:"currency"`
+	Debit    decimal.Decimal `json:"debit"`
+	Credit   decimal.Decimal `json:"credit"`
+}
+
+// Net credit - debit, 客戶帳戶即為餘額
+func (b LedgerAccountBalance) Net() decimal.Decimal {
+	return b.Credit.Sub(b.Debit)
+}
+
+// BalanceMismatch 帳戶餘額與分錄推算不一致
+type BalanceMismatch struct {
+	AccountID uint64          `json:"account_id"`
+	Balance   decimal.Decimal `json:"balance"`
+	Ledger    decimal.Decimal `json:"ledger"`
+}
+
+// CurrencyTotal 單一幣別的借貸總額
+type CurrencyTotal struct {
+	Currency string          `json:"currency"`
+	Debit    decimal.Decimal `json:"debit"`
+	Credit   decimal.Decimal `json:"credit"`
+}
+
+// TrialBalance 試算表
+// Balanced: 每個幣別借貸總額相等 且每個客戶帳戶餘額都與分錄一致
+// TotalDebit / TotalCredit 為所有幣別數字加總, 只在單一幣別時有金額意義
+type TrialBalance struct {
+	Accounts    []LedgerAccountBalance `json:"accounts"`
+	Currencies  []CurrencyTotal        `json:"currencies"`
+	TotalDebit  decimal.Decimal        `json:"total_debit"`
+	TotalCredit decimal.Decimal        `json:"total_credit"`
+	Mismatches  []BalanceMismatch      `json:"mismatches"`
+	Balanced    bool                   `json:"balanced"`
+}
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultTier 帳戶沒有指定等級時使用
+const DefaultTier = "standard"
+
+// Limits 轉出限額, 提款與轉出合併計算, 金額為帳戶幣別
+// 欄位為nil代表不限制; 作為帳戶的個別設定時nil代表沿用等級的設定
+type Limits struct {
+	PerTransaction *decimal.Decimal `json:"per_transaction,omitempty"` // 單筆上限
+	DailyAmount    *decimal.Decimal `json:"daily_amount,omitempty"`    // 滾動視窗內累計金額上限
+	DailyCount     *int             `json:"daily_count,omitempty"`     // 滾動視窗內筆數上限
+}
+
+// Override 以override有設定的欄位覆蓋, 回傳新的Limits
+func (l Limits) Override(override *Limits) Limits {
+	if override == nil {
+		return l
+	}
+	if override.PerTransaction != nil {
+		l.PerTransaction = override.PerTransaction
+	}
+	if override.DailyAmount != nil {
+		l.DailyAmount = override.DailyAmount
+	}
+	if override.DailyCount != nil {
+		l.DailyCount = override.DailyCount
+	}
+	return l
+}
+
+// Validate 金額不可為負數且需符合幣別精度, 筆數不可為負數
+func (l Limits) Validate(currency Currency) error {
+	for name, amount := range map[string]*decimal.Decimal{"per_transaction": l.PerTransaction, "daily_amount": l.DailyAmount} {
+		if amount == nil {
+			continue
+		}
+		if amount.IsNegative() {
+			return NewError(ErrInvalidRequest, fmt.Sprintf("%s limit cannot be negative", name))
+		}
+		if err := currency.CheckAmount(*amount); err != nil {
+			return err
+		}
+	}
+	if l.DailyCount != nil && *l.DailyCount < 0 {
+		return NewError(ErrInvalidRequest, "daily_count limit cannot be negative")
+	}
+	return nil
+}
+
+// LimitUsage 帳戶在滾動視窗內的用量與剩餘額度
+// 圈存中的預授權先佔用額度(Held), 請款後改由請款交易計入Used
+// Remaining欄位為nil代表不限制
+type LimitUsage struct {
+	AccountID       uint64           `json:"account_id"`
+	Tier            string           `json:"tier"`
+	Currency        string           `json:"currency"`
+	Limits          Limits           `json:"-"` // 生效的限額, 帳戶設定覆蓋等級設定
+	WindowStart     time.Time        `json:"window_start"`
+	WindowEnd       time.Time        `json:"window_end"`
+	UsedAmount      decimal.Decimal  `json:"used_amount"`
+	UsedCount       int              `json:"used_count"`
+	HeldAmount      decimal.Decimal  `json:"held_amount"`
+	HeldCount       int              `json:"held_count"`
+	RemainingAmount *decimal.Decimal `json:"remaining_amount"`
+	RemainingCount  *int             `json:"remaining_count"`
+}
+
+// NewLimitUsage 依視窗內的轉出交易與windowEnd時仍圈存中的預授權計算用量
+// 預授權的剩餘金額不論建立時間都佔用額度; 尚未請款過的預授權佔一筆, 請款後由請款交易計算筆數
+func NewLimitUsage(account *Account, limits Limits, windowStart, windowEnd time.Time, debits []*Transaction, holds []*Hold) *LimitUsage {
+	usage := &LimitUsage{
+		AccountID:   account.ID,
+		Tier:        account.CurrentTier(),
+		Currency:    account.CurrencyInfo().Code,
+		Limits:      limits,
+		WindowStart: windowStart,
+		WindowEnd:   windowEnd,
+		UsedAmount:  decimal.Zero,
+		HeldAmount:  decimal.Zero,
+	}
+	for _, transaction := range debits {
+		usage.UsedAmount = usage.UsedAmount.Add(transaction.Amount)
+		usage.UsedCount++
+	}
+	for _, hold := range holds {
+		held := hold.HeldAt(windowEnd)
+		if !held.IsPositive() {
+			continue
+		}
+		usage.HeldAmount = usage.HeldAmount.Add(held)
+		if hold.Captured.IsZero() {
+			usage.HeldCount++
+		}
+	}
+	usage.remaining()
+	return usage
+}
+
+// Record 計入一筆尚未入帳的轉出, 批次轉帳逐筆檢查時使用
+func (u *LimitUsage) Record(amount decimal.Decimal) {
+	u.UsedAmount = u.UsedAmount.Add(amount)
+	u.UsedCount++
+	u.remaining()
+}
+
+func (u *LimitUsage) remaining() {
+	if u.Limits.DailyAmount != nil {
+		remaining := decimal.Max(u.Limits.DailyAmount.Sub(u.UsedAmount).Sub(u.HeldAmount), decimal.Zero)
+		u.RemainingAmount = &remaining
+	}
+	if u.Limits.DailyCount != nil {
+		remaining := *u.Limits.DailyCount - u.UsedCount - u.HeldCount
+		if remaining < 0 {
+			remaining = 0
+		}
+		u.RemainingCount = &remaining
+	}
+}
+
+// Check 這筆轉出金額是否超過單筆, 累計金額或筆數限額
+func (u *LimitUsage) Check(amount decimal.Decimal) error {
+	limits := u.Limits
+	if limits.PerTransaction != nil && amount.GreaterThan(*limits.PerTransaction) {
+		return NewError(ErrLimitExceeded,
+			fmt.Sprintf("amount %s exceeds the per-transaction limit of %s %s", amount.String(), limits.PerTransaction.String(), u.Currency))
+	}
+	if u.RemainingAmount != nil && amount.GreaterThan(*u.RemainingAmount) {
+		return NewError(ErrLimitExceeded,
+			fmt.Sprintf("amount %s exceeds the remaining daily allowance of %s %s", amount.String(), u.RemainingAmount.String(), u.Currency))
+	}
+	if u.RemainingCount != nil && *u.RemainingCount < 1 {
+		return NewError(ErrLimitExceeded,
+			fmt.Sprintf("daily transaction count limit of %d reached", *limits.DailyCount))
+	}
+	return nil
+}
+
+// MarshalJSON 金額依幣別小數位數輸出
+func (u LimitUsage) MarshalJSON() ([]byte, error) {
+	type Alias LimitUsage
+	currency := currencyOf(u.Currency)
+	format := func(amount *decimal.Decimal) *string {
+		if amount == nil {
+			return nil
+		}
+		formatted := currency.Format(*amount)
+		return &formatted
+	}
+	type limitsJSON struct {
+		PerTransaction *string `json:"per_transaction"`
+		DailyAmount    *string `json:"daily_amount"`
+		DailyCount     *int    `json:"daily_count"`
+	}
+	return json.Marshal(&struct {
+		Limits          limitsJSON `json:"limits"`
+		UsedAmount      string     `json:"used_amount"`
+		HeldAmount      string     `json:"held_amount"`
+		RemainingAmount *string    `json:"remaining_amount"`
+		*Alias
+	}{
+		Limits: limitsJSON{
+			PerTransaction: format(u.Limits.PerTransaction),
+			DailyAmount:    format(u.Limits.DailyAmount),
+			DailyCount:     u.Limits.DailyCount,
+		},
+		UsedAmount:      currency.Format(u.UsedAmount),
+		HeldAmount:      currency.Format(u.HeldAmount),
+		RemainingAmount: format(u.RemainingAmount),
+		Alias:           (*Alias)(&u),
+	})
+}
+
+// Debits accountID在這筆交易是否為扣款方(提款或轉出), 限額只計算扣款
+func (t *Transaction) Debits(accountID uint64) bool {
+	switch t.Type {
+	case TransactionTypeWithdraw:
+		return t.ToAccountID == accountID
+	case TransactionTypeTransfer:
+		return t.FromAccountID != nil && *t.FromAccountID == accountID
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// OverdraftEventType 帳戶進入或離開透支
+type OverdraftEventType string
+
+const (
+	OverdraftEntered OverdraftEventType = "entered"
+	OverdraftExited  OverdraftEventType = "exited"
+)
+
+// OverdraftEvent 餘額由非負變為負數(entered)或由負數回到非負(exited)時產生, 與觸發的交易一起入帳
+type OverdraftEvent struct {
+	AccountID      uint64             `json:"account_id"`
+	TransactionID  uint64             `json:"transaction_id"`
+	Type           OverdraftEventType `json:"type"`
+	Balance        decimal.Decimal    `json:"balance"`         // 交易後餘額
+	OverdraftLimit decimal.Decimal    `json:"overdraft_limit"` // 當下的透支額度
+	Currency       string             `json:"currency"`
+	CreatedAt      time.Time          `json:"created_at"`
+	TraceID        string             `json:"trace_id"`
+}
+
+// MarshalJSON 金額依幣別小數位數輸出
+func (e OverdraftEvent) MarshalJSON() ([]byte, error) {
+	type Alias OverdraftEvent
+	currency := currencyOf(e.Currency)
+	return json.Marshal(&struct {
+		Balance        string `json:"balance"`
+		OverdraftLimit string `json:"overdraft_limit"`
+		Currency       string `json:"currency"`
+		*Alias
+	}{
+		Balance:        currency.Format(e.Balance),
+		OverdraftLimit: currency.Format(e.OverdraftLimit),
+		Currency:       currency.Code,
+		Alias:          (*Alias)(&e),
+	})
+}
+
+// TrackOverdraft account為異動後的帳戶, before為異動前餘額, 跨越0時記錄透支事件
+// TransactionID與CreatedAt由storage入帳時填入
+func (t *Transaction) TrackOverdraft(account *Account, before decimal.Decimal) {
+	var eventType OverdraftEventType
+	switch {
+	case !before.IsNegative() && account.Balance.IsNegative():
+		eventType = OverdraftEntered
+	case before.IsNegative() && !account.Balance.IsNegative():
+		eventType = OverdraftExited
+	default:
+		return
+	}
+	t.OverdraftEvents = append(t.OverdraftEvents, OverdraftEvent{
+		AccountID:      account.ID,
+		Type:           eventType,
+		Balance:        account.Balance,
+		OverdraftLimit: account.OverdraftLimit,
+		Currency:       account.CurrencyInfo().Code,
+		TraceID:        t.TraceID,
+	})
+}
+
+// StampOverdraftEvents 交易入帳後回填事件的交易ID與時間
+func (t *Transaction) StampOverdraftEvents() {
+	for i := range t.OverdraftEvents {
+		t.OverdraftEvents[i].TransactionID = t.ID
+		t.OverdraftEvents[i].CreatedAt = t.CreatedAt
+	}
+}
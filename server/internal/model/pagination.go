@@ -0,0 +1,93 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type SortDirection string
+
+const (
+	SortAsc  SortDirection = "asc"
+	SortDesc SortDirection = "desc"
+)
+
+// TransactionQuery 帳戶交易分頁查詢
+// 交易ID依入帳順序遞增, 排序與cursor都以ID為準
+// Cursor: 上一頁最後一筆的交易ID, 0代表第一頁
+type TransactionQuery struct {
+	AccountID uint64
+	Cursor    uint64
+	Limit     int
+	Direction SortDirection
+	Filter    TransactionFilter
+}
+
+// TransactionFilter 交易查詢條件, 零值代表不限制
+// From包含, To不包含
+// CounterpartyID: 轉帳的另一方帳戶
+type TransactionFilter struct {
+	Type           TransactionType
+	From           time.Time
+	To             time.Time
+	MinAmount      *decimal.Decimal
+	MaxAmount      *decimal.Decimal
+	CounterpartyID uint64
+	TraceID        string
+}
+
+// Matches accountID為查詢的帳戶, 用來判斷轉帳的對手方
+func (f TransactionFilter) Matches(accountID uint64, t *Transaction) bool {
+	if f.Type != "" && t.Type != f.Type {
+		return false
+	}
+	if !f.From.IsZero() && t.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !t.CreatedAt.Before(f.To) {
+		return false
+	}
+	if f.MinAmount != nil && t.Amount.LessThan(*f.MinAmount) {
+		return false
+	}
+	if f.MaxAmount != nil && t.Amount.GreaterThan(*f.MaxAmount) {
+		return false
+	}
+	if f.CounterpartyID != 0 && t.Counterparty(accountID) != f.CounterpartyID {
+		return false
+	}
+	if f.TraceID != "" && t.TraceID != f.TraceID {
+		return false
+	}
+	return true
+}
+
+// TransactionPage NextCursor為空代表沒有下一頁
+type TransactionPage struct {
+	Transactions []*Transaction `json:"transactions"`
+	NextCursor   string         `json:"next_cursor,omitempty"`
+}
+
+// EncodeCursor cursor對client是不透明字串
+func EncodeCursor(id uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(id, 10)))
+}
+
+func DecodeCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PaymentStatus ISO 20022 pain.002的狀態代碼
+// 單筆只有ACSC或RJCT; PART只用在整份檔案或單一PmtInf部分成功
+type PaymentStatus string
+
+const (
+	PaymentStatusSettled  PaymentStatus = "ACSC"
+	PaymentStatusRejected PaymentStatus = "RJCT"
+	PaymentStatusPartial  PaymentStatus = "PART"
+)
+
+// PaymentResult pain.001中單筆付款(CdtTrfTxInf)的執行結果
+// DebtorAccount/CreditorAccount為檔案中的帳號, 成功時帶入帳的交易
+type PaymentResult struct {
+	InstructionID   string          `json:"instruction_id,omitempty"`
+	EndToEndID      string          `json:"end_to_end_id"`
+	DebtorAccount   string          `json:"debtor_account"`
+	CreditorAccount string          `json:"creditor_account"`
+	Amount          decimal.Decimal `json:"amount"`
+	Currency        string          `json:"currency"`
+	Status          PaymentStatus   `json:"status"`
+	Reason          string          `json:"reason,omitempty"`
+	Message         string          `json:"message,omitempty"`
+	Transaction     *Transaction    `json:"transaction,omitempty"`
+}
+
+// MarshalJSON 金額依幣別小數位數輸出
+func (r PaymentResult) MarshalJSON() ([]byte, error) {
+	type Alias PaymentResult
+	return json.Marshal(&struct {
+		Amount string `json:"amount"`
+		*Alias
+	}{
+		Amount: currencyOf(r.Currency).Format(r.Amount),
+		Alias:  (*Alias)(&r),
+	})
+}
+
+// PaymentInfoResult 單一PmtInf(同一個扣款帳戶)的結果
+type PaymentInfoResult struct {
+	ID       string          `json:"payment_info_id"`
+	Status   PaymentStatus   `json:"status"`
+	Payments []PaymentResult `json:"payments"`
+}
+
+// PaymentImport 匯入一份pain.001的結果, 也是產生pain.002的內容
+// 一份檔案可能有多種幣別, ControlSum為所有金額直接加總(同pain.001的CtrlSum)
+// 整份檔案被退回時Status為RJCT, Reason/Messages為原因, 沒有執行任何付款
+type PaymentImport struct {
+	MessageID            string              `json:"message_id"`
+	NumberOfTransactions int                 `json:"number_of_transactions"`
+	ControlSum           decimal.Decimal     `json:"control_sum"`
+	Status               PaymentStatus       `json:"status"`
+	Reason               string              `json:"reason,omitempty"`
+	Messages             []string            `json:"messages,omitempty"`
+	Settled              int                 `json:"settled"`
+	Rejected             int                 `json:"rejected"`
+	PaymentInfos         []PaymentInfoResult `json:"payment_infos"`
+	CreatedAt            time.Time           `json:"created_at"`
+}
+
+// Reject 整份檔案退回, 清除已加入的單筆結果
+func (p *PaymentImport) Reject(reason string, messages ...string) {
+	p.Status, p.Reason, p.Messages = PaymentStatusRejected, reason, messages
+	p.PaymentInfos = []PaymentInfoResult{}
+	p.Settled, p.Rejected = 0, 0
+}
+
+// Add 加入一個PmtInf的結果, 依各筆結果決定PmtInf與整份檔案的狀態
+func (p *PaymentImport) Add(info PaymentInfoResult) {
+	settled := 0
+	for _, payment := range info.Payments {
+		if payment.Status == PaymentStatusSettled {
+			settled++
+		}
+	}
+	info.Status = aggregateStatus(settled, len(info.Payments)-settled)
+	p.PaymentInfos = append(p.PaymentInfos, info)
+	p.Settled += settled
+	p.Rejected += len(info.Payments) - settled
+	p.Status = aggregateStatus(p.Settled, p.Rejected)
+}
+
+// aggregateStatus 全部成功ACSC, 全部失敗RJCT, 其他PART
+func aggregateStatus(settled, rejected int) PaymentStatus {
+	switch {
+	case rejected == 0:
+		return PaymentStatusSettled
+	case settled == 0:
+		return PaymentStatusRejected
+	}
+	return PaymentStatusPartial
+}
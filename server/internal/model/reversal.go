@@ -0,0 +1,115 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// NewReversal 沖正交易, amount為zero時沖正原交易剩餘全額
+// 帳戶與幣別由BindReversal依原交易決定
+func NewReversal(originalID uint64, amount decimal.Decimal, description, traceID string) *Transaction {
+	if description == "" {
+		description = fmt.Sprintf("Reversal of transaction %d", originalID)
+	}
+	return &Transaction{
+		Type:        TransactionTypeReversal,
+		Amount:      amount,
+		Description: description,
+		CreatedAt:   time.Now(),
+		TraceID:     traceID,
+		ReversalOf:  &originalID,
+	}
+}
+
+// CheckReversible 只有存款與同幣別轉帳可以沖正
+// 提款(含預授權請款)的款項已離開銀行, 換匯轉帳需以新報價轉回
+func (t *Transaction) CheckReversible() error {
+	switch {
+	case t.Type == TransactionTypeReversal:
+		return NewError(ErrInvalidRequest, fmt.Sprintf("transaction %d is a reversal and cannot be reversed", t.ID))
+	case t.Type != TransactionTypeDeposit && t.Type != TransactionTypeTransfer:
+		return NewError(ErrInvalidRequest, fmt.Sprintf("%s transactions cannot be reversed", t.Type))
+	case t.FX != nil:
+		return NewError(ErrInvalidRequest, "fx transfers cannot be reversed, transfer back with a new quote")
+	}
+	return nil
+}
+
+// ReversalAccounts 沖正時扣款與入帳的帳戶, 存款沖正沒有客戶入帳方回傳0
+func (t *Transaction) ReversalAccounts() (debit, credit uint64) {
+	if t.FromAccountID == nil {
+		return t.ToAccountID, 0
+	}
+	return *t.FromAccountID, t.ToAccountID
+}
+
+// BindReversal 依原交易反向設定帳戶與幣別, refunded為原交易已沖正的金額
+// 存款沖正: ToAccountID為扣款帳戶
+// 轉帳沖正: 由原轉入帳戶(FromAccountID)退回原轉出帳戶(ToAccountID)
+func (t *Transaction) BindReversal(original *Transaction, refunded decimal.Decimal) error {
+	if err := original.CheckReversible(); err != nil {
+		return err
+	}
+	refundable := original.Amount.Sub(refunded)
+	if !refundable.IsPositive() {
+		return NewError(ErrAlreadyReversed, fmt.Sprintf("transaction %d has already been fully reversed", original.ID))
+	}
+	if t.Amount.IsZero() {
+		t.Amount = refundable
+	}
+	currency := currencyOf(original.Currency)
+	if !t.Amount.IsPositive() {
+		return NewError(ErrInvalidAmount, "reversal amount must be positive")
+	}
+	if t.Amount.GreaterThan(refundable) {
+		return NewError(ErrInvalidAmount, fmt.Sprintf("reversal amount %s exceeds refundable amount %s of transaction %d",
+			currency.Format(t.Amount), currency.Format(refundable), original.ID))
+	}
+
+	originalID := original.ID
+	t.ReversalOf = &originalID
+	t.Currency = currency.Code
+	if original.Type == TransactionTypeDeposit {
+		t.FromAccountID, t.ToAccountID = nil, original.ToAccountID
+	} else {
+		from := original.ToAccountID
+		t.FromAccountID, t.ToAccountID = &from, *original.FromAccountID
+	}
+	return currency.CheckAmount(t.Amount)
+}
+
+// Reversal 沖正結果, 含原交易累計沖正與剩餘可沖正金額
+type Reversal struct {
+	Reversal   *Transaction    `json:"reversal"`
+	Original   *Transaction    `json:"original"`
+	Refunded   decimal.Decimal `json:"-"`
+	Refundable decimal.Decimal `json:"-"`
+}
+
+// NewReversalResult refunded為包含本次沖正的累計金額
+func NewReversalResult(reversal, original *Transaction, refunded decimal.Decimal) *Reversal {
+	return &Reversal{
+		Reversal:   reversal,
+		Original:   original,
+		Refunded:   refunded,
+		Refundable: original.Amount.Sub(refunded),
+	}
+}
+
+// MarshalJSON 金額依原交易幣別輸出
+func (r Reversal) MarshalJSON() ([]byte, error) {
+	type Alias Reversal
+	currency := currencyOf(r.Original.Currency)
+	return json.Marshal(&struct {
+		Refunded   string `json:"refunded_amount"`
+		Refundable string `json:"refundable_amount"`
+		*Alias
+	}{
+		Refunded:   currency.Format(r.Refunded),
+		Refundable: currency.Format(r.Refundable),
+		Alias:      (*Alias)(&r),
+	})
+}
@@ -0,0 +1,345 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ScheduleFrequency 定期轉帳的執行頻率
+// once: 只在start_at執行一次; daily / weekly: 每天 / 每週start_at的同一時間
+// monthly: 每月day_of_month, 當月沒有這天時於月底執行; end_of_month: 每月最後一天
+type ScheduleFrequency string
+
+const (
+	ScheduleOnce       ScheduleFrequency = "once"
+	ScheduleDaily      ScheduleFrequency = "daily"
+	ScheduleWeekly     ScheduleFrequency = "weekly"
+	ScheduleMonthly    ScheduleFrequency = "monthly"
+	ScheduleEndOfMonth ScheduleFrequency = "end_of_month"
+)
+
+// Schedule 執行時間由start_at推算, 每次都在start_at的時、分執行
+// 日期以傳入時間的時區計算
+type Schedule struct {
+	Frequency  ScheduleFrequency `json:"frequency"`
+	DayOfMonth int               `json:"day_of_month,omitempty"`
+}
+
+func (s Schedule) Validate() error {
+	switch s.Frequency {
+	case ScheduleOnce, ScheduleDaily, ScheduleWeekly, ScheduleEndOfMonth:
+		if s.DayOfMonth != 0 {
+			return NewError(ErrInvalidRequest, fmt.Sprintf("day_of_month only applies to monthly schedules, got %s", s.Frequency))
+		}
+	case ScheduleMonthly:
+		if s.DayOfMonth < 1 || s.DayOfMonth > 31 {
+			return NewError(ErrInvalidRequest, "day_of_month must be between 1 and 31")
+		}
+	default:
+		return NewError(ErrInvalidRequest,
+			fmt.Sprintf("unknown frequency %q, must be once, daily, weekly, monthly or end_of_month", s.Frequency))
+	}
+	return nil
+}
+
+// First start之後(含)的第一次執行時間
+func (s Schedule) First(start time.Time) time.Time {
+	switch s.Frequency {
+	case ScheduleMonthly, ScheduleEndOfMonth:
+		first := s.inMonth(start, start.Year(), start.Month())
+		if first.Before(start) {
+			first = s.inMonth(start, start.Year(), start.Month()+1)
+		}
+		return first
+	}
+	return start
+}
+
+// Next previous之後的下一次執行時間, once沒有下一次
+func (s Schedule) Next(start, previous time.Time) (time.Time, bool) {
+	switch s.Frequency {
+	case ScheduleDaily:
+		return previous.AddDate(0, 0, 1), true
+	case ScheduleWeekly:
+		return previous.AddDate(0, 0, 7), true
+	case ScheduleMonthly, ScheduleEndOfMonth:
+		return s.inMonth(start, previous.Year(), previous.Month()+1), true
+	}
+	return time.Time{}, false
+}
+
+// inMonth 該月的執行日, 時間與時區同start; month超過12會進位到下一年
+func (s Schedule) inMonth(start time.Time, year int, month time.Month) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, start.Location()).Day()
+	day := last
+	if s.Frequency == ScheduleMonthly && s.DayOfMonth < last {
+		day = s.DayOfMonth
+	}
+	return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+}
+
+// RetryPolicy 可重試的失敗(餘額不足/超過限額/帳戶凍結)每IntervalSeconds重試, 最多MaxRetries次
+// 重試用完後這一期視為失敗, 定期的排程繼續下一期
+type RetryPolicy struct {
+	MaxRetries      int `json:"max_retries"`
+	IntervalSeconds int `json:"interval_seconds"`
+}
+
+func (p RetryPolicy) Validate() error {
+	if p.MaxRetries < 0 {
+		return NewError(ErrInvalidRequest, "max_retries cannot be negative")
+	}
+	if p.MaxRetries > 0 && p.IntervalSeconds <= 0 {
+		return NewError(ErrInvalidRequest, "interval_seconds must be greater than 0")
+	}
+	return nil
+}
+
+// StandingOrderStatus 定期轉帳狀態
+// active: 等待執行; paused: 暫停, 恢復時跳過暫停期間的期數; cancelled: 已取消
+// completed: 單次或已到end_at; failed: 不可重試的錯誤(e.g. 帳戶結清), 不再執行
+type StandingOrderStatus string
+
+const (
+	StandingOrderActive    StandingOrderStatus = "active"
+	StandingOrderPaused    StandingOrderStatus = "paused"
+	StandingOrderCancelled StandingOrderStatus = "cancelled"
+	StandingOrderCompleted StandingOrderStatus = "completed"
+	StandingOrderFailed    StandingOrderStatus = "failed"
+)
+
+// StandingOrder 定期或預約轉帳, 由排程以AccountService.Transfer執行
+// DueAt為目前這一期的執行時間, NextRunAt為下次嘗試的時間(重試時晚於DueAt)
+// 不再執行的狀態DueAt / NextRunAt為zero; EndAt為zero代表沒有結束時間
+type StandingOrder struct {
+	ID            uint64              `json:"id"`
+	FromAccountID uint64              `json:"from_account_id"`
+	ToAccountID   uint64              `json:"to_account_id"`
+	Amount        decimal.Decimal     `json:"amount"`
+	Currency      string              `json:"currency"`
+	Description   string              `json:"description"`
+	Schedule      Schedule            `json:"schedule"`
+	Retry         RetryPolicy         `json:"retry_policy"`
+	Status        StandingOrderStatus `json:"status"`
+	StartAt       time.Time           `json:"start_at"`
+	EndAt         time.Time           `json:"-"`
+	DueAt         time.Time           `json:"-"`
+	NextRunAt     time.Time           `json:"-"`
+	Attempts      int                 `json:"attempts"`
+	Executions    int                 `json:"executions"`
+	LastRunAt     time.Time           `json:"-"`
+	LastError     string              `json:"last_error,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+	TraceID       string              `json:"trace_id"`
+}
+
+// BindAccounts 建立時檢查雙方帳戶: 未結清, 幣別與轉出帳戶一致且不換匯
+// 凍結的帳戶仍可建立, 執行時再依重試規則處理
+func (o *StandingOrder) BindAccounts(from, to *Account) error {
+	if err := from.CheckCredit(); err != nil {
+		return err
+	}
+	if err := to.CheckCredit(); err != nil {
+		return err
+	}
+	transfer := &Transaction{Amount: o.Amount, Currency: o.Currency}
+	if err := transfer.BindCurrency(from); err != nil {
+		return err
+	}
+	if code := to.CurrencyInfo().Code; code != transfer.Currency {
+		return NewError(ErrCurrencyMismatch,
+			fmt.Sprintf("currency mismatch: standing orders cannot convert %s to %s", transfer.Currency, code))
+	}
+	o.Currency = transfer.Currency
+	return nil
+}
+
+// Start 啟用並排定第一期
+func (o *StandingOrder) Start() error {
+	o.Status = StandingOrderActive
+	o.DueAt = o.Schedule.First(o.StartAt)
+	o.NextRunAt = o.DueAt
+	if !o.EndAt.IsZero() && o.DueAt.After(o.EndAt) {
+		return NewError(ErrInvalidRequest, "end_at is before the first execution")
+	}
+	return nil
+}
+
+// Due now時是否該執行
+func (o *StandingOrder) Due(now time.Time) bool {
+	return o.Status == StandingOrderActive && !o.NextRunAt.After(now)
+}
+
+// Reference 這一期轉帳的reference, 同一期重試或重啟後再執行都相同
+func (o *StandingOrder) Reference() string {
+	return fmt.Sprintf("standing-order:%d:%d", o.ID, o.DueAt.UnixNano())
+}
+
+// Succeed 這一期執行成功, 排定下一期
+func (o *StandingOrder) Succeed(now time.Time) {
+	o.Executions++
+	o.LastError = ""
+	o.LastRunAt = now
+	o.UpdatedAt = now
+	o.advance(StandingOrderCompleted)
+}
+
+// Fail 這一期執行失敗
+// 不可重試的錯誤停止排程; 可重試時依RetryPolicy重試, 用完後跳到下一期
+func (o *StandingOrder) Fail(err error, retryable bool, now time.Time) {
+	o.Attempts++
+	o.LastError = err.Error()
+	o.LastRunAt = now
+	o.UpdatedAt = now
+	switch {
+	case !retryable:
+		o.stop(StandingOrderFailed)
+	case o.Attempts <= o.Retry.MaxRetries:
+		o.NextRunAt = now.Add(time.Duration(o.Retry.IntervalSeconds) * time.Second)
+	default:
+		o.advance(StandingOrderFailed)
+	}
+}
+
+// Pause 只有active可以暫停
+func (o *StandingOrder) Pause(now time.Time) error {
+	if o.Status != StandingOrderActive {
+		return o.notActive()
+	}
+	o.Status = StandingOrderPaused
+	o.UpdatedAt = now
+	return nil
+}
+
+// Resume 恢復暫停的排程, 定期的排程不補執行暫停期間已過的期數, 單次的在下次排程執行
+func (o *StandingOrder) Resume(now time.Time) error {
+	if o.Status != StandingOrderPaused {
+		return NewError(ErrStandingOrderNotActive, fmt.Sprintf("standing order %d is %s, only paused orders can be resumed", o.ID, o.Status))
+	}
+	o.Status = StandingOrderActive
+	o.Attempts = 0
+	o.NextRunAt = o.DueAt
+	o.UpdatedAt = now
+	for o.Schedule.Frequency != ScheduleOnce && o.Status == StandingOrderActive && o.DueAt.Before(now) {
+		o.advance(StandingOrderCompleted)
+	}
+	return nil
+}
+
+// Cancel active或paused可以取消
+func (o *StandingOrder) Cancel(now time.Time) error {
+	if o.Status != StandingOrderActive && o.Status != StandingOrderPaused {
+		return o.notActive()
+	}
+	o.UpdatedAt = now
+	o.stop(StandingOrderCancelled)
+	return nil
+}
+
+// advance 排定下一期, 沒有下一期或超過EndAt時以final結束
+func (o *StandingOrder) advance(final StandingOrderStatus) {
+	next, ok := o.Schedule.Next(o.StartAt, o.DueAt)
+	if !ok || (!o.EndAt.IsZero() && next.After(o.EndAt)) {
+		o.stop(final)
+		return
+	}
+	o.Attempts = 0
+	o.DueAt = next
+	o.NextRunAt = next
+}
+
+func (o *StandingOrder) stop(status StandingOrderStatus) {
+	o.Status = status
+	o.DueAt = time.Time{}
+	o.NextRunAt = time.Time{}
+}
+
+func (o *StandingOrder) notActive() error {
+	return NewError(ErrStandingOrderNotActive, fmt.Sprintf("standing order %d is %s", o.ID, o.Status))
+}
+
+// MarshalJSON 金額依幣別小數位數輸出, 未設定的時間不輸出
+func (o StandingOrder) MarshalJSON() ([]byte, error) {
+	type Alias StandingOrder
+	currency := currencyOf(o.Currency)
+	return json.Marshal(&struct {
+		Amount    string     `json:"amount"`
+		EndAt     *time.Time `json:"end_at,omitempty"`
+		DueAt     *time.Time `json:"due_at,omitempty"`
+		NextRunAt *time.Time `json:"next_run_at,omitempty"`
+		LastRunAt *time.Time `json:"last_run_at,omitempty"`
+		*Alias
+	}{
+		Amount:    currency.Format(o.Amount),
+		EndAt:     optionalTime(o.EndAt),
+		DueAt:     optionalTime(o.DueAt),
+		NextRunAt: optionalTime(o.NextRunAt),
+		LastRunAt: optionalTime(o.LastRunAt),
+		Alias:     (*Alias)(&o),
+	})
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+type StandingOrderRunStatus string
+
+const (
+	StandingOrderRunSucceeded StandingOrderRunStatus = "succeeded"
+	StandingOrderRunFailed    StandingOrderRunStatus = "failed"
+)
+
+// StandingOrderRun 一次執行紀錄, 每次執行有自己的trace id, 可對應到轉帳交易與log
+type StandingOrderRun struct {
+	StandingOrderID uint64                 `json:"standing_order_id"`
+	DueAt           time.Time              `json:"due_at"`
+	Attempt         int                    `json:"attempt"`
+	Status          StandingOrderRunStatus `json:"status"`
+	TransactionID   *uint64                `json:"transaction_id,omitempty"`
+	Error           string                 `json:"error,omitempty"`
+	ExecutedAt      time.Time              `json:"executed_at"`
+	TraceID         string                 `json:"trace_id"`
+}
+
+// NewStandingOrderRun 依執行結果建立紀錄, 需在order.Succeed / Fail之前呼叫
+func NewStandingOrderRun(order *StandingOrder, transaction *Transaction, err error, now time.Time, traceID string) *StandingOrderRun {
+	run := &StandingOrderRun{
+		StandingOrderID: order.ID,
+		DueAt:           order.DueAt,
+		Attempt:         order.Attempts + 1,
+		Status:          StandingOrderRunSucceeded,
+		ExecutedAt:      now,
+		TraceID:         traceID,
+	}
+	if err != nil {
+		run.Status = StandingOrderRunFailed
+		run.Error = err.Error()
+		return run
+	}
+	id := transaction.ID
+	run.TransactionID = &id
+	return run
+}
+
+// Retryable 可能自行恢復的失敗可重試: 餘額不足、超過限額、帳戶凍結, 以及非業務錯誤(e.g. 寫入失敗)
+// 帳戶結清、不存在、幣別或金額不合法等重試也不會成功
+func Retryable(err error) bool {
+	for _, permanent := range []error{
+		ErrAccountNotFound, ErrAccountClosed, ErrCurrencyMismatch, ErrUnsupportedCurrency,
+		ErrInvalidAmount, ErrSameAccount, ErrInvalidRequest,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
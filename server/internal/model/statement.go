@@ -0,0 +1,158 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrStatementUnreconciled 由交易紀錄推算的餘額與帳戶餘額不一致, 資料有問題時不產生對帳單
+var ErrStatementUnreconciled = errors.New("statement does not reconcile with account balance")
+
+// Statement 帳戶在[From, To)期間的對帳單
+// OpeningBalance為From之前所有交易推算的餘額, ClosingBalance = OpeningBalance + 期間異動
+// ClosingBalance加上To之後的異動必定等於帳戶餘額
+type Statement struct {
+	AccountID      uint64           `json:"account_id"`
+	Currency       string           `json:"currency"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	OpeningBalance decimal.Decimal  `json:"opening_balance"`
+	ClosingBalance decimal.Decimal  `json:"closing_balance"`
+	TotalCredit    decimal.Decimal  `json:"total_credit"`
+	TotalDebit     decimal.Decimal  `json:"total_debit"`
+	Lines          []StatementLine  `json:"transactions"`
+	Totals         []StatementTotal `json:"totals"`
+}
+
+// StatementLine Amount為交易對帳戶餘額的影響, 入帳為正扣款為負
+// 跨幣別轉入時為換算後的入帳金額; RunningBalance為這筆入帳後的餘額
+type StatementLine struct {
+	Transaction    *Transaction    `json:"transaction"`
+	Amount         decimal.Decimal `json:"amount"`
+	RunningBalance decimal.Decimal `json:"running_balance"`
+}
+
+// StatementTotal 期間內單一交易類型的筆數與入帳/扣款合計
+type StatementTotal struct {
+	Type   TransactionType `json:"type"`
+	Count  int             `json:"count"`
+	Credit decimal.Decimal `json:"credit"`
+	Debit  decimal.Decimal `json:"debit"`
+}
+
+// NewStatement 依帳戶與它的所有交易(同一個時間點的快照, 依入帳順序)產生對帳單
+// from為zero時從開戶開始; 推算的餘額與帳戶餘額不一致時回傳ErrStatementUnreconciled
+func NewStatement(account *Account, history []*Transaction, from, to time.Time) (*Statement, error) {
+	if from.IsZero() {
+		from = account.CreatedAt
+	}
+	statement := &Statement{
+		AccountID:      account.ID,
+		Currency:       account.CurrencyInfo().Code,
+		From:           from,
+		To:             to,
+		OpeningBalance: decimal.Zero,
+		TotalCredit:    decimal.Zero,
+		TotalDebit:     decimal.Zero,
+		Lines:          []StatementLine{},
+		Totals:         []StatementTotal{},
+	}
+
+	var period []*Transaction
+	after := decimal.Zero
+	for _, transaction := range history {
+		change := transaction.BalanceChange(account.ID)
+		switch {
+		case transaction.CreatedAt.Before(from):
+			statement.OpeningBalance = statement.OpeningBalance.Add(change)
+		case transaction.CreatedAt.Before(to):
+			period = append(period, transaction)
+		default:
+			after = after.Add(change)
+		}
+	}
+
+	balance := statement.OpeningBalance
+	totals := make(map[TransactionType]*StatementTotal)
+	for _, transaction := range period {
+		change := transaction.BalanceChange(account.ID)
+		balance = balance.Add(change)
+		statement.Lines = append(statement.Lines, StatementLine{
+			Transaction:    transaction,
+			Amount:         change,
+			RunningBalance: balance,
+		})
+
+		total, ok := totals[transaction.Type]
+		if !ok {
+			total = &StatementTotal{Type: transaction.Type, Credit: decimal.Zero, Debit: decimal.Zero}
+			totals[transaction.Type] = total
+		}
+		total.Count++
+		if change.IsNegative() {
+			total.Debit = total.Debit.Sub(change)
+			statement.TotalDebit = statement.TotalDebit.Sub(change)
+		} else {
+			total.Credit = total.Credit.Add(change)
+			statement.TotalCredit = statement.TotalCredit.Add(change)
+		}
+	}
+	statement.ClosingBalance = balance
+	for _, total := range totals {
+		statement.Totals = append(statement.Totals, *total)
+	}
+	sort.Slice(statement.Totals, func(i, j int) bool { return statement.Totals[i].Type < statement.Totals[j].Type })
+
+	if current := balance.Add(after); !current.Equal(account.Balance) {
+		return nil, fmt.Errorf("%w: account %d balance %s, transactions sum to %s",
+			ErrStatementUnreconciled, account.ID, account.Balance.String(), current.String())
+	}
+	return statement, nil
+}
+
+// MarshalJSON 金額依幣別小數位數輸出
+func (s Statement) MarshalJSON() ([]byte, error) {
+	type Alias Statement
+	currency := currencyOf(s.Currency)
+	type line struct {
+		Transaction    *Transaction `json:"transaction"`
+		Amount         string       `json:"amount"`
+		RunningBalance string       `json:"running_balance"`
+	}
+	type total struct {
+		Type   TransactionType `json:"type"`
+		Count  int             `json:"count"`
+		Credit string          `json:"credit"`
+		Debit  string          `json:"debit"`
+	}
+	lines := make([]line, len(s.Lines))
+	for i, l := range s.Lines {
+		lines[i] = line{Transaction: l.Transaction, Amount: currency.Format(l.Amount), RunningBalance: currency.Format(l.RunningBalance)}
+	}
+	totals := make([]total, len(s.Totals))
+	for i, t := range s.Totals {
+		totals[i] = total{Type: t.Type, Count: t.Count, Credit: currency.Format(t.Credit), Debit: currency.Format(t.Debit)}
+	}
+	return json.Marshal(&struct {
+		OpeningBalance string  `json:"opening_balance"`
+		ClosingBalance string  `json:"closing_balance"`
+		TotalCredit    string  `json:"total_credit"`
+		TotalDebit     string  `json:"total_debit"`
+		Lines          []line  `json:"transactions"`
+		Totals         []total `json:"totals"`
+		*Alias
+	}{
+		OpeningBalance: currency.Format(s.OpeningBalance),
+		ClosingBalance: currency.Format(s.ClosingBalance),
+		TotalCredit:    currency.Format(s.TotalCredit),
+		TotalDebit:     currency.Format(s.TotalDebit),
+		Lines:          lines,
+		Totals:         totals,
+		Alias:          (*Alias)(&s),
+	})
+}
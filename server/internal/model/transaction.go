@@ -2,8 +2,11 @@ package model
 
 import (
 	"encoding/json"
-	"github.com/shopspring/decimal"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type TransactionType string
@@ -12,30 +15,84 @@ const (
 	TransactionTypeDeposit  TransactionType = "deposit"
 	TransactionTypeWithdraw TransactionType = "withdraw"
 	TransactionTypeTransfer TransactionType = "transfer"
+	TransactionTypeReversal TransactionType = "reversal"
+	TransactionTypeInterest TransactionType = "interest"
+	TransactionTypeFee      TransactionType = "fee"
 )
 
 type Transaction struct {
-	ID            uint64            `json:"id"`
-	Type          TransactionType   `json:"type"`
-	FromAccountID *uint64           `json:"from_account_id"`
-	ToAccountID   uint64            `json:"to_account_id"`
-	Amount        decimal.Decimal   `json:"amount"`
-	Description   string            `json:"description"`
-	CreatedAt     time.Time         `json:"created_at"`
-	TraceID       string            `json:"trace_id"`
+	ID            uint64          `json:"id"`
+	Type          TransactionType `json:"type"`
+	FromAccountID *uint64         `json:"from_account_id"`
+	ToAccountID   uint64          `json:"to_account_id"`
+	Amount        decimal.Decimal `json:"amount"`
+	Currency      string          `json:"currency"`
+	Description   string          `json:"description"`
+	CreatedAt     time.Time       `json:"created_at"`
+	TraceID       string          `json:"trace_id"`
+	// FX 跨幣別轉帳才有, Amount/Currency為轉出金額
+	FX *FXConversion `json:"fx,omitempty"`
+	// HoldID 預授權請款才有
+	HoldID *uint64 `json:"hold_id,omitempty"`
+	// ReversalOf 沖正交易才有, 對應被沖正的原交易
+	ReversalOf *uint64 `json:"reversal_of,omitempty"`
+	// FeeFor 手續費交易才有, 對應收費的提款或轉帳
+	FeeFor *uint64 `json:"fee_for,omitempty"`
+	// Reference 呼叫端指定的唯一識別(e.g. 定期轉帳的期數), 同一個reference只會入帳一次
+	Reference string `json:"reference,omitempty"`
+	// Fee 提款或轉帳附加的手續費交易, 由storage與主交易一起入帳, 另存為一筆交易
+	Fee *Transaction `json:"fee,omitempty"`
+	// OverdraftEvents 這筆交易造成的透支進出, 由storage入帳時產生, 另外以帳戶查詢
+	OverdraftEvents []OverdraftEvent `json:"-"`
 }
 
+// MarshalJSON 金額依幣別小數位數輸出
 func (t Transaction) MarshalJSON() ([]byte, error) {
 	type Alias Transaction
+	currency := currencyOf(t.Currency)
 	return json.Marshal(&struct {
-		Amount string `json:"amount"`
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
 		*Alias
 	}{
-		Amount: t.Amount.StringFixed(2),
-		Alias:  (*Alias)(&t),
+		Amount:   currency.Format(t.Amount),
+		Currency: currency.Code,
+		Alias:    (*Alias)(&t),
 	})
 }
 
+// BindCurrency 交易未指定幣別時沿用帳戶幣別, 有指定時需一致, 並檢查金額精度
+func (t *Transaction) BindCurrency(account *Account) error {
+	currency := account.CurrencyInfo()
+	if t.Currency != "" && !strings.EqualFold(t.Currency, currency.Code) {
+		return NewError(ErrCurrencyMismatch, fmt.Sprintf("currency mismatch: account %d is in %s, got %s", account.ID, currency.Code, t.Currency))
+	}
+	t.Currency = currency.Code
+	return currency.CheckAmount(t.Amount)
+}
+
+// CreditAmount 轉入帳戶入帳金額, 換匯時為換算後的金額
+func (t *Transaction) CreditAmount() decimal.Decimal {
+	if t.FX != nil {
+		return t.FX.DestinationAmount
+	}
+	return t.Amount
+}
+
+// Counterparty 轉帳時相對於accountID的另一方, 存提款沒有對手方回傳0
+func (t *Transaction) Counterparty(accountID uint64) uint64 {
+	if t.Type != TransactionTypeTransfer || t.FromAccountID == nil {
+		return 0
+	}
+	switch accountID {
+	case *t.FromAccountID:
+		return t.ToAccountID
+	case t.ToAccountID:
+		return *t.FromAccountID
+	}
+	return 0
+}
+
 func NewDeposit(accountID uint64, amount decimal.Decimal, traceID string) *Transaction {
 	return &Transaction{
 		Type:        TransactionTypeDeposit,
@@ -47,6 +104,17 @@ func NewDeposit(accountID uint64, amount decimal.Decimal, traceID string) *Trans
 	}
 }
 
+// NewOpeningBalance 開戶時的初始餘額, 以存款入帳
+func NewOpeningBalance(accountID uint64, amount decimal.Decimal) *Transaction {
+	return &Transaction{
+		Type:        TransactionTypeDeposit,
+		ToAccountID: accountID,
+		Amount:      amount,
+		Description: "Opening balance",
+		CreatedAt:   time.Now(),
+	}
+}
+
 func NewWithdraw(accountID uint64, amount decimal.Decimal, traceID string) *Transaction {
 	return &Transaction{
 		Type:        TransactionTypeWithdraw,
@@ -68,4 +136,4 @@ func NewTransfer(fromAccountID, toAccountID uint64, amount decimal.Decimal, trac
 		CreatedAt:     time.Now(),
 		TraceID:       traceID,
 	}
-}
\ No newline at end of file
+}
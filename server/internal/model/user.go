@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// MinPasswordLength, MaxPasswordLength bcrypt只取前72 bytes, 超過的部分不會被驗證
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,32}$`)
+
+// Role 使用者角色, 決定可以執行的操作與範圍(自己的帳戶或所有帳戶)
+type Role string
+
+const (
+	// RoleCustomer 只能操作自己的帳戶, 註冊的使用者預設為customer
+	RoleCustomer Role = "customer"
+	// RoleTeller 臨櫃人員, 可以替任何帳戶存款與提款
+	RoleTeller Role = "teller"
+	// RoleAuditor 稽核, 可以查詢所有資料, 不能做任何異動
+	RoleAuditor Role = "auditor"
+	// RoleAdmin 管理帳戶狀態、額度與系統設定
+	RoleAdmin Role = "admin"
+)
+
+var Roles = []Role{RoleCustomer, RoleTeller, RoleAuditor, RoleAdmin}
+
+// ParseRole 角色不分大小寫
+func ParseRole(value string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(value)))
+	for _, known := range Roles {
+		if role == known {
+			return role, nil
+		}
+	}
+	return "", NewError(ErrInvalidRequest, fmt.Sprintf("unknown role %q, available roles: customer, teller, auditor, admin", value))
+}
+
+// User 登入的使用者, 帳戶以Account.OwnerID對應
+// PasswordHash為bcrypt hash, 不回傳給client
+type User struct {
+	ID           uint64    `json:"id"`
+	Username     string    `json:"username"`
+	Role         Role      `json:"role"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CheckCredentials 註冊時檢查帳號與密碼格式
+func CheckCredentials(username, password string) error {
+	if !usernamePattern.MatchString(username) {
+		return NewError(ErrInvalidRequest, "username must be 3-32 characters of letters, digits, '.', '_' or '-'")
+	}
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return NewError(ErrInvalidRequest, fmt.Sprintf("password must be %d-%d bytes", MinPasswordLength, MaxPasswordLength))
+	}
+	return nil
+}
+
+// Token 登入取得的access token, ExpiresIn為秒數
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   int64     `json:"expires_in"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/handler"
+	"github.com/kokp520/banking-system/server/internal/middleware"
+)
+
+// Handlers /v1 API的handler, 由呼叫端依設定組裝service後傳入
+type Handlers struct {
+	Account       *handler.AccountHandler
+	Ledger        *handler.LedgerHandler
+	FX            *handler.FXHandler
+	Limit         *handler.LimitHandler
+	Fee           *handler.FeeHandler
+	Statement     *handler.StatementHandler
+	Reversal      *handler.ReversalHandler
+	Hold          *handler.HoldHandler
+	StandingOrder *handler.StandingOrderHandler
+	Interest      *handler.InterestHandler
+	Payment       *handler.PaymentHandler
+	User          *handler.UserHandler
+}
+
+// RegisterV1 註冊/v1 API, main與測試共用, 路由需要的權限只在這裡宣告
+// authenticate驗證Bearer token(middleware.Auth), idempotency處理Idempotency-Key(middleware.Idempotency)
+func RegisterV1(r *gin.Engine, h Handlers, authenticate, idempotency gin.HandlerFunc) {
+	v1 := r.Group("/v1")
+
+	// 註冊與登入不需token, 需在v1.Use之前註冊
+	v1.POST("/users", h.User.Register)
+	v1.POST("/auth/login", h.User.Login)
+
+	// 以下API需帶Bearer token, 每個路由以middleware.Require宣告需要的權限
+	// 各角色的權限見auth.grants, 只限自己帳戶的權限由service依帳戶擁有者檢查
+	v1.Use(authenticate)
+	v1.GET("/users/me", h.User.Me)
+
+	account := v1.Group("/account")
+	{
+		account.POST("", middleware.Require(auth.AccountCreate), idempotency, h.Account.CreateAccount)
+		account.GET("/:id", middleware.Require(auth.AccountRead), h.Account.GetAccount)
+		account.POST("/:id/deposit", middleware.Require(auth.AccountDeposit), idempotency, h.Account.Deposit)
+		account.POST("/:id/withdraw", middleware.Require(auth.AccountWithdraw), idempotency, h.Account.Withdraw)
+		account.POST("/:id/transfer", middleware.Require(auth.AccountTransfer), idempotency, h.Account.Transfer)
+		account.POST("/:id/freeze", middleware.Require(auth.AccountManage), idempotency, h.Account.FreezeAccount)
+		account.POST("/:id/unfreeze", middleware.Require(auth.AccountManage), idempotency, h.Account.UnfreezeAccount)
+		account.POST("/:id/close", middleware.Require(auth.AccountManage), idempotency, h.Account.CloseAccount)
+		account.GET("/:id/transactions", middleware.Require(auth.AccountRead), h.Account.GetTransactions)
+		account.GET("/:id/statement", middleware.Require(auth.AccountRead), h.Statement.GetStatement)
+		account.GET("/:id/statement/export", middleware.Require(auth.AccountRead), h.Statement.ExportStatement)
+		account.PUT("/:id/overdraft", middleware.Require(auth.AccountManage), h.Account.SetOverdraftLimit)
+		account.GET("/:id/overdraft/events", middleware.Require(auth.AccountRead), h.Account.GetOverdraftEvents)
+		account.GET("/:id/limits", middleware.Require(auth.AccountRead), h.Limit.GetLimits)
+		account.PUT("/:id/limits", middleware.Require(auth.AccountManage), h.Limit.SetLimits)
+		account.GET("/:id/fees/quote", middleware.Require(auth.AccountRead), h.Fee.Quote)
+		account.POST("/:id/holds", middleware.Require(auth.AccountTransfer), idempotency, h.Hold.PlaceHold)
+		account.GET("/:id/holds", middleware.Require(auth.AccountRead), h.Hold.GetHolds)
+		account.POST("/:id/standing-orders", middleware.Require(auth.AccountTransfer), idempotency, h.StandingOrder.CreateStandingOrder)
+		account.GET("/:id/standing-orders", middleware.Require(auth.AccountRead), h.StandingOrder.GetStandingOrders)
+		account.PUT("/:id/product", middleware.Require(auth.AccountManage), h.Interest.SetProduct)
+		account.GET("/:id/interest", middleware.Require(auth.AccountRead), h.Interest.GetAccruals)
+	}
+
+	transactions := v1.Group("/transactions")
+	{
+		transactions.GET("/:id/entries", middleware.Require(auth.AccountRead), h.Ledger.GetEntries)
+		transactions.POST("/:id/reverse", middleware.Require(auth.TransactionReverse), idempotency, h.Reversal.Reverse)
+	}
+
+	v1.POST("/transfers/batch", middleware.Require(auth.AccountTransfer), idempotency, h.Account.TransferBatch)
+	v1.POST("/payments/pain001", middleware.Require(auth.AccountTransfer), h.Payment.ImportPain001)
+
+	holds := v1.Group("/holds")
+	{
+		holds.GET("/:id", middleware.Require(auth.AccountRead), h.Hold.GetHold)
+		holds.POST("/:id/capture", middleware.Require(auth.AccountTransfer), idempotency, h.Hold.CaptureHold)
+		holds.POST("/:id/release", middleware.Require(auth.AccountTransfer), idempotency, h.Hold.ReleaseHold)
+	}
+
+	standingOrders := v1.Group("/standing-orders")
+	{
+		standingOrders.GET("/:id", middleware.Require(auth.AccountRead), h.StandingOrder.GetStandingOrder)
+		standingOrders.GET("/:id/runs", middleware.Require(auth.AccountRead), h.StandingOrder.GetRuns)
+		standingOrders.POST("/:id/pause", middleware.Require(auth.AccountTransfer), h.StandingOrder.Pause)
+		standingOrders.POST("/:id/resume", middleware.Require(auth.AccountTransfer), h.StandingOrder.Resume)
+		standingOrders.POST("/:id/cancel", middleware.Require(auth.AccountTransfer), h.StandingOrder.Cancel)
+	}
+
+	v1.GET("/ledger/trial-balance", middleware.Require(auth.LedgerRead), h.Ledger.TrialBalance)
+	v1.GET("/interest/products", h.Interest.GetProducts)
+	v1.GET("/fees", h.Fee.GetSchedules)
+
+	fx := v1.Group("/fx")
+	{
+		fx.GET("/rates", h.FX.GetRates)
+		fx.POST("/quotes", middleware.Require(auth.AccountTransfer), h.FX.CreateQuote)
+	}
+
+	admin := v1.Group("/admin", middleware.Require(auth.SystemManage))
+	{
+		admin.PUT("/fx/rates", h.FX.SetRates)
+		admin.POST("/standing-orders/run", h.StandingOrder.RunDue)
+		admin.POST("/interest/run", h.Interest.RunAccrual)
+		admin.PUT("/users/:id/role", h.User.SetRole)
+	}
+}
@@ -2,6 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
 	"github.com/kokp520/banking-system/server/internal/model"
 	"github.com/kokp520/banking-system/server/internal/storage"
 	"github.com/kokp520/banking-system/server/pkg/logger"
@@ -11,26 +16,89 @@ import (
 )
 
 // AccountService
-// 可切換成mysql 實作
+// storage依賴介面, 可切換memory / sqlite 實作
 type AccountService struct {
-	storage *storage.MemoryStorage
+	storage storage.Storage
+	fx      *FXService
+	limits  *LimitService
+	fees    *FeeService
+}
+
+// AccountServiceOption 選配的功能, 未設定時不啟用
+type AccountServiceOption func(*AccountService)
+
+// WithFX 啟用跨幣別轉帳
+func WithFX(fx *FXService) AccountServiceOption {
+	return func(s *AccountService) {
+		s.fx = fx
+	}
+}
+
+// WithLimits 提款與轉出前檢查限額
+func WithLimits(limits *LimitService) AccountServiceOption {
+	return func(s *AccountService) {
+		s.limits = limits
+	}
+}
+
+// WithFees 提款與轉帳依設定收取手續費
+func WithFees(fees *FeeService) AccountServiceOption {
+	return func(s *AccountService) {
+		s.fees = fees
+	}
 }
 
-func NewAccountService(storage *storage.MemoryStorage) *AccountService {
-	return &AccountService{
+func NewAccountService(storage storage.Storage, options ...AccountServiceOption) *AccountService {
+	s := &AccountService{
 		storage: storage,
 	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
 }
 
+// CreateAccountInput Currency空字串為model.DefaultCurrency, OverdraftLimit為zero時不可透支
+// Tier空字串為model.DefaultTier, 有設定限額時需為已設定的等級
 type CreateAccountInput struct {
 	Name           string
+	Currency       string
 	InitialBalance decimal.Decimal
+	OverdraftLimit decimal.Decimal
+	Tier           string
+	// OwnerID 帳戶持有人, 0為呼叫者; 替其他使用者開戶需為admin
+	OwnerID uint64
 }
 
 func (s *AccountService) CreateAccount(ctx context.Context, in CreateAccountInput) (*model.Account, error) {
+	if in.InitialBalance.IsNegative() {
+		return nil, ErrNegativeInitialBalance
+	}
+	currency, err := model.LookupCurrency(in.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := currency.CheckAmount(in.InitialBalance); err != nil {
+		return nil, err
+	}
+	owner, err := accountOwner(ctx, s.storage, in.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+
 	account := &model.Account{
-		Name:    in.Name,
-		Balance: in.InitialBalance,
+		Name:     in.Name,
+		Currency: currency.Code,
+		Balance:  in.InitialBalance,
+		OwnerID:  owner,
+	}
+	if err := account.SetOverdraftLimit(in.OverdraftLimit); err != nil {
+		return nil, err
+	}
+	if s.limits != nil {
+		if account.Tier, err = s.limits.CheckTier(in.Tier); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := s.storage.CreateAccount(account); err != nil {
@@ -41,7 +109,9 @@ func (s *AccountService) CreateAccount(ctx context.Context, in CreateAccountInpu
 	logger.WithTraceID(ctx).Info("account created successfully",
 		zap.Uint64("accountId", account.ID),
 		zap.String("name", account.Name),
+		zap.String("currency", account.Currency),
 		zap.String("initialBalance", account.Balance.String()),
+		zap.String("overdraftLimit", account.OverdraftLimit.String()),
 	)
 
 	return account, nil
@@ -51,127 +121,450 @@ func (s *AccountService) CreateAccount(ctx context.Context, in CreateAccountInpu
 // id: accountId
 // @Return: model.Account
 func (s *AccountService) GetAccount(ctx context.Context, id uint64) (*model.Account, error) {
-	return s.storage.GetAccountByID(id)
+	account, err := s.storage.GetAccountByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, account, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	return account, nil
 }
 
+// Currency: 選填, 有帶時需與帳戶幣別一致
 type DepositInput struct {
-	Amount decimal.Decimal
+	Amount   decimal.Decimal
+	Currency string
 }
 
 type WithdrawInput struct {
-	Amount decimal.Decimal
+	Amount   decimal.Decimal
+	Currency string
 }
 
+// TransferInput 雙方幣別不同時需帶QuoteID, 或Convert以即時匯率換匯
 type TransferInput struct {
 	FromAccountID uint64
 	ToAccountID   uint64
 	Amount        decimal.Decimal
+	Currency      string
+	QuoteID       string
+	Convert       bool
+	// Description 選填, 空字串使用預設描述
+	Description string
+	// Reference 選填, 同一個reference只會入帳一次
+	Reference string
 }
 
-// Deposit 存款操作
+// newTransfer 由輸入建立轉帳交易, 尚未換匯
+func newTransfer(in TransferInput, traceID string) *model.Transaction {
+	transfer := model.NewTransfer(in.FromAccountID, in.ToAccountID, in.Amount, traceID)
+	transfer.Currency = in.Currency
+	transfer.Reference = in.Reference
+	if in.Description != "" {
+		transfer.Description = in.Description
+	}
+	return transfer
+}
+
+// Deposit 存款操作, 餘額與交易紀錄由storage原子寫入
 func (s *AccountService) Deposit(ctx context.Context, id uint64, in DepositInput) error {
-	if err := s.storage.Deposit(id, in.Amount); err != nil {
-		logger.WithTraceID(ctx).Error("failed to deposit",
-			zap.Error(err),
-			zap.Uint64("accountId", id),
-			zap.String("amount", in.Amount.String()),
-		)
+	if err := authorize(ctx, s.storage, id, auth.AccountDeposit); err != nil {
 		return err
 	}
-
 	traceID := trace.GetTraceID(ctx)
 	deposit := model.NewDeposit(id, in.Amount, traceID)
-	if err := s.storage.AddTransaction(deposit); err != nil {
-		logger.WithTraceID(ctx).Error("failed to add deposit transaction",
+	deposit.Currency = in.Currency
+	if err := s.storage.Deposit(deposit); err != nil {
+		logger.WithTraceID(ctx).Error("failed to deposit",
 			zap.Error(err),
 			zap.Uint64("accountId", id),
 			zap.String("amount", in.Amount.String()),
 		)
+		return err
 	}
 
 	logger.WithTraceID(ctx).Info("deposit successful",
 		zap.Uint64("accountId", id),
+		zap.Uint64("transactionId", deposit.ID),
 		zap.String("amount", in.Amount.String()),
 	)
+	logOverdraftEvents(ctx, deposit)
 
 	return nil
 }
 
-// Withdraw 提款操作
+// Withdraw 提款操作, 餘額與交易紀錄由storage原子寫入
 func (s *AccountService) Withdraw(ctx context.Context, id uint64, in WithdrawInput) error {
-	if err := s.storage.Withdraw(id, in.Amount); err != nil {
-		logger.WithTraceID(ctx).Error("failed to withdraw",
-			zap.Error(err),
-			zap.Uint64("accountId", id),
-			zap.String("amount", in.Amount.String()),
-		)
+	if err := authorize(ctx, s.storage, id, auth.AccountWithdraw); err != nil {
 		return err
 	}
-
 	traceID := trace.GetTraceID(ctx)
 	withdraw := model.NewWithdraw(id, in.Amount, traceID)
-	if err := s.storage.AddTransaction(withdraw); err != nil {
-		logger.WithTraceID(ctx).Error("failed to add withdraw transaction",
+	withdraw.Currency = in.Currency
+	err := s.debit(ctx, id, in.Amount, func() error {
+		if err := s.attachFee(id, withdraw); err != nil {
+			return err
+		}
+		return s.storage.Withdraw(withdraw)
+	})
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to withdraw",
 			zap.Error(err),
 			zap.Uint64("accountId", id),
 			zap.String("amount", in.Amount.String()),
 		)
+		return err
 	}
 
 	logger.WithTraceID(ctx).Info("withdraw successful",
 		zap.Uint64("accountId", id),
+		zap.Uint64("transactionId", withdraw.ID),
 		zap.String("amount", in.Amount.String()),
+		zap.String("fee", withdraw.FeeAmount().String()),
 	)
+	logOverdraftEvents(ctx, withdraw)
 
 	return nil
 }
 
-// Transfer 轉帳操作
-func (s *AccountService) Transfer(ctx context.Context, in TransferInput) error {
-	if err := s.storage.Transfer(in.FromAccountID, in.ToAccountID, in.Amount); err != nil {
+// Transfer 轉帳操作, 餘額與交易紀錄由storage原子寫入
+// 呼叫者需為轉出帳戶的擁有者, 轉入帳戶不限
+func (s *AccountService) Transfer(ctx context.Context, in TransferInput) (*model.Transaction, error) {
+	if err := s.authorizeSource(ctx, in.FromAccountID); err != nil {
+		return nil, err
+	}
+	transfer := newTransfer(in, trace.GetTraceID(ctx))
+	if in.QuoteID != "" || in.Convert {
+		quote, err := s.quoteTransfer(ctx, in)
+		if err != nil {
+			logger.WithTraceID(ctx).Error("failed to convert transfer",
+				zap.Error(err),
+				zap.Uint64("fromAccountId", in.FromAccountID),
+				zap.Uint64("toAccountId", in.ToAccountID),
+				zap.String("amount", in.Amount.String()),
+				zap.String("quoteId", in.QuoteID),
+			)
+			return nil, err
+		}
+		if quote != nil {
+			transfer.FX = quote.Conversion()
+		}
+	}
+
+	err := s.debit(ctx, in.FromAccountID, in.Amount, func() error {
+		if err := s.attachFee(in.FromAccountID, transfer); err != nil {
+			return err
+		}
+		return s.storage.Transfer(transfer)
+	})
+	if err != nil {
+		if in.QuoteID != "" {
+			// 報價未成交, 過期前可再使用
+			s.fx.Release(in.QuoteID)
+		}
 		logger.WithTraceID(ctx).Error("failed to transfer",
 			zap.Error(err),
 			zap.Uint64("fromAccountId", in.FromAccountID),
 			zap.Uint64("toAccountId", in.ToAccountID),
 			zap.String("amount", in.Amount.String()),
 		)
-		return err
+		return nil, err
+	}
+
+	fields := []zap.Field{
+		zap.Uint64("transactionId", transfer.ID),
+		zap.Uint64("fromAccountId", in.FromAccountID),
+		zap.Uint64("toAccountId", in.ToAccountID),
+		zap.String("amount", in.Amount.String()),
+		zap.String("fee", transfer.FeeAmount().String()),
+	}
+	if fx := transfer.FX; fx != nil {
+		fields = append(fields,
+			zap.String("quoteId", fx.QuoteID),
+			zap.String("destinationAmount", fx.DestinationAmount.String()),
+			zap.String("destinationCurrency", fx.DestinationCurrency),
+			zap.String("rate", fx.Rate.String()),
+		)
+	}
+	logger.WithTraceID(ctx).Info("transfer successful", fields...)
+	logOverdraftEvents(ctx, transfer)
+
+	return transfer, nil
+}
+
+// BatchTransferInput Mode為zero時為atomic, Transfers依序執行
+type BatchTransferInput struct {
+	Mode      model.BatchMode
+	Transfers []TransferInput
+}
+
+// TransferBatch 批次轉帳, e.g. 薪資由一個帳戶轉給多個帳戶
+// atomic: 限額與餘額逐筆累計檢查, 全部通過才一起入帳, 失敗回傳*model.BatchError
+// best_effort: 逐筆以Transfer執行, 回傳每筆的結果
+// 批次不支援換匯
+func (s *AccountService) TransferBatch(ctx context.Context, in BatchTransferInput) (*model.BatchTransferResult, error) {
+	if len(in.Transfers) == 0 {
+		return nil, model.NewError(model.ErrInvalidRequest, "batch must contain at least one transfer")
+	}
+	if len(in.Transfers) > model.MaxBatchTransfers {
+		return nil, model.NewError(model.ErrInvalidRequest, fmt.Sprintf("batch cannot contain more than %d transfers", model.MaxBatchTransfers))
+	}
+	mode, err := model.ParseBatchMode(string(in.Mode))
+	if err != nil {
+		return nil, err
+	}
+	in.Mode = mode
+
+	result := &model.BatchTransferResult{Mode: in.Mode}
+	if in.Mode == model.BatchModeBestEffort {
+		for _, item := range in.Transfers {
+			if err := checkBatchItem(item); err != nil {
+				result.Add(nil, err)
+				continue
+			}
+			result.Add(s.Transfer(ctx, item))
+		}
+		logger.WithTraceID(ctx).Info("batch transfer finished",
+			zap.String("mode", string(in.Mode)),
+			zap.Int("succeeded", result.Succeeded),
+			zap.Int("failed", result.Failed),
+		)
+		return result, nil
 	}
 
 	traceID := trace.GetTraceID(ctx)
-	transfer := model.NewTransfer(in.FromAccountID, in.ToAccountID, in.Amount, traceID)
-	if err := s.storage.AddTransaction(transfer); err != nil {
-		logger.WithTraceID(ctx).Error("failed to add transfer transaction",
+	transfers := make([]*model.Transaction, len(in.Transfers))
+	authorized := make(map[uint64]bool)
+	for i, item := range in.Transfers {
+		if err := checkBatchItem(item); err != nil {
+			return nil, model.NewBatchError(i, err)
+		}
+		if !authorized[item.FromAccountID] {
+			if err := s.authorizeSource(ctx, item.FromAccountID); err != nil {
+				return nil, model.NewBatchError(i, err)
+			}
+			authorized[item.FromAccountID] = true
+		}
+		transfers[i] = newTransfer(item, traceID)
+		if err := s.attachFee(item.FromAccountID, transfers[i]); err != nil {
+			return nil, model.NewBatchError(i, err)
+		}
+	}
+
+	err = s.debitBatch(ctx, transfers, func() error {
+		return s.storage.TransferBatch(transfers)
+	})
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to transfer batch",
 			zap.Error(err),
-			zap.Uint64("fromAccountId", in.FromAccountID),
-			zap.Uint64("toAccountId", in.ToAccountID),
-			zap.String("amount", in.Amount.String()),
+			zap.Int("transferCount", len(transfers)),
 		)
+		return nil, err
 	}
 
-	logger.WithTraceID(ctx).Info("transfer successful",
-		zap.Uint64("fromAccountId", in.FromAccountID),
-		zap.Uint64("toAccountId", in.ToAccountID),
-		zap.String("amount", in.Amount.String()),
+	total, fees := decimal.Zero, decimal.Zero
+	for _, transfer := range transfers {
+		result.Add(transfer, nil)
+		total = total.Add(transfer.Amount)
+		fees = fees.Add(transfer.FeeAmount())
+		logOverdraftEvents(ctx, transfer)
+	}
+	logger.WithTraceID(ctx).Info("batch transfer successful",
+		zap.String("mode", string(in.Mode)),
+		zap.Int("transferCount", len(transfers)),
+		zap.Uint64("firstTransactionId", transfers[0].ID),
+		zap.String("totalAmount", total.String()),
+		zap.String("totalFee", fees.String()),
 	)
+	return result, nil
+}
 
+// authorizeSource 轉出帳戶的authorize, 帳戶不存在時回傳ErrSourceAccountNotFound
+func (s *AccountService) authorizeSource(ctx context.Context, accountID uint64) error {
+	err := authorize(ctx, s.storage, accountID, auth.AccountTransfer)
+	if errors.Is(err, model.ErrAccountNotFound) {
+		return storage.ErrSourceAccountNotFound
+	}
+	return err
+}
+
+// checkBatchItem 批次中的單筆不支援換匯
+func checkBatchItem(in TransferInput) error {
+	if in.QuoteID != "" || in.Convert {
+		return model.NewError(model.ErrInvalidRequest, "currency conversion is not supported in batch transfers")
+	}
 	return nil
 }
 
-func (s *AccountService) GetTransactions(ctx context.Context, accountID uint64) ([]*model.Transaction, error) {
-	transactions, err := s.storage.GetTransactionsByAccountID(accountID)
+// attachFee 有設定手續費時附加在交易上, 由storage與主交易一起入帳
+// 限額只計算主交易金額, 不含手續費
+func (s *AccountService) attachFee(accountID uint64, transaction *model.Transaction) error {
+	if s.fees == nil {
+		return nil
+	}
+	return s.fees.Attach(accountID, transaction)
+}
+
+// debitBatch 有設定限額時先逐筆累計檢查限額再扣款
+func (s *AccountService) debitBatch(ctx context.Context, transfers []*model.Transaction, fn func() error) error {
+	if s.limits == nil {
+		return fn()
+	}
+	return s.limits.EnforceBatch(ctx, transfers, fn)
+}
+
+// debit 有設定限額時先檢查限額再扣款
+func (s *AccountService) debit(ctx context.Context, accountID uint64, amount decimal.Decimal, fn func() error) error {
+	if s.limits == nil {
+		return fn()
+	}
+	return s.limits.Enforce(ctx, accountID, amount, fn)
+}
+
+// quoteTransfer 依雙方帳戶幣別成交報價
+// Convert且幣別相同時不需換匯, 回傳nil
+func (s *AccountService) quoteTransfer(ctx context.Context, in TransferInput) (*model.FXQuote, error) {
+	if s.fx == nil {
+		return nil, model.NewError(model.ErrFXRateUnavailable, "currency conversion is not enabled")
+	}
+	from, err := s.storage.GetAccountByID(in.FromAccountID)
+	if errors.Is(err, model.ErrAccountNotFound) {
+		return nil, storage.ErrSourceAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.storage.GetAccountByID(in.ToAccountID)
+	if errors.Is(err, model.ErrAccountNotFound) {
+		return nil, storage.ErrDestinationAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	source, destination := from.CurrencyInfo().Code, to.CurrencyInfo().Code
+	if in.Currency != "" && !strings.EqualFold(in.Currency, source) {
+		return nil, model.NewError(model.ErrCurrencyMismatch,
+			fmt.Sprintf("currency mismatch: account %d is in %s, got %s", from.ID, source, in.Currency))
+	}
+	if in.QuoteID != "" {
+		return s.fx.Redeem(ctx, in.QuoteID, in.FromAccountID, source, destination, in.Amount)
+	}
+	if source == destination {
+		return nil, nil
+	}
+	return s.fx.Convert(ctx, in.FromAccountID, source, destination, in.Amount)
+}
+
+type ChangeStatusInput struct {
+	Status model.AccountStatus
+	Reason string
+}
+
+// ChangeAccountStatus 凍結/解凍/結清, 原因必填
+func (s *AccountService) ChangeAccountStatus(ctx context.Context, id uint64, in ChangeStatusInput) (*model.Account, error) {
+	if err := authorize(ctx, s.storage, id, auth.AccountManage); err != nil {
+		return nil, err
+	}
+	account, err := s.storage.UpdateAccountStatus(id, in.Status, in.Reason)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to change account status",
+			zap.Error(err),
+			zap.Uint64("accountId", id),
+			zap.String("status", string(in.Status)),
+			zap.String("reason", in.Reason),
+		)
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("account status changed",
+		zap.Uint64("accountId", id),
+		zap.String("status", string(account.Status)),
+		zap.String("reason", in.Reason),
+	)
+
+	return account, nil
+}
+
+// SetOverdraftLimit 調整透支額度, 調降到低於已動用金額時只是不能再扣款
+func (s *AccountService) SetOverdraftLimit(ctx context.Context, id uint64, limit decimal.Decimal) (*model.Account, error) {
+	if err := authorize(ctx, s.storage, id, auth.AccountManage); err != nil {
+		return nil, err
+	}
+	account, err := s.storage.SetOverdraftLimit(id, limit)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to set overdraft limit",
+			zap.Error(err),
+			zap.Uint64("accountId", id),
+			zap.String("limit", limit.String()),
+		)
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("overdraft limit changed",
+		zap.Uint64("accountId", id),
+		zap.String("limit", account.OverdraftLimit.String()),
+		zap.String("overdraftUsed", account.OverdraftUsed().String()),
+	)
+	return account, nil
+}
+
+// GetOverdraftEvents 帳戶透支進出事件, 依交易順序
+func (s *AccountService) GetOverdraftEvents(ctx context.Context, id uint64) ([]model.OverdraftEvent, error) {
+	account, err := s.storage.GetAccountByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, account, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	events, err := s.storage.GetOverdraftEvents(id)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to get overdraft events", zap.Error(err), zap.Uint64("accountId", id))
+		return nil, err
+	}
+	if events == nil {
+		events = []model.OverdraftEvent{}
+	}
+	return events, nil
+}
+
+// logOverdraftEvents 帳戶進入或離開透支時以warn記錄, 事件本身已隨交易寫入storage
+// 附加的手續費交易一併記錄
+func logOverdraftEvents(ctx context.Context, transaction *model.Transaction) {
+	if transaction.Fee != nil {
+		defer logOverdraftEvents(ctx, transaction.Fee)
+	}
+	for _, event := range transaction.OverdraftEvents {
+		logger.WithTraceID(ctx).Warn("account overdraft "+string(event.Type),
+			zap.Uint64("accountId", event.AccountID),
+			zap.Uint64("transactionId", event.TransactionID),
+			zap.String("balance", event.Balance.String()),
+			zap.String("overdraftLimit", event.OverdraftLimit.String()),
+		)
+	}
+}
+
+// GetTransactions 帳戶交易紀錄, cursor分頁
+func (s *AccountService) GetTransactions(ctx context.Context, query model.TransactionQuery) (*model.TransactionPage, error) {
+	if err := authorize(ctx, s.storage, query.AccountID, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	page, err := s.storage.QueryTransactions(query)
 	if err != nil {
 		logger.WithTraceID(ctx).Error("failed to get transactions",
 			zap.Error(err),
-			zap.Uint64("accountId", accountID),
+			zap.Uint64("accountId", query.AccountID),
 		)
 		return nil, err
 	}
 
 	logger.WithTraceID(ctx).Info("transactions retrieved successfully",
-		zap.Uint64("accountId", accountID),
-		zap.Int("transactionCount", len(transactions)),
+		zap.Uint64("accountId", query.AccountID),
+		zap.Int("transactionCount", len(page.Transactions)),
+		zap.Bool("hasMore", page.NextCursor != ""),
 	)
 
-	return transactions, nil
+	return page, nil
 }
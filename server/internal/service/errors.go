@@ -0,0 +1,8 @@
+package service
+
+import "github.com/kokp520/banking-system/server/internal/model"
+
+// service層驗證的業務錯誤, 分類沿用model
+var (
+	ErrNegativeInitialBalance = model.NewError(model.ErrInvalidAmount, "initial balance cannot be negative")
+)
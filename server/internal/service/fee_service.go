@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/shopspring/decimal"
+)
+
+// FeeService 提款與轉帳手續費
+// 手續費依扣款帳戶幣別計算, 附加在交易上由storage與主交易一起入帳
+type FeeService struct {
+	storage   storage.Storage
+	schedules map[model.TransactionType]model.FeeSchedule
+}
+
+// NewFeeService 未設定的操作不收費
+func NewFeeService(storage storage.Storage, schedules []model.FeeSchedule) *FeeService {
+	s := &FeeService{
+		storage:   storage,
+		schedules: make(map[model.TransactionType]model.FeeSchedule, len(schedules)),
+	}
+	for _, schedule := range schedules {
+		s.schedules[schedule.Operation] = schedule
+	}
+	return s
+}
+
+// Schedules 已設定的手續費, 依model.FeeOperations的順序
+func (s *FeeService) Schedules() []model.FeeSchedule {
+	schedules := []model.FeeSchedule{}
+	for _, operation := range model.FeeOperations {
+		if schedule, ok := s.schedules[operation]; ok {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules
+}
+
+// Quote 試算帳戶執行operation的手續費, 不會扣款
+// 實際扣款時依當下的設定重新計算
+func (s *FeeService) Quote(ctx context.Context, accountID uint64, operation model.TransactionType, amount decimal.Decimal) (*model.FeeQuote, error) {
+	if !model.IsFeeOperation(operation) {
+		return nil, model.NewError(model.ErrInvalidRequest,
+			fmt.Sprintf("unknown operation %q, available operations: withdraw, transfer", operation))
+	}
+	if !amount.IsPositive() {
+		return nil, model.NewError(model.ErrInvalidAmount, "amount must be greater than 0")
+	}
+	account, err := s.storage.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, account, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	currency := account.CurrencyInfo()
+	if err := currency.CheckAmount(amount); err != nil {
+		return nil, err
+	}
+
+	quote := &model.FeeQuote{
+		AccountID: accountID,
+		Operation: operation,
+		Amount:    amount,
+		Currency:  currency.Code,
+		Fee:       decimal.Zero,
+	}
+	if schedule, ok := s.schedules[operation]; ok {
+		quote.Schedule = &schedule
+		quote.Fee = schedule.Compute(amount, currency)
+	}
+	quote.Total = amount.Add(quote.Fee)
+	return quote, nil
+}
+
+// Attach 計算手續費並附加在交易上, 手續費為zero時不附加
+// 扣款帳戶不存在時不附加, 交由storage回傳對應的錯誤
+func (s *FeeService) Attach(accountID uint64, transaction *model.Transaction) error {
+	schedule, ok := s.schedules[transaction.Type]
+	if !ok {
+		return nil
+	}
+	account, err := s.storage.GetAccountByID(accountID)
+	if errors.Is(err, model.ErrAccountNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	currency := account.CurrencyInfo()
+	fee := schedule.Compute(transaction.Amount, currency)
+	if !fee.IsPositive() {
+		return nil
+	}
+	transaction.Fee = model.NewFee(accountID, fee, currency.Code, transaction.Type, transaction.TraceID)
+	return nil
+}
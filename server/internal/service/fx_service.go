@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// FXConfig
+// Spread: 成交匯率 = 中間價 * (1 - Spread), e.g. 0.0025為25bps
+// QuoteTTL: 報價有效時間
+// Rounding: 轉入金額捨入方式, 預設無條件捨去
+type FXConfig struct {
+	Spread   decimal.Decimal
+	QuoteTTL time.Duration
+	Rounding model.RoundingPolicy
+}
+
+// FXRateTable 匯率表, 檔案與管理API使用相同格式
+type FXRateTable struct {
+	Rates []model.FXRate `json:"rates"`
+}
+
+// fxQuoteState 報價只能成交一次, used在轉帳失敗時會還原
+type fxQuoteState struct {
+	quote model.FXQuote
+	used  bool
+}
+
+// FXService 匯率表與報價
+// 匯率表整批替換, 報價保存在記憶體, 過期後於下次報價時清除
+type FXService struct {
+	config FXConfig
+
+	mutex  sync.Mutex
+	rates  map[string]model.FXRate // key: BASE/QUOTE
+	quotes map[string]*fxQuoteState
+}
+
+// defaultQuoteTTL 未設定QuoteTTL時的報價有效時間
+const defaultQuoteTTL = 30 * time.Second
+
+func NewFXService(config FXConfig) *FXService {
+	if config.Rounding == "" {
+		config.Rounding = model.RoundDown
+	}
+	if config.QuoteTTL <= 0 {
+		config.QuoteTTL = defaultQuoteTTL
+	}
+	return &FXService{
+		config: config,
+		rates:  make(map[string]model.FXRate),
+		quotes: make(map[string]*fxQuoteState),
+	}
+}
+
+func ratePair(base, quote string) string {
+	return base + "/" + quote
+}
+
+// LoadRatesFile 由JSON檔載入匯率表, 格式同FXRateTable
+func (s *FXService) LoadRatesFile(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var table FXRateTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return fmt.Errorf("decode fx rates %s: %w", path, err)
+	}
+	_, err = s.SetRates(ctx, table.Rates)
+	return err
+}
+
+// SetRates 驗證後整批替換匯率表, 已發出的報價不受影響
+func (s *FXService) SetRates(ctx context.Context, rates []model.FXRate) ([]model.FXRate, error) {
+	now := time.Now()
+	table := make(map[string]model.FXRate, len(rates))
+	for _, rate := range rates {
+		base, err := model.LookupCurrency(rate.Base)
+		if err != nil {
+			return nil, err
+		}
+		quote, err := model.LookupCurrency(rate.Quote)
+		if err != nil {
+			return nil, err
+		}
+		if base.Code == quote.Code {
+			return nil, model.NewError(model.ErrInvalidRequest, fmt.Sprintf("fx rate %s/%s: base and quote must differ", base.Code, quote.Code))
+		}
+		if !rate.Rate.IsPositive() {
+			return nil, model.NewError(model.ErrInvalidRequest, fmt.Sprintf("fx rate %s/%s must be positive", base.Code, quote.Code))
+		}
+		pair := ratePair(base.Code, quote.Code)
+		if _, ok := table[pair]; ok {
+			return nil, model.NewError(model.ErrInvalidRequest, fmt.Sprintf("duplicate fx rate %s", pair))
+		}
+		table[pair] = model.FXRate{Base: base.Code, Quote: quote.Code, Rate: rate.Rate, UpdatedAt: now}
+	}
+
+	s.mutex.Lock()
+	s.rates = table
+	s.mutex.Unlock()
+
+	logger.WithTraceID(ctx).Info("fx rates updated", zap.Int("rateCount", len(table)))
+	return s.Rates(), nil
+}
+
+// Rates 目前的匯率表, 依幣別對排序
+func (s *FXService) Rates() []model.FXRate {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rates := make([]model.FXRate, 0, len(s.rates))
+	for _, rate := range s.rates {
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		return ratePair(rates[i].Base, rates[i].Quote) < ratePair(rates[j].Base, rates[j].Quote)
+	})
+	return rates
+}
+
+// midRate 直接報價, 或以反向報價取倒數
+// 呼叫端需持有mutex
+func (s *FXService) midRate(from, to string) (decimal.Decimal, error) {
+	if rate, ok := s.rates[ratePair(from, to)]; ok {
+		return rate.Rate, nil
+	}
+	if rate, ok := s.rates[ratePair(to, from)]; ok {
+		return decimal.NewFromInt(1).DivRound(rate.Rate, model.RatePrecision), nil
+	}
+	return decimal.Zero, model.NewError(model.ErrFXRateUnavailable, fmt.Sprintf("no fx rate for %s/%s", from, to))
+}
+
+// Quote 以目前匯率報價, 報價在QuoteTTL內可由同一個呼叫者從accountID轉出一次
+func (s *FXService) Quote(ctx context.Context, accountID uint64, from, to string, amount decimal.Decimal) (*model.FXQuote, error) {
+	quote, err := s.newQuote(quoteHolder(ctx), accountID, from, to, amount, false)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("fx quote issued",
+		zap.String("quoteId", quote.ID),
+		zap.Uint64("sourceAccountId", quote.SourceAccountID),
+		zap.String("pair", ratePair(quote.SourceCurrency, quote.DestinationCurrency)),
+		zap.String("sourceAmount", quote.SourceAmount.String()),
+		zap.String("destinationAmount", quote.DestinationAmount.String()),
+		zap.String("rate", quote.Rate.String()),
+		zap.Time("expiresAt", quote.ExpiresAt),
+	)
+	return quote, nil
+}
+
+// quoteHolder context中的呼叫者, 系統作業為0
+func quoteHolder(ctx context.Context) uint64 {
+	if principal, ok := auth.PrincipalFrom(ctx); ok {
+		return principal.UserID
+	}
+	return 0
+}
+
+// newQuote used為true時報價直接成交, 不能再被Redeem
+func (s *FXService) newQuote(userID, accountID uint64, from, to string, amount decimal.Decimal, used bool) (*model.FXQuote, error) {
+	source, err := model.LookupCurrency(from)
+	if err != nil {
+		return nil, err
+	}
+	destination, err := model.LookupCurrency(to)
+	if err != nil {
+		return nil, err
+	}
+	if source.Code == destination.Code {
+		return nil, model.NewError(model.ErrInvalidRequest, fmt.Sprintf("no conversion needed from %s to %s", source.Code, destination.Code))
+	}
+	if !amount.IsPositive() {
+		return nil, model.NewError(model.ErrInvalidAmount, "amount must be greater than 0")
+	}
+	if err := source.CheckAmount(amount); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	mid, err := s.midRate(source.Code, destination.Code)
+	if err != nil {
+		return nil, err
+	}
+	// spread與捨入都不會讓客戶拿到比中間價更多
+	rate := mid.Mul(decimal.NewFromInt(1).Sub(s.config.Spread)).Truncate(model.RatePrecision)
+	converted := s.config.Rounding.Round(amount.Mul(rate), destination.MinorUnits)
+	if !converted.IsPositive() {
+		return nil, model.NewError(model.ErrInvalidAmount,
+			fmt.Sprintf("amount %s %s is too small to convert to %s", amount.String(), source.Code, destination.Code))
+	}
+
+	now := time.Now()
+	s.purgeExpired(now)
+
+	quote := model.FXQuote{
+		ID:                  uuid.New().String(),
+		SourceAccountID:     accountID,
+		UserID:              userID,
+		SourceCurrency:      source.Code,
+		DestinationCurrency: destination.Code,
+		SourceAmount:        amount,
+		DestinationAmount:   converted,
+		MidRate:             mid,
+		Rate:                rate,
+		Spread:              s.config.Spread,
+		Rounding:            s.config.Rounding,
+		ExpiresAt:           now.Add(s.config.QuoteTTL),
+	}
+	s.quotes[quote.ID] = &fxQuoteState{quote: quote, used: used}
+	return &quote, nil
+}
+
+// purgeExpired 清除過期報價, 呼叫端需持有mutex
+func (s *FXService) purgeExpired(now time.Time) {
+	for id, state := range s.quotes {
+		if state.quote.Expired(now) {
+			delete(s.quotes, id)
+		}
+	}
+}
+
+// Convert 即時報價並直接成交, 轉帳未帶quote_id時使用
+func (s *FXService) Convert(ctx context.Context, accountID uint64, from, to string, amount decimal.Decimal) (*model.FXQuote, error) {
+	return s.newQuote(quoteHolder(ctx), accountID, from, to, amount, true)
+}
+
+// Redeem 成交報價, 呼叫者、轉出帳戶、幣別與金額需與報價相同
+// 其他使用者的報價視為不存在; 成交後的報價不能再用, 轉帳失敗時呼叫Release還原
+func (s *FXService) Redeem(ctx context.Context, id string, accountID uint64, from, to string, amount decimal.Decimal) (*model.FXQuote, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.quotes[id]
+	if !ok || state.quote.UserID != quoteHolder(ctx) {
+		return nil, model.NewError(model.ErrQuoteNotFound, fmt.Sprintf("fx quote %s not found", id))
+	}
+	quote := state.quote
+	if quote.SourceAccountID != accountID {
+		return nil, model.NewError(model.ErrInvalidRequest,
+			fmt.Sprintf("fx quote %s is for account %d, transfer is from account %d", id, quote.SourceAccountID, accountID))
+	}
+	if state.used {
+		return nil, model.NewError(model.ErrQuoteExpired, fmt.Sprintf("fx quote %s has already been used", id))
+	}
+	if quote.Expired(time.Now()) {
+		return nil, model.NewError(model.ErrQuoteExpired, fmt.Sprintf("fx quote %s expired at %s", id, quote.ExpiresAt.Format(time.RFC3339)))
+	}
+	if !strings.EqualFold(quote.SourceCurrency, from) || !strings.EqualFold(quote.DestinationCurrency, to) {
+		return nil, model.NewError(model.ErrCurrencyMismatch,
+			fmt.Sprintf("fx quote %s is for %s/%s, transfer is %s/%s", id, quote.SourceCurrency, quote.DestinationCurrency, from, to))
+	}
+	if !quote.SourceAmount.Equal(amount) {
+		return nil, model.NewError(model.ErrInvalidRequest,
+			fmt.Sprintf("fx quote %s is for amount %s, got %s", id, quote.SourceAmount.String(), amount.String()))
+	}
+
+	state.used = true
+	return &quote, nil
+}
+
+// Release 轉帳失敗時還原報價, 未過期前可再使用
+func (s *FXService) Release(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if state, ok := s.quotes[id]; ok {
+		state.used = false
+	}
+}
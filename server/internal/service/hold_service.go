@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/kokp520/banking-system/server/pkg/trace"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// DefaultHoldTTL 未指定到期時間的預授權保留7天
+const DefaultHoldTTL = 7 * 24 * time.Hour
+
+// HoldService 預授權: 先圈存再請款或解除, 逾期自動解除
+type HoldService struct {
+	storage    storage.Storage
+	defaultTTL time.Duration
+	limits     *LimitService
+	fees       *FeeService
+}
+
+// HoldServiceOption 選配的功能, 未設定時不啟用
+type HoldServiceOption func(*HoldService)
+
+// WithHoldLimits 圈存前檢查限額並佔用額度, 在圈存金額內的請款不再檢查
+func WithHoldLimits(limits *LimitService) HoldServiceOption {
+	return func(s *HoldService) {
+		s.limits = limits
+	}
+}
+
+// WithHoldFees 請款依withdraw的手續費設定收費, 與請款一起入帳
+func WithHoldFees(fees *FeeService) HoldServiceOption {
+	return func(s *HoldService) {
+		s.fees = fees
+	}
+}
+
+// NewHoldService defaultTTL <= 0 時使用DefaultHoldTTL
+func NewHoldService(storage storage.Storage, defaultTTL time.Duration, options ...HoldServiceOption) *HoldService {
+	if defaultTTL <= 0 {
+		defaultTTL = DefaultHoldTTL
+	}
+	s := &HoldService{
+		storage:    storage,
+		defaultTTL: defaultTTL,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// PlaceHoldInput ExpiresAt為zero時使用預設保留時間
+type PlaceHoldInput struct {
+	Amount      decimal.Decimal
+	Currency    string
+	Description string
+	ExpiresAt   time.Time
+}
+
+// PlaceHold 圈存, 可用餘額需足夠
+func (s *HoldService) PlaceHold(ctx context.Context, accountID uint64, in PlaceHoldInput) (*model.Hold, error) {
+	now := time.Now()
+	expiresAt := in.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(s.defaultTTL)
+	}
+	if !expiresAt.After(now) {
+		return nil, model.NewError(model.ErrInvalidRequest, "expires_at must be in the future")
+	}
+	if err := authorize(ctx, s.storage, accountID, auth.AccountTransfer); err != nil {
+		return nil, err
+	}
+
+	hold := &model.Hold{
+		AccountID:   accountID,
+		Amount:      in.Amount,
+		Currency:    in.Currency,
+		Description: in.Description,
+		ExpiresAt:   expiresAt,
+		TraceID:     trace.GetTraceID(ctx),
+	}
+	// 圈存中的金額計入限額用量, 請款時不再檢查
+	create := func() error {
+		return s.storage.CreateHold(hold)
+	}
+	var err error
+	if s.limits == nil {
+		err = create()
+	} else {
+		err = s.limits.Enforce(ctx, accountID, in.Amount, create)
+	}
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to place hold",
+			zap.Error(err),
+			zap.Uint64("accountId", accountID),
+			zap.String("amount", in.Amount.String()),
+		)
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("hold placed",
+		zap.Uint64("holdId", hold.ID),
+		zap.Uint64("accountId", accountID),
+		zap.String("amount", hold.Amount.String()),
+		zap.Time("expiresAt", hold.ExpiresAt),
+	)
+	return hold, nil
+}
+
+func (s *HoldService) GetHold(ctx context.Context, id uint64) (*model.Hold, error) {
+	return s.getHold(ctx, id, auth.AccountRead)
+}
+
+// getHold 呼叫者需為預授權帳戶的擁有者
+func (s *HoldService) getHold(ctx context.Context, id uint64, permission auth.Permission) (*model.Hold, error) {
+	hold, err := s.storage.GetHold(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, s.storage, hold.AccountID, permission); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// GetHolds 帳戶所有預授權, 依建立順序
+func (s *HoldService) GetHolds(ctx context.Context, accountID uint64) ([]*model.Hold, error) {
+	account, err := s.storage.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, account, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	holds, err := s.storage.GetHoldsByAccountID(accountID)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to get holds", zap.Error(err), zap.Uint64("accountId", accountID))
+		return nil, err
+	}
+	if holds == nil {
+		holds = []*model.Hold{}
+	}
+	return holds, nil
+}
+
+// CaptureHoldInput Amount為zero時請款全部剩餘金額
+type CaptureHoldInput struct {
+	Amount decimal.Decimal
+}
+
+// CaptureHold 請款, 以提款交易扣帳, 部分請款後剩餘金額仍圈存到解除或逾期
+func (s *HoldService) CaptureHold(ctx context.Context, id uint64, in CaptureHoldInput) (*model.Hold, *model.Transaction, error) {
+	hold, err := s.getHold(ctx, id, auth.AccountTransfer)
+	if err != nil {
+		return nil, nil, err
+	}
+	amount := in.Amount
+	if amount.IsZero() {
+		amount = hold.Remaining()
+	}
+
+	capture := model.NewCapture(hold, amount, trace.GetTraceID(ctx))
+	settle := func() error {
+		if s.fees != nil {
+			if err := s.fees.Attach(hold.AccountID, capture); err != nil {
+				return err
+			}
+		}
+		var err error
+		hold, err = s.storage.CaptureHold(capture)
+		return err
+	}
+	// 請款金額不超過圈存剩餘金額(storage檢查), 額度已在圈存時佔用
+	if s.limits == nil {
+		err = settle()
+	} else {
+		err = s.limits.Settle(hold.AccountID, settle)
+	}
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to capture hold",
+			zap.Error(err),
+			zap.Uint64("holdId", id),
+			zap.String("amount", amount.String()),
+		)
+		return nil, nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("hold captured",
+		zap.Uint64("holdId", id),
+		zap.Uint64("transactionId", capture.ID),
+		zap.String("amount", amount.String()),
+		zap.String("fee", capture.FeeAmount().String()),
+		zap.String("status", string(hold.Status)),
+	)
+	logOverdraftEvents(ctx, capture)
+	return hold, capture, nil
+}
+
+// ReleaseHold 解除剩餘圈存
+func (s *HoldService) ReleaseHold(ctx context.Context, id uint64) (*model.Hold, error) {
+	if _, err := s.getHold(ctx, id, auth.AccountTransfer); err != nil {
+		return nil, err
+	}
+	hold, err := s.storage.ReleaseHold(id)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to release hold", zap.Error(err), zap.Uint64("holdId", id))
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("hold released",
+		zap.Uint64("holdId", id),
+		zap.String("captured", hold.Captured.String()),
+	)
+	return hold, nil
+}
+
+// ExpireHolds 標記已逾期的預授權
+// 逾期的圈存在到期當下就不再計入, 這裡只是讓狀態落地並留下紀錄
+func (s *HoldService) ExpireHolds(ctx context.Context) ([]*model.Hold, error) {
+	expired, err := s.storage.ExpireHolds(time.Now())
+	for _, hold := range expired {
+		logger.WithTraceID(ctx).Info("hold expired",
+			zap.Uint64("holdId", hold.ID),
+			zap.Uint64("accountId", hold.AccountID),
+			zap.String("released", hold.Remaining().String()),
+		)
+	}
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to expire holds", zap.Error(err))
+	}
+	return expired, err
+}
+
+// RunExpiry 每interval標記一次逾期預授權, ctx結束時返回
+func (s *HoldService) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 錯誤已記錄, 下次再試
+			_, _ = s.ExpireHolds(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
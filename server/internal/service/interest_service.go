@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// InterestService 帳戶計息
+// 每天依前一天的日終餘額計提利息, 累計到月底入帳為interest交易
+// 排程停擺錯過的日子在下次執行時依當時的交易紀錄逐日補算
+type InterestService struct {
+	storage  storage.Storage
+	products map[string]model.Product
+	// mu 背景排程與手動補跑互斥
+	mu sync.Mutex
+}
+
+// NewInterestService products的key為產品名稱, 不分大小寫
+func NewInterestService(storage storage.Storage, products map[string]model.Product) *InterestService {
+	normalized := make(map[string]model.Product, len(products))
+	for name, product := range products {
+		name = strings.ToLower(name)
+		product.Name = name
+		normalized[name] = product
+	}
+	return &InterestService{
+		storage:  storage,
+		products: normalized,
+	}
+}
+
+// Products 已設定的計息產品, 依名稱排序
+func (s *InterestService) Products() []model.Product {
+	products := make([]model.Product, 0, len(s.products))
+	for _, product := range s.products {
+		products = append(products, product)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].Name < products[j].Name })
+	return products
+}
+
+func (s *InterestService) productNames() []string {
+	names := make([]string, 0, len(s.products))
+	for name := range s.products {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetProduct 指定帳戶的計息產品, 產品需為已設定的產品
+func (s *InterestService) SetProduct(ctx context.Context, accountID uint64, name string) (*model.Account, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := s.products[name]; !ok {
+		return nil, model.NewError(model.ErrInvalidRequest,
+			fmt.Sprintf("unknown product %q, available products: %s", name, strings.Join(s.productNames(), ", ")))
+	}
+	if err := authorize(ctx, s.storage, accountID, auth.AccountManage); err != nil {
+		return nil, err
+	}
+
+	account, err := s.storage.SetAccountProduct(accountID, name)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to set account product",
+			zap.Error(err),
+			zap.Uint64("accountId", accountID),
+			zap.String("product", name),
+		)
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("account product changed",
+		zap.Uint64("accountId", accountID),
+		zap.String("product", account.Product),
+		zap.Time("accruedThrough", account.AccruedThrough),
+	)
+	return account, nil
+}
+
+// GetAccruals 帳戶的每日計息紀錄
+func (s *InterestService) GetAccruals(ctx context.Context, accountID uint64) ([]model.InterestAccrual, error) {
+	if err := authorize(ctx, s.storage, accountID, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	return s.storage.GetInterestAccruals(accountID)
+}
+
+// RunAccrual 所有計息帳戶計息到now的前一天, 回傳本次新增的計息紀錄
+// 單一帳戶失敗不影響其他帳戶, 該帳戶下次執行時從未計息的日子繼續
+func (s *InterestService) RunAccrual(ctx context.Context, now time.Time) ([]model.InterestAccrual, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts, err := s.storage.GetInterestBearingAccounts()
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to list interest bearing accounts", zap.Error(err))
+		return nil, err
+	}
+
+	year, month, day := now.Local().Date()
+	through := time.Date(year, month, day-1, 0, 0, 0, 0, time.Local)
+	accruals := []model.InterestAccrual{}
+	for _, account := range accounts {
+		product, ok := s.products[account.Product]
+		if !ok {
+			logger.WithTraceID(ctx).Warn("account product is not configured, skip accrual",
+				zap.Uint64("accountId", account.ID),
+				zap.String("product", account.Product),
+			)
+			continue
+		}
+
+		accrued, err := s.storage.AccrueInterest(account.ID, product, through)
+		if err != nil {
+			logger.WithTraceID(ctx).Error("failed to accrue interest", zap.Error(err), zap.Uint64("accountId", account.ID))
+			continue
+		}
+		for _, accrual := range accrued {
+			if accrual.TransactionID != nil {
+				logger.WithTraceID(ctx).Info("interest posted",
+					zap.Uint64("accountId", account.ID),
+					zap.Uint64("transactionId", *accrual.TransactionID),
+					zap.String("amount", accrual.Posted.String()),
+					zap.String("date", accrual.Date.Format(time.DateOnly)),
+				)
+			}
+		}
+		if len(accrued) > 1 {
+			logger.WithTraceID(ctx).Info("missed interest accruals recomputed",
+				zap.Uint64("accountId", account.ID),
+				zap.Int("days", len(accrued)),
+				zap.String("from", accrued[0].Date.Format(time.DateOnly)),
+			)
+		}
+		accruals = append(accruals, accrued...)
+	}
+	return accruals, nil
+}
+
+// RunAccrualJob 每interval檢查一次, 當天已計息的帳戶不會重算, ctx結束時返回
+func (s *InterestService) RunAccrualJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 錯誤已記錄, 下次再試
+			_, _ = s.RunAccrual(ctx, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
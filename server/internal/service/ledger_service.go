@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// LedgerService 複式記帳總帳查詢
+type LedgerService struct {
+	storage storage.Storage
+}
+
+func NewLedgerService(storage storage.Storage) *LedgerService {
+	return &LedgerService{
+		storage: storage,
+	}
+}
+
+// TrialBalance 試算表, 借貸不平或帳戶餘額與分錄不符時記錄error log
+func (s *LedgerService) TrialBalance(ctx context.Context) (*model.TrialBalance, error) {
+	trial, err := s.storage.TrialBalance()
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to compute trial balance", zap.Error(err))
+		return nil, err
+	}
+
+	if !trial.Balanced {
+		logger.WithTraceID(ctx).Error("trial balance does not balance",
+			zap.String("totalDebit", trial.TotalDebit.String()),
+			zap.String("totalCredit", trial.TotalCredit.String()),
+			zap.Int("mismatchCount", len(trial.Mismatches)),
+		)
+	}
+
+	return trial, nil
+}
+
+// GetEntries 交易對應的借貸分錄
+func (s *LedgerService) GetEntries(ctx context.Context, transactionID uint64) ([]model.LedgerEntry, error) {
+	if err := authorizeTransaction(ctx, s.storage, transactionID, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	entries, err := s.storage.GetEntriesByTransactionID(transactionID)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to get ledger entries",
+			zap.Error(err),
+			zap.Uint64("transactionId", transactionID),
+		)
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// DefaultLimitWindow 限額的滾動視窗
+const DefaultLimitWindow = 24 * time.Hour
+
+// LimitConfig
+// Window: 累計金額與筆數的滾動視窗, <= 0 時為DefaultLimitWindow
+// Tiers: 各等級的限額, 帳戶未指定等級時用model.DefaultTier
+type LimitConfig struct {
+	Window time.Duration
+	Tiers  map[string]model.Limits
+}
+
+// LimitService 提款與轉出的限額, 用量由交易紀錄在滾動視窗內即時計算
+// 檢查與扣款在同一把帳戶鎖內執行, 同帳戶的併發請求不會一起超過限額
+type LimitService struct {
+	storage storage.Storage
+	window  time.Duration
+	tiers   map[string]model.Limits
+	locks   sync.Map // accountID -> *sync.Mutex
+}
+
+func NewLimitService(storage storage.Storage, cfg LimitConfig) *LimitService {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultLimitWindow
+	}
+	tiers := make(map[string]model.Limits, len(cfg.Tiers))
+	for name, limits := range cfg.Tiers {
+		tiers[strings.ToLower(name)] = limits
+	}
+	return &LimitService{
+		storage: storage,
+		window:  cfg.Window,
+		tiers:   tiers,
+	}
+}
+
+// Tiers 已設定的等級名稱, 依字母排序
+func (s *LimitService) Tiers() []string {
+	names := make([]string, 0, len(s.tiers))
+	for name := range s.tiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// limitsOf 帳戶生效的限額, 帳戶個別設定覆蓋等級設定; 等級已不在設定中時沿用預設等級
+func (s *LimitService) limitsOf(account *model.Account) model.Limits {
+	tier, ok := s.tiers[account.CurrentTier()]
+	if !ok {
+		tier = s.tiers[model.DefaultTier]
+	}
+	return tier.Override(account.Limits)
+}
+
+// Usage 帳戶目前的限額用量與剩餘額度
+func (s *LimitService) Usage(ctx context.Context, accountID uint64) (*model.LimitUsage, error) {
+	account, err := s.storage.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, account, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	usage, err := s.usage(account, time.Now())
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to compute limit usage", zap.Error(err), zap.Uint64("accountId", accountID))
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (s *LimitService) usage(account *model.Account, now time.Time) (*model.LimitUsage, error) {
+	windowStart := now.Add(-s.window)
+	debits, err := s.debits(account.ID, windowStart)
+	if err != nil {
+		return nil, err
+	}
+	holds, err := s.storage.GetHoldsByAccountID(account.ID)
+	if err != nil {
+		return nil, err
+	}
+	return model.NewLimitUsage(account, s.limitsOf(account), windowStart, now, debits, holds), nil
+}
+
+// debits 帳戶from之後的提款與轉出, 透過交易索引分頁讀取
+func (s *LimitService) debits(accountID uint64, from time.Time) ([]*model.Transaction, error) {
+	query := model.TransactionQuery{
+		AccountID: accountID,
+		Limit:     storage.MaxPageLimit,
+		Filter:    model.TransactionFilter{From: from},
+	}
+	var debits []*model.Transaction
+	for {
+		page, err := s.storage.QueryTransactions(query)
+		if err != nil {
+			return nil, err
+		}
+		for _, transaction := range page.Transactions {
+			if transaction.Debits(accountID) {
+				debits = append(debits, transaction)
+			}
+		}
+		if page.NextCursor == "" {
+			return debits, nil
+		}
+		if query.Cursor, err = model.DecodeCursor(page.NextCursor); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// lock 帳戶的限額鎖, 檢查與異動用量的操作需持有
+func (s *LimitService) lock(accountID uint64) *sync.Mutex {
+	value, _ := s.locks.LoadOrStore(accountID, &sync.Mutex{})
+	return value.(*sync.Mutex)
+}
+
+// Settle 持有帳戶鎖執行已佔用額度的扣款, 不再檢查限額
+// 預授權請款使用: 圈存時已檢查並佔用額度, 請款只是把圈存轉為交易, 持鎖避免其他檢查讀到轉換中的用量
+func (s *LimitService) Settle(accountID uint64, debit func() error) error {
+	lock := s.lock(accountID)
+	lock.Lock()
+	defer lock.Unlock()
+	return debit()
+}
+
+// Enforce 持有帳戶鎖檢查限額, 通過後執行debit
+// debit回傳錯誤時不佔用額度, 用量來自交易紀錄與圈存中的預授權
+func (s *LimitService) Enforce(ctx context.Context, accountID uint64, amount decimal.Decimal, debit func() error) error {
+	lock := s.lock(accountID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	account, err := s.storage.GetAccountByID(accountID)
+	if errors.Is(err, model.ErrAccountNotFound) {
+		// 帳戶不存在交由storage回傳對應的錯誤(e.g. source account not found)
+		return debit()
+	}
+	if err != nil {
+		return err
+	}
+	usage, err := s.usage(account, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := usage.Check(amount); err != nil {
+		logger.WithTraceID(ctx).Warn("transaction limit exceeded",
+			zap.Uint64("accountId", accountID),
+			zap.String("tier", usage.Tier),
+			zap.String("amount", amount.String()),
+			zap.String("usedAmount", usage.UsedAmount.String()),
+			zap.Int("usedCount", usage.UsedCount),
+			zap.String("heldAmount", usage.HeldAmount.String()),
+		)
+		return err
+	}
+	return debit()
+}
+
+// EnforceBatch 依帳戶ID順序持有所有轉出帳戶的鎖, 逐筆累計檢查限額, 全部通過後執行debit
+// 與Enforce使用同一組鎖, 批次與單筆併發時不會一起超過限額
+func (s *LimitService) EnforceBatch(ctx context.Context, transfers []*model.Transaction, debit func() error) error {
+	ids := make([]uint64, 0, len(transfers))
+	for _, transfer := range transfers {
+		ids = append(ids, *transfer.FromAccountID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		lock := s.lock(id)
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	now := time.Now()
+	usages := make(map[uint64]*model.LimitUsage)
+	for i, transfer := range transfers {
+		accountID := *transfer.FromAccountID
+		usage, ok := usages[accountID]
+		if !ok {
+			account, err := s.storage.GetAccountByID(accountID)
+			if errors.Is(err, model.ErrAccountNotFound) {
+				// 帳戶不存在交由storage回傳對應的錯誤
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if usage, err = s.usage(account, now); err != nil {
+				return err
+			}
+			usages[accountID] = usage
+		}
+		if err := usage.Check(transfer.Amount); err != nil {
+			logger.WithTraceID(ctx).Warn("transaction limit exceeded",
+				zap.Uint64("accountId", accountID),
+				zap.Int("batchIndex", i),
+				zap.String("tier", usage.Tier),
+				zap.String("amount", transfer.Amount.String()),
+				zap.String("usedAmount", usage.UsedAmount.String()),
+				zap.Int("usedCount", usage.UsedCount),
+				zap.String("heldAmount", usage.HeldAmount.String()),
+			)
+			return model.NewBatchError(i, err)
+		}
+		usage.Record(transfer.Amount)
+	}
+	return debit()
+}
+
+// CheckTier 等級需為已設定的等級, 回傳正規化後的名稱, 空字串代表不指定
+func (s *LimitService) CheckTier(tier string) (string, error) {
+	tier = strings.ToLower(strings.TrimSpace(tier))
+	if _, ok := s.tiers[tier]; tier != "" && !ok {
+		return "", model.NewError(model.ErrInvalidRequest,
+			fmt.Sprintf("unknown tier %q, available tiers: %s", tier, strings.Join(s.Tiers(), ", ")))
+	}
+	return tier, nil
+}
+
+// SetLimits 調整帳戶等級與個別限額
+func (s *LimitService) SetLimits(ctx context.Context, accountID uint64, tier string, limits *model.Limits) (*model.Account, error) {
+	tier, err := s.CheckTier(tier)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, s.storage, accountID, auth.AccountManage); err != nil {
+		return nil, err
+	}
+
+	account, err := s.storage.SetAccountLimits(accountID, tier, limits)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to set account limits",
+			zap.Error(err),
+			zap.Uint64("accountId", accountID),
+			zap.String("tier", tier),
+		)
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("account limits changed",
+		zap.Uint64("accountId", accountID),
+		zap.String("tier", account.CurrentTier()),
+		zap.Bool("override", account.Limits != nil),
+	)
+	return account, nil
+}
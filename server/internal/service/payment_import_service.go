@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/iso20022"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// pain001Scope 已匯入的MsgId記在IdempotencyStore的這個scope, 登入時再依使用者區分
+const pain001Scope = "pain.001"
+
+// importScope MsgId只在發起方內唯一, 登入的使用者各自一個scope, 與Idempotency-Key的隔離方式相同
+func importScope(ctx context.Context) string {
+	if principal, ok := auth.PrincipalFrom(ctx); ok {
+		return pain001Scope + ":user:" + strconv.FormatUint(principal.UserID, 10)
+	}
+	return pain001Scope
+}
+
+// PaymentImportService 匯入ISO 20022 pain.001批次付款, 每筆以AccountService.Transfer執行
+type PaymentImportService struct {
+	accounts *AccountService
+	imported storage.IdempotencyStore
+	window   time.Duration
+	bic      string
+}
+
+// NewPaymentImportService window內同一個MsgId只會執行一次, bic為pain.002中的本行BIC
+func NewPaymentImportService(accounts *AccountService, imported storage.IdempotencyStore, window time.Duration, bic string) *PaymentImportService {
+	return &PaymentImportService{
+		accounts: accounts,
+		imported: imported,
+		window:   window,
+		bic:      bic,
+	}
+}
+
+// Import 解析並執行pain.001
+// XML格式錯誤或不是pain.001回傳ErrInvalidRequest
+// 欄位不符規則或MsgId重複時整份退回(Status為RJCT), 不執行任何付款
+// 其他情況逐筆轉帳, 各筆成功與否互不影響
+func (s *PaymentImportService) Import(ctx context.Context, data []byte) (*model.PaymentImport, error) {
+	message, err := iso20022.ParsePain001(bytes.NewReader(data))
+	if err != nil {
+		logger.WithTraceID(ctx).Warn("failed to parse pain.001", zap.Error(err))
+		return nil, err
+	}
+
+	result := &model.PaymentImport{
+		MessageID:            message.GroupHeader.MessageID,
+		NumberOfTransactions: message.Count(),
+		ControlSum:           decimal.Zero,
+		PaymentInfos:         []model.PaymentInfoResult{},
+		CreatedAt:            time.Now(),
+	}
+	var invalid *iso20022.ValidationError
+	if err := message.Validate(); errors.As(err, &invalid) {
+		messages := make([]string, len(invalid.Problems))
+		for i, problem := range invalid.Problems {
+			messages[i] = problem.Message
+		}
+		result.Reject(invalid.Code(), messages...)
+		logger.WithTraceID(ctx).Warn("pain.001 rejected",
+			zap.String("messageId", result.MessageID),
+			zap.Strings("problems", messages),
+		)
+		return result, nil
+	}
+	for _, info := range message.PaymentInfos {
+		for _, transfer := range info.Transactions {
+			result.ControlSum = result.ControlSum.Add(decimal.RequireFromString(strings.TrimSpace(transfer.Amount.Value)))
+		}
+	}
+
+	scope := importScope(ctx)
+	hash := sha256.Sum256(data)
+	record, err := s.imported.Begin(scope, result.MessageID, hex.EncodeToString(hash[:]), s.window)
+	if record != nil || errors.Is(err, storage.ErrIdempotencyKeyMismatch) || errors.Is(err, storage.ErrIdempotencyKeyInProgress) {
+		result.Reject(iso20022.ReasonDuplicateMessage, "message "+result.MessageID+" has already been imported")
+		logger.WithTraceID(ctx).Warn("duplicate pain.001", zap.String("messageId", result.MessageID))
+		return result, nil
+	}
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to check pain.001 message id", zap.Error(err), zap.String("messageId", result.MessageID))
+		return nil, err
+	}
+
+	// 開始執行後MsgId不再釋放, 重送同一份檔案不會重複付款
+	for _, info := range message.PaymentInfos {
+		payments := make([]model.PaymentResult, len(info.Transactions))
+		for i, transfer := range info.Transactions {
+			payments[i] = s.execute(ctx, info, transfer)
+		}
+		result.Add(model.PaymentInfoResult{ID: info.ID, Payments: payments})
+	}
+
+	summary, _ := json.Marshal(result)
+	if err := s.imported.Complete(scope, result.MessageID, http.StatusOK, summary); err != nil {
+		logger.WithTraceID(ctx).Error("failed to save pain.001 message id", zap.Error(err), zap.String("messageId", result.MessageID))
+	}
+
+	logger.WithTraceID(ctx).Info("pain.001 imported",
+		zap.String("messageId", result.MessageID),
+		zap.String("status", string(result.Status)),
+		zap.Int("settled", result.Settled),
+		zap.Int("rejected", result.Rejected),
+	)
+	return result, nil
+}
+
+// execute 執行單筆付款, 失敗時記錄原因代碼
+func (s *PaymentImportService) execute(ctx context.Context, info iso20022.PaymentInfo, transfer iso20022.CreditTransfer) model.PaymentResult {
+	payment := model.PaymentResult{
+		InstructionID:   transfer.InstructionID,
+		EndToEndID:      transfer.EndToEndID,
+		DebtorAccount:   info.DebtorAccount.String(),
+		CreditorAccount: transfer.CreditorAccount.String(),
+		Amount:          decimal.RequireFromString(strings.TrimSpace(transfer.Amount.Value)),
+		Currency:        transfer.Amount.Currency,
+		Status:          model.PaymentStatusRejected,
+	}
+	reject := func(reason string, err error) model.PaymentResult {
+		payment.Reason, payment.Message = reason, err.Error()
+		logger.WithTraceID(ctx).Warn("pain.001 payment rejected",
+			zap.String("endToEndId", payment.EndToEndID),
+			zap.String("reason", reason),
+			zap.Error(err),
+		)
+		return payment
+	}
+
+	if info.ExecutionDay().After(time.Now()) {
+		return reject(iso20022.ReasonExecutionDateInFuture,
+			errors.New("requested execution date "+info.ExecutionDate+" is in the future, only immediate execution is supported"))
+	}
+	debtorID, err := info.DebtorAccount.AccountID()
+	if err != nil {
+		return reject(iso20022.ReasonInvalidDebtorAccount, err)
+	}
+	creditorID, err := transfer.CreditorAccount.AccountID()
+	if err != nil {
+		return reject(iso20022.ReasonInvalidCreditorAccount, err)
+	}
+
+	transaction, err := s.accounts.Transfer(ctx, TransferInput{
+		FromAccountID: debtorID,
+		ToAccountID:   creditorID,
+		Amount:        payment.Amount,
+		Currency:      payment.Currency,
+		Description:   transfer.Description(),
+	})
+	if err != nil {
+		return reject(paymentReason(err), err)
+	}
+	payment.Status, payment.Transaction = model.PaymentStatusSettled, transaction
+	return payment
+}
+
+// paymentReason 轉帳失敗對應的pain.002原因代碼
+func paymentReason(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrSourceAccountNotFound):
+		return iso20022.ReasonInvalidDebtorAccount
+	case errors.Is(err, storage.ErrDestinationAccountNotFound):
+		return iso20022.ReasonInvalidCreditorAccount
+	case errors.Is(err, model.ErrAccountNotFound), errors.Is(err, model.ErrSameAccount):
+		return iso20022.ReasonIncorrectAccount
+	case errors.Is(err, model.ErrAccountClosed):
+		return iso20022.ReasonClosedAccount
+	case errors.Is(err, model.ErrAccountFrozen):
+		return iso20022.ReasonBlockedAccount
+	case errors.Is(err, model.ErrInsufficientBalance):
+		return iso20022.ReasonInsufficientFunds
+	case errors.Is(err, model.ErrLimitExceeded):
+		return iso20022.ReasonNotAllowedAmount
+	case errors.Is(err, model.ErrCurrencyMismatch), errors.Is(err, model.ErrUnsupportedCurrency):
+		return iso20022.ReasonNotAllowedCurrency
+	case errors.Is(err, model.ErrInvalidAmount):
+		return iso20022.ReasonInvalidAmount
+	case errors.Is(err, model.ErrForbidden):
+		return iso20022.ReasonTransactionForbidden
+	}
+	return iso20022.ReasonNarrative
+}
+
+// WriteReport 依匯入結果寫出pain.002付款狀態報告
+func (s *PaymentImportService) WriteReport(w io.Writer, result *model.PaymentImport) error {
+	return iso20022.WritePain002(w, result, iso20022.Options{BIC: s.bic, GeneratedAt: result.CreatedAt})
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// authorize 呼叫者對帳戶執行permission的授權, 依角色的範圍:
+// ScopeAny為所有帳戶, ScopeOwn只限呼叫者擁有的帳戶
+// context沒有呼叫者時為系統作業(排程、未啟用驗證的呼叫), 不檢查
+func authorize(ctx context.Context, store storage.Storage, accountID uint64, permission auth.Permission) error {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok || auth.Evaluate(principal, permission) == auth.ScopeAny {
+		return nil
+	}
+	account, err := store.GetAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	return checkAccess(ctx, account, permission)
+}
+
+// checkAccess 已取得帳戶時的authorize
+func checkAccess(ctx context.Context, account *model.Account, permission auth.Permission) error {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil
+	}
+	switch auth.Evaluate(principal, permission) {
+	case auth.ScopeAny:
+		return nil
+	case auth.ScopeOwn:
+		if account.OwnerID == principal.UserID {
+			return nil
+		}
+		return deny(ctx, principal, permission, account.ID, fmt.Sprintf("account %d does not belong to the caller", account.ID))
+	}
+	return deny(ctx, principal, permission, account.ID, fmt.Sprintf("role %s is not allowed to %s", principal.Role, permission))
+}
+
+// deny 記錄被拒絕的操作並回傳ErrForbidden
+func deny(ctx context.Context, principal *auth.Principal, permission auth.Permission, accountID uint64, message string) error {
+	logger.WithTraceID(ctx).Warn("access denied",
+		zap.Uint64("userId", principal.UserID),
+		zap.String("role", string(principal.Role)),
+		zap.String("permission", string(permission)),
+		zap.Uint64("accountId", accountID),
+	)
+	return model.NewError(model.ErrForbidden, message)
+}
+
+// authorizeTransaction 呼叫者需能對交易任一方帳戶執行permission
+func authorizeTransaction(ctx context.Context, store storage.Storage, transactionID uint64, permission auth.Permission) error {
+	if _, ok := auth.PrincipalFrom(ctx); !ok {
+		return nil
+	}
+	transaction, err := store.GetTransactionByID(transactionID)
+	if err != nil {
+		return err
+	}
+	accounts := []uint64{transaction.ToAccountID}
+	if transaction.FromAccountID != nil {
+		accounts = append(accounts, *transaction.FromAccountID)
+	}
+	for _, accountID := range accounts {
+		if accountID == 0 {
+			continue
+		}
+		if err := authorize(ctx, store, accountID, permission); !errors.Is(err, model.ErrForbidden) {
+			return err
+		}
+	}
+	return model.NewError(model.ErrForbidden, fmt.Sprintf("transaction %d does not belong to the caller", transactionID))
+}
+
+// accountOwner 新帳戶的擁有者, ownerID為0時為呼叫者
+// 替其他使用者開戶需有ScopeAny的AccountCreate; 系統作業建立的帳戶沒有指定時沒有擁有者
+func accountOwner(ctx context.Context, store storage.Storage, ownerID uint64) (uint64, error) {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return ownerID, nil
+	}
+	scope := auth.Evaluate(principal, auth.AccountCreate)
+	if ownerID == 0 || ownerID == principal.UserID {
+		if scope == auth.ScopeNone {
+			return 0, deny(ctx, principal, auth.AccountCreate, 0, fmt.Sprintf("role %s is not allowed to %s", principal.Role, auth.AccountCreate))
+		}
+		return principal.UserID, nil
+	}
+	if scope != auth.ScopeAny {
+		return 0, deny(ctx, principal, auth.AccountCreate, 0, "only admins can open accounts for other users")
+	}
+	if _, err := store.GetUserByID(ownerID); err != nil {
+		return 0, err
+	}
+	return ownerID, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/kokp520/banking-system/server/pkg/trace"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// ReversalService 沖正與退款: 以反向交易退回存款或轉帳, 原交易不變
+type ReversalService struct {
+	storage storage.Storage
+}
+
+func NewReversalService(storage storage.Storage) *ReversalService {
+	return &ReversalService{
+		storage: storage,
+	}
+}
+
+// ReverseInput Amount為zero時沖正剩餘全額, Reason會記為沖正交易的描述
+type ReverseInput struct {
+	Amount decimal.Decimal
+	Reason string
+}
+
+// Reverse 沖正交易, 可分次部分退款, 累計不超過原交易金額
+// 不受限額控管, 限額只計入客戶發起的提款與轉出
+// 呼叫者需有TransactionReverse, 依沖正時扣款帳戶(原交易入帳方)檢查
+func (s *ReversalService) Reverse(ctx context.Context, transactionID uint64, in ReverseInput) (*model.Reversal, error) {
+	if _, ok := auth.PrincipalFrom(ctx); ok {
+		original, err := s.storage.GetTransactionByID(transactionID)
+		if err != nil {
+			return nil, err
+		}
+		// 扣款帳戶由反向交易決定: 存款沖正為原存入帳戶, 轉帳沖正為原轉入帳戶, 不是原交易的轉出方
+		bound := model.NewReversal(transactionID, decimal.Zero, in.Reason, "")
+		if err := bound.BindReversal(original, decimal.Zero); err != nil {
+			return nil, err
+		}
+		debit, _ := bound.ReversalAccounts()
+		if err := authorize(ctx, s.storage, debit, auth.TransactionReverse); err != nil {
+			return nil, err
+		}
+	}
+	reversal := model.NewReversal(transactionID, in.Amount, in.Reason, trace.GetTraceID(ctx))
+	result, err := s.storage.Reverse(reversal)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to reverse transaction",
+			zap.Error(err),
+			zap.Uint64("transactionId", transactionID),
+			zap.String("amount", in.Amount.String()),
+		)
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("transaction reversed",
+		zap.Uint64("transactionId", transactionID),
+		zap.Uint64("reversalId", reversal.ID),
+		zap.String("amount", reversal.Amount.String()),
+		zap.String("refundable", result.Refundable.String()),
+	)
+	logOverdraftEvents(ctx, reversal)
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReverseAuthorizesDebitedAccount 只限自己帳戶的沖正權限依沖正時的扣款帳戶檢查
+// 轉帳沖正由原轉入帳戶扣款, 只擁有原轉出帳戶的呼叫者不能把款項扣回
+func TestReverseAuthorizesDebitedAccount(t *testing.T) {
+	logger.Init("info", "json", "")
+	restore := auth.OverrideGrant(model.RoleCustomer, auth.TransactionReverse, auth.ScopeOwn)
+	defer restore()
+
+	store := storage.NewMemoryStorage()
+	sender := &model.Account{Name: "sender", Balance: decimal.NewFromInt(100), OwnerID: 1}
+	recipient := &model.Account{Name: "recipient", Balance: decimal.Zero, OwnerID: 2}
+	require.NoError(t, store.CreateAccount(sender))
+	require.NoError(t, store.CreateAccount(recipient))
+	transfer := model.NewTransfer(sender.ID, recipient.ID, decimal.NewFromInt(40), "")
+	require.NoError(t, store.Transfer(transfer))
+
+	service := NewReversalService(store)
+	as := func(userID uint64) context.Context {
+		return auth.WithPrincipal(context.Background(), &auth.Principal{UserID: userID, Role: model.RoleCustomer})
+	}
+
+	_, err := service.Reverse(as(1), transfer.ID, ReverseInput{Amount: decimal.NewFromInt(10)})
+	assert.ErrorIs(t, err, model.ErrForbidden)
+	got, err := store.GetAccountByID(recipient.ID)
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(40).Equal(got.Balance))
+
+	result, err := service.Reverse(as(2), transfer.ID, ReverseInput{Amount: decimal.NewFromInt(10)})
+	require.NoError(t, err)
+	assert.Equal(t, recipient.ID, *result.Reversal.FromAccountID)
+	assert.Equal(t, sender.ID, result.Reversal.ToAccountID)
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/kokp520/banking-system/server/pkg/trace"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// DefaultRetryPolicy 未設定時可重試的失敗每小時重試, 最多3次
+var DefaultRetryPolicy = model.RetryPolicy{MaxRetries: 3, IntervalSeconds: 3600}
+
+// StandingOrderService 定期與預約轉帳
+// 排程到期時經AccountService.Transfer執行, 與一般轉帳走相同的狀態、限額與餘額檢查
+type StandingOrderService struct {
+	storage  storage.Storage
+	accounts *AccountService
+	retry    model.RetryPolicy
+	// mu 執行與暫停/恢復/取消互斥, 執行結果不會覆蓋同時發生的狀態變更
+	mu sync.Mutex
+}
+
+// NewStandingOrderService retry.IntervalSeconds <= 0 時使用DefaultRetryPolicy
+func NewStandingOrderService(storage storage.Storage, accounts *AccountService, retry model.RetryPolicy) *StandingOrderService {
+	if retry.IntervalSeconds <= 0 {
+		retry = DefaultRetryPolicy
+	}
+	return &StandingOrderService{
+		storage:  storage,
+		accounts: accounts,
+		retry:    retry,
+	}
+}
+
+// CreateStandingOrderInput StartAt為zero時立即開始, EndAt為zero代表不結束, Retry為nil時使用預設
+type CreateStandingOrderInput struct {
+	ToAccountID uint64
+	Amount      decimal.Decimal
+	Currency    string
+	Description string
+	Schedule    model.Schedule
+	StartAt     time.Time
+	EndAt       time.Time
+	Retry       *model.RetryPolicy
+}
+
+// CreateStandingOrder 建立時檢查雙方帳戶與幣別, 日期以伺服器時區計算
+func (s *StandingOrderService) CreateStandingOrder(ctx context.Context, fromAccountID uint64, in CreateStandingOrderInput) (*model.StandingOrder, error) {
+	order, err := s.newStandingOrder(ctx, fromAccountID, in)
+	if err != nil {
+		return nil, err
+	}
+	order.TraceID = trace.GetTraceID(ctx)
+	if err := s.storage.CreateStandingOrder(order); err != nil {
+		logger.WithTraceID(ctx).Error("failed to create standing order",
+			zap.Error(err),
+			zap.Uint64("fromAccountId", fromAccountID),
+			zap.Uint64("toAccountId", in.ToAccountID),
+		)
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("standing order created",
+		zap.Uint64("standingOrderId", order.ID),
+		zap.Uint64("fromAccountId", order.FromAccountID),
+		zap.Uint64("toAccountId", order.ToAccountID),
+		zap.String("amount", order.Amount.String()),
+		zap.String("frequency", string(order.Schedule.Frequency)),
+		zap.Time("dueAt", order.DueAt),
+	)
+	return order, nil
+}
+
+func (s *StandingOrderService) newStandingOrder(ctx context.Context, fromAccountID uint64, in CreateStandingOrderInput) (*model.StandingOrder, error) {
+	if !in.Amount.IsPositive() {
+		return nil, model.NewError(model.ErrInvalidAmount, "amount must be greater than 0")
+	}
+	if fromAccountID == in.ToAccountID {
+		return nil, model.ErrSameAccount
+	}
+	if err := in.Schedule.Validate(); err != nil {
+		return nil, err
+	}
+	retry := s.retry
+	if in.Retry != nil {
+		retry = *in.Retry
+	}
+	if err := retry.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	startAt := in.StartAt
+	if startAt.IsZero() {
+		startAt = now
+	}
+	// 容許呼叫端一分鐘內的時鐘誤差
+	if startAt.Before(now.Add(-time.Minute)) {
+		return nil, model.NewError(model.ErrInvalidRequest, "start_at cannot be in the past")
+	}
+
+	from, err := s.storage.GetAccountByID(fromAccountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, from, auth.AccountTransfer); err != nil {
+		return nil, err
+	}
+	to, err := s.storage.GetAccountByID(in.ToAccountID)
+	if errors.Is(err, model.ErrAccountNotFound) {
+		return nil, storage.ErrDestinationAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	order := &model.StandingOrder{
+		FromAccountID: fromAccountID,
+		ToAccountID:   in.ToAccountID,
+		Amount:        in.Amount,
+		Currency:      in.Currency,
+		Description:   in.Description,
+		Schedule:      in.Schedule,
+		Retry:         retry,
+		StartAt:       startAt.Local(),
+	}
+	if !in.EndAt.IsZero() {
+		order.EndAt = in.EndAt.Local()
+	}
+	if err := order.BindAccounts(from, to); err != nil {
+		return nil, err
+	}
+	if err := order.Start(); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *StandingOrderService) GetStandingOrder(ctx context.Context, id uint64) (*model.StandingOrder, error) {
+	return s.getStandingOrder(ctx, id, auth.AccountRead)
+}
+
+// getStandingOrder 呼叫者需為轉出帳戶的擁有者
+func (s *StandingOrderService) getStandingOrder(ctx context.Context, id uint64, permission auth.Permission) (*model.StandingOrder, error) {
+	order, err := s.storage.GetStandingOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, s.storage, order.FromAccountID, permission); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// GetStandingOrders 帳戶轉出的定期轉帳, 依建立順序
+func (s *StandingOrderService) GetStandingOrders(ctx context.Context, accountID uint64) ([]*model.StandingOrder, error) {
+	account, err := s.storage.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, account, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	orders, err := s.storage.GetStandingOrdersByAccountID(accountID)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to get standing orders", zap.Error(err), zap.Uint64("accountId", accountID))
+		return nil, err
+	}
+	if orders == nil {
+		orders = []*model.StandingOrder{}
+	}
+	return orders, nil
+}
+
+// GetRuns 執行紀錄, 每筆帶執行時的trace id
+func (s *StandingOrderService) GetRuns(ctx context.Context, id uint64) ([]*model.StandingOrderRun, error) {
+	if _, err := s.getStandingOrder(ctx, id, auth.AccountRead); err != nil {
+		return nil, err
+	}
+	return s.storage.GetStandingOrderRuns(id)
+}
+
+func (s *StandingOrderService) Pause(ctx context.Context, id uint64) (*model.StandingOrder, error) {
+	return s.transition(ctx, id, "paused", (*model.StandingOrder).Pause)
+}
+
+// Resume 定期的排程從下一個未過的期數繼續
+func (s *StandingOrderService) Resume(ctx context.Context, id uint64) (*model.StandingOrder, error) {
+	return s.transition(ctx, id, "resumed", (*model.StandingOrder).Resume)
+}
+
+func (s *StandingOrderService) Cancel(ctx context.Context, id uint64) (*model.StandingOrder, error) {
+	return s.transition(ctx, id, "cancelled", (*model.StandingOrder).Cancel)
+}
+
+// transition 在mu內讀取、變更並寫回, 與執行互斥
+func (s *StandingOrderService) transition(ctx context.Context, id uint64, action string, apply func(*model.StandingOrder, time.Time) error) (*model.StandingOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.getStandingOrder(ctx, id, auth.AccountTransfer)
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(order, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.storage.UpdateStandingOrder(order, nil); err != nil {
+		logger.WithTraceID(ctx).Error("failed to update standing order", zap.Error(err), zap.Uint64("standingOrderId", id))
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("standing order "+action,
+		zap.Uint64("standingOrderId", id),
+		zap.String("status", string(order.Status)),
+	)
+	return order, nil
+}
+
+// RunDue 執行now時到期的定期轉帳, 每筆各自一個trace id, 回傳本次的執行紀錄
+// 排程停擺期間錯過的期數會逐期補執行, 每次RunDue每筆最多執行一期
+func (s *StandingOrderService) RunDue(ctx context.Context, now time.Time) ([]*model.StandingOrderRun, error) {
+	due, err := s.storage.DueStandingOrders(now)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to list due standing orders", zap.Error(err))
+		return nil, err
+	}
+
+	runs := []*model.StandingOrderRun{}
+	for _, order := range due {
+		run, err := s.execute(order.ID, now)
+		if err != nil {
+			// 寫回失敗, 下次排程再處理
+			logger.WithTraceID(ctx).Error("failed to record standing order run", zap.Error(err), zap.Uint64("standingOrderId", order.ID))
+			continue
+		}
+		if run != nil {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+// execute 重新讀取確認仍到期後轉帳, 並寫回排程與執行紀錄
+// 轉帳帶這一期的reference, 轉帳後寫回前crash時重啟後找到原本的轉帳補寫紀錄, 不會再付一次
+func (s *StandingOrderService) execute(id uint64, now time.Time) (*model.StandingOrderRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.storage.GetStandingOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	if !order.Due(now) {
+		return nil, nil
+	}
+
+	traceID := uuid.New().String()
+	ctx := trace.WithTraceID(context.Background(), traceID)
+	description := order.Description
+	if description == "" {
+		description = fmt.Sprintf("Standing order %d", order.ID)
+	}
+	transfer, err := s.storage.GetTransactionByReference(order.Reference())
+	switch {
+	case err == nil:
+		logger.WithTraceID(ctx).Warn("standing order already transferred, recording run",
+			zap.Uint64("standingOrderId", order.ID),
+			zap.Uint64("transactionId", transfer.ID),
+		)
+	case errors.Is(err, model.ErrTransactionNotFound):
+		transfer, err = s.accounts.Transfer(ctx, TransferInput{
+			FromAccountID: order.FromAccountID,
+			ToAccountID:   order.ToAccountID,
+			Amount:        order.Amount,
+			Currency:      order.Currency,
+			Description:   description,
+			Reference:     order.Reference(),
+		})
+	default:
+		return nil, err
+	}
+
+	run := model.NewStandingOrderRun(order, transfer, err, now, traceID)
+	if err != nil {
+		order.Fail(err, model.Retryable(err), now)
+		logger.WithTraceID(ctx).Warn("standing order failed",
+			zap.Error(err),
+			zap.Uint64("standingOrderId", order.ID),
+			zap.Int("attempt", run.Attempt),
+			zap.String("status", string(order.Status)),
+			zap.Time("nextRunAt", order.NextRunAt),
+		)
+	} else {
+		order.Succeed(now)
+		logger.WithTraceID(ctx).Info("standing order executed",
+			zap.Uint64("standingOrderId", order.ID),
+			zap.Uint64("transactionId", transfer.ID),
+			zap.String("status", string(order.Status)),
+			zap.Time("nextRunAt", order.NextRunAt),
+		)
+	}
+
+	if err := s.storage.UpdateStandingOrder(order, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// RunScheduler 每interval執行一次到期的定期轉帳, ctx結束時返回
+func (s *StandingOrderService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 錯誤已記錄, 下次再試
+			_, _ = s.RunDue(ctx, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/export"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// StatementService 帳戶對帳單與匯出
+type StatementService struct {
+	storage storage.Storage
+	bic     string
+}
+
+// NewStatementService bic為匯出檔案中的銀行代碼, 空字串代表不帶
+func NewStatementService(storage storage.Storage, bic string) *StatementService {
+	return &StatementService{
+		storage: storage,
+		bic:     bic,
+	}
+}
+
+// GetStatement 帳戶在[from, to)期間的對帳單, from為zero時從開戶開始, to為zero時到現在
+// 餘額由帳戶的所有交易推算, 與帳戶餘額不一致時不回傳對帳單
+func (s *StatementService) GetStatement(ctx context.Context, accountID uint64, from, to time.Time) (*model.Statement, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !from.IsZero() && !from.Before(to) {
+		return nil, model.NewError(model.ErrInvalidRequest, "from must be before to")
+	}
+
+	account, history, err := s.storage.GetAccountHistory(accountID)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to get account history", zap.Error(err), zap.Uint64("accountId", accountID))
+		return nil, err
+	}
+	if err := checkAccess(ctx, account, auth.AccountRead); err != nil {
+		return nil, err
+	}
+
+	statement, err := model.NewStatement(account, history, from, to)
+	if errors.Is(err, model.ErrStatementUnreconciled) {
+		logger.WithTraceID(ctx).Error("statement does not reconcile",
+			zap.Error(err),
+			zap.Uint64("accountId", accountID),
+			zap.String("balance", account.Balance.String()),
+		)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithTraceID(ctx).Info("statement generated",
+		zap.Uint64("accountId", accountID),
+		zap.Time("from", statement.From),
+		zap.Time("to", statement.To),
+		zap.Int("transactionCount", len(statement.Lines)),
+	)
+	return statement, nil
+}
+
+// Export 產生對帳單並依format匯出, 對帳單通過對帳後才回傳
+// 回傳時還沒寫出任何資料, 錯誤可以正常回應; 寫出由handler設定header後進行
+func (s *StatementService) Export(ctx context.Context, accountID uint64, from, to time.Time, format string) (*export.File, error) {
+	f, err := export.Lookup(format)
+	if err != nil {
+		return nil, err
+	}
+	statement, err := s.GetStatement(ctx, accountID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &export.File{
+		Format:    f,
+		Statement: statement,
+		Options:   export.Options{BIC: s.bic, GeneratedAt: time.Now()},
+	}, nil
+}
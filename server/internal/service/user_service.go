@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/auth"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/storage"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials 帳號不存在與密碼錯誤回傳相同的錯誤, 不透露帳號是否存在
+var ErrInvalidCredentials = model.NewError(model.ErrUnauthorized, "invalid username or password")
+
+// UserService 使用者註冊與登入, 登入成功簽發JWT
+type UserService struct {
+	storage storage.Storage
+	jwt     *auth.JWT
+	// dummyHash 帳號不存在時仍比對一次, 回應時間與密碼錯誤相同
+	dummyHash []byte
+}
+
+func NewUserService(storage storage.Storage, jwt *auth.JWT) *UserService {
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	return &UserService{
+		storage:   storage,
+		jwt:       jwt,
+		dummyHash: dummyHash,
+	}
+}
+
+// Register 建立使用者, username不分大小寫, 角色為customer
+func (s *UserService) Register(ctx context.Context, username, password string) (*model.User, error) {
+	user, err := s.createUser(ctx, username, password, model.RoleCustomer)
+	if err != nil {
+		return nil, err
+	}
+	logger.WithTraceID(ctx).Info("user registered", zap.Uint64("userId", user.ID), zap.String("username", user.Username))
+	return user, nil
+}
+
+func (s *UserService) createUser(ctx context.Context, username, password string, role model.Role) (*model.User, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if err := model.CheckCredentials(username, password); err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		Username:     username,
+		Role:         role,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now(),
+	}
+	if err := s.storage.CreateUser(user); err != nil {
+		logger.WithTraceID(ctx).Warn("failed to register user", zap.Error(err), zap.String("username", username))
+		return nil, err
+	}
+	return user, nil
+}
+
+// EnsureAdmin 啟動時建立初始admin, 讓系統有人可以指派角色
+// 使用者已存在時不變更其角色與密碼
+func (s *UserService) EnsureAdmin(ctx context.Context, username, password string) error {
+	existing, err := s.storage.GetUserByUsername(strings.ToLower(strings.TrimSpace(username)))
+	if err == nil {
+		if existing.Role != model.RoleAdmin {
+			logger.WithTraceID(ctx).Warn("bootstrap admin username is taken by a non-admin user",
+				zap.Uint64("userId", existing.ID), zap.String("role", string(existing.Role)))
+		}
+		return nil
+	}
+	if !errors.Is(err, model.ErrUserNotFound) {
+		return err
+	}
+
+	user, err := s.createUser(ctx, username, password, model.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	logger.WithTraceID(ctx).Info("bootstrap admin created", zap.Uint64("userId", user.ID), zap.String("username", user.Username))
+	return nil
+}
+
+// Login 驗證密碼並簽發access token
+func (s *UserService) Login(ctx context.Context, username, password string) (*model.Token, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	user, err := s.storage.GetUserByUsername(username)
+	if errors.Is(err, model.ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		logger.WithTraceID(ctx).Warn("login failed", zap.String("username", username), zap.String("reason", "unknown user"))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		logger.WithTraceID(ctx).Warn("login failed", zap.Uint64("userId", user.ID), zap.String("reason", "wrong password"))
+		return nil, ErrInvalidCredentials
+	}
+
+	token, err := s.jwt.Issue(user)
+	if err != nil {
+		logger.WithTraceID(ctx).Error("failed to issue token", zap.Error(err), zap.Uint64("userId", user.ID))
+		return nil, err
+	}
+	logger.WithTraceID(ctx).Info("user logged in", zap.Uint64("userId", user.ID), zap.Time("expiresAt", token.ExpiresAt))
+	return token, nil
+}
+
+// Me 目前登入的使用者
+func (s *UserService) Me(ctx context.Context) (*model.User, error) {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, model.NewError(model.ErrUnauthorized, "login required")
+	}
+	return s.storage.GetUserByID(principal.UserID)
+}
+
+// SetRole 變更使用者角色, 已簽發的token立即套用新角色
+// admin不能變更自己的角色, 避免系統沒有admin
+func (s *UserService) SetRole(ctx context.Context, id uint64, role string) (*model.User, error) {
+	parsed, err := model.ParseRole(role)
+	if err != nil {
+		return nil, err
+	}
+	if principal, ok := auth.PrincipalFrom(ctx); ok && principal.UserID == id {
+		return nil, model.NewError(model.ErrInvalidRequest, "cannot change your own role")
+	}
+
+	user, err := s.storage.SetUserRole(id, parsed)
+	if err != nil {
+		return nil, err
+	}
+	logger.WithTraceID(ctx).Info("user role changed", zap.Uint64("userId", user.ID), zap.String("role", string(user.Role)))
+	return user, nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountStatusTransitions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "status", Balance: decimal.NewFromInt(10)}
+		require.NoError(t, storage.CreateAccount(account))
+		assert.Equal(t, model.AccountStatusActive, account.Status)
+
+		_, err := storage.UpdateAccountStatus(account.ID, model.AccountStatusFrozen, " ")
+		assert.ErrorIs(t, err, model.ErrInvalidRequest)
+		_, err = storage.UpdateAccountStatus(999, model.AccountStatusFrozen, "fraud")
+		assert.ErrorIs(t, err, model.ErrAccountNotFound)
+		_, err = storage.UpdateAccountStatus(account.ID, model.AccountStatusActive, "already active")
+		assert.ErrorIs(t, err, model.ErrInvalidStatusTransition)
+
+		frozen, err := storage.UpdateAccountStatus(account.ID, model.AccountStatusFrozen, "suspicious login")
+		require.NoError(t, err)
+		assert.Equal(t, model.AccountStatusFrozen, frozen.Status)
+		assert.Equal(t, "suspicious login", frozen.StatusReason)
+
+		retrieved, err := storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.AccountStatusFrozen, retrieved.Status)
+		assert.Equal(t, "suspicious login", retrieved.StatusReason)
+
+		// 有餘額不能結清
+		_, err = storage.UpdateAccountStatus(account.ID, model.AccountStatusClosed, "customer request")
+		assert.ErrorIs(t, err, model.ErrBalanceNotZero)
+
+		_, err = storage.UpdateAccountStatus(account.ID, model.AccountStatusActive, "verified")
+		require.NoError(t, err)
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(10), "")))
+
+		closed, err := storage.UpdateAccountStatus(account.ID, model.AccountStatusClosed, "customer request")
+		require.NoError(t, err)
+		assert.Equal(t, model.AccountStatusClosed, closed.Status)
+
+		// 結清後不能再變更
+		_, err = storage.UpdateAccountStatus(account.ID, model.AccountStatusActive, "reopen")
+		assert.ErrorIs(t, err, model.ErrInvalidStatusTransition)
+	})
+}
+
+func TestAccountStatusEnforcement(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		frozen := &model.Account{Name: "frozen", Balance: decimal.NewFromInt(50)}
+		active := &model.Account{Name: "active", Balance: decimal.NewFromInt(50)}
+		closed := &model.Account{Name: "closed"}
+		require.NoError(t, storage.CreateAccount(frozen))
+		require.NoError(t, storage.CreateAccount(active))
+		require.NoError(t, storage.CreateAccount(closed))
+
+		_, err := storage.UpdateAccountStatus(frozen.ID, model.AccountStatusFrozen, "fraud")
+		require.NoError(t, err)
+		_, err = storage.UpdateAccountStatus(closed.ID, model.AccountStatusClosed, "done")
+		require.NoError(t, err)
+
+		// frozen: 可以入帳, 不能轉出
+		assert.NoError(t, storage.Deposit(model.NewDeposit(frozen.ID, decimal.NewFromInt(1), "")))
+		assert.NoError(t, storage.Transfer(model.NewTransfer(active.ID, frozen.ID, decimal.NewFromInt(1), "")))
+		assert.ErrorIs(t, storage.Withdraw(model.NewWithdraw(frozen.ID, decimal.NewFromInt(1), "")), model.ErrAccountFrozen)
+		assert.ErrorIs(t, storage.Transfer(model.NewTransfer(frozen.ID, active.ID, decimal.NewFromInt(1), "")), model.ErrAccountFrozen)
+
+		// closed: 全部拒絕
+		assert.ErrorIs(t, storage.Deposit(model.NewDeposit(closed.ID, decimal.NewFromInt(1), "")), model.ErrAccountClosed)
+		assert.ErrorIs(t, storage.Withdraw(model.NewWithdraw(closed.ID, decimal.NewFromInt(1), "")), model.ErrAccountClosed)
+		assert.ErrorIs(t, storage.Transfer(model.NewTransfer(active.ID, closed.ID, decimal.NewFromInt(1), "")), model.ErrAccountClosed)
+		assert.ErrorIs(t, storage.Transfer(model.NewTransfer(closed.ID, active.ID, decimal.NewFromInt(1), "")), model.ErrAccountClosed)
+
+		// 被拒絕的交易不影響餘額
+		retrieved, err := storage.GetAccountByID(frozen.ID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(52).Equal(retrieved.Balance))
+		retrieved, err = storage.GetAccountByID(active.ID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(49).Equal(retrieved.Balance))
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+	})
+}
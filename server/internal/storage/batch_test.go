@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createBatchAccounts 開一個有餘額的轉出帳戶與n個空帳戶
+func createBatchAccounts(t *testing.T, storage Storage, balance int64, n int) (uint64, []uint64) {
+	source := &model.Account{Name: "payroll", Balance: decimal.NewFromInt(balance)}
+	require.NoError(t, storage.CreateAccount(source))
+	payees := make([]uint64, n)
+	for i := range payees {
+		payee := &model.Account{Name: "employee"}
+		require.NoError(t, storage.CreateAccount(payee))
+		payees[i] = payee.ID
+	}
+	return source.ID, payees
+}
+
+func TestTransferBatch(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		sourceID, payees := createBatchAccounts(t, storage, 1000, 3)
+		batch := []*model.Transaction{
+			model.NewTransfer(sourceID, payees[0], decimal.NewFromInt(300), "trace-payroll"),
+			model.NewTransfer(sourceID, payees[1], decimal.NewFromInt(250), "trace-payroll"),
+			model.NewTransfer(sourceID, payees[2], decimal.RequireFromString("449.99"), "trace-payroll"),
+		}
+		require.NoError(t, storage.TransferBatch(batch))
+
+		for i, transfer := range batch {
+			assert.NotZero(t, transfer.ID)
+			assert.Equal(t, "TWD", transfer.Currency)
+			if i > 0 {
+				assert.Equal(t, batch[i-1].ID+1, transfer.ID)
+			}
+			entries, err := storage.GetEntriesByTransactionID(transfer.ID)
+			require.NoError(t, err)
+			assert.Len(t, entries, 2)
+		}
+		assertBalances(t, storage, sourceID, "0.01", "0.01")
+		assertBalances(t, storage, payees[0], "300", "300")
+		assertBalances(t, storage, payees[2], "449.99", "449.99")
+
+		transactions, err := storage.GetTransactionsByAccountID(sourceID)
+		require.NoError(t, err)
+		assert.Len(t, transactions, 4)
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+		assert.Empty(t, trial.Mismatches)
+	})
+}
+
+func TestTransferBatchAllOrNothing(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		sourceID, payees := createBatchAccounts(t, storage, 500, 3)
+		frozen := &model.Account{Name: "closed later"}
+		require.NoError(t, storage.CreateAccount(frozen))
+		_, err := storage.UpdateAccountStatus(frozen.ID, model.AccountStatusClosed, "left company")
+		require.NoError(t, err)
+
+		tests := []struct {
+			name  string
+			batch []*model.Transaction
+			index int
+			kind  error
+		}{
+			{
+				name: "cumulative balance",
+				batch: []*model.Transaction{
+					model.NewTransfer(sourceID, payees[0], decimal.NewFromInt(300), ""),
+					model.NewTransfer(sourceID, payees[1], decimal.NewFromInt(100), ""),
+					model.NewTransfer(sourceID, payees[2], decimal.NewFromInt(101), ""),
+				},
+				index: 2,
+				kind:  model.ErrInsufficientBalance,
+			},
+			{
+				name: "unknown destination",
+				batch: []*model.Transaction{
+					model.NewTransfer(sourceID, payees[0], decimal.NewFromInt(1), ""),
+					model.NewTransfer(sourceID, 9999, decimal.NewFromInt(1), ""),
+				},
+				index: 1,
+				kind:  model.ErrAccountNotFound,
+			},
+			{
+				name: "closed destination",
+				batch: []*model.Transaction{
+					model.NewTransfer(sourceID, payees[0], decimal.NewFromInt(1), ""),
+					model.NewTransfer(sourceID, frozen.ID, decimal.NewFromInt(1), ""),
+				},
+				index: 1,
+				kind:  model.ErrAccountClosed,
+			},
+			{
+				name: "same account",
+				batch: []*model.Transaction{
+					model.NewTransfer(sourceID, payees[0], decimal.NewFromInt(1), ""),
+					model.NewTransfer(sourceID, sourceID, decimal.NewFromInt(1), ""),
+				},
+				index: 1,
+				kind:  model.ErrSameAccount,
+			},
+			{
+				name: "precision",
+				batch: []*model.Transaction{
+					model.NewTransfer(sourceID, payees[0], decimal.RequireFromString("0.001"), ""),
+				},
+				index: 0,
+				kind:  model.ErrInvalidAmount,
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := storage.TransferBatch(tt.batch)
+				assert.ErrorIs(t, err, tt.kind)
+				var batchErr *model.BatchError
+				require.True(t, errors.As(err, &batchErr))
+				assert.Equal(t, tt.index, batchErr.Index)
+				for _, transfer := range tt.batch {
+					assert.Zero(t, transfer.ID)
+				}
+			})
+		}
+
+		assertBalances(t, storage, sourceID, "500", "500")
+		for _, payee := range payees {
+			assertBalances(t, storage, payee, "0", "0")
+		}
+		transactions, err := storage.GetAllTransactions()
+		require.NoError(t, err)
+		assert.Len(t, transactions, 1)
+	})
+}
+
+func TestTransferBatchHeldFunds(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		sourceID, payees := createBatchAccounts(t, storage, 100, 2)
+		require.NoError(t, storage.CreateHold(newTestHold(sourceID, "40")))
+
+		err := storage.TransferBatch([]*model.Transaction{
+			model.NewTransfer(sourceID, payees[0], decimal.NewFromInt(30), ""),
+			model.NewTransfer(sourceID, payees[1], decimal.NewFromInt(31), ""),
+		})
+		assert.ErrorIs(t, err, model.ErrInsufficientBalance)
+
+		require.NoError(t, storage.TransferBatch([]*model.Transaction{
+			model.NewTransfer(sourceID, payees[0], decimal.NewFromInt(30), ""),
+			model.NewTransfer(sourceID, payees[1], decimal.NewFromInt(30), ""),
+		}))
+		assertBalances(t, storage, sourceID, "40", "0")
+	})
+}
+
+// TestTransferBatchConcurrent 批次與反方向的單筆轉帳併發, 不會deadlock且總額不變
+func TestTransferBatchConcurrent(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		accounts := make([]uint64, 5)
+		for i := range accounts {
+			account := &model.Account{Name: "account", Balance: decimal.NewFromInt(1000)}
+			require.NoError(t, storage.CreateAccount(account))
+			accounts[i] = account.ID
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				// 由後往前轉, 與單筆轉帳的方向相反
+				var batch []*model.Transaction
+				for j := len(accounts) - 1; j > 0; j-- {
+					batch = append(batch, model.NewTransfer(accounts[j], accounts[j-1], decimal.NewFromInt(int64(i+1)), ""))
+				}
+				assert.NoError(t, storage.TransferBatch(batch))
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				from, to := accounts[i%len(accounts)], accounts[(i+1)%len(accounts)]
+				assert.NoError(t, storage.Transfer(model.NewTransfer(from, to, decimal.NewFromInt(5), "")))
+			}(i)
+		}
+		wg.Wait()
+
+		total := decimal.Zero
+		for _, id := range accounts {
+			account, err := storage.GetAccountByID(id)
+			require.NoError(t, err)
+			total = total.Add(account.Balance)
+		}
+		assert.True(t, decimal.NewFromInt(5000).Equal(total), total.String())
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+		assert.Empty(t, trial.Mismatches)
+	})
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrencyPrecision(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		tests := []struct {
+			currency string
+			valid    string
+			invalid  string
+		}{
+			{"JPY", "100", "100.5"},
+			{"USD", "10.25", "10.255"},
+			{"KWD", "1.125", "1.1255"},
+		}
+
+		for _, tt := range tests {
+			account := &model.Account{Name: tt.currency, Currency: tt.currency}
+			require.NoError(t, storage.CreateAccount(account))
+
+			deposit := model.NewDeposit(account.ID, decimal.RequireFromString(tt.valid), "")
+			require.NoError(t, storage.Deposit(deposit), tt.currency)
+			assert.Equal(t, tt.currency, deposit.Currency)
+
+			err := storage.Deposit(model.NewDeposit(account.ID, decimal.RequireFromString(tt.invalid), ""))
+			assert.ErrorIs(t, err, model.ErrInvalidAmount, tt.currency)
+			err = storage.Withdraw(model.NewWithdraw(account.ID, decimal.RequireFromString(tt.invalid), ""))
+			assert.ErrorIs(t, err, model.ErrInvalidAmount, tt.currency)
+
+			retrieved, err := storage.GetAccountByID(account.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.currency, retrieved.Currency)
+			assert.True(t, decimal.RequireFromString(tt.valid).Equal(retrieved.Balance), tt.currency)
+
+			transactions, err := storage.GetTransactionsByAccountID(account.ID)
+			require.NoError(t, err)
+			require.Len(t, transactions, 1)
+			assert.Equal(t, tt.currency, transactions[0].Currency)
+		}
+	})
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		usd := &model.Account{Name: "usd", Currency: "USD", Balance: decimal.NewFromInt(100)}
+		jpy := &model.Account{Name: "jpy", Currency: "JPY", Balance: decimal.NewFromInt(1000)}
+		twd := &model.Account{Name: "default"}
+		require.NoError(t, storage.CreateAccount(usd))
+		require.NoError(t, storage.CreateAccount(jpy))
+		require.NoError(t, storage.CreateAccount(twd))
+		assert.Equal(t, model.DefaultCurrency, twd.Currency)
+
+		err := storage.Transfer(model.NewTransfer(usd.ID, jpy.ID, decimal.NewFromInt(1), ""))
+		assert.ErrorIs(t, err, model.ErrCurrencyMismatch)
+
+		// 指定幣別需與帳戶一致
+		deposit := model.NewDeposit(usd.ID, decimal.NewFromInt(1), "")
+		deposit.Currency = "JPY"
+		assert.ErrorIs(t, storage.Deposit(deposit), model.ErrCurrencyMismatch)
+		deposit = model.NewDeposit(usd.ID, decimal.NewFromInt(1), "")
+		deposit.Currency = "usd"
+		require.NoError(t, storage.Deposit(deposit))
+		assert.Equal(t, "USD", deposit.Currency)
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+		require.Len(t, trial.Currencies, 2)
+		assert.Equal(t, "JPY", trial.Currencies[0].Currency)
+		assert.True(t, decimal.NewFromInt(1000).Equal(trial.Currencies[0].Debit))
+		assert.Equal(t, "USD", trial.Currencies[1].Currency)
+		assert.True(t, decimal.NewFromInt(101).Equal(trial.Currencies[1].Credit))
+	})
+}
+
+func TestTransferWithConversion(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		usd := &model.Account{Name: "usd", Currency: "USD", Balance: decimal.NewFromInt(100)}
+		jpy := &model.Account{Name: "jpy", Currency: "JPY"}
+		require.NoError(t, storage.CreateAccount(usd))
+		require.NoError(t, storage.CreateAccount(jpy))
+
+		convert := func(amount, converted, currency string) *model.Transaction {
+			transfer := model.NewTransfer(usd.ID, jpy.ID, decimal.RequireFromString(amount), "trace-fx")
+			transfer.FX = &model.FXConversion{
+				QuoteID:             "quote-1",
+				DestinationAmount:   decimal.RequireFromString(converted),
+				DestinationCurrency: currency,
+				Rate:                decimal.RequireFromString("150.822"),
+				MidRate:             decimal.RequireFromString("151.2"),
+			}
+			return transfer
+		}
+
+		// 換算後的幣別與精度需符合轉入帳戶
+		assert.ErrorIs(t, storage.Transfer(convert("10", "1508", "EUR")), model.ErrCurrencyMismatch)
+		assert.ErrorIs(t, storage.Transfer(convert("10", "1508.22", "JPY")), model.ErrInvalidAmount)
+
+		transfer := convert("10.50", "1583", "jpy")
+		require.NoError(t, storage.Transfer(transfer))
+		assert.Equal(t, "USD", transfer.Currency)
+		assert.Equal(t, "JPY", transfer.FX.DestinationCurrency)
+
+		retrieved, err := storage.GetAccountByID(usd.ID)
+		require.NoError(t, err)
+		assert.True(t, decimal.RequireFromString("89.50").Equal(retrieved.Balance))
+		retrieved, err = storage.GetAccountByID(jpy.ID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(1583).Equal(retrieved.Balance))
+
+		transactions, err := storage.GetTransactionsByAccountID(jpy.ID)
+		require.NoError(t, err)
+		require.Len(t, transactions, 1)
+		require.NotNil(t, transactions[0].FX)
+		assert.Equal(t, "quote-1", transactions[0].FX.QuoteID)
+		assert.True(t, decimal.NewFromInt(1583).Equal(transactions[0].FX.DestinationAmount))
+		assert.True(t, decimal.RequireFromString("150.822").Equal(transactions[0].FX.Rate))
+		assert.True(t, decimal.RequireFromString("151.2").Equal(transactions[0].FX.MidRate))
+
+		// 兩個幣別各自經由system:fx軋平
+		entries, err := storage.GetEntriesByTransactionID(transfer.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 4)
+		assert.Equal(t, model.SystemAccountFX, entries[1].Account)
+		assert.Equal(t, "USD", entries[1].Currency)
+		assert.Equal(t, model.SystemAccountFX, entries[2].Account)
+		assert.Equal(t, "JPY", entries[2].Currency)
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+		assert.Empty(t, trial.Mismatches)
+	})
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+// storage回傳的業務錯誤, 皆可用errors.Is對應到model的錯誤分類
+var (
+	ErrSourceAccountNotFound      = model.NewError(model.ErrAccountNotFound, "source account not found")
+	ErrDestinationAccountNotFound = model.NewError(model.ErrAccountNotFound, "destination account not found")
+
+	// ErrDuplicateReference 已有相同reference的交易, 不會重複入帳
+	ErrDuplicateReference = model.NewError(model.ErrInvalidRequest, "transaction reference already used")
+
+	errInvalidDeposit  = model.NewError(model.ErrInvalidAmount, "deposit amount cannot be negative")
+	errInvalidWithdraw = model.NewError(model.ErrInvalidAmount, "withdraw amount cannot be negative")
+	errInvalidTransfer = model.NewError(model.ErrInvalidAmount, "transfer amount must be positive")
+	errInvalidHold     = model.NewError(model.ErrInvalidAmount, "hold amount must be positive")
+	errInvalidFee      = model.NewError(model.ErrInvalidAmount, "fee amount must be positive")
+)
+
+// checkBatchTransfer 批次中的單筆轉帳, 與Transfer進入前的檢查相同
+func checkBatchTransfer(transaction *model.Transaction) error {
+	if transaction.FromAccountID == nil {
+		return ErrSourceAccountNotFound
+	}
+	if !transaction.Amount.IsPositive() {
+		return errInvalidTransfer
+	}
+	if *transaction.FromAccountID == transaction.ToAccountID {
+		return model.ErrSameAccount
+	}
+	return nil
+}
+
+// checkTransfer 轉出帳戶需可扣款, 轉入帳戶需可入帳
+// 雙方幣別需一致, 換匯轉帳則換算後的幣別與金額需符合轉入帳戶
+func checkTransfer(from, to *model.Account, transaction *model.Transaction) error {
+	if err := from.CheckDebit(); err != nil {
+		return err
+	}
+	if err := to.CheckCredit(); err != nil {
+		return err
+	}
+	if err := transaction.BindCurrency(from); err != nil {
+		return err
+	}
+	if fx := transaction.FX; fx != nil {
+		currency := to.CurrencyInfo()
+		if !strings.EqualFold(fx.DestinationCurrency, currency.Code) {
+			return model.NewError(model.ErrCurrencyMismatch,
+				fmt.Sprintf("currency mismatch: account %d is in %s, conversion is to %s", to.ID, currency.Code, fx.DestinationCurrency))
+		}
+		if !fx.DestinationAmount.IsPositive() {
+			return errInvalidTransfer
+		}
+		fx.DestinationCurrency = currency.Code
+		return currency.CheckAmount(fx.DestinationAmount)
+	}
+	if code := to.CurrencyInfo().Code; code != transaction.Currency {
+		return model.NewError(model.ErrCurrencyMismatch,
+			fmt.Sprintf("currency mismatch: cannot transfer %s to %s account without conversion", transaction.Currency, code))
+	}
+	return nil
+}
+
+// checkAvailable 扣款金額不能超過可用餘額(帳上餘額加透支額度, 扣除預授權圈存)
+func checkAvailable(account *model.Account, amount decimal.Decimal) error {
+	if !account.AvailableBalance().LessThan(amount) {
+		return nil
+	}
+	if account.Held.IsZero() && account.OverdraftLimit.IsZero() {
+		return model.ErrInsufficientBalance
+	}
+	return model.NewError(model.ErrInsufficientBalance,
+		fmt.Sprintf("insufficient available balance: balance %s, overdraft limit %s, held by authorizations %s",
+			account.Balance.String(), account.OverdraftLimit.String(), account.Held.String()))
+}
+
+// checkFee 手續費需為正數, 由扣款帳戶支付且與帳戶同幣別
+func checkFee(account *model.Account, transaction *model.Transaction) error {
+	fee := transaction.Fee
+	if fee == nil {
+		return nil
+	}
+	if !fee.Amount.IsPositive() || fee.ToAccountID != account.ID {
+		return errInvalidFee
+	}
+	return fee.BindCurrency(account)
+}
+
+// checkHold 圈存金額需為正數且符合帳戶幣別精度, 帳戶需可扣款
+func checkHold(account *model.Account, hold *model.Hold) error {
+	if !hold.Amount.IsPositive() {
+		return errInvalidHold
+	}
+	if err := account.CheckDebit(); err != nil {
+		return err
+	}
+	currency := account.CurrencyInfo()
+	if hold.Currency != "" && !strings.EqualFold(hold.Currency, currency.Code) {
+		return model.NewError(model.ErrCurrencyMismatch, fmt.Sprintf("currency mismatch: account %d is in %s, got %s", account.ID, currency.Code, hold.Currency))
+	}
+	hold.Currency = currency.Code
+	if err := currency.CheckAmount(hold.Amount); err != nil {
+		return err
+	}
+	return checkAvailable(account, hold.Amount)
+}
+
+// checkCapture 帳戶需可扣款, 請款金額不超過hold剩餘金額, 成功時hold套用請款
+// account.Held包含這筆hold本身, 請款動用的是自己圈存的金額
+func checkCapture(account *model.Account, hold *model.Hold, transaction *model.Transaction, now time.Time) error {
+	if err := account.CheckDebit(); err != nil {
+		return err
+	}
+	if err := transaction.BindCurrency(account); err != nil {
+		return err
+	}
+	if err := checkFee(account, transaction); err != nil {
+		return err
+	}
+	held := hold.HeldAt(now)
+	if err := hold.Capture(transaction.Amount, now); err != nil {
+		return err
+	}
+	// 請款金額已圈存, 手續費需由其餘可用餘額支付
+	available := *account
+	available.Held = account.Held.Sub(held)
+	return checkAvailable(&available, transaction.Amount.Add(transaction.FeeAmount()))
+}
+
+// checkReversal 扣款帳戶需可扣款且可用餘額足以退回, 轉帳沖正時原轉出帳戶需可入帳
+func checkReversal(debit, credit *model.Account, transaction *model.Transaction) error {
+	if err := debit.CheckDebit(); err != nil {
+		return err
+	}
+	if credit != nil {
+		if err := credit.CheckCredit(); err != nil {
+			return err
+		}
+	}
+	if err := checkAvailable(debit, transaction.Amount); err != nil {
+		return model.NewError(model.ErrInsufficientBalance,
+			fmt.Sprintf("account %d no longer has the funds to reverse transaction %d: %s", debit.ID, *transaction.ReversalOf, err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package storage
+
+import "github.com/kokp520/banking-system/server/internal/model"
+
+// chargeFee 主交易扣款後再扣手續費, 手續費造成的透支進出記在手續費交易上
+func chargeFee(account *model.Account, transaction *model.Transaction) {
+	fee := transaction.Fee
+	if fee == nil {
+		return
+	}
+	before := account.Balance
+	account.Balance = account.Balance.Sub(fee.Amount)
+	fee.TrackOverdraft(account, before)
+}
+
+// withFees 每筆主交易後接著它的手續費交易, 依入帳順序排列
+func withFees(transactions []*model.Transaction) []*model.Transaction {
+	posted := make([]*model.Transaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		posted = append(posted, transaction)
+		if transaction.Fee != nil {
+			posted = append(posted, transaction.Fee)
+		}
+	}
+	return posted
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decimalPtr(value string) *decimal.Decimal {
+	d := decimal.RequireFromString(value)
+	return &d
+}
+
+func TestFeeScheduleCompute(t *testing.T) {
+	twd, _ := model.LookupCurrency("TWD")
+	usd, _ := model.LookupCurrency("USD")
+	tiered := model.FeeSchedule{
+		Operation: model.TransactionTypeTransfer,
+		Type:      model.FeeTypeTiered,
+		Tiers: []model.FeeTier{
+			{UpTo: decimalPtr("1000")},
+			{UpTo: decimalPtr("50000"), Amount: decimal.NewFromInt(10)},
+			{Rate: decimal.RequireFromString("0.0005")},
+		},
+		Max: decimalPtr("100"),
+	}
+
+	tests := []struct {
+		name     string
+		schedule model.FeeSchedule
+		amount   string
+		currency model.Currency
+		want     string
+	}{
+		{"flat", model.FeeSchedule{Type: model.FeeTypeFlat, Amount: decimal.NewFromInt(15)}, "100", twd, "15"},
+		{"percentage rounds half up", model.FeeSchedule{Type: model.FeeTypePercentage, Rate: decimal.RequireFromString("0.001")}, "15", usd, "0.02"},
+		{"percentage min", model.FeeSchedule{Type: model.FeeTypePercentage, Rate: decimal.RequireFromString("0.001"), Min: decimalPtr("1")}, "100", usd, "1"},
+		{"percentage max", model.FeeSchedule{Type: model.FeeTypePercentage, Rate: decimal.RequireFromString("0.001"), Max: decimalPtr("5")}, "100000", usd, "5"},
+		{"tier upper bound inclusive", tiered, "1000", twd, "0"},
+		{"second tier", tiered, "1000.5", twd, "10"},
+		{"unbounded tier", tiered, "80000", twd, "40"},
+		{"unbounded tier capped", tiered, "1000000", twd, "100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.schedule.Compute(decimal.RequireFromString(tt.amount), tt.currency)
+			assert.True(t, decimal.RequireFromString(tt.want).Equal(got), "got %s", got)
+		})
+	}
+
+	tiered.Tiers[0], tiered.Tiers[1] = tiered.Tiers[1], tiered.Tiers[0]
+	assert.ErrorIs(t, tiered.Validate(), model.ErrInvalidRequest)
+	invalid := model.FeeSchedule{Operation: model.TransactionTypeDeposit, Type: model.FeeTypeFlat}
+	assert.ErrorIs(t, invalid.Validate(), model.ErrInvalidRequest)
+	invalid = model.FeeSchedule{Operation: model.TransactionTypeWithdraw, Type: model.FeeTypeFlat, Min: decimalPtr("5"), Max: decimalPtr("1")}
+	assert.ErrorIs(t, invalid.Validate(), model.ErrInvalidRequest)
+}
+
+// withFee 附加手續費, 由accountID支付
+func withFee(transaction *model.Transaction, accountID uint64, amount string) *model.Transaction {
+	transaction.Fee = model.NewFee(accountID, decimal.RequireFromString(amount), "", transaction.Type, transaction.TraceID)
+	return transaction
+}
+
+func TestFeeStorage(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "fee payer", Balance: decimal.NewFromInt(100)}
+		require.NoError(t, storage.CreateAccount(account))
+		payee := &model.Account{Name: "payee"}
+		require.NoError(t, storage.CreateAccount(payee))
+
+		// 提款金額足夠但加上手續費不足, 整筆不入帳
+		withdraw := withFee(model.NewWithdraw(account.ID, decimal.NewFromInt(95), "trace-fee"), account.ID, "15")
+		assert.ErrorIs(t, storage.Withdraw(withdraw), model.ErrInsufficientBalance)
+		transactions, err := storage.GetTransactionsByAccountID(account.ID)
+		require.NoError(t, err)
+		assert.Len(t, transactions, 1)
+
+		withdraw = withFee(model.NewWithdraw(account.ID, decimal.NewFromInt(50), "trace-fee"), account.ID, "15")
+		require.NoError(t, storage.Withdraw(withdraw))
+		require.NotNil(t, withdraw.Fee)
+		assert.Equal(t, withdraw.ID+1, withdraw.Fee.ID)
+		require.NotNil(t, withdraw.Fee.FeeFor)
+		assert.Equal(t, withdraw.ID, *withdraw.Fee.FeeFor)
+		assert.Equal(t, "TWD", withdraw.Fee.Currency)
+
+		transfer := withFee(model.NewTransfer(account.ID, payee.ID, decimal.NewFromInt(20), "trace-fee"), account.ID, "10")
+		require.NoError(t, storage.Transfer(transfer))
+
+		got, err := storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(5).Equal(got.Balance), "balance %s", got.Balance)
+		got, err = storage.GetAccountByID(payee.ID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(20).Equal(got.Balance))
+
+		// 手續費另存為一筆交易, 主交易不帶手續費
+		fee, err := storage.GetTransactionByID(transfer.Fee.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.TransactionTypeFee, fee.Type)
+		assert.Equal(t, account.ID, fee.ToAccountID)
+		require.NotNil(t, fee.FeeFor)
+		assert.Equal(t, transfer.ID, *fee.FeeFor)
+		original, err := storage.GetTransactionByID(transfer.ID)
+		require.NoError(t, err)
+		assert.Nil(t, original.Fee)
+		payeeTransactions, err := storage.GetTransactionsByAccountID(payee.ID)
+		require.NoError(t, err)
+		assert.Len(t, payeeTransactions, 1)
+
+		entries, err := storage.GetEntriesByTransactionID(fee.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, model.CustomerLedgerAccount(account.ID), entries[0].Account)
+		assert.Equal(t, model.SystemAccountFees, entries[1].Account)
+		assert.True(t, decimal.NewFromInt(10).Equal(entries[1].Amount))
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+		for _, balance := range trial.Accounts {
+			if balance.Account == model.SystemAccountFees {
+				assert.True(t, decimal.NewFromInt(25).Equal(balance.Net()), "fees %s", balance.Net())
+			}
+		}
+	})
+}
+
+// TestFeeHoldCapture 請款的手續費與請款一起入帳, 由圈存以外的可用餘額支付
+func TestFeeHoldCapture(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "card", Balance: decimal.NewFromInt(100)}
+		require.NoError(t, storage.CreateAccount(account))
+		hold := newTestHold(account.ID, "60")
+		require.NoError(t, storage.CreateHold(hold))
+
+		capture := withFee(model.NewCapture(hold, decimal.NewFromInt(60), "trace-fee"), account.ID, "41")
+		_, err := storage.CaptureHold(capture)
+		assert.ErrorIs(t, err, model.ErrInsufficientBalance)
+		assertBalances(t, storage, account.ID, "100", "40")
+
+		capture = withFee(model.NewCapture(hold, decimal.NewFromInt(60), "trace-fee"), account.ID, "5")
+		captured, err := storage.CaptureHold(capture)
+		require.NoError(t, err)
+		assert.Equal(t, model.HoldStatusCaptured, captured.Status)
+		require.NotNil(t, capture.Fee)
+		assert.Equal(t, capture.ID+1, capture.Fee.ID)
+		assertBalances(t, storage, account.ID, "35", "35")
+
+		fee, err := storage.GetTransactionByID(capture.Fee.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.TransactionTypeFee, fee.Type)
+		require.NotNil(t, fee.FeeFor)
+		assert.Equal(t, capture.ID, *fee.FeeFor)
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+	})
+}
+
+func TestFeeTransferBatch(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		sourceID, payees := createBatchAccounts(t, storage, 100, 2)
+		batch := []*model.Transaction{
+			withFee(model.NewTransfer(sourceID, payees[0], decimal.NewFromInt(40), "trace-batch"), sourceID, "5"),
+			model.NewTransfer(sourceID, payees[1], decimal.NewFromInt(40), "trace-batch"),
+		}
+		require.NoError(t, storage.TransferBatch(batch))
+		assert.Equal(t, batch[0].ID+1, batch[0].Fee.ID)
+		assert.Equal(t, batch[0].Fee.ID+1, batch[1].ID)
+		assert.Equal(t, batch[0].ID, *batch[0].Fee.FeeFor)
+
+		source, err := storage.GetAccountByID(sourceID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(15).Equal(source.Balance))
+
+		// 第二筆加上手續費超過餘額, 整批不入帳
+		batch = []*model.Transaction{
+			model.NewTransfer(sourceID, payees[0], decimal.NewFromInt(5), "trace-batch"),
+			withFee(model.NewTransfer(sourceID, payees[1], decimal.NewFromInt(5), "trace-batch"), sourceID, "6"),
+		}
+		var batchErr *model.BatchError
+		require.ErrorAs(t, storage.TransferBatch(batch), &batchErr)
+		assert.Equal(t, 1, batchErr.Index)
+		assert.ErrorIs(t, batchErr, model.ErrInsufficientBalance)
+		assert.Zero(t, batch[1].Fee.ID)
+
+		source, err = storage.GetAccountByID(sourceID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(15).Equal(source.Balance))
+	})
+}
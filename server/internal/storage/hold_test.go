@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHold(accountID uint64, amount string) *model.Hold {
+	return &model.Hold{
+		AccountID: accountID,
+		Amount:    decimal.RequireFromString(amount),
+		ExpiresAt: time.Now().Add(time.Hour),
+		TraceID:   "trace-hold",
+	}
+}
+
+func assertBalances(t *testing.T, storage Storage, accountID uint64, balance, available string) {
+	t.Helper()
+	account, err := storage.GetAccountByID(accountID)
+	require.NoError(t, err)
+	assert.True(t, decimal.RequireFromString(balance).Equal(account.Balance), "balance %s", account.Balance.String())
+	assert.True(t, decimal.RequireFromString(available).Equal(account.AvailableBalance()), "available %s", account.AvailableBalance().String())
+}
+
+func TestHoldReducesAvailableBalance(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "card", Balance: decimal.NewFromInt(100)}
+		other := &model.Account{Name: "other"}
+		require.NoError(t, storage.CreateAccount(account))
+		require.NoError(t, storage.CreateAccount(other))
+
+		hold := newTestHold(account.ID, "60")
+		require.NoError(t, storage.CreateHold(hold))
+		assert.NotZero(t, hold.ID)
+		assert.Equal(t, model.HoldStatusActive, hold.Status)
+		assert.Equal(t, model.DefaultCurrency, hold.Currency)
+		assertBalances(t, storage, account.ID, "100", "40")
+
+		// 提款轉帳以可用餘額檢查
+		assert.ErrorIs(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(41), "")), model.ErrInsufficientBalance)
+		assert.ErrorIs(t, storage.Transfer(model.NewTransfer(account.ID, other.ID, decimal.NewFromInt(41), "")), model.ErrInsufficientBalance)
+		assert.ErrorIs(t, storage.CreateHold(newTestHold(account.ID, "41")), model.ErrInsufficientBalance)
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(30), "")))
+		require.NoError(t, storage.Transfer(model.NewTransfer(account.ID, other.ID, decimal.NewFromInt(10), "")))
+		assertBalances(t, storage, account.ID, "60", "0")
+
+		assert.ErrorIs(t, storage.CreateHold(newTestHold(account.ID, "0")), model.ErrInvalidAmount)
+		assert.ErrorIs(t, storage.CreateHold(newTestHold(account.ID, "0.001")), model.ErrInvalidAmount)
+		assert.ErrorIs(t, storage.CreateHold(newTestHold(999, "1")), model.ErrAccountNotFound)
+
+		holds, err := storage.GetHoldsByAccountID(account.ID)
+		require.NoError(t, err)
+		require.Len(t, holds, 1)
+		assert.Equal(t, hold.ID, holds[0].ID)
+		assert.Equal(t, "trace-hold", holds[0].TraceID)
+	})
+}
+
+func TestHoldCapture(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "card", Balance: decimal.NewFromInt(100)}
+		require.NoError(t, storage.CreateAccount(account))
+		hold := newTestHold(account.ID, "60")
+		require.NoError(t, storage.CreateHold(hold))
+
+		// 部分請款, 剩餘仍圈存
+		capture := model.NewCapture(hold, decimal.NewFromInt(20), "trace-capture")
+		captured, err := storage.CaptureHold(capture)
+		require.NoError(t, err)
+		assert.NotZero(t, capture.ID)
+		assert.Equal(t, model.HoldStatusActive, captured.Status)
+		assert.True(t, decimal.NewFromInt(20).Equal(captured.Captured))
+		assertBalances(t, storage, account.ID, "80", "40")
+
+		_, err = storage.CaptureHold(model.NewCapture(hold, decimal.NewFromInt(41), ""))
+		assert.ErrorIs(t, err, model.ErrInvalidAmount)
+
+		captured, err = storage.CaptureHold(model.NewCapture(hold, decimal.NewFromInt(40), ""))
+		require.NoError(t, err)
+		assert.Equal(t, model.HoldStatusCaptured, captured.Status)
+		assertBalances(t, storage, account.ID, "40", "40")
+
+		_, err = storage.CaptureHold(model.NewCapture(hold, decimal.NewFromInt(1), ""))
+		assert.ErrorIs(t, err, model.ErrHoldNotActive)
+		_, err = storage.ReleaseHold(hold.ID)
+		assert.ErrorIs(t, err, model.ErrHoldNotActive)
+
+		retrieved, err := storage.GetHold(hold.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.HoldStatusCaptured, retrieved.Status)
+		assert.True(t, decimal.NewFromInt(60).Equal(retrieved.Captured))
+
+		transactions, err := storage.GetTransactionsByAccountID(account.ID)
+		require.NoError(t, err)
+		require.Len(t, transactions, 3)
+		assert.Equal(t, model.TransactionTypeWithdraw, transactions[1].Type)
+		require.NotNil(t, transactions[1].HoldID)
+		assert.Equal(t, hold.ID, *transactions[1].HoldID)
+		assert.Equal(t, "trace-capture", transactions[1].TraceID)
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+
+		_, err = storage.GetHold(999)
+		assert.ErrorIs(t, err, model.ErrHoldNotFound)
+	})
+}
+
+func TestHoldReleaseAndExpiry(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "card", Balance: decimal.NewFromInt(100)}
+		require.NoError(t, storage.CreateAccount(account))
+
+		released := newTestHold(account.ID, "30")
+		require.NoError(t, storage.CreateHold(released))
+		expiring := newTestHold(account.ID, "50")
+		require.NoError(t, storage.CreateHold(expiring))
+		assertBalances(t, storage, account.ID, "100", "20")
+
+		hold, err := storage.ReleaseHold(released.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.HoldStatusReleased, hold.Status)
+		assertBalances(t, storage, account.ID, "100", "50")
+
+		// 到期前不會被標記
+		expired, err := storage.ExpireHolds(time.Now())
+		require.NoError(t, err)
+		assert.Empty(t, expired)
+
+		expired, err = storage.ExpireHolds(time.Now().Add(2 * time.Hour))
+		require.NoError(t, err)
+		require.Len(t, expired, 1)
+		assert.Equal(t, expiring.ID, expired[0].ID)
+		assert.Equal(t, model.HoldStatusExpired, expired[0].Status)
+		assertBalances(t, storage, account.ID, "100", "100")
+
+		retrieved, err := storage.GetHold(expiring.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.HoldStatusExpired, retrieved.Status)
+		_, err = storage.CaptureHold(model.NewCapture(retrieved, decimal.NewFromInt(1), ""))
+		assert.ErrorIs(t, err, model.ErrHoldNotActive)
+
+		expired, err = storage.ExpireHolds(time.Now().Add(2 * time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, expired)
+	})
+}
+
+func TestHoldExpiresWithoutSweep(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "card", Balance: decimal.NewFromInt(100)}
+		require.NoError(t, storage.CreateAccount(account))
+
+		hold := newTestHold(account.ID, "80")
+		hold.ExpiresAt = time.Now().Add(20 * time.Millisecond)
+		require.NoError(t, storage.CreateHold(hold))
+		assertBalances(t, storage, account.ID, "100", "20")
+
+		// 過了到期時間即不計入圈存, 不需等ExpireHolds
+		time.Sleep(30 * time.Millisecond)
+		assertBalances(t, storage, account.ID, "100", "100")
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(90), "")))
+	})
+}
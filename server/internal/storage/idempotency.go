@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+var (
+	ErrIdempotencyKeyMismatch   = errors.New("idempotency key reused with different payload")
+	ErrIdempotencyKeyInProgress = errors.New("request with the same idempotency key is in progress")
+)
+
+// IdempotencyStore 保存Idempotency-Key第一次請求的回應
+type IdempotencyStore interface {
+	// Begin 佔用key
+	// 第一次使用(或已過期)回傳 (nil, nil), 呼叫端處理完後Complete或Release
+	// 已完成回傳保存的record供重放
+	// fingerprint不同回傳ErrIdempotencyKeyMismatch, 處理中回傳ErrIdempotencyKeyInProgress
+	Begin(scope, key, fingerprint string, ttl time.Duration) (*model.IdempotencyRecord, error)
+	// Complete 保存回應
+	Complete(scope, key string, statusCode int, body []byte) error
+	// Release 放棄key(例如server error), 讓client可以重試
+	Release(scope, key string) error
+}
+
+var (
+	_ IdempotencyStore = (*MemoryIdempotencyStore)(nil)
+	_ IdempotencyStore = (*MemoryStorage)(nil)
+	_ IdempotencyStore = (*SQLiteStorage)(nil)
+)
+
+// NewIdempotencyStore storage自己保存Idempotency-Key時(sqlite, memory+WAL)與其他狀態一起落地,
+// 重啟後重試仍會重放; 其他實作用不落地的MemoryIdempotencyStore
+func NewIdempotencyStore(s Storage) IdempotencyStore {
+	if store, ok := s.(IdempotencyStore); ok {
+		return store
+	}
+	return NewMemoryIdempotencyStore()
+}
+
+type idempotencyKey struct {
+	scope string
+	key   string
+}
+
+// replayRecord 未過期的record: fingerprint不同或處理中回傳錯誤, 已完成回傳copy供重放
+func replayRecord(record *model.IdempotencyRecord, fingerprint string) (*model.IdempotencyRecord, error) {
+	if record.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyMismatch
+	}
+	if !record.Completed {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	recordCopy := *record
+	return &recordCopy, nil
+}
+
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[idempotencyKey]*model.IdempotencyRecord
+	lastSweep time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[idempotencyKey]*model.IdempotencyRecord),
+	}
+}
+
+// sweepInterval 過期record最多每分鐘清一次
+const sweepInterval = time.Minute
+
+func (s *MemoryIdempotencyStore) Begin(scope, key, fingerprint string, ttl time.Duration) (*model.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, record := range s.records {
+			if now.After(record.ExpiresAt) {
+				delete(s.records, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	k := idempotencyKey{scope: scope, key: key}
+	if record, ok := s.records[k]; ok && now.Before(record.ExpiresAt) {
+		return replayRecord(record, fingerprint)
+	}
+
+	s.records[k] = &model.IdempotencyRecord{
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(scope, key string, statusCode int, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[idempotencyKey{scope: scope, key: key}]
+	if !ok {
+		return errors.New("idempotency key not found")
+	}
+	record.StatusCode = statusCode
+	record.Body = body
+	record.Completed = true
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, idempotencyKey{scope: scope, key: key})
+	return nil
+}
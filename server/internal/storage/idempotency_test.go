@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		store := NewIdempotencyStore(storage)
+
+		// 第一次使用
+		record, err := store.Begin("client:a", "key-1", "fp-1", time.Hour)
+		require.NoError(t, err)
+		assert.Nil(t, record)
+
+		// 處理中
+		_, err = store.Begin("client:a", "key-1", "fp-1", time.Hour)
+		assert.ErrorIs(t, err, ErrIdempotencyKeyInProgress)
+
+		require.NoError(t, store.Complete("client:a", "key-1", 200, []byte(`{"code":200}`)))
+
+		// 重放
+		record, err = store.Begin("client:a", "key-1", "fp-1", time.Hour)
+		require.NoError(t, err)
+		require.NotNil(t, record)
+		assert.Equal(t, 200, record.StatusCode)
+		assert.Equal(t, `{"code":200}`, string(record.Body))
+
+		// payload不同
+		_, err = store.Begin("client:a", "key-1", "fp-2", time.Hour)
+		assert.ErrorIs(t, err, ErrIdempotencyKeyMismatch)
+
+		// 不同scope互不影響
+		record, err = store.Begin("client:b", "key-1", "fp-2", time.Hour)
+		require.NoError(t, err)
+		assert.Nil(t, record)
+
+		// release後可以重新使用
+		require.NoError(t, store.Release("client:b", "key-1"))
+		record, err = store.Begin("client:b", "key-1", "fp-3", time.Hour)
+		require.NoError(t, err)
+		assert.Nil(t, record)
+	})
+}
+
+func TestIdempotencyStoreExpiry(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		store := NewIdempotencyStore(storage)
+
+		_, err := store.Begin("client:a", "key-1", "fp-1", time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, store.Complete("client:a", "key-1", 200, []byte(`{}`)))
+
+		time.Sleep(5 * time.Millisecond)
+
+		// 過期後視為新的key, 不同payload也可以使用
+		record, err := store.Begin("client:a", "key-1", "fp-2", time.Hour)
+		require.NoError(t, err)
+		assert.Nil(t, record)
+	})
+}
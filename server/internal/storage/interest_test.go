@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProduct 1,000,000的日終餘額每天計息100
+var testProduct = model.Product{Name: "savings", Rate: decimal.RequireFromString("0.0365"), DayCount: model.DayCountAct365}
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.Local)
+}
+
+func TestDayCountConventions(t *testing.T) {
+	tests := []struct {
+		name     string
+		dayCount model.DayCount
+		from, to time.Time
+		want     int
+	}{
+		{"act/365 month", model.DayCountAct365, day(2026, 1, 1), day(2026, 2, 1), 31},
+		{"act/360 leap february", model.DayCountAct360, day(2028, 2, 1), day(2028, 3, 1), 29},
+		{"30/360 31st counts zero", model.DayCount30360, day(2026, 1, 30), day(2026, 1, 31), 0},
+		{"30/360 from 31st", model.DayCount30360, day(2026, 1, 31), day(2026, 2, 1), 1},
+		{"30/360 february end", model.DayCount30360, day(2026, 2, 28), day(2026, 3, 1), 3},
+		{"30/360 leap february end", model.DayCount30360, day(2028, 2, 29), day(2028, 3, 1), 2},
+		{"30/360 year", model.DayCount30360, day(2026, 3, 15), day(2027, 3, 15), 360},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.dayCount.Days(tt.from, tt.to))
+		})
+	}
+
+	// 30/360逐日加總每個月都是30天
+	total := 0
+	for d := day(2026, 2, 1); d.Month() == time.February; d = d.AddDate(0, 0, 1) {
+		total += model.DayCount30360.Days(d, d.AddDate(0, 0, 1))
+	}
+	assert.Equal(t, 30, total)
+
+	assert.Error(t, model.DayCount("ACT/ACT").Validate())
+}
+
+func TestInterestAccrualPostsMonthlyWithRemainder(t *testing.T) {
+	t.Run("remainder carried to next month", func(t *testing.T) {
+		product := model.Product{Name: "basic", Rate: decimal.RequireFromString("0.01"), DayCount: model.DayCountAct360}
+		account := &model.Account{ID: 1, Balance: decimal.NewFromInt(1000), Currency: "TWD", AccruedThrough: day(2026, 8, 31)}
+
+		accruals, postings := account.AccrueInterest(product, day(2026, 10, 31), nil)
+		require.Len(t, accruals, 61)
+		require.Len(t, postings, 2)
+		assert.True(t, decimal.RequireFromString("0.83").Equal(postings[0].Amount), postings[0].Amount.String())
+		assert.Equal(t, model.TransactionTypeInterest, postings[0].Type)
+		assert.Equal(t, "Interest for 2026-09", postings[0].Description)
+
+		// 10月的日終餘額含9月入帳的利息
+		assert.True(t, decimal.RequireFromString("1000.83").Equal(accruals[30].Balance))
+
+		amounts, posted := decimal.Zero, decimal.Zero
+		for _, accrual := range accruals {
+			amounts = amounts.Add(accrual.Amount)
+			posted = posted.Add(accrual.Posted)
+		}
+		assert.True(t, amounts.Sub(posted).Equal(account.AccruedInterest))
+		assert.True(t, account.AccruedInterest.LessThan(decimal.RequireFromString("0.01")))
+		assert.True(t, account.AccruedInterest.IsPositive())
+		assert.True(t, decimal.NewFromInt(1000).Add(posted).Equal(account.Balance))
+		assert.True(t, day(2026, 10, 31).Equal(account.AccruedThrough))
+	})
+
+	t.Run("30/360 february", func(t *testing.T) {
+		product := model.Product{Name: "term", Rate: decimal.RequireFromString("0.01"), DayCount: model.DayCount30360}
+		account := &model.Account{ID: 1, Balance: decimal.NewFromInt(360000), Currency: "TWD", AccruedThrough: day(2026, 1, 31)}
+
+		accruals, postings := account.AccrueInterest(product, day(2026, 2, 28), nil)
+		require.Len(t, accruals, 28)
+		assert.Equal(t, 3, accruals[27].Days)
+		assert.True(t, decimal.NewFromInt(30).Equal(accruals[27].Amount))
+		require.Len(t, postings, 1)
+		assert.True(t, decimal.NewFromInt(300).Equal(postings[0].Amount))
+	})
+
+	t.Run("negative balance earns nothing", func(t *testing.T) {
+		account := &model.Account{ID: 1, Balance: decimal.NewFromInt(-500), Currency: "TWD", AccruedThrough: day(2026, 3, 29)}
+		accruals, postings := account.AccrueInterest(testProduct, day(2026, 3, 31), nil)
+		require.Len(t, accruals, 2)
+		assert.True(t, accruals[0].Amount.IsZero())
+		assert.Empty(t, postings)
+	})
+}
+
+func TestInterestAccrualBackdated(t *testing.T) {
+	at := func(d time.Time, hour int) time.Time { return d.Add(time.Duration(hour) * time.Hour) }
+	deposit := func(id uint64, amount int64, createdAt time.Time) *model.Transaction {
+		transaction := model.NewDeposit(1, decimal.NewFromInt(amount), "")
+		transaction.ID, transaction.Currency, transaction.CreatedAt = id, "TWD", createdAt
+		return transaction
+	}
+	withdraw := func(id uint64, amount int64, createdAt time.Time) *model.Transaction {
+		transaction := model.NewWithdraw(1, decimal.NewFromInt(amount), "")
+		transaction.ID, transaction.Currency, transaction.CreatedAt = id, "TWD", createdAt
+		return transaction
+	}
+	// 9/1開戶1,000,000, 9/29存入1,000,000, 10/2提出500,000, 目前餘額1,500,000
+	history := []*model.Transaction{
+		deposit(1, 1000000, at(day(2026, 9, 1), 9)),
+		deposit(2, 1000000, at(day(2026, 9, 29), 12)),
+		withdraw(3, 500000, at(day(2026, 10, 2), 12)),
+	}
+	newAccount := func() *model.Account {
+		return &model.Account{ID: 1, Balance: decimal.NewFromInt(1500000), Currency: "TWD", Product: "savings", AccruedThrough: day(2026, 9, 27)}
+	}
+
+	// 排程停擺, 10/3一次補算9/28~10/2
+	account := newAccount()
+	accruals, postings := account.AccrueInterest(testProduct, day(2026, 10, 2), history)
+	require.Len(t, accruals, 5)
+	want := []struct {
+		balance, amount string
+	}{
+		{"1000000", "100"},
+		{"2000000", "200"},
+		{"2000000", "200"},
+		{"2000500", "200.05"}, // 9月利息500計入10/1日終餘額
+		{"1500500", "150.05"},
+	}
+	for i, w := range want {
+		assert.True(t, decimal.RequireFromString(w.balance).Equal(accruals[i].Balance), "day %d balance %s", i, accruals[i].Balance)
+		assert.True(t, decimal.RequireFromString(w.amount).Equal(accruals[i].Amount), "day %d amount %s", i, accruals[i].Amount)
+	}
+	require.Len(t, postings, 1)
+	assert.True(t, decimal.NewFromInt(500).Equal(accruals[2].Posted))
+	assert.True(t, decimal.NewFromInt(500).Equal(postings[0].Amount))
+
+	// 每天準時執行: 每次只計前一天, 利息交易在隔天凌晨入帳
+	daily := newAccount()
+	daily.Balance = decimal.NewFromInt(1000000)
+	var dailyAccruals []model.InterestAccrual
+	var seen []*model.Transaction
+	nextID := uint64(100)
+	for d := day(2026, 9, 28); !d.After(day(2026, 10, 2)); d = d.AddDate(0, 0, 1) {
+		now := at(d.AddDate(0, 0, 1), 0).Add(5 * time.Minute)
+		// 執行時帳戶餘額為截至now的交易
+		for _, transaction := range history {
+			if transaction.CreatedAt.After(d) && transaction.CreatedAt.Before(d.AddDate(0, 0, 1)) {
+				daily.Balance = daily.Balance.Add(transaction.BalanceChange(1))
+				seen = append(seen, transaction)
+			}
+		}
+		accrued, posted := daily.AccrueInterest(testProduct, d, seen)
+		for _, posting := range posted {
+			nextID++
+			posting.ID, posting.CreatedAt = nextID, now
+			seen = append(seen, posting)
+		}
+		dailyAccruals = append(dailyAccruals, accrued...)
+	}
+	require.Len(t, dailyAccruals, len(accruals))
+	for i := range accruals {
+		assert.True(t, dailyAccruals[i].Balance.Equal(accruals[i].Balance), "day %d", i)
+		assert.True(t, dailyAccruals[i].Amount.Equal(accruals[i].Amount), "day %d", i)
+	}
+	assert.True(t, daily.AccruedInterest.Equal(account.AccruedInterest))
+	assert.True(t, daily.Balance.Equal(account.Balance))
+}
+
+func TestInterestStorage(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "saver", Balance: decimal.NewFromInt(1000000), Currency: "TWD"}
+		require.NoError(t, storage.CreateAccount(account))
+		other := &model.Account{Name: "plain", Balance: decimal.NewFromInt(1000000), Currency: "TWD"}
+		require.NoError(t, storage.CreateAccount(other))
+
+		// 未指定產品的帳戶不計息
+		accruals, err := storage.AccrueInterest(other.ID, testProduct, time.Now().AddDate(0, 0, 3))
+		require.NoError(t, err)
+		assert.Empty(t, accruals)
+
+		_, err = storage.SetAccountProduct(999, "savings")
+		assert.ErrorIs(t, err, model.ErrAccountNotFound)
+		_, err = storage.AccrueInterest(999, testProduct, time.Now())
+		assert.ErrorIs(t, err, model.ErrAccountNotFound)
+
+		now := time.Now()
+		today := day(now.Year(), now.Month(), now.Day())
+		updated, err := storage.SetAccountProduct(account.ID, "savings")
+		require.NoError(t, err)
+		assert.Equal(t, "savings", updated.Product)
+		assert.True(t, today.AddDate(0, 0, -1).Equal(updated.AccruedThrough))
+
+		accounts, err := storage.GetInterestBearingAccounts()
+		require.NoError(t, err)
+		require.Len(t, accounts, 1)
+		assert.Equal(t, account.ID, accounts[0].ID)
+
+		// 計息到月底, 月底入帳
+		monthEnd := day(now.Year(), now.Month()+1, 1).AddDate(0, 0, -1)
+		days := int(monthEnd.Sub(today).Hours()/24+0.5) + 1
+		accruals, err = storage.AccrueInterest(account.ID, testProduct, monthEnd)
+		require.NoError(t, err)
+		require.Len(t, accruals, days)
+		for _, accrual := range accruals[:days-1] {
+			assert.True(t, decimal.NewFromInt(100).Equal(accrual.Amount))
+			assert.Nil(t, accrual.TransactionID)
+		}
+		last := accruals[days-1]
+		require.NotNil(t, last.TransactionID)
+		interest := decimal.NewFromInt(int64(100 * days))
+		assert.True(t, interest.Equal(last.Posted))
+
+		posting, err := storage.GetTransactionByID(*last.TransactionID)
+		require.NoError(t, err)
+		assert.Equal(t, model.TransactionTypeInterest, posting.Type)
+		assert.Nil(t, posting.FromAccountID)
+		assert.Equal(t, account.ID, posting.ToAccountID)
+		assert.True(t, interest.Equal(posting.Amount))
+		entries, err := storage.GetEntriesByTransactionID(posting.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, model.SystemAccountInterest, entries[0].Account)
+
+		got, err := storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(1000000).Add(interest).Equal(got.Balance))
+		assert.True(t, got.AccruedInterest.IsZero())
+		assert.True(t, monthEnd.Equal(got.AccruedThrough))
+
+		// 已計息的日子不會重算
+		accruals, err = storage.AccrueInterest(account.ID, testProduct, monthEnd)
+		require.NoError(t, err)
+		assert.Empty(t, accruals)
+
+		// 之後的日終餘額含入帳的利息與新的存款
+		require.NoError(t, storage.Deposit(model.NewDeposit(account.ID, decimal.NewFromInt(1000000), "trace-interest")))
+		accruals, err = storage.AccrueInterest(account.ID, testProduct, monthEnd.AddDate(0, 0, 2))
+		require.NoError(t, err)
+		require.Len(t, accruals, 2)
+		balance := decimal.NewFromInt(2000000).Add(interest)
+		assert.True(t, balance.Equal(accruals[0].Balance), accruals[0].Balance.String())
+		assert.True(t, balance.Mul(testProduct.Rate).Div(decimal.NewFromInt(365)).Equal(accruals[1].Amount))
+
+		history, err := storage.GetInterestAccruals(account.ID)
+		require.NoError(t, err)
+		require.Len(t, history, days+2)
+		assert.True(t, today.Equal(history[0].Date))
+		require.NotNil(t, history[days-1].TransactionID)
+		assert.Equal(t, posting.ID, *history[days-1].TransactionID)
+		assert.Equal(t, model.DayCountAct365, history[0].DayCount)
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+		assert.Empty(t, trial.Mismatches)
+
+		page, err := storage.QueryTransactions(model.TransactionQuery{
+			AccountID: account.ID,
+			Filter:    model.TransactionFilter{Type: model.TransactionTypeInterest},
+		})
+		require.NoError(t, err)
+		require.Len(t, page.Transactions, 1)
+		assert.Equal(t, posting.ID, page.Transactions[0].ID)
+	})
+}
+
+// TestCloseWithAccruedInterest 月中結清時未入帳的利息不能隨結清消失
+func TestCloseWithAccruedInterest(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "closing saver", Balance: decimal.NewFromInt(1000000)}
+		require.NoError(t, storage.CreateAccount(account))
+		_, err := storage.SetAccountProduct(account.ID, "savings")
+		require.NoError(t, err)
+
+		// 計息到月中的某一天, 今天是月底時改到下個月1號避免入帳
+		now := time.Now()
+		through := day(now.Year(), now.Month(), now.Day())
+		if through.AddDate(0, 0, 1).Day() == 1 {
+			through = through.AddDate(0, 0, 1)
+		}
+		_, err = storage.AccrueInterest(account.ID, testProduct, through)
+		require.NoError(t, err)
+		got, err := storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		require.True(t, got.AccruedInterest.IsPositive())
+
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(1000000), "")))
+		_, err = storage.UpdateAccountStatus(account.ID, model.AccountStatusClosed, "customer request")
+		assert.ErrorIs(t, err, model.ErrBalanceNotZero)
+		got, err = storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.AccountStatusActive, got.CurrentStatus())
+
+		// 月底入帳提領後可以結清
+		monthEnd := day(through.Year(), through.Month()+1, 1).AddDate(0, 0, -1)
+		_, err = storage.AccrueInterest(account.ID, testProduct, monthEnd)
+		require.NoError(t, err)
+		got, err = storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		require.True(t, got.Balance.IsPositive())
+		require.True(t, got.AccruedInterest.IsZero())
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(account.ID, got.Balance, "")))
+
+		closed, err := storage.UpdateAccountStatus(account.ID, model.AccountStatusClosed, "customer request")
+		require.NoError(t, err)
+		assert.Equal(t, model.AccountStatusClosed, closed.CurrentStatus())
+	})
+
+	// 不足幣別最小單位的餘數不會入帳, 不影響結清
+	account := &model.Account{ID: 1, Balance: decimal.Zero, Currency: "TWD", AccruedInterest: decimal.RequireFromString("0.004")}
+	assert.NoError(t, account.Transition(model.AccountStatusClosed, "customer request"))
+}
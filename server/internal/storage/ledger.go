@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+// buildTrialBalance 依幣別彙總分錄產生試算表, 並逐一核對客戶帳戶餘額與分錄推算結果
+func buildTrialBalance(entries []model.LedgerEntry, accounts []*model.Account) *model.TrialBalance {
+	type key struct{ account, currency string }
+	totals := make(map[key]*model.LedgerAccountBalance)
+	currencies := make(map[string]*model.CurrencyTotal)
+	trial := &model.TrialBalance{}
+
+	for _, entry := range entries {
+		// 舊分錄沒有幣別
+		currencyCode := entry.Currency
+		if currencyCode == "" {
+			currencyCode = model.DefaultCurrency
+		}
+
+		total, ok := totals[key{entry.Account, currencyCode}]
+		if !ok {
+			total = &model.LedgerAccountBalance{Account: entry.Account, Currency: currencyCode}
+			totals[key{entry.Account, currencyCode}] = total
+		}
+		currency, ok := currencies[currencyCode]
+		if !ok {
+			currency = &model.CurrencyTotal{Currency: currencyCode}
+			currencies[currencyCode] = currency
+		}
+
+		switch entry.Side {
+		case model.EntryDebit:
+			total.Debit = total.Debit.Add(entry.Amount)
+			currency.Debit = currency.Debit.Add(entry.Amount)
+			trial.TotalDebit = trial.TotalDebit.Add(entry.Amount)
+		case model.EntryCredit:
+			total.Credit = total.Credit.Add(entry.Amount)
+			currency.Credit = currency.Credit.Add(entry.Amount)
+			trial.TotalCredit = trial.TotalCredit.Add(entry.Amount)
+		}
+	}
+
+	for _, account := range accounts {
+		ledger := decimal.Zero
+		if total, ok := totals[key{model.CustomerLedgerAccount(account.ID), account.CurrencyInfo().Code}]; ok {
+			ledger = total.Net()
+		}
+		if !ledger.Equal(account.Balance) {
+			trial.Mismatches = append(trial.Mismatches, model.BalanceMismatch{
+				AccountID: account.ID,
+				Balance:   account.Balance,
+				Ledger:    ledger,
+			})
+		}
+	}
+	sort.Slice(trial.Mismatches, func(i, j int) bool {
+		return trial.Mismatches[i].AccountID < trial.Mismatches[j].AccountID
+	})
+
+	trial.Accounts = make([]model.LedgerAccountBalance, 0, len(totals))
+	for _, total := range totals {
+		trial.Accounts = append(trial.Accounts, *total)
+	}
+	// system帳戶排前面, 其餘依代碼, 幣別排序
+	sort.Slice(trial.Accounts, func(i, j int) bool {
+		a, b := trial.Accounts[i], trial.Accounts[j]
+		if sa, sb := strings.HasPrefix(a.Account, "system:"), strings.HasPrefix(b.Account, "system:"); sa != sb {
+			return sa
+		}
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		return a.Currency < b.Currency
+	})
+
+	trial.Balanced = len(trial.Mismatches) == 0
+	trial.Currencies = make([]model.CurrencyTotal, 0, len(currencies))
+	for _, currency := range currencies {
+		trial.Currencies = append(trial.Currencies, *currency)
+		if !currency.Debit.Equal(currency.Credit) {
+			trial.Balanced = false
+		}
+	}
+	sort.Slice(trial.Currencies, func(i, j int) bool {
+		return trial.Currencies[i].Currency < trial.Currencies[j].Currency
+	})
+	return trial
+}
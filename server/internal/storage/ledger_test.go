@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerEntries(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		from := &model.Account{Name: "from", Balance: decimal.NewFromFloat(100)}
+		to := &model.Account{Name: "to", Balance: decimal.Zero}
+		require.NoError(t, storage.CreateAccount(from))
+		require.NoError(t, storage.CreateAccount(to))
+
+		tests := []struct {
+			name        string
+			transaction *model.Transaction
+			post        func(*model.Transaction) error
+			debit       string
+			credit      string
+		}{
+			{
+				name:        "deposit",
+				transaction: model.NewDeposit(from.ID, decimal.NewFromFloat(50), ""),
+				post:        storage.Deposit,
+				debit:       model.SystemAccountCashIn,
+				credit:      model.CustomerLedgerAccount(from.ID),
+			},
+			{
+				name:        "withdraw",
+				transaction: model.NewWithdraw(from.ID, decimal.NewFromFloat(20), ""),
+				post:        storage.Withdraw,
+				debit:       model.CustomerLedgerAccount(from.ID),
+				credit:      model.SystemAccountCashOut,
+			},
+			{
+				name:        "transfer",
+				transaction: model.NewTransfer(from.ID, to.ID, decimal.NewFromFloat(30), ""),
+				post:        storage.Transfer,
+				debit:       model.CustomerLedgerAccount(from.ID),
+				credit:      model.CustomerLedgerAccount(to.ID),
+			},
+		}
+
+		for _, tt := range tests {
+			require.NoError(t, tt.post(tt.transaction), tt.name)
+
+			entries, err := storage.GetEntriesByTransactionID(tt.transaction.ID)
+			require.NoError(t, err)
+			require.Len(t, entries, 2, tt.name)
+
+			assert.Equal(t, model.EntryDebit, entries[0].Side)
+			assert.Equal(t, tt.debit, entries[0].Account, tt.name)
+			assert.Equal(t, model.EntryCredit, entries[1].Side)
+			assert.Equal(t, tt.credit, entries[1].Account, tt.name)
+			assert.True(t, entries[0].Amount.Equal(entries[1].Amount), tt.name)
+		}
+
+		// 失敗的交易不產生分錄
+		failed := model.NewWithdraw(from.ID, decimal.NewFromFloat(1000), "")
+		assert.Error(t, storage.Withdraw(failed))
+		entries, err := storage.GetEntriesByTransactionID(failed.ID)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestTrialBalance(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		a := &model.Account{Name: "a", Balance: decimal.NewFromFloat(100)}
+		b := &model.Account{Name: "b", Balance: decimal.NewFromFloat(50)}
+		require.NoError(t, storage.CreateAccount(a))
+		require.NoError(t, storage.CreateAccount(b))
+
+		require.NoError(t, storage.Deposit(model.NewDeposit(a.ID, decimal.NewFromFloat(25.5), "")))
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(b.ID, decimal.NewFromFloat(10), "")))
+		require.NoError(t, storage.Transfer(model.NewTransfer(a.ID, b.ID, decimal.NewFromFloat(40), "")))
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+
+		assert.True(t, trial.Balanced)
+		assert.Empty(t, trial.Mismatches)
+		assert.True(t, trial.TotalDebit.Equal(trial.TotalCredit))
+
+		// 所有總帳帳戶淨額加總為0
+		net := decimal.Zero
+		balances := make(map[string]decimal.Decimal)
+		for _, account := range trial.Accounts {
+			net = net.Add(account.Net())
+			balances[account.Account] = account.Net()
+		}
+		assert.True(t, net.IsZero(), "books should sum to zero, got %s", net)
+
+		// cash_in: 100 + 50 + 25.5 借方, cash_out: 10 貸方
+		assert.True(t, decimal.NewFromFloat(-175.5).Equal(balances[model.SystemAccountCashIn]))
+		assert.True(t, decimal.NewFromFloat(10).Equal(balances[model.SystemAccountCashOut]))
+		assert.True(t, decimal.NewFromFloat(85.5).Equal(balances[model.CustomerLedgerAccount(a.ID)]))
+		assert.True(t, decimal.NewFromFloat(80).Equal(balances[model.CustomerLedgerAccount(b.ID)]))
+	})
+}
+
+// 只寫紀錄不動分錄的帳戶會被試算抓出來
+func TestTrialBalanceDetectsMismatch(t *testing.T) {
+	trial := buildTrialBalance(
+		[]model.LedgerEntry{
+			{Account: model.SystemAccountCashIn, Side: model.EntryDebit, Amount: decimal.NewFromFloat(100)},
+			{Account: model.CustomerLedgerAccount(1), Side: model.EntryCredit, Amount: decimal.NewFromFloat(100)},
+		},
+		[]*model.Account{{ID: 1, Balance: decimal.NewFromFloat(120)}},
+	)
+
+	assert.False(t, trial.Balanced)
+	require.Len(t, trial.Mismatches, 1)
+	assert.Equal(t, uint64(1), trial.Mismatches[0].AccountID)
+	assert.True(t, decimal.NewFromFloat(100).Equal(trial.Mismatches[0].Ledger))
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAccountLimits(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "business", Tier: "business"}
+		require.NoError(t, storage.CreateAccount(account))
+
+		retrieved, err := storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "business", retrieved.CurrentTier())
+		assert.Nil(t, retrieved.Limits)
+
+		perTransaction := decimal.RequireFromString("250.50")
+		count := 3
+		limits := &model.Limits{PerTransaction: &perTransaction, DailyCount: &count}
+		// tier空字串維持目前等級
+		updated, err := storage.SetAccountLimits(account.ID, "", limits)
+		require.NoError(t, err)
+		assert.Equal(t, "business", updated.Tier)
+
+		retrieved, err = storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		require.NotNil(t, retrieved.Limits)
+		assert.True(t, perTransaction.Equal(*retrieved.Limits.PerTransaction))
+		assert.Nil(t, retrieved.Limits.DailyAmount)
+		assert.Equal(t, 3, *retrieved.Limits.DailyCount)
+
+		_, err = storage.SetAccountLimits(account.ID, "standard", nil)
+		require.NoError(t, err)
+		retrieved, err = storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "standard", retrieved.Tier)
+		assert.Nil(t, retrieved.Limits)
+
+		negative := decimal.NewFromInt(-1)
+		_, err = storage.SetAccountLimits(account.ID, "", &model.Limits{DailyAmount: &negative})
+		assert.ErrorIs(t, err, model.ErrInvalidRequest)
+		precise := decimal.RequireFromString("0.001")
+		_, err = storage.SetAccountLimits(account.ID, "", &model.Limits{DailyAmount: &precise})
+		assert.ErrorIs(t, err, model.ErrInvalidAmount)
+		_, err = storage.SetAccountLimits(999, "", nil)
+		assert.ErrorIs(t, err, model.ErrAccountNotFound)
+	})
+}
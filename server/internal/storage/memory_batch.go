@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+// TransferBatch 依帳戶ID順序鎖住批次涉及的所有帳戶(與Transfer相同的順序, 不會互相等待)
+// 在帳戶副本上依序套用每一筆(含手續費), 全部通過才以一筆WAL紀錄寫入
+func (s *MemoryStorage) TransferBatch(transactions []*model.Transaction) error {
+	ids := make([]uint64, 0, 2*len(transactions))
+	for i, transaction := range transactions {
+		if err := checkBatchTransfer(transaction); err != nil {
+			return model.NewBatchError(i, err)
+		}
+		ids = append(ids, *transaction.FromAccountID, transaction.ToAccountID)
+	}
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
+	unlock := s.lockAccounts(ids...)
+	defer unlock()
+
+	now := time.Now()
+	working := make(map[uint64]*model.Account, len(ids))
+	s.globalMutex.RLock()
+	for _, id := range ids {
+		if account, exists := s.accounts[id]; exists && working[id] == nil {
+			working[id] = s.withHolds(account, now)
+		}
+	}
+	s.globalMutex.RUnlock()
+
+	for i, transaction := range transactions {
+		from, to := working[*transaction.FromAccountID], working[transaction.ToAccountID]
+		if from == nil {
+			return model.NewBatchError(i, ErrSourceAccountNotFound)
+		}
+		if to == nil {
+			return model.NewBatchError(i, ErrDestinationAccountNotFound)
+		}
+		if err := checkTransfer(from, to, transaction); err != nil {
+			return model.NewBatchError(i, err)
+		}
+		if err := checkFee(from, transaction); err != nil {
+			return model.NewBatchError(i, err)
+		}
+		if err := checkAvailable(from, transaction.Amount.Add(transaction.FeeAmount())); err != nil {
+			return model.NewBatchError(i, err)
+		}
+
+		fromBefore, toBefore := from.Balance, to.Balance
+		from.Balance = from.Balance.Sub(transaction.Amount)
+		from.UpdatedAt = now
+		to.Balance = to.Balance.Add(transaction.CreditAmount())
+		to.UpdatedAt = now
+		transaction.TrackOverdraft(from, fromBefore)
+		transaction.TrackOverdraft(to, toBefore)
+		chargeFee(from, transaction)
+	}
+
+	accounts := make([]model.Account, 0, len(working))
+	for _, account := range working {
+		// Held由讀取時計算, 不寫入
+		updated := *account
+		updated.Held = decimal.Zero
+		accounts = append(accounts, updated)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+
+	s.globalMutex.RLock()
+	defer s.globalMutex.RUnlock()
+
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	posted := withFees(transactions)
+	for i, transaction := range posted {
+		transaction.ID = s.transactionID + uint64(i) + 1
+		transaction.CreatedAt = now
+		transaction.StampOverdraftEvents()
+	}
+	for _, transaction := range transactions {
+		transaction.LinkFee()
+	}
+	return s.commit(walRecord{Op: walOpBatch, Accounts: accounts, Batch: posted})
+}
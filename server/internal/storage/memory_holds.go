@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+// withHolds 帳戶copy並填入now時有效預授權的圈存合計
+// 呼叫端需持有帳戶鎖, hold的異動也都在帳戶寫鎖內
+func (s *MemoryStorage) withHolds(account *model.Account, now time.Time) *model.Account {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	accountCopy := *account
+	accountCopy.Held = decimal.Zero
+	for _, id := range s.accountHolds[account.ID] {
+		accountCopy.Held = accountCopy.Held.Add(s.holds[id].HeldAt(now))
+	}
+	return &accountCopy
+}
+
+// putHold 新增或覆蓋hold, 呼叫端需持有transactionMutex
+func (s *MemoryStorage) putHold(hold model.Hold) {
+	if existing, ok := s.holds[hold.ID]; ok {
+		*existing = hold
+		return
+	}
+	s.holds[hold.ID] = &hold
+	s.accountHolds[hold.AccountID] = append(s.accountHolds[hold.AccountID], hold.ID)
+	if hold.ID > s.holdID {
+		s.holdID = hold.ID
+	}
+}
+
+// commitHolds 只異動hold, 呼叫端需持有帳戶寫鎖
+func (s *MemoryStorage) commitHolds(holds ...model.Hold) error {
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	return s.commit(walRecord{Op: walOpHold, Holds: holds})
+}
+
+// CreateHold 圈存, 可用餘額需足夠, 與提款轉帳在同一把帳戶寫鎖內互斥
+func (s *MemoryStorage) CreateHold(hold *model.Hold) error {
+	if !hold.Amount.IsPositive() {
+		return errInvalidHold
+	}
+
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
+	accountLock := s.getAccountLock(hold.AccountID)
+	accountLock.Lock()
+	defer accountLock.Unlock()
+
+	s.globalMutex.RLock()
+	account, exists := s.accounts[hold.AccountID]
+	s.globalMutex.RUnlock()
+
+	if !exists {
+		return model.ErrAccountNotFound
+	}
+	now := time.Now()
+	if err := checkHold(s.withHolds(account, now), hold); err != nil {
+		return err
+	}
+
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	hold.ID = s.holdID + 1
+	hold.Captured = decimal.Zero
+	hold.Status = model.HoldStatusActive
+	hold.CreatedAt = now
+	hold.UpdatedAt = now
+	if err := s.commit(walRecord{Op: walOpHold, Holds: []model.Hold{*hold}}); err != nil {
+		hold.ID = 0
+		return err
+	}
+	return nil
+}
+
+// getHold hold的copy, 不存在時回傳ErrHoldNotFound
+func (s *MemoryStorage) getHold(id uint64) (*model.Hold, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	hold, exists := s.holds[id]
+	if !exists {
+		return nil, model.ErrHoldNotFound
+	}
+	holdCopy := *hold
+	return &holdCopy, nil
+}
+
+func (s *MemoryStorage) GetHold(id uint64) (*model.Hold, error) {
+	return s.getHold(id)
+}
+
+func (s *MemoryStorage) GetHoldsByAccountID(accountID uint64) ([]*model.Hold, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	var holds []*model.Hold
+	for _, id := range s.accountHolds[accountID] {
+		holdCopy := *s.holds[id]
+		holds = append(holds, &holdCopy)
+	}
+	return holds, nil
+}
+
+// lockHold 取得hold所屬帳戶的寫鎖後重新讀取hold, 呼叫端負責unlock
+func (s *MemoryStorage) lockHold(id uint64) (*model.Hold, func(), error) {
+	hold, err := s.getHold(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.ledgerMutex.RLock()
+	accountLock := s.getAccountLock(hold.AccountID)
+	accountLock.Lock()
+	unlock := func() {
+		accountLock.Unlock()
+		s.ledgerMutex.RUnlock()
+	}
+
+	// hold所屬帳戶不會變, 拿到鎖後的狀態才是準的
+	if hold, err = s.getHold(id); err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return hold, unlock, nil
+}
+
+// CaptureHold 請款, hold, 提款交易與附加的手續費在同一把帳戶寫鎖內一起完成
+// transaction.HoldID: 請款的hold, transaction.Amount: 請款金額
+func (s *MemoryStorage) CaptureHold(transaction *model.Transaction) (*model.Hold, error) {
+	if transaction.HoldID == nil {
+		return nil, model.ErrHoldNotFound
+	}
+	hold, unlock, err := s.lockHold(*transaction.HoldID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	s.globalMutex.RLock()
+	account, exists := s.accounts[hold.AccountID]
+	s.globalMutex.RUnlock()
+
+	if !exists {
+		return nil, model.ErrAccountNotFound
+	}
+	now := time.Now()
+	if err := checkCapture(s.withHolds(account, now), hold, transaction, now); err != nil {
+		return nil, err
+	}
+
+	updated := *account
+	updated.Balance = account.Balance.Sub(transaction.Amount)
+	updated.UpdatedAt = now
+	transaction.TrackOverdraft(&updated, account.Balance)
+	chargeFee(&updated, transaction)
+
+	record := walRecord{Op: walOpPost, Accounts: []model.Account{updated}, Holds: []model.Hold{*hold}, Transaction: transaction}
+	if err := s.postRecord(record); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ReleaseHold 解除剩餘圈存
+func (s *MemoryStorage) ReleaseHold(id uint64) (*model.Hold, error) {
+	hold, unlock, err := s.lockHold(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := hold.Release(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.commitHolds(*hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ExpireHolds 將now時已過期的active hold標記為expired
+// 過期的hold本來就不計入圈存, 標記只是讓狀態落地
+func (s *MemoryStorage) ExpireHolds(now time.Time) ([]*model.Hold, error) {
+	s.transactionMutex.RLock()
+	var candidates []uint64
+	for id, hold := range s.holds {
+		if hold.Status == model.HoldStatusActive && hold.StatusAt(now) == model.HoldStatusExpired {
+			candidates = append(candidates, id)
+		}
+	}
+	s.transactionMutex.RUnlock()
+
+	var expired []*model.Hold
+	for _, id := range candidates {
+		hold, err := s.expireHold(id, now)
+		if err != nil {
+			return expired, err
+		}
+		if hold != nil {
+			expired = append(expired, hold)
+		}
+	}
+	sortHolds(expired)
+	return expired, nil
+}
+
+// expireHold 持有帳戶寫鎖重新確認後標記, 期間被請款或解除時回傳nil
+func (s *MemoryStorage) expireHold(id uint64, now time.Time) (*model.Hold, error) {
+	hold, unlock, err := s.lockHold(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if hold.Status != model.HoldStatusActive || hold.StatusAt(now) != model.HoldStatusExpired {
+		return nil, nil
+	}
+	hold.Status = model.HoldStatusExpired
+	hold.UpdatedAt = now
+	if err := s.commitHolds(*hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+func sortHolds(holds []*model.Hold) {
+	sort.Slice(holds, func(i, j int) bool { return holds[i].ID < holds[j].ID })
+}
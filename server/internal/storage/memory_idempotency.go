@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+// putIdempotency 保存record, 呼叫端需持有transactionMutex
+func (s *MemoryStorage) putIdempotency(record model.IdempotencyRecord) {
+	s.idempotency[idempotencyKey{scope: record.Scope, key: record.Key}] = &record
+}
+
+// Begin 同SQLiteStorage, record隨WAL與snapshot落地, 重啟後已完成的請求仍會重放, 未完成的可以重試
+func (s *MemoryStorage) Begin(scope, key, fingerprint string, ttl time.Duration) (*model.IdempotencyRecord, error) {
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.idempotencySweep) > sweepInterval {
+		// 過期的record只從記憶體移除, 重放時即使再載入也視為不存在
+		for k, record := range s.idempotency {
+			if now.After(record.ExpiresAt) {
+				delete(s.idempotency, k)
+			}
+		}
+		s.idempotencySweep = now
+	}
+
+	if record, ok := s.idempotency[idempotencyKey{scope: scope, key: key}]; ok && now.Before(record.ExpiresAt) {
+		return replayRecord(record, fingerprint)
+	}
+	record := model.IdempotencyRecord{
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	return nil, s.commit(walRecord{Op: walOpIdempotency, Idempotency: []model.IdempotencyRecord{record}})
+}
+
+func (s *MemoryStorage) Complete(scope, key string, statusCode int, body []byte) error {
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	record, ok := s.idempotency[idempotencyKey{scope: scope, key: key}]
+	if !ok {
+		return errors.New("idempotency key not found")
+	}
+	updated := *record
+	updated.StatusCode = statusCode
+	updated.Body = body
+	updated.Completed = true
+	return s.commit(walRecord{Op: walOpIdempotency, Idempotency: []model.IdempotencyRecord{updated}})
+}
+
+func (s *MemoryStorage) Release(scope, key string) error {
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	if _, ok := s.idempotency[idempotencyKey{scope: scope, key: key}]; !ok {
+		return nil
+	}
+	released := model.IdempotencyRecord{Scope: scope, Key: key}
+	return s.commit(walRecord{Op: walOpIdempotency, ReleasedKeys: []model.IdempotencyRecord{released}})
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+func (s *MemoryStorage) SetAccountProduct(id uint64, product string) (*model.Account, error) {
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
+	accountLock := s.getAccountLock(id)
+	accountLock.Lock()
+	defer accountLock.Unlock()
+
+	s.globalMutex.RLock()
+	account, exists := s.accounts[id]
+	s.globalMutex.RUnlock()
+
+	if !exists {
+		return nil, model.ErrAccountNotFound
+	}
+
+	updated := *account
+	if err := updated.SetProduct(product, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.updateAccount(updated); err != nil {
+		return nil, err
+	}
+	return s.withHolds(&updated, time.Now()), nil
+}
+
+// GetInterestBearingAccounts 先取得帳戶ID, 再逐一在帳戶讀鎖內讀取
+func (s *MemoryStorage) GetInterestBearingAccounts() ([]*model.Account, error) {
+	s.globalMutex.RLock()
+	ids := make([]uint64, 0, len(s.accounts))
+	for id := range s.accounts {
+		ids = append(ids, id)
+	}
+	s.globalMutex.RUnlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var accounts []*model.Account
+	for _, id := range ids {
+		account, err := s.GetAccountByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if account.Product != "" {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+// AccrueInterest 持有帳戶寫鎖, 推算日終餘額期間帳戶不會有新的交易
+func (s *MemoryStorage) AccrueInterest(accountID uint64, product model.Product, through time.Time) ([]model.InterestAccrual, error) {
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
+	accountLock := s.getAccountLock(accountID)
+	accountLock.Lock()
+	defer accountLock.Unlock()
+
+	s.globalMutex.RLock()
+	account, exists := s.accounts[accountID]
+	s.globalMutex.RUnlock()
+
+	if !exists {
+		return nil, model.ErrAccountNotFound
+	}
+	if account.AccruedThrough.IsZero() {
+		return nil, nil
+	}
+
+	updated := *account
+	history := s.transactionsSince(accountID, updated.AccruedThrough.AddDate(0, 0, 1))
+	accruals, postings := updated.AccrueInterest(product, through, history)
+	if len(accruals) == 0 {
+		return accruals, nil
+	}
+
+	s.globalMutex.RLock()
+	defer s.globalMutex.RUnlock()
+
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	now := time.Now()
+	updated.UpdatedAt = now
+	for i, posting := range postings {
+		posting.ID = s.transactionID + uint64(i) + 1
+		posting.CreatedAt = now
+		posting.StampOverdraftEvents()
+	}
+	model.BindInterestPostings(accruals, postings)
+	for i := range accruals {
+		accruals[i].CreatedAt = now
+	}
+	if err := s.commit(walRecord{Op: walOpInterest, Accounts: []model.Account{updated}, Batch: postings, Accruals: accruals}); err != nil {
+		return nil, err
+	}
+	return accruals, nil
+}
+
+// transactionsSince 帳戶在since(含)之後的交易, 由帳戶索引從最新往回找
+func (s *MemoryStorage) transactionsSince(accountID uint64, since time.Time) []*model.Transaction {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	ids := s.accountIndex[accountID]
+	var transactions []*model.Transaction
+	for i := len(ids) - 1; i >= 0; i-- {
+		transaction := s.transactions[ids[i]]
+		if transaction.CreatedAt.Before(since) {
+			break
+		}
+		transactionCopy := *transaction
+		transactions = append(transactions, &transactionCopy)
+	}
+	return transactions
+}
+
+func (s *MemoryStorage) GetInterestAccruals(accountID uint64) ([]model.InterestAccrual, error) {
+	if _, err := s.GetAccountByID(accountID); err != nil {
+		return nil, err
+	}
+
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	return append([]model.InterestAccrual{}, s.interestAccruals[accountID]...), nil
+}
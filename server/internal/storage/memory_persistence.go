@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.gob"
+)
+
+// memorySnapshot MemoryStorage完整狀態, LSN為snapshot涵蓋到的最後一筆WAL
+type memorySnapshot struct {
+	LSN           uint64
+	AccountID     uint64
+	TransactionID uint64
+	EntryID       uint64
+	HoldID        uint64
+	Accounts      []model.Account
+	Transactions  []model.Transaction
+	Entries       []model.LedgerEntry
+	Holds         []model.Hold
+	// 定期轉帳與執行紀錄, 舊版snapshot沒有這兩欄, 載入時為空
+	StandingOrderID uint64
+	StandingOrders  []model.StandingOrder
+	StandingRuns    []model.StandingOrderRun
+	// 計息紀錄, 舊版snapshot沒有這欄, 載入時為空
+	InterestAccruals []model.InterestAccrual
+	// 使用者, 舊版snapshot沒有這兩欄, 載入時為空
+	UserID uint64
+	Users  []model.User
+	// 未過期的Idempotency-Key, 舊版snapshot沒有這欄, 載入時為空
+	Idempotency []model.IdempotencyRecord
+}
+
+// OpenMemoryStorage 落地到dir的MemoryStorage
+// 啟動時載入最後一份snapshot, 再重放之後的WAL, 檔尾寫到一半的紀錄會被截斷
+// crash前還在處理中的Idempotency-Key視為放棄, client可以重試
+// snapshotInterval > 0 時定期snapshot並清空WAL, Close時也會做一次
+func OpenMemoryStorage(dir string, snapshotInterval time.Duration) (*MemoryStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := NewMemoryStorage()
+	s.dir = dir
+
+	snapshot, err := readSnapshot(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		s.restore(snapshot)
+	}
+
+	var lsn uint64
+	if snapshot != nil {
+		lsn = snapshot.LSN
+	}
+	s.wal, err = openWAL(filepath.Join(dir, walFileName), lsn, s.apply)
+	if err != nil {
+		return nil, err
+	}
+	s.dropPendingIdempotency()
+
+	s.done = make(chan struct{})
+	if snapshotInterval > 0 {
+		s.stopped = make(chan struct{})
+		go s.snapshotLoop(snapshotInterval)
+	}
+	return s, nil
+}
+
+func (s *MemoryStorage) snapshotLoop(interval time.Duration) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				logger.Error("failed to snapshot memory storage", zap.Error(err), zap.String("dir", s.dir))
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Snapshot 將目前狀態寫成snapshot並清空WAL
+// 持有transactionMutex期間所有異動暫停, 狀態與WAL位置一致
+func (s *MemoryStorage) Snapshot() error {
+	if s.wal == nil {
+		return errors.New("memory storage is not persistent")
+	}
+
+	s.globalMutex.RLock()
+	defer s.globalMutex.RUnlock()
+
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	snapshot := &memorySnapshot{
+		LSN:             s.wal.lsn,
+		AccountID:       s.accountID,
+		TransactionID:   s.transactionID,
+		EntryID:         s.entryID,
+		HoldID:          s.holdID,
+		Accounts:        make([]model.Account, 0, len(s.accounts)),
+		Transactions:    make([]model.Transaction, 0, len(s.transactions)),
+		Entries:         s.entries,
+		Holds:           make([]model.Hold, 0, len(s.holds)),
+		StandingOrderID: s.standingOrderID,
+		StandingOrders:  make([]model.StandingOrder, 0, len(s.standingOrders)),
+		UserID:          s.userID,
+		Users:           make([]model.User, 0, len(s.users)),
+	}
+	for _, account := range s.accounts {
+		snapshot.Accounts = append(snapshot.Accounts, *account)
+	}
+	for id := uint64(1); id <= s.transactionID; id++ {
+		snapshot.Transactions = append(snapshot.Transactions, *s.transactions[id])
+	}
+	for id := uint64(1); id <= s.holdID; id++ {
+		snapshot.Holds = append(snapshot.Holds, *s.holds[id])
+	}
+	for id := uint64(1); id <= s.standingOrderID; id++ {
+		snapshot.StandingOrders = append(snapshot.StandingOrders, *s.standingOrders[id])
+		snapshot.StandingRuns = append(snapshot.StandingRuns, s.standingRuns[id]...)
+	}
+	for id := uint64(1); id <= s.accountID; id++ {
+		snapshot.InterestAccruals = append(snapshot.InterestAccruals, s.interestAccruals[id]...)
+	}
+	for id := uint64(1); id <= s.userID; id++ {
+		snapshot.Users = append(snapshot.Users, *s.users[id])
+	}
+	now := time.Now()
+	for _, record := range s.idempotency {
+		if now.Before(record.ExpiresAt) {
+			snapshot.Idempotency = append(snapshot.Idempotency, *record)
+		}
+	}
+
+	if err := writeSnapshot(filepath.Join(s.dir, snapshotFileName), snapshot); err != nil {
+		return err
+	}
+	// snapshot已落地, 清空失敗也只會在重放時跳過LSN較小的紀錄
+	return s.wal.reset()
+}
+
+// dropPendingIdempotency 移除未完成的Idempotency-Key, 只在啟動時呼叫
+// 處理中的請求隨process結束不會再Complete, 保留下來client在整個TTL內都只會收到409
+func (s *MemoryStorage) dropPendingIdempotency() {
+	for k, record := range s.idempotency {
+		if !record.Completed {
+			delete(s.idempotency, k)
+		}
+	}
+}
+
+// restore 由snapshot重建狀態與帳戶索引, 只在啟動時呼叫
+func (s *MemoryStorage) restore(snapshot *memorySnapshot) {
+	for i := range snapshot.Accounts {
+		account := snapshot.Accounts[i]
+		s.accounts[account.ID] = &account
+	}
+	for i := range snapshot.Transactions {
+		s.appendTransaction(&snapshot.Transactions[i])
+	}
+	for _, hold := range snapshot.Holds {
+		s.putHold(hold)
+	}
+	for _, order := range snapshot.StandingOrders {
+		s.putStandingOrder(order)
+	}
+	for _, run := range snapshot.StandingRuns {
+		s.standingRuns[run.StandingOrderID] = append(s.standingRuns[run.StandingOrderID], run)
+	}
+	for _, accrual := range snapshot.InterestAccruals {
+		s.interestAccruals[accrual.AccountID] = append(s.interestAccruals[accrual.AccountID], accrual)
+	}
+	for _, user := range snapshot.Users {
+		s.putUser(user)
+	}
+	for _, record := range snapshot.Idempotency {
+		s.putIdempotency(record)
+	}
+	s.entries = snapshot.Entries
+	s.accountID = snapshot.AccountID
+	s.transactionID = snapshot.TransactionID
+	s.entryID = snapshot.EntryID
+	s.holdID = snapshot.HoldID
+	s.standingOrderID = snapshot.StandingOrderID
+	s.userID = snapshot.UserID
+}
+
+func readSnapshot(path string) (*memorySnapshot, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var snapshot memorySnapshot
+	if err := gob.NewDecoder(file).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("decode snapshot %s: %w", path, err)
+	}
+	return &snapshot, nil
+}
+
+// writeSnapshot 先寫暫存檔fsync後rename, crash時只會看到舊的或新的完整snapshot
+func writeSnapshot(path string, snapshot *memorySnapshot) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(file).Encode(snapshot); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// rename要落地需要fsync目錄
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,575 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crash 模擬程序中斷: 不做Close時的snapshot, 只釋放檔案
+func crash(t *testing.T, s *MemoryStorage) {
+	require.NoError(t, s.wal.close())
+}
+
+// seedPersistent 開KWD帳戶並做存提轉(含3位小數金額), 回傳兩個帳戶ID
+func seedPersistent(t *testing.T, s *MemoryStorage) (uint64, uint64) {
+	alice := &model.Account{Name: "alice", Balance: decimal.NewFromInt(100), Currency: "KWD"}
+	bob := &model.Account{Name: "bob", Balance: decimal.Zero, Currency: "KWD"}
+	require.NoError(t, s.CreateAccount(alice))
+	require.NoError(t, s.CreateAccount(bob))
+	require.NoError(t, s.Deposit(model.NewDeposit(alice.ID, decimal.RequireFromString("0.125"), "trace-1")))
+	require.NoError(t, s.Withdraw(model.NewWithdraw(alice.ID, decimal.NewFromInt(10), "trace-2")))
+	require.NoError(t, s.Transfer(model.NewTransfer(alice.ID, bob.ID, decimal.NewFromInt(30), "trace-3")))
+	return alice.ID, bob.ID
+}
+
+func assertRecovered(t *testing.T, s *MemoryStorage, aliceID, bobID uint64) {
+	alice, err := s.GetAccountByID(aliceID)
+	require.NoError(t, err)
+	assert.True(t, decimal.RequireFromString("60.125").Equal(alice.Balance), alice.Balance.String())
+	bob, err := s.GetAccountByID(bobID)
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(30).Equal(bob.Balance), bob.Balance.String())
+
+	transactions, err := s.GetTransactionsByAccountID(aliceID)
+	require.NoError(t, err)
+	// opening + deposit + withdraw + transfer
+	require.Len(t, transactions, 4)
+	assert.Equal(t, "trace-3", transactions[3].TraceID)
+
+	trial, err := s.TrialBalance()
+	require.NoError(t, err)
+	assert.True(t, trial.Balanced)
+}
+
+func TestMemoryStorageReplaysWAL(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+	assertRecovered(t, recovered, aliceID, bobID)
+
+	// 重放後ID接續分配
+	carol := &model.Account{Name: "carol"}
+	require.NoError(t, recovered.CreateAccount(carol))
+	assert.Equal(t, bobID+1, carol.ID)
+	deposit := model.NewDeposit(carol.ID, decimal.NewFromInt(1), "")
+	require.NoError(t, recovered.Deposit(deposit))
+	assert.Equal(t, uint64(5), deposit.ID)
+}
+
+func TestMemoryStorageReplaysAccountStatus(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+	_, err = s.UpdateAccountStatus(aliceID, model.AccountStatusFrozen, "fraud")
+	require.NoError(t, err)
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+	assertRecovered(t, recovered, aliceID, bobID)
+
+	alice, err := recovered.GetAccountByID(aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, model.AccountStatusFrozen, alice.Status)
+	assert.Equal(t, "fraud", alice.StatusReason)
+}
+
+func TestMemoryStorageSnapshotThenWAL(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+
+	require.NoError(t, s.Snapshot())
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "wal should be truncated after snapshot")
+
+	// snapshot之後的異動只在WAL
+	require.NoError(t, s.AddTransaction(&model.Transaction{Type: model.TransactionTypeDeposit, ToAccountID: bobID, Amount: decimal.NewFromInt(1)}))
+	require.NoError(t, s.Deposit(model.NewDeposit(bobID, decimal.NewFromInt(5), "")))
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	bob, err := recovered.GetAccountByID(bobID)
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(35).Equal(bob.Balance), bob.Balance.String())
+
+	all, err := recovered.GetAllTransactions()
+	require.NoError(t, err)
+	require.Len(t, all, 6)
+	// AddTransaction只有紀錄沒有分錄
+	entries, err := recovered.GetEntriesByTransactionID(all[4].ID)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	alice, err := recovered.GetAccountByID(aliceID)
+	require.NoError(t, err)
+	assert.True(t, decimal.RequireFromString("60.125").Equal(alice.Balance))
+}
+
+func TestMemoryStorageCloseSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+
+	_, err = os.Stat(filepath.Join(dir, snapshotFileName))
+	require.NoError(t, err)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+	assertRecovered(t, recovered, aliceID, bobID)
+}
+
+// snapshot落地但WAL還沒清空就crash, 重放時要跳過已包含在snapshot的紀錄
+func TestMemoryStorageSkipsRecordsCoveredBySnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+
+	walPath := filepath.Join(dir, walFileName)
+	wal, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	require.NoError(t, s.Snapshot())
+	crash(t, s)
+	require.NoError(t, os.WriteFile(walPath, wal, 0o644))
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+	assertRecovered(t, recovered, aliceID, bobID)
+}
+
+func TestMemoryStorageTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+	require.NoError(t, s.Deposit(model.NewDeposit(bobID, decimal.NewFromInt(7), "")))
+	crash(t, s)
+
+	walPath := filepath.Join(dir, walFileName)
+	wal, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	intact := int64(len(wal))
+
+	// 最後一筆存款只寫了一半
+	require.NoError(t, os.WriteFile(walPath, wal[:len(wal)-5], 0o644))
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	assertRecovered(t, recovered, aliceID, bobID)
+
+	info, err := os.Stat(walPath)
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), intact-5, "torn record should be truncated")
+
+	// 截斷後可以繼續寫入, 重開後仍一致
+	require.NoError(t, recovered.Deposit(model.NewDeposit(bobID, decimal.NewFromInt(1), "")))
+	crash(t, recovered)
+
+	reopened, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer reopened.Close()
+	bob, err := reopened.GetAccountByID(bobID)
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(31).Equal(bob.Balance), bob.Balance.String())
+}
+
+func TestMemoryStorageRejectsCorruptedWAL(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	seedPersistent(t, s)
+	crash(t, s)
+
+	walPath := filepath.Join(dir, walFileName)
+	wal, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+
+	// 第一筆紀錄中間的位元被改掉, 後面還有完整紀錄, 不能當成torn tail截斷
+	wal[walHeaderSize+1] ^= 0xff
+	require.NoError(t, os.WriteFile(walPath, wal, 0o644))
+
+	_, err = OpenMemoryStorage(dir, 0)
+	assert.ErrorIs(t, err, ErrWALCorrupted)
+}
+
+func TestMemoryStorageRejectsCorruptedWALLength(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	seedPersistent(t, s)
+	crash(t, s)
+
+	walPath := filepath.Join(dir, walFileName)
+	wal, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+
+	// 第一筆紀錄的長度被改成超過檔案大小, 後面的完整紀錄不能被當成torn tail截掉
+	wal[0] ^= 0x7f
+	require.NoError(t, os.WriteFile(walPath, wal, 0o644))
+
+	_, err = OpenMemoryStorage(dir, 0)
+	assert.ErrorIs(t, err, ErrWALCorrupted)
+	info, err := os.Stat(walPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(wal)), info.Size(), "corrupted wal must not be truncated")
+}
+
+func TestMemoryStorageReplaysHolds(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+
+	captured := &model.Hold{AccountID: aliceID, Amount: decimal.NewFromInt(20), ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, s.CreateHold(captured))
+	_, err = s.CaptureHold(model.NewCapture(captured, decimal.RequireFromString("5.125"), ""))
+	require.NoError(t, err)
+	require.NoError(t, s.Snapshot())
+
+	// snapshot之後的hold只在WAL
+	released := &model.Hold{AccountID: aliceID, Amount: decimal.NewFromInt(10), ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, s.CreateHold(released))
+	_, err = s.ReleaseHold(released.ID)
+	require.NoError(t, err)
+	active := &model.Hold{AccountID: bobID, Amount: decimal.NewFromInt(7), ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, s.CreateHold(active))
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	alice, err := recovered.GetAccountByID(aliceID)
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(55).Equal(alice.Balance), alice.Balance.String())
+	assert.True(t, decimal.RequireFromString("14.875").Equal(alice.Held), alice.Held.String())
+	bob, err := recovered.GetAccountByID(bobID)
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(7).Equal(bob.Held), bob.Held.String())
+
+	hold, err := recovered.GetHold(released.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldStatusReleased, hold.Status)
+
+	// 重放後ID接續分配
+	next := &model.Hold{AccountID: bobID, Amount: decimal.NewFromInt(1), ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, recovered.CreateHold(next))
+	assert.Equal(t, active.ID+1, next.ID)
+}
+
+func TestMemoryStorageReplaysOverdraft(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, _ := seedPersistent(t, s)
+
+	_, err = s.SetOverdraftLimit(aliceID, decimal.NewFromInt(100))
+	require.NoError(t, err)
+	require.NoError(t, s.Withdraw(model.NewWithdraw(aliceID, decimal.NewFromInt(80), "")))
+	require.NoError(t, s.Snapshot())
+	require.NoError(t, s.Deposit(model.NewDeposit(aliceID, decimal.NewFromInt(50), "")))
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	alice, err := recovered.GetAccountByID(aliceID)
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(100).Equal(alice.OverdraftLimit))
+	events, err := recovered.GetOverdraftEvents(aliceID)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, model.OverdraftEntered, events[0].Type)
+	assert.Equal(t, model.OverdraftExited, events[1].Type)
+}
+
+func TestMemoryStorageReplaysLimits(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, _ := seedPersistent(t, s)
+
+	daily := decimal.NewFromInt(500)
+	_, err = s.SetAccountLimits(aliceID, "business", &model.Limits{DailyAmount: &daily})
+	require.NoError(t, err)
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	alice, err := recovered.GetAccountByID(aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, "business", alice.Tier)
+	require.NotNil(t, alice.Limits)
+	assert.True(t, daily.Equal(*alice.Limits.DailyAmount))
+}
+
+func TestMemoryStorageReplaysReversals(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+
+	transactions, err := s.GetTransactionsByAccountID(bobID)
+	require.NoError(t, err)
+	transfer := transactions[len(transactions)-1]
+	_, err = s.Reverse(model.NewReversal(transfer.ID, decimal.RequireFromString("10.5"), "", "trace-reverse"))
+	require.NoError(t, err)
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	assertBalances(t, recovered, aliceID, "70.625", "70.625")
+	assertBalances(t, recovered, bobID, "19.5", "19.5")
+
+	// 重放後已沖正金額仍計入, 不能超額退款
+	_, err = recovered.Reverse(model.NewReversal(transfer.ID, decimal.NewFromInt(20), "", ""))
+	assert.ErrorIs(t, err, model.ErrInvalidAmount)
+	result, err := recovered.Reverse(model.NewReversal(transfer.ID, decimal.Zero, "", ""))
+	require.NoError(t, err)
+	assert.True(t, decimal.RequireFromString("19.5").Equal(result.Reversal.Amount))
+}
+
+func TestMemoryStorageReplaysBatch(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+
+	carol := &model.Account{Name: "carol", Currency: "KWD"}
+	require.NoError(t, s.CreateAccount(carol))
+	batch := []*model.Transaction{
+		model.NewTransfer(aliceID, bobID, decimal.RequireFromString("1.5"), "trace-batch"),
+		model.NewTransfer(aliceID, carol.ID, decimal.RequireFromString("2.25"), "trace-batch"),
+	}
+	require.NoError(t, s.TransferBatch(batch))
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	assertBalances(t, recovered, aliceID, "56.375", "56.375")
+	assertBalances(t, recovered, bobID, "31.5", "31.5")
+	assertBalances(t, recovered, carol.ID, "2.25", "2.25")
+	for _, transfer := range batch {
+		stored, err := recovered.GetTransactionByID(transfer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "trace-batch", stored.TraceID)
+	}
+
+	// 重放後交易ID接續
+	next := model.NewDeposit(carol.ID, decimal.NewFromInt(1), "")
+	require.NoError(t, recovered.Deposit(next))
+	assert.Equal(t, batch[1].ID+1, next.ID)
+}
+
+func TestMemoryStorageReplaysStandingOrders(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+
+	now := time.Now()
+	order := newTestStandingOrder(aliceID, bobID, model.Schedule{Frequency: model.ScheduleDaily}, now)
+	order.Currency = "KWD"
+	require.NoError(t, order.Start())
+	require.NoError(t, s.CreateStandingOrder(order))
+	run := model.NewStandingOrderRun(order, nil, model.ErrInsufficientBalance, now, "trace-run")
+	order.Fail(model.ErrInsufficientBalance, true, now)
+	require.NoError(t, s.UpdateStandingOrder(order, run))
+	// snapshot之後的異動由WAL重放
+	require.NoError(t, s.Snapshot())
+	require.NoError(t, order.Pause(now))
+	require.NoError(t, s.UpdateStandingOrder(order, nil))
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	got, err := recovered.GetStandingOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StandingOrderPaused, got.Status)
+	assert.Equal(t, 1, got.Attempts)
+	assert.True(t, order.NextRunAt.Equal(got.NextRunAt))
+	runs, err := recovered.GetStandingOrderRuns(order.ID)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "trace-run", runs[0].TraceID)
+
+	// 重放後ID接續
+	next := newTestStandingOrder(aliceID, bobID, model.Schedule{Frequency: model.ScheduleOnce}, now)
+	require.NoError(t, next.Start())
+	require.NoError(t, recovered.CreateStandingOrder(next))
+	assert.Equal(t, order.ID+1, next.ID)
+}
+
+func TestMemoryStorageReplaysInterest(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, _ := seedPersistent(t, s)
+
+	_, err = s.SetAccountProduct(aliceID, "savings")
+	require.NoError(t, err)
+	// snapshot之後的計息由WAL重放
+	require.NoError(t, s.Snapshot())
+	now := time.Now()
+	monthEnd := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, time.Local)
+	accruals, err := s.AccrueInterest(aliceID, testProduct, monthEnd)
+	require.NoError(t, err)
+	require.NotEmpty(t, accruals)
+	want, err := s.GetAccountByID(aliceID)
+	require.NoError(t, err)
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	got, err := recovered.GetAccountByID(aliceID)
+	require.NoError(t, err)
+	assert.True(t, want.Balance.Equal(got.Balance), got.Balance.String())
+	assert.True(t, want.AccruedInterest.Equal(got.AccruedInterest), got.AccruedInterest.String())
+	assert.True(t, monthEnd.Equal(got.AccruedThrough))
+	assert.Equal(t, "savings", got.Product)
+
+	replayed, err := recovered.GetInterestAccruals(aliceID)
+	require.NoError(t, err)
+	require.Len(t, replayed, len(accruals))
+	assert.Equal(t, accruals[len(accruals)-1].TransactionID, replayed[len(replayed)-1].TransactionID)
+
+	trial, err := recovered.TrialBalance()
+	require.NoError(t, err)
+	assert.True(t, trial.Balanced)
+
+	// 重放後不會重算已計息的日子
+	accruals, err = recovered.AccrueInterest(aliceID, testProduct, monthEnd)
+	require.NoError(t, err)
+	assert.Empty(t, accruals)
+}
+
+func TestMemoryStorageReplaysFees(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	aliceID, bobID := seedPersistent(t, s)
+
+	withdraw := withFee(model.NewWithdraw(aliceID, decimal.NewFromInt(10), "trace-fee"), aliceID, "0.125")
+	require.NoError(t, s.Withdraw(withdraw))
+	transfer := withFee(model.NewTransfer(aliceID, bobID, decimal.NewFromInt(20), "trace-fee"), aliceID, "1")
+	require.NoError(t, s.Transfer(transfer))
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	assertBalances(t, recovered, aliceID, "29", "29")
+	assertBalances(t, recovered, bobID, "50", "50")
+	for _, transaction := range []*model.Transaction{withdraw, transfer} {
+		fee, err := recovered.GetTransactionByID(transaction.Fee.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.TransactionTypeFee, fee.Type)
+		require.NotNil(t, fee.FeeFor)
+		assert.Equal(t, transaction.ID, *fee.FeeFor)
+		stored, err := recovered.GetTransactionByID(transaction.ID)
+		require.NoError(t, err)
+		assert.Nil(t, stored.Fee)
+	}
+
+	trial, err := recovered.TrialBalance()
+	require.NoError(t, err)
+	assert.True(t, trial.Balanced)
+
+	// 重放後交易ID接續
+	next := model.NewDeposit(bobID, decimal.NewFromInt(1), "")
+	require.NoError(t, recovered.Deposit(next))
+	assert.Equal(t, transfer.Fee.ID+1, next.ID)
+}
+
+func TestMemoryStorageReplaysIdempotencyKeys(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+
+	_, err = s.Begin("client", "before-snapshot", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.Complete("client", "before-snapshot", 201, []byte(`{"id":1}`)))
+	_, err = s.Begin("client", "in-progress-snapshot", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.Snapshot())
+
+	_, err = s.Begin("client", "after-snapshot", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.Complete("client", "after-snapshot", 200, []byte(`{"id":2}`)))
+	_, err = s.Begin("client", "in-progress", "fp", time.Hour)
+	require.NoError(t, err)
+	_, err = s.Begin("client", "released", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.Release("client", "released"))
+	crash(t, s)
+
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	record, err := recovered.Begin("client", "before-snapshot", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, 201, record.StatusCode)
+	assert.Equal(t, `{"id":1}`, string(record.Body))
+
+	record, err = recovered.Begin("client", "after-snapshot", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, 200, record.StatusCode)
+
+	_, err = recovered.Begin("client", "after-snapshot", "other", time.Hour)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyMismatch)
+	// crash前處理中的key不會卡住, 可以重試
+	record, err = recovered.Begin("client", "in-progress", "fp", time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+	_, err = recovered.Begin("client", "in-progress", "fp", time.Hour)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyInProgress)
+	record, err = recovered.Begin("client", "in-progress-snapshot", "fp", time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	// release過的key可以重新開始
+	record, err = recovered.Begin("client", "released", "fp", time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
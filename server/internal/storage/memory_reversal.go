@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+// Reverse 鎖住原交易的所有帳戶後計算已沖正金額, 同一筆原交易的沖正彼此互斥不會超額
+func (s *MemoryStorage) Reverse(transaction *model.Transaction) (*model.Reversal, error) {
+	if transaction.ReversalOf == nil {
+		return nil, model.ErrTransactionNotFound
+	}
+	original, err := s.GetTransactionByID(*transaction.ReversalOf)
+	if err != nil {
+		return nil, err
+	}
+	if err := original.CheckReversible(); err != nil {
+		return nil, err
+	}
+
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
+	ids := []uint64{original.ToAccountID}
+	if original.FromAccountID != nil {
+		ids = append(ids, *original.FromAccountID)
+	}
+	unlock := s.lockAccounts(ids...)
+	defer unlock()
+
+	s.transactionMutex.RLock()
+	refunded := s.refunded(original)
+	s.transactionMutex.RUnlock()
+
+	if err := transaction.BindReversal(original, refunded); err != nil {
+		return nil, err
+	}
+
+	debitID, creditID := transaction.ReversalAccounts()
+	s.globalMutex.RLock()
+	debit, debitExists := s.accounts[debitID]
+	credit, creditExists := s.accounts[creditID]
+	s.globalMutex.RUnlock()
+
+	if !debitExists {
+		return nil, ErrSourceAccountNotFound
+	}
+	if creditID != 0 && !creditExists {
+		return nil, ErrDestinationAccountNotFound
+	}
+	now := time.Now()
+	if err := checkReversal(s.withHolds(debit, now), credit, transaction); err != nil {
+		return nil, err
+	}
+
+	debitUpdated := *debit
+	debitUpdated.Balance = debit.Balance.Sub(transaction.Amount)
+	debitUpdated.UpdatedAt = now
+	transaction.TrackOverdraft(&debitUpdated, debit.Balance)
+	accounts := []model.Account{debitUpdated}
+	if credit != nil {
+		creditUpdated := *credit
+		creditUpdated.Balance = credit.Balance.Add(transaction.Amount)
+		creditUpdated.UpdatedAt = now
+		transaction.TrackOverdraft(&creditUpdated, credit.Balance)
+		accounts = append(accounts, creditUpdated)
+	}
+
+	if err := s.post(transaction, accounts...); err != nil {
+		return nil, err
+	}
+	return model.NewReversalResult(transaction, original, refunded.Add(transaction.Amount)), nil
+}
+
+// refunded 原交易已沖正的累計金額, 呼叫端需持有transactionMutex
+// 沖正一定會異動原交易的ToAccountID, 從該帳戶索引中原交易之後的交易找起
+func (s *MemoryStorage) refunded(original *model.Transaction) decimal.Decimal {
+	index := s.accountIndex[original.ToAccountID]
+	start := sort.Search(len(index), func(i int) bool { return index[i] > original.ID })
+
+	total := decimal.Zero
+	for _, id := range index[start:] {
+		if t := s.transactions[id]; t.ReversalOf != nil && *t.ReversalOf == original.ID {
+			total = total.Add(t.Amount)
+		}
+	}
+	return total
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+// putStandingOrder 新增或覆蓋standing order, 呼叫端需持有transactionMutex
+func (s *MemoryStorage) putStandingOrder(order model.StandingOrder) {
+	if existing, ok := s.standingOrders[order.ID]; ok {
+		*existing = order
+		return
+	}
+	s.standingOrders[order.ID] = &order
+	if order.ID > s.standingOrderID {
+		s.standingOrderID = order.ID
+	}
+}
+
+func (s *MemoryStorage) CreateStandingOrder(order *model.StandingOrder) error {
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	now := time.Now()
+	order.ID = s.standingOrderID + 1
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	if err := s.commit(walRecord{Op: walOpStandingOrder, StandingOrders: []model.StandingOrder{*order}}); err != nil {
+		order.ID = 0
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetStandingOrder(id uint64) (*model.StandingOrder, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	order, exists := s.standingOrders[id]
+	if !exists {
+		return nil, model.ErrStandingOrderNotFound
+	}
+	orderCopy := *order
+	return &orderCopy, nil
+}
+
+func (s *MemoryStorage) GetStandingOrdersByAccountID(accountID uint64) ([]*model.StandingOrder, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	var orders []*model.StandingOrder
+	for id := uint64(1); id <= s.standingOrderID; id++ {
+		if order := s.standingOrders[id]; order.FromAccountID == accountID {
+			orderCopy := *order
+			orders = append(orders, &orderCopy)
+		}
+	}
+	return orders, nil
+}
+
+func (s *MemoryStorage) UpdateStandingOrder(order *model.StandingOrder, run *model.StandingOrderRun) error {
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	if _, exists := s.standingOrders[order.ID]; !exists {
+		return model.ErrStandingOrderNotFound
+	}
+	record := walRecord{Op: walOpStandingOrder, StandingOrders: []model.StandingOrder{*order}}
+	if run != nil {
+		record.Runs = []model.StandingOrderRun{*run}
+	}
+	return s.commit(record)
+}
+
+func (s *MemoryStorage) DueStandingOrders(now time.Time) ([]*model.StandingOrder, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	var due []*model.StandingOrder
+	for _, order := range s.standingOrders {
+		if order.Due(now) {
+			orderCopy := *order
+			due = append(due, &orderCopy)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextRunAt.Equal(due[j].NextRunAt) {
+			return due[i].NextRunAt.Before(due[j].NextRunAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	return due, nil
+}
+
+func (s *MemoryStorage) GetStandingOrderRuns(orderID uint64) ([]*model.StandingOrderRun, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	if _, exists := s.standingOrders[orderID]; !exists {
+		return nil, model.ErrStandingOrderNotFound
+	}
+	runs := make([]*model.StandingOrderRun, 0, len(s.standingRuns[orderID]))
+	for _, run := range s.standingRuns[orderID] {
+		runCopy := run
+		runs = append(runs, &runCopy)
+	}
+	return runs, nil
+}
@@ -1,7 +1,7 @@
 package storage
 
 import (
-	"errors"
+	"sort"
 	"sync"
 	"time"
 
@@ -10,21 +10,57 @@ import (
 )
 
 type MemoryStorage struct {
-	accounts        map[uint64]*model.Account
-	transactions map[uint64]*model.Transaction
-	accountID       uint64
-	transactionID   uint64
-	globalMutex     sync.RWMutex // 鎖accounts map
-	accountLocks    sync.Map     // 鎖每隔帳戶, sync.map是原子性
-	transactionMutex sync.RWMutex
+	accounts         map[uint64]*model.Account
+	transactions     map[uint64]*model.Transaction
+	accountIndex     map[uint64][]uint64 // 帳戶 -> 交易ID, 依ID遞增
+	entries          []model.LedgerEntry
+	accountID        uint64
+	transactionID    uint64
+	entryID          uint64
+	holds            map[uint64]*model.Hold
+	accountHolds     map[uint64][]uint64 // 帳戶 -> hold ID, 依ID遞增
+	holdID           uint64
+	standingOrders   map[uint64]*model.StandingOrder
+	standingRuns     map[uint64][]model.StandingOrderRun // standing order ID -> 執行紀錄
+	standingOrderID  uint64
+	interestAccruals map[uint64][]model.InterestAccrual // 帳戶 -> 計息紀錄, 依日期
+	users            map[uint64]*model.User
+	usernames        map[string]uint64 // username -> user ID
+	references       map[string]uint64 // Transaction.Reference -> 交易ID
+	userID           uint64
+	idempotency      map[idempotencyKey]*model.IdempotencyRecord
+	idempotencySweep time.Time
+	globalMutex      sync.RWMutex // 鎖accounts map
+	accountLocks     sync.Map     // 鎖每隔帳戶, sync.map是原子性
+	transactionMutex sync.RWMutex // 鎖transactions + entries + holds + standing orders + 計息紀錄 + users + idempotency
+	// ledgerMutex 所有異動餘額的操作持有讀鎖(彼此不互斥), 試算時持有寫鎖取得一致的快照
+	// 鎖順序固定為 ledgerMutex -> 帳戶鎖 -> globalMutex -> transactionMutex
+	ledgerMutex sync.RWMutex
+
+	// 落地設定, 由OpenMemoryStorage開啟, nil代表純記憶體
+	dir       string
+	wal       *writeAheadLog
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		accounts:        make(map[uint64]*model.Account),
-		transactions: make(map[uint64]*model.Transaction),
-		accountID:       0,
-		transactionID:   0,
+		accounts:         make(map[uint64]*model.Account),
+		transactions:     make(map[uint64]*model.Transaction),
+		accountIndex:     make(map[uint64][]uint64),
+		holds:            make(map[uint64]*model.Hold),
+		accountHolds:     make(map[uint64][]uint64),
+		standingOrders:   make(map[uint64]*model.StandingOrder),
+		standingRuns:     make(map[uint64][]model.StandingOrderRun),
+		interestAccruals: make(map[uint64][]model.InterestAccrual),
+		users:            make(map[uint64]*model.User),
+		usernames:        make(map[string]uint64),
+		references:       make(map[string]uint64),
+		idempotency:      make(map[idempotencyKey]*model.IdempotencyRecord),
+		accountID:        0,
+		transactionID:    0,
 	}
 }
 
@@ -35,16 +71,36 @@ func (s *MemoryStorage) getAccountLock(accountID uint64) *sync.RWMutex {
 	return value.(*sync.RWMutex)
 }
 
+// CreateAccount 開戶, 初始餘額以opening deposit入帳
 func (s *MemoryStorage) CreateAccount(account *model.Account) error {
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
 	s.globalMutex.Lock()
 	defer s.globalMutex.Unlock()
 
-	s.accountID++
-	account.ID = s.accountID
-	account.CreatedAt = time.Now()
-	account.UpdatedAt = time.Now()
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
 
-	s.accounts[account.ID] = account
+	now := time.Now()
+	account.ID = s.accountID + 1
+	account.CreatedAt = now
+	account.UpdatedAt = now
+	if account.Status == "" {
+		account.Status = model.AccountStatusActive
+	}
+	account.Currency = account.CurrencyInfo().Code
+
+	record := walRecord{Op: walOpCreateAccount, Accounts: []model.Account{*account}}
+	if account.Balance.GreaterThan(decimal.Zero) {
+		opening := model.NewOpeningBalance(account.ID, account.Balance)
+		opening.Currency = account.Currency
+		record.Transaction = s.stamp(opening)
+	}
+	if err := s.commit(record); err != nil {
+		account.ID = 0
+		return err
+	}
 	return nil
 }
 
@@ -59,19 +115,24 @@ func (s *MemoryStorage) GetAccountByID(id uint64) (*model.Account, error) {
 	s.globalMutex.RUnlock()
 
 	if !exists {
-		return nil, errors.New("account not found")
+		return nil, model.ErrAccountNotFound
 	}
 
 	// Return a copy to avoid external modifications
-	accountCopy := *account
-	return &accountCopy, nil
+	return s.withHolds(account, time.Now()), nil
 }
 
-func (s *MemoryStorage) Deposit(id uint64, amount decimal.Decimal) error {
+// Deposit 存款, 餘額異動與交易紀錄在同一把帳戶寫鎖內完成
+// transaction.ToAccountID: 存入帳戶
+func (s *MemoryStorage) Deposit(transaction *model.Transaction) error {
+	id, amount := transaction.ToAccountID, transaction.Amount
 	if amount.LessThanOrEqual(decimal.Zero) {
-		return errors.New("deposit amount cannot be negative")
+		return errInvalidDeposit
 	}
 
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
 	accountLock := s.getAccountLock(id)
 	accountLock.Lock()
 	defer accountLock.Unlock()
@@ -81,19 +142,33 @@ func (s *MemoryStorage) Deposit(id uint64, amount decimal.Decimal) error {
 	s.globalMutex.RUnlock()
 
 	if !exists {
-		return errors.New("account not found")
+		return model.ErrAccountNotFound
+	}
+	if err := account.CheckCredit(); err != nil {
+		return err
+	}
+	if err := transaction.BindCurrency(account); err != nil {
+		return err
 	}
 
-	account.Balance = account.Balance.Add(amount)
-	account.UpdatedAt = time.Now()
-	return nil
+	updated := *account
+	updated.Balance = account.Balance.Add(amount)
+	updated.UpdatedAt = time.Now()
+	transaction.TrackOverdraft(&updated, account.Balance)
+	return s.post(transaction, updated)
 }
 
-func (s *MemoryStorage) Withdraw(id uint64, amount decimal.Decimal) error {
+// Withdraw 提款, 餘額異動與交易紀錄在同一把帳戶寫鎖內完成
+// transaction.ToAccountID: 提款帳戶
+func (s *MemoryStorage) Withdraw(transaction *model.Transaction) error {
+	id, amount := transaction.ToAccountID, transaction.Amount
 	if amount.LessThanOrEqual(decimal.Zero) {
-		return errors.New("withdraw amount cannot be negative")
+		return errInvalidWithdraw
 	}
 
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
 	accountLock := s.getAccountLock(id)
 	accountLock.Lock()
 	defer accountLock.Unlock()
@@ -103,27 +178,46 @@ func (s *MemoryStorage) Withdraw(id uint64, amount decimal.Decimal) error {
 	s.globalMutex.RUnlock()
 
 	if !exists {
-		return errors.New("account not found")
+		return model.ErrAccountNotFound
 	}
-
-	if account.Balance.LessThan(amount) {
-		return errors.New("insufficient balance")
+	if err := account.CheckDebit(); err != nil {
+		return err
+	}
+	if err := transaction.BindCurrency(account); err != nil {
+		return err
+	}
+	if err := checkFee(account, transaction); err != nil {
+		return err
+	}
+	if err := checkAvailable(s.withHolds(account, time.Now()), amount.Add(transaction.FeeAmount())); err != nil {
+		return err
 	}
 
-	account.Balance = account.Balance.Sub(amount)
-	account.UpdatedAt = time.Now()
-	return nil
+	updated := *account
+	updated.Balance = account.Balance.Sub(amount)
+	updated.UpdatedAt = time.Now()
+	transaction.TrackOverdraft(&updated, account.Balance)
+	chargeFee(&updated, transaction)
+	return s.post(transaction, updated)
 }
 
-func (s *MemoryStorage) Transfer(fromID, toID uint64, amount decimal.Decimal) error {
+// Transfer 轉帳, 雙方餘額與交易紀錄在兩把帳戶寫鎖內一起完成
+func (s *MemoryStorage) Transfer(transaction *model.Transaction) error {
+	if transaction.FromAccountID == nil {
+		return ErrSourceAccountNotFound
+	}
+	fromID, toID, amount := *transaction.FromAccountID, transaction.ToAccountID, transaction.Amount
 	if amount.LessThanOrEqual(decimal.Zero) {
-		return errors.New("transfer amount must be positive")
+		return errInvalidTransfer
 	}
 
 	if fromID == toID {
-		return errors.New("cannot transfer to the same account")
+		return model.ErrSameAccount
 	}
 
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
 	var firstLock, secondLock *sync.RWMutex
 	var firstID, secondID uint64
 
@@ -147,18 +241,28 @@ func (s *MemoryStorage) Transfer(fromID, toID uint64, amount decimal.Decimal) er
 	if !fromExists {
 		firstLock.RUnlock()
 		secondLock.RUnlock()
-		return errors.New("source account not found")
+		return ErrSourceAccountNotFound
 	}
 	if !toExists {
 		firstLock.RUnlock()
 		secondLock.RUnlock()
-		return errors.New("destination account not found")
+		return ErrDestinationAccountNotFound
+	}
+	if err := checkTransfer(fromAccount, toAccount, transaction); err != nil {
+		firstLock.RUnlock()
+		secondLock.RUnlock()
+		return err
+	}
+	if err := checkFee(fromAccount, transaction); err != nil {
+		firstLock.RUnlock()
+		secondLock.RUnlock()
+		return err
 	}
 
-	if fromAccount.Balance.LessThan(amount) {
+	if err := checkAvailable(s.withHolds(fromAccount, time.Now()), amount.Add(transaction.FeeAmount())); err != nil {
 		firstLock.RUnlock()
 		secondLock.RUnlock()
-		return errors.New("insufficient balance")
+		return err
 	}
 
 	// 釋放讀鎖
@@ -177,45 +281,339 @@ func (s *MemoryStorage) Transfer(fromID, toID uint64, amount decimal.Decimal) er
 	s.globalMutex.RUnlock()
 
 	if !fromExists {
-		return errors.New("source account not found")
+		return ErrSourceAccountNotFound
 	}
 	if !toExists {
-		return errors.New("destination account not found")
+		return ErrDestinationAccountNotFound
+	}
+	if err := checkTransfer(fromAccount, toAccount, transaction); err != nil {
+		return err
+	}
+	if err := checkFee(fromAccount, transaction); err != nil {
+		return err
 	}
 
-	if fromAccount.Balance.LessThan(amount) {
-		return errors.New("insufficient balance")
+	if err := checkAvailable(s.withHolds(fromAccount, time.Now()), amount.Add(transaction.FeeAmount())); err != nil {
+		return err
 	}
 
-	fromAccount.Balance = fromAccount.Balance.Sub(amount)
-	fromAccount.UpdatedAt = time.Now()
+	now := time.Now()
+	fromUpdated, toUpdated := *fromAccount, *toAccount
+	fromUpdated.Balance = fromAccount.Balance.Sub(amount)
+	fromUpdated.UpdatedAt = now
+	toUpdated.Balance = toAccount.Balance.Add(transaction.CreditAmount())
+	toUpdated.UpdatedAt = now
+	transaction.TrackOverdraft(&fromUpdated, fromAccount.Balance)
+	transaction.TrackOverdraft(&toUpdated, toAccount.Balance)
+	chargeFee(&fromUpdated, transaction)
+
+	return s.post(transaction, fromUpdated, toUpdated)
+}
 
-	toAccount.Balance = toAccount.Balance.Add(amount)
-	toAccount.UpdatedAt = time.Now()
+// lockAccounts 依帳戶ID遞增順序取得寫鎖, 重複的ID只鎖一次, 固定順序避免互相等待
+func (s *MemoryStorage) lockAccounts(ids ...uint64) (unlock func()) {
+	sorted := append([]uint64(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
 
-	return nil
+	locks := make([]*sync.RWMutex, 0, len(sorted))
+	for i, id := range sorted {
+		if i > 0 && id == sorted[i-1] {
+			continue
+		}
+		lock := s.getAccountLock(id)
+		lock.Lock()
+		locks = append(locks, lock)
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
+
+// UpdateAccountStatus 持有帳戶寫鎖, 與存提轉互斥, 結清時的餘額檢查不會過期
+func (s *MemoryStorage) UpdateAccountStatus(id uint64, status model.AccountStatus, reason string) (*model.Account, error) {
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
+	accountLock := s.getAccountLock(id)
+	accountLock.Lock()
+	defer accountLock.Unlock()
+
+	s.globalMutex.RLock()
+	account, exists := s.accounts[id]
+	s.globalMutex.RUnlock()
+
+	if !exists {
+		return nil, model.ErrAccountNotFound
+	}
+
+	updated := *account
+	if err := updated.Transition(status, reason); err != nil {
+		return nil, err
+	}
+	if err := s.updateAccount(updated); err != nil {
+		return nil, err
+	}
+	return s.withHolds(&updated, time.Now()), nil
+}
+
+// SetOverdraftLimit 持有帳戶寫鎖, 與扣款互斥
+func (s *MemoryStorage) SetOverdraftLimit(id uint64, limit decimal.Decimal) (*model.Account, error) {
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
+	accountLock := s.getAccountLock(id)
+	accountLock.Lock()
+	defer accountLock.Unlock()
+
+	s.globalMutex.RLock()
+	account, exists := s.accounts[id]
+	s.globalMutex.RUnlock()
+
+	if !exists {
+		return nil, model.ErrAccountNotFound
+	}
+
+	updated := *account
+	if err := updated.SetOverdraftLimit(limit); err != nil {
+		return nil, err
+	}
+	if err := s.updateAccount(updated); err != nil {
+		return nil, err
+	}
+	return s.withHolds(&updated, time.Now()), nil
+}
+
+// SetAccountLimits 持有帳戶寫鎖寫入等級與個別限額
+func (s *MemoryStorage) SetAccountLimits(id uint64, tier string, limits *model.Limits) (*model.Account, error) {
+	s.ledgerMutex.RLock()
+	defer s.ledgerMutex.RUnlock()
+
+	accountLock := s.getAccountLock(id)
+	accountLock.Lock()
+	defer accountLock.Unlock()
+
+	s.globalMutex.RLock()
+	account, exists := s.accounts[id]
+	s.globalMutex.RUnlock()
+
+	if !exists {
+		return nil, model.ErrAccountNotFound
+	}
+
+	updated := *account
+	if err := updated.SetLimits(tier, limits); err != nil {
+		return nil, err
+	}
+	if err := s.updateAccount(updated); err != nil {
+		return nil, err
+	}
+	return s.withHolds(&updated, time.Now()), nil
 }
 
+// GetOverdraftEvents 帳戶的透支進出事件, 依交易順序
+// 事件隨交易一起保存, 由帳戶的交易索引取出
+func (s *MemoryStorage) GetOverdraftEvents(accountID uint64) ([]model.OverdraftEvent, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	var events []model.OverdraftEvent
+	for _, id := range s.accountIndex[accountID] {
+		for _, event := range s.transactions[id].OverdraftEvents {
+			if event.AccountID == accountID {
+				events = append(events, event)
+			}
+		}
+	}
+	return events, nil
+}
+
+// updateAccount 只異動帳戶不產生交易, 呼叫端需持有帳戶寫鎖
+func (s *MemoryStorage) updateAccount(account model.Account) error {
+	s.globalMutex.RLock()
+	defer s.globalMutex.RUnlock()
+
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	return s.commit(walRecord{Op: walOpUpdateAccount, Accounts: []model.Account{account}})
+}
+
+// AddTransaction 只寫入交易紀錄, 不異動餘額也不產生分錄
 func (s *MemoryStorage) AddTransaction(transaction *model.Transaction) error {
 	s.transactionMutex.Lock()
 	defer s.transactionMutex.Unlock()
 
-	s.transactionID++
-	transaction.ID = s.transactionID
-	s.transactions[transaction.ID] = transaction
+	transaction.ID = s.transactionID + 1
+	return s.commit(walRecord{Op: walOpRecord, Transaction: transaction})
+}
+
+// post 寫入交易紀錄, 借貸分錄與異動後的帳戶
+// 由Deposit/Withdraw/Transfer在持有帳戶寫鎖時呼叫, accounts為異動後的帳戶狀態
+// 有附加手續費時, 手續費交易緊接在主交易之後, 在同一筆WAL紀錄內
+func (s *MemoryStorage) post(transaction *model.Transaction, accounts ...model.Account) error {
+	return s.postRecord(walRecord{Op: walOpPost, Accounts: accounts, Transaction: transaction})
+}
+
+// postRecord 同post, record可另外帶同時異動的狀態(e.g. 請款的hold)
+func (s *MemoryStorage) postRecord(record walRecord) error {
+	s.globalMutex.RLock()
+	defer s.globalMutex.RUnlock()
+
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	if reference := record.Transaction.Reference; reference != "" {
+		if _, exists := s.references[reference]; exists {
+			return ErrDuplicateReference
+		}
+	}
+	transaction := s.stamp(record.Transaction)
+	if fee := transaction.Fee; fee != nil {
+		fee.ID = transaction.ID + 1
+		fee.CreatedAt = transaction.CreatedAt
+		fee.StampOverdraftEvents()
+		transaction.LinkFee()
+		record.Batch = []*model.Transaction{fee}
+	}
+	return s.commit(record)
+}
+
+// stamp 分配交易ID, 以入帳時間為準與ID順序一致, 呼叫端需持有transactionMutex
+func (s *MemoryStorage) stamp(transaction *model.Transaction) *model.Transaction {
+	transaction.ID = s.transactionID + 1
+	transaction.CreatedAt = time.Now()
+	transaction.StampOverdraftEvents()
+	return transaction
+}
+
+// commit 有WAL時先寫WAL再套用到記憶體, 寫入失敗時狀態不變
+// 呼叫端需持有transactionMutex, 異動帳戶時還需持有globalMutex
+func (s *MemoryStorage) commit(record walRecord) error {
+	if s.wal != nil {
+		if err := s.wal.append(&record); err != nil {
+			if record.Transaction != nil {
+				record.Transaction.ID = 0
+			}
+			for _, transaction := range record.Batch {
+				transaction.ID = 0
+			}
+			return err
+		}
+	}
+	s.apply(record)
 	return nil
 }
 
+// apply 套用一筆異動, 線上寫入與WAL重放共用同一段邏輯
+func (s *MemoryStorage) apply(record walRecord) {
+	for _, account := range record.Accounts {
+		accountCopy := account
+		if existing, ok := s.accounts[account.ID]; ok {
+			*existing = accountCopy
+		} else {
+			s.accounts[account.ID] = &accountCopy
+		}
+		if account.ID > s.accountID {
+			s.accountID = account.ID
+		}
+	}
+	for _, hold := range record.Holds {
+		s.putHold(hold)
+	}
+	for _, order := range record.StandingOrders {
+		s.putStandingOrder(order)
+	}
+	for _, run := range record.Runs {
+		s.standingRuns[run.StandingOrderID] = append(s.standingRuns[run.StandingOrderID], run)
+	}
+	for _, accrual := range record.Accruals {
+		s.interestAccruals[accrual.AccountID] = append(s.interestAccruals[accrual.AccountID], accrual)
+	}
+	for _, user := range record.Users {
+		s.putUser(user)
+	}
+	for _, idempotency := range record.Idempotency {
+		s.putIdempotency(idempotency)
+	}
+	for _, released := range record.ReleasedKeys {
+		delete(s.idempotency, idempotencyKey{scope: released.Scope, key: released.Key})
+	}
+
+	transactions := record.Batch
+	if record.Transaction != nil {
+		transactions = append([]*model.Transaction{record.Transaction}, transactions...)
+	}
+	for _, transaction := range transactions {
+		s.appendTransaction(transaction)
+		if record.Op == walOpRecord {
+			continue
+		}
+		for _, entry := range transaction.Entries() {
+			s.entryID++
+			entry.ID = s.entryID
+			s.entries = append(s.entries, entry)
+		}
+	}
+}
+
+// appendTransaction 保存一份copy並更新帳戶索引, 呼叫端需持有transactionMutex
+func (s *MemoryStorage) appendTransaction(transaction *model.Transaction) {
+	s.transactionID = transaction.ID
+	transactionCopy := *transaction
+	// 手續費另存為一筆交易
+	transactionCopy.Fee = nil
+	s.transactions[transaction.ID] = &transactionCopy
+	if transaction.Reference != "" {
+		s.references[transaction.Reference] = transaction.ID
+	}
+
+	s.accountIndex[transaction.ToAccountID] = append(s.accountIndex[transaction.ToAccountID], transaction.ID)
+	if from := transaction.FromAccountID; from != nil && *from != transaction.ToAccountID {
+		s.accountIndex[*from] = append(s.accountIndex[*from], transaction.ID)
+	}
+}
+
+// GetAccountHistory 持有帳戶讀鎖, 餘額與交易紀錄為同一個時間點的狀態
+func (s *MemoryStorage) GetAccountHistory(accountID uint64) (*model.Account, []*model.Transaction, error) {
+	accountLock := s.getAccountLock(accountID)
+	accountLock.RLock()
+	defer accountLock.RUnlock()
+
+	s.globalMutex.RLock()
+	account, exists := s.accounts[accountID]
+	s.globalMutex.RUnlock()
+
+	if !exists {
+		return nil, nil, model.ErrAccountNotFound
+	}
+
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	transactions := make([]*model.Transaction, 0, len(s.accountIndex[accountID]))
+	for _, id := range s.accountIndex[accountID] {
+		transactionCopy := *s.transactions[id]
+		transactions = append(transactions, &transactionCopy)
+	}
+	return s.withHolds(account, time.Now()), transactions, nil
+}
+
+// GetTransactionsByAccountID
+// 持有帳戶讀鎖, 進行中的存提轉完成(餘額+紀錄)前不會讀到半套狀態
 func (s *MemoryStorage) GetTransactionsByAccountID(accountID uint64) ([]*model.Transaction, error) {
+	accountLock := s.getAccountLock(accountID)
+	accountLock.RLock()
+	defer accountLock.RUnlock()
+
 	s.transactionMutex.RLock()
 	defer s.transactionMutex.RUnlock()
 
 	var transactions []*model.Transaction
-	for _, transaction := range s.transactions {
-		if transaction.ToAccountID == accountID || (transaction.FromAccountID != nil && *transaction.FromAccountID == accountID) {
-			transactionCopy := *transaction
-			transactions = append(transactions, &transactionCopy)
-		}
+	for _, id := range s.accountIndex[accountID] {
+		transactionCopy := *s.transactions[id]
+		transactions = append(transactions, &transactionCopy)
 	}
 	return transactions, nil
 }
@@ -225,9 +623,134 @@ func (s *MemoryStorage) GetAllTransactions() ([]*model.Transaction, error) {
 	defer s.transactionMutex.RUnlock()
 
 	var transactions []*model.Transaction
-	for _, transaction := range s.transactions {
-		transactionCopy := *transaction
+	// id由1開始連續遞增
+	for id := uint64(1); id <= s.transactionID; id++ {
+		transactionCopy := *s.transactions[id]
 		transactions = append(transactions, &transactionCopy)
 	}
 	return transactions, nil
 }
+
+func (s *MemoryStorage) GetTransactionByID(id uint64) (*model.Transaction, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	transaction, exists := s.transactions[id]
+	if !exists {
+		return nil, model.ErrTransactionNotFound
+	}
+	transactionCopy := *transaction
+	return &transactionCopy, nil
+}
+
+func (s *MemoryStorage) GetTransactionByReference(reference string) (*model.Transaction, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	id, exists := s.references[reference]
+	if !exists {
+		return nil, model.ErrTransactionNotFound
+	}
+	transactionCopy := *s.transactions[id]
+	return &transactionCopy, nil
+}
+
+// QueryTransactions 在帳戶索引上二分搜尋cursor位置, 依方向往後取符合filter的limit+1筆
+func (s *MemoryStorage) QueryTransactions(query model.TransactionQuery) (*model.TransactionPage, error) {
+	query = normalizeQuery(query)
+
+	accountLock := s.getAccountLock(query.AccountID)
+	accountLock.RLock()
+	defer accountLock.RUnlock()
+
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	index := s.accountIndex[query.AccountID]
+
+	// ids: 依查詢方向排列的候選交易
+	var ids []uint64
+	if query.Direction == model.SortAsc {
+		start := sort.Search(len(index), func(i int) bool { return index[i] > query.Cursor })
+		ids = index[start:]
+	} else {
+		end := len(index)
+		if query.Cursor > 0 {
+			end = sort.Search(len(index), func(i int) bool { return index[i] >= query.Cursor })
+		}
+		ids = make([]uint64, 0, end)
+		for i := end - 1; i >= 0; i-- {
+			ids = append(ids, index[i])
+		}
+	}
+
+	var transactions []*model.Transaction
+	for _, id := range ids {
+		if len(transactions) > query.Limit {
+			break
+		}
+		transaction := s.transactions[id]
+		if !query.Filter.Matches(query.AccountID, transaction) {
+			continue
+		}
+		transactionCopy := *transaction
+		transactions = append(transactions, &transactionCopy)
+	}
+
+	return newTransactionPage(transactions, query.Limit), nil
+}
+
+func (s *MemoryStorage) GetEntriesByTransactionID(transactionID uint64) ([]model.LedgerEntry, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	var entries []model.LedgerEntry
+	for _, entry := range s.entries {
+		if entry.TransactionID == transactionID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// TrialBalance 持有ledgerMutex寫鎖, 期間沒有任何餘額異動
+func (s *MemoryStorage) TrialBalance() (*model.TrialBalance, error) {
+	s.ledgerMutex.Lock()
+	defer s.ledgerMutex.Unlock()
+
+	s.globalMutex.RLock()
+	accounts := make([]*model.Account, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accountCopy := *account
+		accounts = append(accounts, &accountCopy)
+	}
+	s.globalMutex.RUnlock()
+
+	s.transactionMutex.RLock()
+	entries := make([]model.LedgerEntry, len(s.entries))
+	copy(entries, s.entries)
+	s.transactionMutex.RUnlock()
+
+	return buildTrialBalance(entries, accounts), nil
+}
+
+// Close 純記憶體時沒有需要釋放的資源
+// 有落地時停止定期snapshot, 最後做一次snapshot再關閉WAL
+func (s *MemoryStorage) Close() error {
+	if s.wal == nil {
+		return nil
+	}
+
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if s.stopped != nil {
+			<-s.stopped
+		}
+		err = s.Snapshot()
+		if closeErr := s.wal.close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+// putUser 新增使用者並更新username索引, 呼叫端需持有transactionMutex
+func (s *MemoryStorage) putUser(user model.User) {
+	s.users[user.ID] = &user
+	s.usernames[user.Username] = user.ID
+	if user.ID > s.userID {
+		s.userID = user.ID
+	}
+}
+
+func (s *MemoryStorage) CreateUser(user *model.User) error {
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	if _, exists := s.usernames[user.Username]; exists {
+		return model.ErrUsernameTaken
+	}
+	user.ID = s.userID + 1
+	user.CreatedAt = time.Now()
+	if err := s.commit(walRecord{Op: walOpUser, Users: []model.User{*user}}); err != nil {
+		user.ID = 0
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetUserByID(id uint64) (*model.User, error) {
+	s.transactionMutex.RLock()
+	defer s.transactionMutex.RUnlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, model.ErrUserNotFound
+	}
+	userCopy := *user
+	return &userCopy, nil
+}
+
+func (s *MemoryStorage) GetUserByUsername(username string) (*model.User, error) {
+	s.transactionMutex.RLock()
+	id, exists := s.usernames[username]
+	s.transactionMutex.RUnlock()
+
+	if !exists {
+		return nil, model.ErrUserNotFound
+	}
+	return s.GetUserByID(id)
+}
+
+func (s *MemoryStorage) SetUserRole(id uint64, role model.Role) (*model.User, error) {
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, model.ErrUserNotFound
+	}
+	updated := *user
+	updated.Role = role
+	if err := s.commit(walRecord{Op: walOpUser, Users: []model.User{updated}}); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
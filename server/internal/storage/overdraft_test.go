@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverdraftLimit(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "business", Balance: decimal.NewFromInt(100), OverdraftLimit: decimal.NewFromInt(50)}
+		other := &model.Account{Name: "supplier"}
+		require.NoError(t, storage.CreateAccount(account))
+		require.NoError(t, storage.CreateAccount(other))
+		assertBalances(t, storage, account.ID, "100", "150")
+
+		// 透支到額度為止
+		assert.ErrorIs(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(151), "")), model.ErrInsufficientBalance)
+		withdraw := model.NewWithdraw(account.ID, decimal.NewFromInt(120), "trace-enter")
+		require.NoError(t, storage.Withdraw(withdraw))
+		require.Len(t, withdraw.OverdraftEvents, 1)
+		assert.Equal(t, model.OverdraftEntered, withdraw.OverdraftEvents[0].Type)
+		assert.Equal(t, withdraw.ID, withdraw.OverdraftEvents[0].TransactionID)
+
+		retrieved, err := storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(-20).Equal(retrieved.Balance), retrieved.Balance.String())
+		assert.True(t, decimal.NewFromInt(20).Equal(retrieved.OverdraftUsed()))
+		assert.True(t, decimal.NewFromInt(30).Equal(retrieved.AvailableBalance()))
+
+		// 透支中再扣款不會重複產生事件
+		transfer := model.NewTransfer(account.ID, other.ID, decimal.NewFromInt(30), "")
+		require.NoError(t, storage.Transfer(transfer))
+		assert.Empty(t, transfer.OverdraftEvents)
+		assert.ErrorIs(t, storage.Transfer(model.NewTransfer(account.ID, other.ID, decimal.RequireFromString("0.01"), "")), model.ErrInsufficientBalance)
+
+		// 轉入使餘額回到非負時離開透支
+		back := model.NewTransfer(other.ID, account.ID, decimal.NewFromInt(30), "")
+		require.NoError(t, storage.Transfer(back))
+		assert.Empty(t, back.OverdraftEvents)
+		deposit := model.NewDeposit(account.ID, decimal.NewFromInt(20), "trace-exit")
+		require.NoError(t, storage.Deposit(deposit))
+		require.Len(t, deposit.OverdraftEvents, 1)
+		assert.Equal(t, model.OverdraftExited, deposit.OverdraftEvents[0].Type)
+
+		events, err := storage.GetOverdraftEvents(account.ID)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, model.OverdraftEntered, events[0].Type)
+		assert.Equal(t, withdraw.ID, events[0].TransactionID)
+		assert.True(t, decimal.NewFromInt(-20).Equal(events[0].Balance))
+		assert.True(t, decimal.NewFromInt(50).Equal(events[0].OverdraftLimit))
+		assert.Equal(t, "trace-enter", events[0].TraceID)
+		assert.Equal(t, model.OverdraftExited, events[1].Type)
+		assert.Equal(t, deposit.ID, events[1].TransactionID)
+		assert.True(t, decimal.Zero.Equal(events[1].Balance))
+
+		events, err = storage.GetOverdraftEvents(other.ID)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+	})
+}
+
+func TestSetOverdraftLimit(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "business", Currency: "JPY"}
+		require.NoError(t, storage.CreateAccount(account))
+		assert.ErrorIs(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(1), "")), model.ErrInsufficientBalance)
+
+		updated, err := storage.SetOverdraftLimit(account.ID, decimal.NewFromInt(1000))
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(1000).Equal(updated.OverdraftLimit))
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(800), "")))
+
+		// 調降到低於已動用金額, 可用餘額為負, 不能再扣款
+		updated, err = storage.SetOverdraftLimit(account.ID, decimal.NewFromInt(500))
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(-300).Equal(updated.AvailableBalance()))
+		assert.ErrorIs(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(1), "")), model.ErrInsufficientBalance)
+
+		retrieved, err := storage.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(500).Equal(retrieved.OverdraftLimit))
+
+		_, err = storage.SetOverdraftLimit(account.ID, decimal.NewFromInt(-1))
+		assert.ErrorIs(t, err, model.ErrInvalidAmount)
+		_, err = storage.SetOverdraftLimit(account.ID, decimal.RequireFromString("0.5"))
+		assert.ErrorIs(t, err, model.ErrInvalidAmount)
+		_, err = storage.SetOverdraftLimit(999, decimal.NewFromInt(1))
+		assert.ErrorIs(t, err, model.ErrAccountNotFound)
+
+		// 透支中不能結清
+		_, err = storage.UpdateAccountStatus(account.ID, model.AccountStatusClosed, "close")
+		assert.ErrorIs(t, err, model.ErrBalanceNotZero)
+	})
+}
+
+func TestOverdraftHoldCapture(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "card", Balance: decimal.NewFromInt(10), OverdraftLimit: decimal.NewFromInt(100)}
+		require.NoError(t, storage.CreateAccount(account))
+
+		hold := newTestHold(account.ID, "60")
+		require.NoError(t, storage.CreateHold(hold))
+		assertBalances(t, storage, account.ID, "10", "50")
+
+		capture := model.NewCapture(hold, decimal.NewFromInt(60), "")
+		_, err := storage.CaptureHold(capture)
+		require.NoError(t, err)
+		require.Len(t, capture.OverdraftEvents, 1)
+		assert.Equal(t, model.OverdraftEntered, capture.OverdraftEvents[0].Type)
+		assertBalances(t, storage, account.ID, "-50", "50")
+	})
+}
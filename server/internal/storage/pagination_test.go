@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 建立帳戶並產生 opening + 9筆存款 共10筆交易, 另一個帳戶的交易穿插其中
+func seedTransactions(t *testing.T, storage Storage) (*model.Account, []uint64) {
+	account := &model.Account{Name: "paged", Balance: decimal.NewFromInt(1)}
+	other := &model.Account{Name: "other", Balance: decimal.Zero}
+	require.NoError(t, storage.CreateAccount(account))
+	require.NoError(t, storage.CreateAccount(other))
+
+	for i := 0; i < 9; i++ {
+		require.NoError(t, storage.Deposit(model.NewDeposit(account.ID, decimal.NewFromInt(int64(i+1)), "")))
+		require.NoError(t, storage.Deposit(model.NewDeposit(other.ID, decimal.NewFromInt(1), "")))
+	}
+
+	transactions, err := storage.GetTransactionsByAccountID(account.ID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 10)
+
+	ids := make([]uint64, len(transactions))
+	for i, transaction := range transactions {
+		ids[i] = transaction.ID
+		if i > 0 {
+			require.Greater(t, ids[i], ids[i-1], "transactions should be ordered by id")
+			require.False(t, transaction.CreatedAt.Before(transactions[i-1].CreatedAt), "transactions should be ordered by time")
+		}
+	}
+	return account, ids
+}
+
+// 逐頁讀完, 回傳讀到的交易ID
+func readAllPages(t *testing.T, storage Storage, query model.TransactionQuery) ([]uint64, int) {
+	var ids []uint64
+	pages := 0
+	for {
+		page, err := storage.QueryTransactions(query)
+		require.NoError(t, err)
+		pages++
+		for _, transaction := range page.Transactions {
+			ids = append(ids, transaction.ID)
+		}
+		if page.NextCursor == "" {
+			return ids, pages
+		}
+
+		query.Cursor, err = model.DecodeCursor(page.NextCursor)
+		require.NoError(t, err)
+	}
+}
+
+func TestQueryTransactionsAscending(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account, expected := seedTransactions(t, storage)
+
+		ids, pages := readAllPages(t, storage, model.TransactionQuery{
+			AccountID: account.ID,
+			Limit:     3,
+			Direction: model.SortAsc,
+		})
+		assert.Equal(t, expected, ids)
+		assert.Equal(t, 4, pages)
+	})
+}
+
+func TestQueryTransactionsDescending(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account, ascending := seedTransactions(t, storage)
+
+		expected := make([]uint64, len(ascending))
+		for i, id := range ascending {
+			expected[len(ascending)-1-i] = id
+		}
+
+		ids, pages := readAllPages(t, storage, model.TransactionQuery{
+			AccountID: account.ID,
+			Limit:     5,
+			Direction: model.SortDesc,
+		})
+		assert.Equal(t, expected, ids)
+		// 剛好整除時最後一頁不會回傳next_cursor
+		assert.Equal(t, 2, pages)
+	})
+}
+
+func TestQueryTransactionsDefaults(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account, ids := seedTransactions(t, storage)
+
+		// 預設desc, 預設limit
+		page, err := storage.QueryTransactions(model.TransactionQuery{AccountID: account.ID})
+		require.NoError(t, err)
+		require.Len(t, page.Transactions, len(ids))
+		assert.Equal(t, ids[len(ids)-1], page.Transactions[0].ID)
+		assert.Empty(t, page.NextCursor)
+
+		// 沒有交易的帳戶回傳空陣列
+		page, err = storage.QueryTransactions(model.TransactionQuery{AccountID: 999})
+		require.NoError(t, err)
+		assert.NotNil(t, page.Transactions)
+		assert.Empty(t, page.Transactions)
+	})
+}
+
+func TestCursorEncoding(t *testing.T) {
+	id, err := model.DecodeCursor(model.EncodeCursor(42))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), id)
+
+	id, err = model.DecodeCursor("")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), id)
+
+	_, err = model.DecodeCursor("not a cursor!")
+	assert.Error(t, err)
+}
+
+func TestQueryTransactionsFilter(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		alice := &model.Account{Name: "alice", Balance: decimal.NewFromInt(100)}
+		bob := &model.Account{Name: "bob", Balance: decimal.Zero}
+		carol := &model.Account{Name: "carol", Balance: decimal.Zero}
+		require.NoError(t, storage.CreateAccount(alice))
+		require.NoError(t, storage.CreateAccount(bob))
+		require.NoError(t, storage.CreateAccount(carol))
+
+		deposit := model.NewDeposit(alice.ID, decimal.RequireFromString("20.50"), "trace-deposit")
+		require.NoError(t, storage.Deposit(deposit))
+		withdraw := model.NewWithdraw(alice.ID, decimal.NewFromInt(5), "trace-withdraw")
+		require.NoError(t, storage.Withdraw(withdraw))
+		toBob := model.NewTransfer(alice.ID, bob.ID, decimal.NewFromInt(10), "trace-bob")
+		require.NoError(t, storage.Transfer(toBob))
+		fromBob := model.NewTransfer(bob.ID, alice.ID, decimal.NewFromInt(3), "trace-bob")
+		require.NoError(t, storage.Transfer(fromBob))
+		toCarol := model.NewTransfer(alice.ID, carol.ID, decimal.NewFromInt(30), "trace-carol")
+		require.NoError(t, storage.Transfer(toCarol))
+
+		query := func(filter model.TransactionFilter) []uint64 {
+			ids, _ := readAllPages(t, storage, model.TransactionQuery{
+				AccountID: alice.ID,
+				Limit:     1,
+				Direction: model.SortAsc,
+				Filter:    filter,
+			})
+			return ids
+		}
+
+		ten := decimal.NewFromInt(10)
+		twentyHalf := decimal.RequireFromString("20.5")
+
+		assert.Equal(t, []uint64{toBob.ID, fromBob.ID, toCarol.ID},
+			query(model.TransactionFilter{Type: model.TransactionTypeTransfer}))
+		assert.Equal(t, []uint64{toBob.ID, fromBob.ID},
+			query(model.TransactionFilter{CounterpartyID: bob.ID}))
+		assert.Equal(t, []uint64{toBob.ID, fromBob.ID},
+			query(model.TransactionFilter{TraceID: "trace-bob"}))
+		// 金額邊界包含, 字串精度不同也要相等
+		assert.Equal(t, []uint64{deposit.ID, toBob.ID},
+			query(model.TransactionFilter{MinAmount: &ten, MaxAmount: &twentyHalf}))
+		// From包含, To不包含
+		assert.Equal(t, []uint64{withdraw.ID, toBob.ID},
+			query(model.TransactionFilter{From: withdraw.CreatedAt, To: fromBob.CreatedAt}))
+		assert.Equal(t, []uint64{toCarol.ID},
+			query(model.TransactionFilter{Type: model.TransactionTypeTransfer, MinAmount: &twentyHalf}))
+		assert.Empty(t, query(model.TransactionFilter{TraceID: "unknown"}))
+
+		// 對手方是相對於查詢帳戶判斷
+		ids, _ := readAllPages(t, storage, model.TransactionQuery{
+			AccountID: bob.ID,
+			Filter:    model.TransactionFilter{CounterpartyID: alice.ID},
+		})
+		assert.Equal(t, []uint64{fromBob.ID, toBob.ID}, ids)
+	})
+}
+
+// TestQueryTransactionsAmountBoundary 金額條件以decimal比較, 各實作在邊界與超過float精度的金額結果一致
+func TestQueryTransactionsAmountBoundary(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "boundary", Balance: decimal.Zero}
+		require.NoError(t, storage.CreateAccount(account))
+		small := model.NewDeposit(account.ID, decimal.RequireFromString("100.10"), "")
+		require.NoError(t, storage.Deposit(small))
+		next := model.NewDeposit(account.ID, decimal.RequireFromString("100.11"), "")
+		require.NoError(t, storage.Deposit(next))
+		// 2^53+1, 轉成float會變成2^53
+		large := model.NewDeposit(account.ID, decimal.RequireFromString("9007199254740993"), "")
+		require.NoError(t, storage.Deposit(large))
+
+		query := func(min, max string) []uint64 {
+			filter := model.TransactionFilter{}
+			if min != "" {
+				amount := decimal.RequireFromString(min)
+				filter.MinAmount = &amount
+			}
+			if max != "" {
+				amount := decimal.RequireFromString(max)
+				filter.MaxAmount = &amount
+			}
+			ids, _ := readAllPages(t, storage, model.TransactionQuery{AccountID: account.ID, Limit: 1, Direction: model.SortAsc, Filter: filter})
+			return ids
+		}
+
+		assert.Equal(t, []uint64{small.ID}, query("100.1", "100.10"))
+		assert.Equal(t, []uint64{next.ID, large.ID}, query("100.1000000000000000001", ""))
+		assert.Equal(t, []uint64{small.ID, next.ID}, query("", "9007199254740992"))
+		assert.Equal(t, []uint64{large.ID}, query("9007199254740993", "9007199254740993"))
+		assert.Empty(t, query("9007199254740993.001", ""))
+	})
+}
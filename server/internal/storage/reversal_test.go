@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseTransfer(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		from := &model.Account{Name: "payer", Balance: decimal.NewFromInt(100)}
+		to := &model.Account{Name: "payee"}
+		require.NoError(t, storage.CreateAccount(from))
+		require.NoError(t, storage.CreateAccount(to))
+
+		transfer := model.NewTransfer(from.ID, to.ID, decimal.NewFromInt(60), "trace-transfer")
+		require.NoError(t, storage.Transfer(transfer))
+
+		// 部分退款
+		partial := model.NewReversal(transfer.ID, decimal.NewFromInt(25), "", "trace-refund")
+		result, err := storage.Reverse(partial)
+		require.NoError(t, err)
+		assert.NotZero(t, partial.ID)
+		assert.Equal(t, model.TransactionTypeReversal, partial.Type)
+		assert.Equal(t, to.ID, *partial.FromAccountID)
+		assert.Equal(t, from.ID, partial.ToAccountID)
+		assert.Equal(t, transfer.ID, *partial.ReversalOf)
+		assert.Equal(t, "TWD", partial.Currency)
+		assert.True(t, decimal.NewFromInt(25).Equal(result.Refunded))
+		assert.True(t, decimal.NewFromInt(35).Equal(result.Refundable))
+		assert.Equal(t, transfer.ID, result.Original.ID)
+		assertBalances(t, storage, from.ID, "65", "65")
+		assertBalances(t, storage, to.ID, "35", "35")
+
+		// 累計超過原交易金額
+		_, err = storage.Reverse(model.NewReversal(transfer.ID, decimal.NewFromInt(36), "", ""))
+		assert.ErrorIs(t, err, model.ErrInvalidAmount)
+
+		// 不帶金額沖正剩餘全額
+		rest := model.NewReversal(transfer.ID, decimal.Zero, "customer dispute", "")
+		result, err = storage.Reverse(rest)
+		require.NoError(t, err)
+		assert.True(t, decimal.NewFromInt(35).Equal(rest.Amount))
+		assert.Equal(t, "customer dispute", rest.Description)
+		assert.True(t, result.Refundable.IsZero())
+		assertBalances(t, storage, from.ID, "100", "100")
+		assertBalances(t, storage, to.ID, "0", "0")
+
+		// 已全額沖正
+		_, err = storage.Reverse(model.NewReversal(transfer.ID, decimal.Zero, "", ""))
+		assert.ErrorIs(t, err, model.ErrAlreadyReversed)
+
+		entries, err := storage.GetEntriesByTransactionID(partial.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, model.CustomerLedgerAccount(to.ID), entries[0].Account)
+		assert.Equal(t, model.EntryDebit, entries[0].Side)
+		assert.Equal(t, model.CustomerLedgerAccount(from.ID), entries[1].Account)
+		assert.Equal(t, model.EntryCredit, entries[1].Side)
+
+		stored, err := storage.GetTransactionByID(rest.ID)
+		require.NoError(t, err)
+		assert.Equal(t, transfer.ID, *stored.ReversalOf)
+
+		trial, err := storage.TrialBalance()
+		require.NoError(t, err)
+		assert.True(t, trial.Balanced)
+		assert.Empty(t, trial.Mismatches)
+	})
+}
+
+func TestReverseDeposit(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "customer"}
+		require.NoError(t, storage.CreateAccount(account))
+		deposit := model.NewDeposit(account.ID, decimal.NewFromInt(80), "")
+		require.NoError(t, storage.Deposit(deposit))
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(50), "")))
+
+		// 存入的款項已被提走, 不足以退回
+		_, err := storage.Reverse(model.NewReversal(deposit.ID, decimal.Zero, "", ""))
+		assert.ErrorIs(t, err, model.ErrInsufficientBalance)
+		assertBalances(t, storage, account.ID, "30", "30")
+
+		reversal := model.NewReversal(deposit.ID, decimal.NewFromInt(30), "", "")
+		_, err = storage.Reverse(reversal)
+		require.NoError(t, err)
+		assert.Nil(t, reversal.FromAccountID)
+		assert.Equal(t, account.ID, reversal.ToAccountID)
+		assertBalances(t, storage, account.ID, "0", "0")
+
+		entries, err := storage.GetEntriesByTransactionID(reversal.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, model.CustomerLedgerAccount(account.ID), entries[0].Account)
+		assert.Equal(t, model.EntryDebit, entries[0].Side)
+		assert.Equal(t, model.SystemAccountCashIn, entries[1].Account)
+
+		page, err := storage.QueryTransactions(model.TransactionQuery{AccountID: account.ID, Filter: model.TransactionFilter{Type: model.TransactionTypeReversal}})
+		require.NoError(t, err)
+		require.Len(t, page.Transactions, 1)
+		assert.Equal(t, reversal.ID, page.Transactions[0].ID)
+	})
+}
+
+func TestReverseRejected(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "customer", Balance: decimal.NewFromInt(100)}
+		other := &model.Account{Name: "other"}
+		require.NoError(t, storage.CreateAccount(account))
+		require.NoError(t, storage.CreateAccount(other))
+
+		withdraw := model.NewWithdraw(account.ID, decimal.NewFromInt(10), "")
+		require.NoError(t, storage.Withdraw(withdraw))
+		_, err := storage.Reverse(model.NewReversal(withdraw.ID, decimal.Zero, "", ""))
+		assert.ErrorIs(t, err, model.ErrInvalidRequest)
+
+		_, err = storage.Reverse(model.NewReversal(9999, decimal.Zero, "", ""))
+		assert.ErrorIs(t, err, model.ErrTransactionNotFound)
+
+		// 沖正交易本身不能再沖正
+		transfer := model.NewTransfer(account.ID, other.ID, decimal.NewFromInt(20), "")
+		require.NoError(t, storage.Transfer(transfer))
+		reversal := model.NewReversal(transfer.ID, decimal.NewFromInt(5), "", "")
+		_, err = storage.Reverse(reversal)
+		require.NoError(t, err)
+		_, err = storage.Reverse(model.NewReversal(reversal.ID, decimal.Zero, "", ""))
+		assert.ErrorIs(t, err, model.ErrInvalidRequest)
+
+		// 精度不符
+		_, err = storage.Reverse(model.NewReversal(transfer.ID, decimal.RequireFromString("0.001"), "", ""))
+		assert.ErrorIs(t, err, model.ErrInvalidAmount)
+
+		// 原轉出帳戶已結清, 款項無法退回
+		_, err = storage.Reverse(model.NewReversal(transfer.ID, decimal.Zero, "", ""))
+		require.NoError(t, err)
+		transfer = model.NewTransfer(account.ID, other.ID, decimal.NewFromInt(20), "")
+		require.NoError(t, storage.Transfer(transfer))
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(70), "")))
+		_, err = storage.UpdateAccountStatus(account.ID, model.AccountStatusClosed, "customer request")
+		require.NoError(t, err)
+		_, err = storage.Reverse(model.NewReversal(transfer.ID, decimal.Zero, "", ""))
+		assert.ErrorIs(t, err, model.ErrAccountClosed)
+		assertBalances(t, storage, other.ID, "20", "20")
+	})
+}
+
+func TestReverseConcurrent(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		from := &model.Account{Name: "payer", Balance: decimal.NewFromInt(100)}
+		to := &model.Account{Name: "payee"}
+		require.NoError(t, storage.CreateAccount(from))
+		require.NoError(t, storage.CreateAccount(to))
+		transfer := model.NewTransfer(from.ID, to.ID, decimal.NewFromInt(50), "")
+		require.NoError(t, storage.Transfer(transfer))
+
+		// 20筆各退10, 只有5筆能成功
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := storage.Reverse(model.NewReversal(transfer.ID, decimal.NewFromInt(10), "", "")); err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 5, succeeded)
+		assertBalances(t, storage, from.ID, "100", "100")
+		assertBalances(t, storage, to.ID, "0", "0")
+	})
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+// TransferBatch 所有轉帳在同一個db transaction內依序入帳, 任一筆失敗整批rollback
+func (s *SQLiteStorage) TransferBatch(transactions []*model.Transaction) error {
+	for i, transaction := range transactions {
+		if err := checkBatchTransfer(transaction); err != nil {
+			return model.NewBatchError(i, err)
+		}
+	}
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	err := s.withTx(func(tx *sql.Tx) error {
+		for i, transaction := range transactions {
+			if err := transfer(tx, transaction); err != nil {
+				return model.NewBatchError(i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// rollback後已回填的交易ID無效
+		for _, transaction := range withFees(transactions) {
+			transaction.ID = 0
+		}
+	}
+	return err
+}
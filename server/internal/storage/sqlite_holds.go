@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+const holdColumns = `id, account_id, amount, captured, currency, status, description, expires_at, created_at, updated_at, trace_id`
+
+func scanHold(row rowScanner) (*model.Hold, error) {
+	var (
+		hold                            model.Hold
+		amount, captured, status        string
+		expiresAt, createdAt, updatedAt int64
+	)
+	if err := row.Scan(&hold.ID, &hold.AccountID, &amount, &captured, &hold.Currency, &status, &hold.Description,
+		&expiresAt, &createdAt, &updatedAt, &hold.TraceID); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if hold.Amount, err = decimal.NewFromString(amount); err != nil {
+		return nil, err
+	}
+	if hold.Captured, err = decimal.NewFromString(captured); err != nil {
+		return nil, err
+	}
+	hold.Status = model.HoldStatus(status)
+	hold.ExpiresAt = time.Unix(0, expiresAt)
+	hold.CreatedAt = time.Unix(0, createdAt)
+	hold.UpdatedAt = time.Unix(0, updatedAt)
+	return &hold, nil
+}
+
+func scanHolds(rows *sql.Rows) ([]*model.Hold, error) {
+	defer rows.Close()
+
+	var holds []*model.Hold
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// heldAmount now時有效預授權的剩餘圈存合計, 金額為decimal字串不在sql內加總
+func heldAmount(q querier, accountID uint64, now time.Time) (decimal.Decimal, error) {
+	rows, err := q.Query(`SELECT `+holdColumns+` FROM holds WHERE account_id = ? AND status = ? AND expires_at > ?`,
+		accountID, string(model.HoldStatusActive), now.UnixNano())
+	if err != nil {
+		return decimal.Zero, err
+	}
+	holds, err := scanHolds(rows)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	held := decimal.Zero
+	for _, hold := range holds {
+		held = held.Add(hold.HeldAt(now))
+	}
+	return held, nil
+}
+
+func getHold(q querier, id uint64) (*model.Hold, error) {
+	hold, err := scanHold(q.QueryRow(`SELECT `+holdColumns+` FROM holds WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, model.ErrHoldNotFound
+	}
+	return hold, err
+}
+
+// updateHold 寫入請款金額與狀態
+func updateHold(tx *sql.Tx, hold *model.Hold) error {
+	_, err := tx.Exec(`UPDATE holds SET captured = ?, status = ?, updated_at = ? WHERE id = ?`,
+		hold.Captured.String(), string(hold.Status), hold.UpdatedAt.UnixNano(), hold.ID)
+	return err
+}
+
+// CreateHold 在同一個db transaction內檢查可用餘額並寫入hold
+func (s *SQLiteStorage) CreateHold(hold *model.Hold) error {
+	if !hold.Amount.IsPositive() {
+		return errInvalidHold
+	}
+
+	return s.withTx(func(tx *sql.Tx) error {
+		account, err := getAccount(tx, hold.AccountID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkHold(account, hold); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		hold.Captured = decimal.Zero
+		hold.Status = model.HoldStatusActive
+		hold.CreatedAt = now
+		hold.UpdatedAt = now
+		result, err := tx.Exec(`INSERT INTO holds (account_id, amount, captured, currency, status, description, expires_at, created_at, updated_at, trace_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			hold.AccountID, hold.Amount.String(), hold.Captured.String(), hold.Currency, string(hold.Status), hold.Description,
+			hold.ExpiresAt.UnixNano(), now.UnixNano(), now.UnixNano(), hold.TraceID)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		hold.ID = uint64(id)
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) GetHold(id uint64) (*model.Hold, error) {
+	return getHold(s.db, id)
+}
+
+func (s *SQLiteStorage) GetHoldsByAccountID(accountID uint64) ([]*model.Hold, error) {
+	rows, err := s.db.Query(`SELECT `+holdColumns+` FROM holds WHERE account_id = ? ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanHolds(rows)
+}
+
+// CaptureHold hold, 餘額, 提款交易與附加的手續費在同一個db transaction內寫入
+func (s *SQLiteStorage) CaptureHold(transaction *model.Transaction) (*model.Hold, error) {
+	if transaction.HoldID == nil {
+		return nil, model.ErrHoldNotFound
+	}
+
+	var hold *model.Hold
+	err := s.withTx(func(tx *sql.Tx) error {
+		var err error
+		if hold, err = getHold(tx, *transaction.HoldID); err != nil {
+			return err
+		}
+		account, err := getAccount(tx, hold.AccountID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkCapture(account, hold, transaction, time.Now()); err != nil {
+			return err
+		}
+
+		if err := updateHold(tx, hold); err != nil {
+			return err
+		}
+		before := account.Balance
+		account.Balance = account.Balance.Sub(transaction.Amount)
+		transaction.TrackOverdraft(account, before)
+		chargeFee(account, transaction)
+		if err := updateBalance(tx, account); err != nil {
+			return err
+		}
+		return postWithFee(tx, transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+func (s *SQLiteStorage) ReleaseHold(id uint64) (*model.Hold, error) {
+	var hold *model.Hold
+	err := s.withTx(func(tx *sql.Tx) error {
+		var err error
+		if hold, err = getHold(tx, id); err != nil {
+			return err
+		}
+		if err := hold.Release(time.Now()); err != nil {
+			return err
+		}
+		return updateHold(tx, hold)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ExpireHolds 將now時已過期的active hold標記為expired
+func (s *SQLiteStorage) ExpireHolds(now time.Time) ([]*model.Hold, error) {
+	var expired []*model.Hold
+	err := s.withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT `+holdColumns+` FROM holds WHERE status = ? AND expires_at <= ? ORDER BY id`,
+			string(model.HoldStatusActive), now.UnixNano())
+		if err != nil {
+			return err
+		}
+		if expired, err = scanHolds(rows); err != nil {
+			return err
+		}
+
+		for _, hold := range expired {
+			hold.Status = model.HoldStatusExpired
+			hold.UpdatedAt = now
+			if err := updateHold(tx, hold); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+func (s *SQLiteStorage) SetAccountProduct(id uint64, product string) (*model.Account, error) {
+	var account *model.Account
+	err := s.withTx(func(tx *sql.Tx) error {
+		var err error
+		account, err = getAccount(tx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := account.SetProduct(product, time.Now()); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE accounts SET product = ?, accrued_through = ?, updated_at = ? WHERE id = ?`,
+			account.Product, optionalUnixNano(account.AccruedThrough), account.UpdatedAt.UnixNano(), account.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *SQLiteStorage) GetInterestBearingAccounts() ([]*model.Account, error) {
+	rows, err := s.db.Query(`SELECT id FROM accounts WHERE product <> '' ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	accounts := make([]*model.Account, 0, len(ids))
+	for _, id := range ids {
+		account, err := s.GetAccountByID(id)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// AccrueInterest 帳戶、交易與計息紀錄在同一個db transaction內讀寫
+func (s *SQLiteStorage) AccrueInterest(accountID uint64, product model.Product, through time.Time) ([]model.InterestAccrual, error) {
+	var accruals []model.InterestAccrual
+	err := s.withTx(func(tx *sql.Tx) error {
+		account, err := getAccount(tx, accountID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if account.AccruedThrough.IsZero() {
+			return nil
+		}
+
+		rows, err := tx.Query(`SELECT `+transactionColumns+` FROM account_transactions a
+			JOIN transactions t ON t.id = a.transaction_id
+			WHERE a.account_id = ? AND t.created_at >= ? ORDER BY a.transaction_id`,
+			accountID, account.AccruedThrough.AddDate(0, 0, 1).UnixNano())
+		if err != nil {
+			return err
+		}
+		history, err := scanTransactions(rows)
+		if err != nil {
+			return err
+		}
+
+		var postings []*model.Transaction
+		accruals, postings = account.AccrueInterest(product, through, history)
+		if len(accruals) == 0 {
+			return nil
+		}
+
+		for _, posting := range postings {
+			if err := postTransaction(tx, posting); err != nil {
+				return err
+			}
+		}
+		model.BindInterestPostings(accruals, postings)
+
+		now := time.Now()
+		account.UpdatedAt = now
+		_, err = tx.Exec(`UPDATE accounts SET balance = ?, accrued_interest = ?, accrued_through = ?, updated_at = ? WHERE id = ?`,
+			account.Balance.String(), account.AccruedInterest.String(), optionalUnixNano(account.AccruedThrough),
+			now.UnixNano(), account.ID)
+		if err != nil {
+			return err
+		}
+
+		for i := range accruals {
+			accrual := &accruals[i]
+			accrual.CreatedAt = now
+			var transactionID sql.NullInt64
+			if accrual.TransactionID != nil {
+				transactionID = sql.NullInt64{Int64: int64(*accrual.TransactionID), Valid: true}
+			}
+			_, err := tx.Exec(`INSERT INTO interest_accruals (account_id, date, balance, product, rate, day_count, days, amount,
+					accrued, posted, transaction_id, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				accrual.AccountID, accrual.Date.UnixNano(), accrual.Balance.String(), accrual.Product, accrual.Rate.String(),
+				string(accrual.DayCount), accrual.Days, accrual.Amount.String(), accrual.Accrued.String(), accrual.Posted.String(),
+				transactionID, now.UnixNano())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return accruals, nil
+}
+
+func (s *SQLiteStorage) GetInterestAccruals(accountID uint64) ([]model.InterestAccrual, error) {
+	if _, err := s.GetAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT account_id, date, balance, product, rate, day_count, days, amount, accrued, posted,
+		transaction_id, created_at
+		FROM interest_accruals WHERE account_id = ? ORDER BY date`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accruals := []model.InterestAccrual{}
+	for rows.Next() {
+		var (
+			accrual                                model.InterestAccrual
+			balance, rate, amount, accrued, posted string
+			dayCount                               string
+			transactionID                          sql.NullInt64
+			date, createdAt                        int64
+		)
+		if err := rows.Scan(&accrual.AccountID, &date, &balance, &accrual.Product, &rate, &dayCount, &accrual.Days,
+			&amount, &accrued, &posted, &transactionID, &createdAt); err != nil {
+			return nil, err
+		}
+		for _, field := range []struct {
+			value string
+			dest  *decimal.Decimal
+		}{
+			{balance, &accrual.Balance},
+			{rate, &accrual.Rate},
+			{amount, &accrual.Amount},
+			{accrued, &accrual.Accrued},
+			{posted, &accrual.Posted},
+		} {
+			if *field.dest, err = decimal.NewFromString(field.value); err != nil {
+				return nil, err
+			}
+		}
+		accrual.DayCount = model.DayCount(dayCount)
+		accrual.Date = time.Unix(0, date)
+		accrual.CreatedAt = time.Unix(0, createdAt)
+		if transactionID.Valid {
+			id := uint64(transactionID.Int64)
+			accrual.TransactionID = &id
+		}
+		accruals = append(accruals, accrual)
+	}
+	return accruals, rows.Err()
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+func (s *SQLiteStorage) GetTransactionByID(id uint64) (*model.Transaction, error) {
+	return getTransaction(s.db, id)
+}
+
+func (s *SQLiteStorage) GetTransactionByReference(reference string) (*model.Transaction, error) {
+	rows, err := s.db.Query(`SELECT `+transactionColumns+` FROM transactions t WHERE t.reference = ?`, reference)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := scanTransactions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(transactions) == 0 {
+		return nil, model.ErrTransactionNotFound
+	}
+	return transactions[0], nil
+}
+
+// getTransaction 不存在回傳model.ErrTransactionNotFound
+func getTransaction(q querier, id uint64) (*model.Transaction, error) {
+	rows, err := q.Query(`SELECT `+transactionColumns+` FROM transactions t WHERE t.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := scanTransactions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(transactions) == 0 {
+		return nil, model.ErrTransactionNotFound
+	}
+	return transactions[0], nil
+}
+
+// Reverse 讀取原交易, 已沖正金額與帳戶餘額在同一個db transaction內, 由sqlite序列化
+func (s *SQLiteStorage) Reverse(transaction *model.Transaction) (*model.Reversal, error) {
+	if transaction.ReversalOf == nil {
+		return nil, model.ErrTransactionNotFound
+	}
+
+	var result *model.Reversal
+	err := s.withTx(func(tx *sql.Tx) error {
+		original, err := getTransaction(tx, *transaction.ReversalOf)
+		if err != nil {
+			return err
+		}
+		refunded, err := refundedAmount(tx, original.ID)
+		if err != nil {
+			return err
+		}
+		if err := transaction.BindReversal(original, refunded); err != nil {
+			return err
+		}
+
+		debitID, creditID := transaction.ReversalAccounts()
+		debit, err := getAccount(tx, debitID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSourceAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var credit *model.Account
+		if creditID != 0 {
+			credit, err = getAccount(tx, creditID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrDestinationAccountNotFound
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := checkReversal(debit, credit, transaction); err != nil {
+			return err
+		}
+
+		debitBefore := debit.Balance
+		debit.Balance = debit.Balance.Sub(transaction.Amount)
+		transaction.TrackOverdraft(debit, debitBefore)
+		if err := updateBalance(tx, debit); err != nil {
+			return err
+		}
+		if credit != nil {
+			creditBefore := credit.Balance
+			credit.Balance = credit.Balance.Add(transaction.Amount)
+			transaction.TrackOverdraft(credit, creditBefore)
+			if err := updateBalance(tx, credit); err != nil {
+				return err
+			}
+		}
+		if err := postTransaction(tx, transaction); err != nil {
+			return err
+		}
+		result = model.NewReversalResult(transaction, original, refunded.Add(transaction.Amount))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// refundedAmount 原交易已沖正的累計金額
+func refundedAmount(tx *sql.Tx, originalID uint64) (decimal.Decimal, error) {
+	rows, err := tx.Query(`SELECT amount FROM transactions WHERE reversal_of = ?`, originalID)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	defer rows.Close()
+
+	total := decimal.Zero
+	for rows.Next() {
+		var amount string
+		if err := rows.Scan(&amount); err != nil {
+			return decimal.Zero, err
+		}
+		value, err := decimal.NewFromString(amount)
+		if err != nil {
+			return decimal.Zero, err
+		}
+		total = total.Add(value)
+	}
+	return total, rows.Err()
+}
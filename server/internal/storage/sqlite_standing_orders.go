@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+const standingOrderColumns = `id, from_account_id, to_account_id, amount, currency, description, frequency, day_of_month,
+	max_retries, retry_interval, status, start_at, end_at, due_at, next_run_at, attempts, executions, last_run_at, last_error,
+	created_at, updated_at, trace_id`
+
+// optionalUnixNano zero time存0
+func optionalUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromOptionalUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+func scanStandingOrder(row rowScanner) (*model.StandingOrder, error) {
+	var (
+		order                                                             model.StandingOrder
+		amount, frequency, status                                         string
+		startAt, endAt, dueAt, nextRunAt, lastRunAt, createdAt, updatedAt int64
+	)
+	if err := row.Scan(&order.ID, &order.FromAccountID, &order.ToAccountID, &amount, &order.Currency, &order.Description,
+		&frequency, &order.Schedule.DayOfMonth, &order.Retry.MaxRetries, &order.Retry.IntervalSeconds, &status,
+		&startAt, &endAt, &dueAt, &nextRunAt, &order.Attempts, &order.Executions, &lastRunAt, &order.LastError,
+		&createdAt, &updatedAt, &order.TraceID); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if order.Amount, err = decimal.NewFromString(amount); err != nil {
+		return nil, err
+	}
+	order.Schedule.Frequency = model.ScheduleFrequency(frequency)
+	order.Status = model.StandingOrderStatus(status)
+	order.StartAt = time.Unix(0, startAt)
+	order.EndAt = fromOptionalUnixNano(endAt)
+	order.DueAt = fromOptionalUnixNano(dueAt)
+	order.NextRunAt = fromOptionalUnixNano(nextRunAt)
+	order.LastRunAt = fromOptionalUnixNano(lastRunAt)
+	order.CreatedAt = time.Unix(0, createdAt)
+	order.UpdatedAt = time.Unix(0, updatedAt)
+	return &order, nil
+}
+
+func scanStandingOrders(rows *sql.Rows) ([]*model.StandingOrder, error) {
+	defer rows.Close()
+
+	var orders []*model.StandingOrder
+	for rows.Next() {
+		order, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+func (s *SQLiteStorage) CreateStandingOrder(order *model.StandingOrder) error {
+	now := time.Now()
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	result, err := s.db.Exec(`INSERT INTO standing_orders (from_account_id, to_account_id, amount, currency, description,
+			frequency, day_of_month, max_retries, retry_interval, status, start_at, end_at, due_at, next_run_at,
+			attempts, executions, last_run_at, last_error, created_at, updated_at, trace_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.FromAccountID, order.ToAccountID, order.Amount.String(), order.Currency, order.Description,
+		string(order.Schedule.Frequency), order.Schedule.DayOfMonth, order.Retry.MaxRetries, order.Retry.IntervalSeconds,
+		string(order.Status), order.StartAt.UnixNano(), optionalUnixNano(order.EndAt), optionalUnixNano(order.DueAt),
+		optionalUnixNano(order.NextRunAt), order.Attempts, order.Executions, optionalUnixNano(order.LastRunAt),
+		order.LastError, now.UnixNano(), now.UnixNano(), order.TraceID)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	order.ID = uint64(id)
+	return nil
+}
+
+func (s *SQLiteStorage) GetStandingOrder(id uint64) (*model.StandingOrder, error) {
+	order, err := scanStandingOrder(s.db.QueryRow(`SELECT `+standingOrderColumns+` FROM standing_orders WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, model.ErrStandingOrderNotFound
+	}
+	return order, err
+}
+
+func (s *SQLiteStorage) GetStandingOrdersByAccountID(accountID uint64) ([]*model.StandingOrder, error) {
+	rows, err := s.db.Query(`SELECT `+standingOrderColumns+` FROM standing_orders WHERE from_account_id = ? ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanStandingOrders(rows)
+}
+
+// UpdateStandingOrder 排程狀態與執行紀錄在同一個db transaction內寫入
+func (s *SQLiteStorage) UpdateStandingOrder(order *model.StandingOrder, run *model.StandingOrderRun) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE standing_orders SET status = ?, due_at = ?, next_run_at = ?, attempts = ?, executions = ?,
+				last_run_at = ?, last_error = ?, updated_at = ?
+			WHERE id = ?`,
+			string(order.Status), optionalUnixNano(order.DueAt), optionalUnixNano(order.NextRunAt), order.Attempts,
+			order.Executions, optionalUnixNano(order.LastRunAt), order.LastError, order.UpdatedAt.UnixNano(), order.ID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return model.ErrStandingOrderNotFound
+		}
+		if run == nil {
+			return nil
+		}
+
+		var transactionID sql.NullInt64
+		if run.TransactionID != nil {
+			transactionID = sql.NullInt64{Int64: int64(*run.TransactionID), Valid: true}
+		}
+		_, err = tx.Exec(`INSERT INTO standing_order_runs (standing_order_id, due_at, attempt, status, transaction_id, error, executed_at, trace_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			run.StandingOrderID, optionalUnixNano(run.DueAt), run.Attempt, string(run.Status), transactionID, run.Error,
+			run.ExecutedAt.UnixNano(), run.TraceID)
+		return err
+	})
+}
+
+func (s *SQLiteStorage) DueStandingOrders(now time.Time) ([]*model.StandingOrder, error) {
+	rows, err := s.db.Query(`SELECT `+standingOrderColumns+` FROM standing_orders WHERE status = ? AND next_run_at <= ? ORDER BY next_run_at, id`,
+		string(model.StandingOrderActive), now.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	return scanStandingOrders(rows)
+}
+
+func (s *SQLiteStorage) GetStandingOrderRuns(orderID uint64) ([]*model.StandingOrderRun, error) {
+	if _, err := s.GetStandingOrder(orderID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT standing_order_id, due_at, attempt, status, transaction_id, error, executed_at, trace_id
+		FROM standing_order_runs WHERE standing_order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*model.StandingOrderRun{}
+	for rows.Next() {
+		var (
+			run               model.StandingOrderRun
+			status            string
+			transactionID     sql.NullInt64
+			dueAt, executedAt int64
+		)
+		if err := rows.Scan(&run.StandingOrderID, &dueAt, &run.Attempt, &status, &transactionID, &run.Error,
+			&executedAt, &run.TraceID); err != nil {
+			return nil, err
+		}
+		run.Status = model.StandingOrderRunStatus(status)
+		run.DueAt = fromOptionalUnixNano(dueAt)
+		run.ExecutedAt = time.Unix(0, executedAt)
+		if transactionID.Valid {
+			id := uint64(transactionID.Int64)
+			run.TransactionID = &id
+		}
+		runs = append(runs, &run)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,1135 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	_ "modernc.org/sqlite" // pure go sqlite driver, 不需要cgo
+)
+
+// migrations 依序執行, 已執行的版本記錄在 PRAGMA user_version
+// 新增schema只能append, 不能修改已存在的項目
+var migrations = []string{
+	`CREATE TABLE accounts (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		name       TEXT    NOT NULL,
+		balance    TEXT    NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE transactions (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		type            TEXT    NOT NULL,
+		from_account_id INTEGER,
+		to_account_id   INTEGER NOT NULL,
+		amount          TEXT    NOT NULL,
+		description     TEXT    NOT NULL,
+		created_at      INTEGER NOT NULL,
+		trace_id        TEXT    NOT NULL
+	);
+	CREATE INDEX idx_transactions_from ON transactions(from_account_id);
+	CREATE INDEX idx_transactions_to ON transactions(to_account_id);`,
+
+	// 複式記帳分錄, 既有帳戶以目前餘額補一組期初分錄
+	`CREATE TABLE ledger_entries (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		transaction_id INTEGER NOT NULL,
+		account        TEXT    NOT NULL,
+		side           TEXT    NOT NULL,
+		amount         TEXT    NOT NULL,
+		created_at     INTEGER NOT NULL
+	);
+	CREATE INDEX idx_ledger_entries_transaction ON ledger_entries(transaction_id);
+	INSERT INTO ledger_entries (transaction_id, account, side, amount, created_at)
+		SELECT 0, 'system:cash_in', 'debit', balance, created_at FROM accounts WHERE CAST(balance AS REAL) > 0;
+	INSERT INTO ledger_entries (transaction_id, account, side, amount, created_at)
+		SELECT 0, 'customer:' || id, 'credit', balance, created_at FROM accounts WHERE CAST(balance AS REAL) > 0;`,
+
+	`CREATE TABLE idempotency_keys (
+		scope       TEXT    NOT NULL,
+		key         TEXT    NOT NULL,
+		fingerprint TEXT    NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		body        BLOB,
+		completed   INTEGER NOT NULL DEFAULT 0,
+		created_at  INTEGER NOT NULL,
+		expires_at  INTEGER NOT NULL,
+		PRIMARY KEY (scope, key)
+	);
+	CREATE INDEX idx_idempotency_keys_expires ON idempotency_keys(expires_at);`,
+
+	// 帳戶交易索引, 分頁查詢用
+	`CREATE TABLE account_transactions (
+		account_id     INTEGER NOT NULL,
+		transaction_id INTEGER NOT NULL,
+		PRIMARY KEY (account_id, transaction_id)
+	) WITHOUT ROWID;
+	INSERT INTO account_transactions (account_id, transaction_id)
+		SELECT to_account_id, id FROM transactions;
+	INSERT OR IGNORE INTO account_transactions (account_id, transaction_id)
+		SELECT from_account_id, id FROM transactions WHERE from_account_id IS NOT NULL;`,
+
+	// 帳戶狀態
+	`ALTER TABLE accounts ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+	ALTER TABLE accounts ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';`,
+
+	// 幣別, 既有資料為TWD
+	`ALTER TABLE accounts ADD COLUMN currency TEXT NOT NULL DEFAULT 'TWD';
+	ALTER TABLE transactions ADD COLUMN currency TEXT NOT NULL DEFAULT 'TWD';
+	ALTER TABLE ledger_entries ADD COLUMN currency TEXT NOT NULL DEFAULT 'TWD';`,
+
+	// 換匯轉帳, 非換匯交易為NULL
+	`ALTER TABLE transactions ADD COLUMN fx_quote_id TEXT;
+	ALTER TABLE transactions ADD COLUMN fx_destination_amount TEXT;
+	ALTER TABLE transactions ADD COLUMN fx_destination_currency TEXT;
+	ALTER TABLE transactions ADD COLUMN fx_rate TEXT;
+	ALTER TABLE transactions ADD COLUMN fx_mid_rate TEXT;`,
+
+	// 預授權圈存, 請款交易以hold_id對應
+	`CREATE TABLE holds (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id  INTEGER NOT NULL,
+		amount      TEXT    NOT NULL,
+		captured    TEXT    NOT NULL,
+		currency    TEXT    NOT NULL,
+		status      TEXT    NOT NULL,
+		description TEXT    NOT NULL,
+		expires_at  INTEGER NOT NULL,
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL,
+		trace_id    TEXT    NOT NULL
+	);
+	CREATE INDEX idx_holds_account ON holds(account_id, status);
+	CREATE INDEX idx_holds_status_expires ON holds(status, expires_at);
+	ALTER TABLE transactions ADD COLUMN hold_id INTEGER;`,
+
+	// 透支額度與透支進出事件
+	`ALTER TABLE accounts ADD COLUMN overdraft_limit TEXT NOT NULL DEFAULT '0';
+	CREATE TABLE overdraft_events (
+		account_id      INTEGER NOT NULL,
+		transaction_id  INTEGER NOT NULL,
+		type            TEXT    NOT NULL,
+		balance         TEXT    NOT NULL,
+		overdraft_limit TEXT    NOT NULL,
+		currency        TEXT    NOT NULL,
+		created_at      INTEGER NOT NULL,
+		trace_id        TEXT    NOT NULL,
+		PRIMARY KEY (account_id, transaction_id)
+	) WITHOUT ROWID;`,
+
+	// 帳戶等級與個別限額(JSON, NULL代表沿用等級設定)
+	`ALTER TABLE accounts ADD COLUMN tier TEXT NOT NULL DEFAULT '';
+	ALTER TABLE accounts ADD COLUMN limits TEXT;`,
+
+	// 沖正交易對應的原交易
+	`ALTER TABLE transactions ADD COLUMN reversal_of INTEGER;
+	CREATE INDEX idx_transactions_reversal_of ON transactions(reversal_of);`,
+
+	// 定期轉帳與執行紀錄, 未設定的時間存0
+	`CREATE TABLE standing_orders (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		from_account_id INTEGER NOT NULL,
+		to_account_id   INTEGER NOT NULL,
+		amount          TEXT    NOT NULL,
+		currency        TEXT    NOT NULL,
+		description     TEXT    NOT NULL,
+		frequency       TEXT    NOT NULL,
+		day_of_month    INTEGER NOT NULL,
+		max_retries     INTEGER NOT NULL,
+		retry_interval  INTEGER NOT NULL,
+		status          TEXT    NOT NULL,
+		start_at        INTEGER NOT NULL,
+		end_at          INTEGER NOT NULL,
+		due_at          INTEGER NOT NULL,
+		next_run_at     INTEGER NOT NULL,
+		attempts        INTEGER NOT NULL,
+		executions      INTEGER NOT NULL,
+		last_run_at     INTEGER NOT NULL,
+		last_error      TEXT    NOT NULL,
+		created_at      INTEGER NOT NULL,
+		updated_at      INTEGER NOT NULL,
+		trace_id        TEXT    NOT NULL
+	);
+	CREATE INDEX idx_standing_orders_account ON standing_orders(from_account_id);
+	CREATE INDEX idx_standing_orders_due ON standing_orders(status, next_run_at);
+	CREATE TABLE standing_order_runs (
+		id                INTEGER PRIMARY KEY AUTOINCREMENT,
+		standing_order_id INTEGER NOT NULL,
+		due_at            INTEGER NOT NULL,
+		attempt           INTEGER NOT NULL,
+		status            TEXT    NOT NULL,
+		transaction_id    INTEGER,
+		error             TEXT    NOT NULL,
+		executed_at       INTEGER NOT NULL,
+		trace_id          TEXT    NOT NULL
+	);
+	CREATE INDEX idx_standing_order_runs_order ON standing_order_runs(standing_order_id);`,
+
+	// 計息產品與計息進度, accrued_through為0代表未曾指定產品
+	`ALTER TABLE accounts ADD COLUMN product TEXT NOT NULL DEFAULT '';
+	ALTER TABLE accounts ADD COLUMN accrued_interest TEXT NOT NULL DEFAULT '0';
+	ALTER TABLE accounts ADD COLUMN accrued_through INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE interest_accruals (
+		account_id     INTEGER NOT NULL,
+		date           INTEGER NOT NULL,
+		balance        TEXT    NOT NULL,
+		product        TEXT    NOT NULL,
+		rate           TEXT    NOT NULL,
+		day_count      TEXT    NOT NULL,
+		days           INTEGER NOT NULL,
+		amount         TEXT    NOT NULL,
+		accrued        TEXT    NOT NULL,
+		posted         TEXT    NOT NULL,
+		transaction_id INTEGER,
+		created_at     INTEGER NOT NULL,
+		PRIMARY KEY (account_id, date)
+	) WITHOUT ROWID;`,
+	// 手續費交易對應的提款或轉帳
+	`ALTER TABLE transactions ADD COLUMN fee_for INTEGER;
+	CREATE INDEX idx_transactions_fee_for ON transactions(fee_for);`,
+	// 使用者與帳戶持有人, owner_id為0代表啟用登入前開立的帳戶
+	`CREATE TABLE users (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		username      TEXT    NOT NULL UNIQUE,
+		password_hash TEXT    NOT NULL,
+		created_at    INTEGER NOT NULL
+	);
+	ALTER TABLE accounts ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 0;`,
+	// 使用者角色, 既有使用者為customer
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'customer';`,
+	// 呼叫端指定的交易reference, NULL不受unique限制
+	`ALTER TABLE transactions ADD COLUMN reference TEXT;
+	CREATE UNIQUE INDEX idx_transactions_reference ON transactions(reference);`,
+	// 金額放大1000倍的整數, 供金額條件在SQL內比較; 既有資料由decimal字串補齊小數到3位後轉換
+	`ALTER TABLE transactions ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0;
+	UPDATE transactions SET amount_minor = CASE
+		WHEN instr(amount, '.') = 0 THEN CAST(amount || '000' AS INTEGER)
+		ELSE CAST(substr(amount, 1, instr(amount, '.') - 1) || substr(substr(amount, instr(amount, '.') + 1) || '000', 1, 3) AS INTEGER)
+	END;`,
+}
+
+// SQLiteStorage 嵌入式sqlite實作
+// 金額以TEXT存decimal字串避免浮點誤差, 時間以unix nano存INTEGER
+// 只開一條connection, 所有寫入在同一個db transaction內完成, 由sqlite序列化
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	if path == "" {
+		return nil, errors.New("sqlite path is required")
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite同時只允許一個writer, 單一connection避免SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStorage{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// 上次結束前還在處理中的Idempotency-Key不會再Complete, 視為放棄讓client可以重試
+	if _, err := db.Exec(`DELETE FROM idempotency_keys WHERE completed = 0`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLiteStorage) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		err := s.withTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migrations[i]); err != nil {
+				return fmt.Errorf("migration %d: %w", i+1, err)
+			}
+			// PRAGMA不支援參數綁定
+			_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withTx 在db transaction中執行fn, fn回傳error則rollback
+func (s *SQLiteStorage) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// querier *sql.DB與*sql.Tx共用的查詢介面
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func scanAccount(row rowScanner) (*model.Account, error) {
+	var (
+		account              model.Account
+		balance, status      string
+		overdraftLimit       string
+		limits               sql.NullString
+		accruedInterest      string
+		accruedThrough       int64
+		createdAt, updatedAt int64
+	)
+	if err := row.Scan(&account.ID, &account.Name, &account.OwnerID, &balance, &account.Currency, &status, &account.StatusReason, &overdraftLimit,
+		&account.Tier, &limits, &account.Product, &accruedInterest, &accruedThrough, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if account.Balance, err = decimal.NewFromString(balance); err != nil {
+		return nil, err
+	}
+	if account.OverdraftLimit, err = decimal.NewFromString(overdraftLimit); err != nil {
+		return nil, err
+	}
+	if account.AccruedInterest, err = decimal.NewFromString(accruedInterest); err != nil {
+		return nil, err
+	}
+	account.AccruedThrough = fromOptionalUnixNano(accruedThrough)
+	if limits.Valid {
+		account.Limits = &model.Limits{}
+		if err := json.Unmarshal([]byte(limits.String), account.Limits); err != nil {
+			return nil, err
+		}
+	}
+	account.Status = model.AccountStatus(status)
+	account.CreatedAt = time.Unix(0, createdAt)
+	account.UpdatedAt = time.Unix(0, updatedAt)
+	return &account, nil
+}
+
+const accountColumns = `id, name, owner_id, balance, currency, status, status_reason, overdraft_limit, tier, limits,
+	product, accrued_interest, accrued_through, created_at, updated_at`
+
+// limitsColumn 帳戶個別限額存成JSON, nil為NULL
+func limitsColumn(limits *model.Limits) (sql.NullString, error) {
+	if limits == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// getAccount 讀取帳戶並填入有效預授權的圈存合計, 不存在回傳sql.ErrNoRows
+func getAccount(q querier, id uint64) (*model.Account, error) {
+	account, err := scanAccount(q.QueryRow(`SELECT `+accountColumns+` FROM accounts WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if account.Held, err = heldAmount(q, id, time.Now()); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func updateBalance(tx *sql.Tx, account *model.Account) error {
+	account.UpdatedAt = time.Now()
+	_, err := tx.Exec(`UPDATE accounts SET balance = ?, updated_at = ? WHERE id = ?`,
+		account.Balance.String(), account.UpdatedAt.UnixNano(), account.ID)
+	return err
+}
+
+// CreateAccount 開戶, 初始餘額以opening deposit入帳
+func (s *SQLiteStorage) CreateAccount(account *model.Account) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		now := time.Now()
+		if account.Status == "" {
+			account.Status = model.AccountStatusActive
+		}
+		account.Currency = account.CurrencyInfo().Code
+		limits, err := limitsColumn(account.Limits)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(`INSERT INTO accounts (name, owner_id, balance, currency, status, status_reason, overdraft_limit, tier, limits, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			account.Name, account.OwnerID, account.Balance.String(), account.Currency, string(account.Status), account.StatusReason, account.OverdraftLimit.String(),
+			account.Tier, limits, now.UnixNano(), now.UnixNano())
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		account.ID = uint64(id)
+		account.CreatedAt = now
+		account.UpdatedAt = now
+
+		if account.Balance.GreaterThan(decimal.Zero) {
+			opening := model.NewOpeningBalance(account.ID, account.Balance)
+			opening.Currency = account.Currency
+			return postTransaction(tx, opening)
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) GetAccountByID(id uint64) (*model.Account, error) {
+	account, err := getAccount(s.db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, model.ErrAccountNotFound
+	}
+	return account, err
+}
+
+func (s *SQLiteStorage) Deposit(transaction *model.Transaction) error {
+	id, amount := transaction.ToAccountID, transaction.Amount
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return errInvalidDeposit
+	}
+
+	return s.withTx(func(tx *sql.Tx) error {
+		account, err := getAccount(tx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := account.CheckCredit(); err != nil {
+			return err
+		}
+		if err := transaction.BindCurrency(account); err != nil {
+			return err
+		}
+
+		before := account.Balance
+		account.Balance = account.Balance.Add(amount)
+		transaction.TrackOverdraft(account, before)
+		if err := updateBalance(tx, account); err != nil {
+			return err
+		}
+		return postTransaction(tx, transaction)
+	})
+}
+
+func (s *SQLiteStorage) Withdraw(transaction *model.Transaction) error {
+	id, amount := transaction.ToAccountID, transaction.Amount
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return errInvalidWithdraw
+	}
+
+	return s.withTx(func(tx *sql.Tx) error {
+		account, err := getAccount(tx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := account.CheckDebit(); err != nil {
+			return err
+		}
+		if err := transaction.BindCurrency(account); err != nil {
+			return err
+		}
+		if err := checkFee(account, transaction); err != nil {
+			return err
+		}
+		if err := checkAvailable(account, amount.Add(transaction.FeeAmount())); err != nil {
+			return err
+		}
+
+		before := account.Balance
+		account.Balance = account.Balance.Sub(amount)
+		transaction.TrackOverdraft(account, before)
+		chargeFee(account, transaction)
+		if err := updateBalance(tx, account); err != nil {
+			return err
+		}
+		return postWithFee(tx, transaction)
+	})
+}
+
+func (s *SQLiteStorage) Transfer(transaction *model.Transaction) error {
+	if transaction.FromAccountID == nil {
+		return ErrSourceAccountNotFound
+	}
+	fromID, toID, amount := *transaction.FromAccountID, transaction.ToAccountID, transaction.Amount
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return errInvalidTransfer
+	}
+
+	if fromID == toID {
+		return model.ErrSameAccount
+	}
+
+	return s.withTx(func(tx *sql.Tx) error {
+		return transfer(tx, transaction)
+	})
+}
+
+// transfer 在db transaction內檢查雙方帳戶並入帳, Transfer與TransferBatch共用
+func transfer(tx *sql.Tx, transaction *model.Transaction) error {
+	fromID, toID, amount := *transaction.FromAccountID, transaction.ToAccountID, transaction.Amount
+	fromAccount, err := getAccount(tx, fromID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSourceAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	toAccount, err := getAccount(tx, toID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDestinationAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkTransfer(fromAccount, toAccount, transaction); err != nil {
+		return err
+	}
+	if err := checkFee(fromAccount, transaction); err != nil {
+		return err
+	}
+
+	if err := checkAvailable(fromAccount, amount.Add(transaction.FeeAmount())); err != nil {
+		return err
+	}
+
+	fromBefore := fromAccount.Balance
+	fromAccount.Balance = fromAccount.Balance.Sub(amount)
+	transaction.TrackOverdraft(fromAccount, fromBefore)
+	chargeFee(fromAccount, transaction)
+	if err := updateBalance(tx, fromAccount); err != nil {
+		return err
+	}
+
+	toBefore := toAccount.Balance
+	toAccount.Balance = toAccount.Balance.Add(transaction.CreditAmount())
+	transaction.TrackOverdraft(toAccount, toBefore)
+	if err := updateBalance(tx, toAccount); err != nil {
+		return err
+	}
+	return postWithFee(tx, transaction)
+}
+
+// UpdateAccountStatus 在同一個db transaction內讀取, 驗證並寫入狀態
+func (s *SQLiteStorage) UpdateAccountStatus(id uint64, status model.AccountStatus, reason string) (*model.Account, error) {
+	var account *model.Account
+	err := s.withTx(func(tx *sql.Tx) error {
+		var err error
+		account, err = getAccount(tx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := account.Transition(status, reason); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE accounts SET status = ?, status_reason = ?, updated_at = ? WHERE id = ?`,
+			string(account.Status), account.StatusReason, account.UpdatedAt.UnixNano(), account.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *SQLiteStorage) SetOverdraftLimit(id uint64, limit decimal.Decimal) (*model.Account, error) {
+	var account *model.Account
+	err := s.withTx(func(tx *sql.Tx) error {
+		var err error
+		account, err = getAccount(tx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := account.SetOverdraftLimit(limit); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE accounts SET overdraft_limit = ?, updated_at = ? WHERE id = ?`,
+			account.OverdraftLimit.String(), account.UpdatedAt.UnixNano(), account.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *SQLiteStorage) SetAccountLimits(id uint64, tier string, limits *model.Limits) (*model.Account, error) {
+	var account *model.Account
+	err := s.withTx(func(tx *sql.Tx) error {
+		var err error
+		account, err = getAccount(tx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := account.SetLimits(tier, limits); err != nil {
+			return err
+		}
+		column, err := limitsColumn(account.Limits)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE accounts SET tier = ?, limits = ?, updated_at = ? WHERE id = ?`,
+			account.Tier, column, account.UpdatedAt.UnixNano(), account.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *SQLiteStorage) GetOverdraftEvents(accountID uint64) ([]model.OverdraftEvent, error) {
+	rows, err := s.db.Query(`SELECT account_id, transaction_id, type, balance, overdraft_limit, currency, created_at, trace_id
+		FROM overdraft_events WHERE account_id = ? ORDER BY transaction_id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.OverdraftEvent
+	for rows.Next() {
+		var (
+			event                   model.OverdraftEvent
+			eventType               string
+			balance, overdraftLimit string
+			createdAt               int64
+		)
+		if err := rows.Scan(&event.AccountID, &event.TransactionID, &eventType, &balance, &overdraftLimit,
+			&event.Currency, &createdAt, &event.TraceID); err != nil {
+			return nil, err
+		}
+		if event.Balance, err = decimal.NewFromString(balance); err != nil {
+			return nil, err
+		}
+		if event.OverdraftLimit, err = decimal.NewFromString(overdraftLimit); err != nil {
+			return nil, err
+		}
+		event.Type = model.OverdraftEventType(eventType)
+		event.CreatedAt = time.Unix(0, createdAt)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// AddTransaction 只寫入交易紀錄, 不異動餘額也不產生分錄
+func (s *SQLiteStorage) AddTransaction(transaction *model.Transaction) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return insertTransaction(tx, transaction)
+	})
+}
+
+// postTransaction 寫入交易紀錄與對應的借貸分錄
+func postTransaction(tx *sql.Tx, transaction *model.Transaction) error {
+	// 以入帳時間為準, 與ID順序一致
+	transaction.CreatedAt = time.Now()
+	if err := insertTransaction(tx, transaction); err != nil {
+		return err
+	}
+
+	for _, entry := range transaction.Entries() {
+		_, err := tx.Exec(`INSERT INTO ledger_entries (transaction_id, account, side, amount, currency, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			entry.TransactionID, entry.Account, string(entry.Side), entry.Amount.String(), entry.Currency, entry.CreatedAt.UnixNano())
+		if err != nil {
+			return err
+		}
+	}
+
+	transaction.StampOverdraftEvents()
+	for _, event := range transaction.OverdraftEvents {
+		_, err := tx.Exec(`INSERT INTO overdraft_events (account_id, transaction_id, type, balance, overdraft_limit, currency, created_at, trace_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			event.AccountID, event.TransactionID, string(event.Type), event.Balance.String(), event.OverdraftLimit.String(),
+			event.Currency, event.CreatedAt.UnixNano(), event.TraceID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postWithFee 寫入主交易, 有附加手續費時接著寫入手續費交易
+func postWithFee(tx *sql.Tx, transaction *model.Transaction) error {
+	if err := postTransaction(tx, transaction); err != nil {
+		return err
+	}
+	if transaction.Fee == nil {
+		return nil
+	}
+	transaction.LinkFee()
+	return postTransaction(tx, transaction.Fee)
+}
+
+// insertTransaction 寫入交易紀錄並回填id
+func insertTransaction(tx *sql.Tx, transaction *model.Transaction) error {
+	var fromAccountID sql.NullInt64
+	if transaction.FromAccountID != nil {
+		fromAccountID = sql.NullInt64{Int64: int64(*transaction.FromAccountID), Valid: true}
+	}
+
+	currency := transaction.Currency
+	if currency == "" {
+		currency = model.DefaultCurrency
+	}
+	var fxQuoteID, fxDestinationAmount, fxDestinationCurrency, fxRate, fxMidRate sql.NullString
+	if fx := transaction.FX; fx != nil {
+		fxQuoteID = sql.NullString{String: fx.QuoteID, Valid: true}
+		fxDestinationAmount = sql.NullString{String: fx.DestinationAmount.String(), Valid: true}
+		fxDestinationCurrency = sql.NullString{String: fx.DestinationCurrency, Valid: true}
+		fxRate = sql.NullString{String: fx.Rate.String(), Valid: true}
+		fxMidRate = sql.NullString{String: fx.MidRate.String(), Valid: true}
+	}
+	var holdID sql.NullInt64
+	if transaction.HoldID != nil {
+		holdID = sql.NullInt64{Int64: int64(*transaction.HoldID), Valid: true}
+	}
+	var reversalOf sql.NullInt64
+	if transaction.ReversalOf != nil {
+		reversalOf = sql.NullInt64{Int64: int64(*transaction.ReversalOf), Valid: true}
+	}
+	var feeFor sql.NullInt64
+	if transaction.FeeFor != nil {
+		feeFor = sql.NullInt64{Int64: int64(*transaction.FeeFor), Valid: true}
+	}
+	var reference sql.NullString
+	if transaction.Reference != "" {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM transactions WHERE reference = ?)`, transaction.Reference).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrDuplicateReference
+		}
+		reference = sql.NullString{String: transaction.Reference, Valid: true}
+	}
+	result, err := tx.Exec(`INSERT INTO transactions (type, from_account_id, to_account_id, amount, amount_minor, currency, description, created_at, trace_id,
+		fx_quote_id, fx_destination_amount, fx_destination_currency, fx_rate, fx_mid_rate, hold_id, reversal_of, fee_for, reference)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		string(transaction.Type), fromAccountID, transaction.ToAccountID, transaction.Amount.String(),
+		amountMinor(transaction.Amount.Shift(amountMinorScale)), currency,
+		transaction.Description, transaction.CreatedAt.UnixNano(), transaction.TraceID,
+		fxQuoteID, fxDestinationAmount, fxDestinationCurrency, fxRate, fxMidRate, holdID, reversalOf, feeFor, reference)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	transaction.ID = uint64(id)
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO account_transactions (account_id, transaction_id) VALUES (?, ?)`,
+		transaction.ToAccountID, transaction.ID)
+	if err != nil {
+		return err
+	}
+	if transaction.FromAccountID != nil {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO account_transactions (account_id, transaction_id) VALUES (?, ?)`,
+			*transaction.FromAccountID, transaction.ID)
+	}
+	return err
+}
+
+// transactionColumns 查詢時transactions一律alias為t
+const transactionColumns = `t.id, t.type, t.from_account_id, t.to_account_id, t.amount, t.currency, t.description, t.created_at, t.trace_id,
+	t.fx_quote_id, t.fx_destination_amount, t.fx_destination_currency, t.fx_rate, t.fx_mid_rate, t.hold_id, t.reversal_of, t.fee_for, t.reference`
+
+func scanTransactions(rows *sql.Rows) ([]*model.Transaction, error) {
+	defer rows.Close()
+
+	var transactions []*model.Transaction
+	for rows.Next() {
+		var (
+			transaction   model.Transaction
+			txType        string
+			fromAccountID sql.NullInt64
+			amount        string
+			createdAt     int64
+			fx            fxColumns
+			holdID        sql.NullInt64
+			reversalOf    sql.NullInt64
+			feeFor        sql.NullInt64
+			reference     sql.NullString
+		)
+		if err := rows.Scan(&transaction.ID, &txType, &fromAccountID, &transaction.ToAccountID, &amount, &transaction.Currency,
+			&transaction.Description, &createdAt, &transaction.TraceID,
+			&fx.quoteID, &fx.destinationAmount, &fx.destinationCurrency, &fx.rate, &fx.midRate, &holdID, &reversalOf, &feeFor, &reference); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if transaction.Amount, err = decimal.NewFromString(amount); err != nil {
+			return nil, err
+		}
+		transaction.Type = model.TransactionType(txType)
+		if fromAccountID.Valid {
+			id := uint64(fromAccountID.Int64)
+			transaction.FromAccountID = &id
+		}
+		transaction.CreatedAt = time.Unix(0, createdAt)
+		if transaction.FX, err = fx.conversion(); err != nil {
+			return nil, err
+		}
+		if holdID.Valid {
+			id := uint64(holdID.Int64)
+			transaction.HoldID = &id
+		}
+		if reversalOf.Valid {
+			id := uint64(reversalOf.Int64)
+			transaction.ReversalOf = &id
+		}
+		if feeFor.Valid {
+			id := uint64(feeFor.Int64)
+			transaction.FeeFor = &id
+		}
+		transaction.Reference = reference.String
+		transactions = append(transactions, &transaction)
+	}
+	return transactions, rows.Err()
+}
+
+// fxColumns transactions的換匯欄位, fx_quote_id為NULL代表不是換匯交易
+type fxColumns struct {
+	quoteID, destinationAmount, destinationCurrency, rate, midRate sql.NullString
+}
+
+func (c fxColumns) conversion() (*model.FXConversion, error) {
+	if !c.quoteID.Valid {
+		return nil, nil
+	}
+	fx := &model.FXConversion{QuoteID: c.quoteID.String, DestinationCurrency: c.destinationCurrency.String}
+	var err error
+	if fx.DestinationAmount, err = decimal.NewFromString(c.destinationAmount.String); err != nil {
+		return nil, err
+	}
+	if fx.Rate, err = decimal.NewFromString(c.rate.String); err != nil {
+		return nil, err
+	}
+	if fx.MidRate, err = decimal.NewFromString(c.midRate.String); err != nil {
+		return nil, err
+	}
+	return fx, nil
+}
+
+func (s *SQLiteStorage) GetTransactionsByAccountID(accountID uint64) ([]*model.Transaction, error) {
+	rows, err := s.db.Query(`SELECT `+transactionColumns+` FROM account_transactions a
+		JOIN transactions t ON t.id = a.transaction_id
+		WHERE a.account_id = ? ORDER BY a.transaction_id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTransactions(rows)
+}
+
+// GetAccountHistory 帳戶與交易在同一個db transaction內讀取
+func (s *SQLiteStorage) GetAccountHistory(accountID uint64) (*model.Account, []*model.Transaction, error) {
+	var (
+		account      *model.Account
+		transactions []*model.Transaction
+	)
+	err := s.withTx(func(tx *sql.Tx) error {
+		var err error
+		account, err = getAccount(tx, accountID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`SELECT `+transactionColumns+` FROM account_transactions a
+			JOIN transactions t ON t.id = a.transaction_id
+			WHERE a.account_id = ? ORDER BY a.transaction_id`, accountID)
+		if err != nil {
+			return err
+		}
+		transactions, err = scanTransactions(rows)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, transactions, nil
+}
+
+func (s *SQLiteStorage) GetAllTransactions() ([]*model.Transaction, error) {
+	rows, err := s.db.Query(`SELECT ` + transactionColumns + ` FROM transactions t ORDER BY t.id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTransactions(rows)
+}
+
+// QueryTransactions 走account_transactions主鍵(account_id, transaction_id)做keyset分頁, filter轉成where條件
+// 金額條件以amount_minor整數比較, 與memory的decimal比較結果一致
+func (s *SQLiteStorage) QueryTransactions(query model.TransactionQuery) (*model.TransactionPage, error) {
+	query = normalizeQuery(query)
+
+	where, args := `a.account_id = ?`, []any{query.AccountID}
+	order, cursor := `ASC`, `a.transaction_id > ?`
+	if query.Direction == model.SortDesc {
+		order, cursor = `DESC`, `a.transaction_id < ?`
+	}
+	if query.Cursor > 0 {
+		where += ` AND ` + cursor
+		args = append(args, query.Cursor)
+	}
+
+	filter := query.Filter
+	if filter.Type != "" {
+		where += ` AND t.type = ?`
+		args = append(args, string(filter.Type))
+	}
+	if !filter.From.IsZero() {
+		where += ` AND t.created_at >= ?`
+		args = append(args, filter.From.UnixNano())
+	}
+	if !filter.To.IsZero() {
+		where += ` AND t.created_at < ?`
+		args = append(args, filter.To.UnixNano())
+	}
+	// 存入的金額都是amountMinorScale位數內的整數倍, 下限無條件進位, 上限無條件捨去後以整數比較不影響結果
+	if filter.MinAmount != nil {
+		where += ` AND t.amount_minor >= ?`
+		args = append(args, amountMinor(filter.MinAmount.Shift(amountMinorScale).Ceil()))
+	}
+	if filter.MaxAmount != nil {
+		where += ` AND t.amount_minor <= ?`
+		args = append(args, amountMinor(filter.MaxAmount.Shift(amountMinorScale).Floor()))
+	}
+	if filter.CounterpartyID != 0 {
+		where += ` AND t.type = ? AND ((t.from_account_id = ? AND t.to_account_id = ?) OR (t.from_account_id = ? AND t.to_account_id = ?))`
+		args = append(args, string(model.TransactionTypeTransfer),
+			query.AccountID, filter.CounterpartyID, filter.CounterpartyID, query.AccountID)
+	}
+	if filter.TraceID != "" {
+		where += ` AND t.trace_id = ?`
+		args = append(args, filter.TraceID)
+	}
+	args = append(args, query.Limit+1)
+
+	rows, err := s.db.Query(`SELECT `+transactionColumns+` FROM account_transactions a
+		JOIN transactions t ON t.id = a.transaction_id
+		WHERE `+where+`
+		ORDER BY a.transaction_id `+order+` LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := scanTransactions(rows)
+	if err != nil {
+		return nil, err
+	}
+	return newTransactionPage(transactions, query.Limit), nil
+}
+
+// amountMinorScale 支援幣別中最多的小數位數, amount_minor = amount * 10^amountMinorScale
+const amountMinorScale = 3
+
+var (
+	maxAmountMinor = decimal.NewFromInt(math.MaxInt64)
+	minAmountMinor = decimal.NewFromInt(math.MinInt64)
+)
+
+// amountMinor 已放大為整數的金額轉int64, 超出範圍時夾在int64上下限
+func amountMinor(scaled decimal.Decimal) int64 {
+	if scaled.GreaterThan(maxAmountMinor) {
+		return math.MaxInt64
+	}
+	if scaled.LessThan(minAmountMinor) {
+		return math.MinInt64
+	}
+	return scaled.IntPart()
+}
+
+func scanEntries(rows *sql.Rows) ([]model.LedgerEntry, error) {
+	defer rows.Close()
+
+	var entries []model.LedgerEntry
+	for rows.Next() {
+		var (
+			entry     model.LedgerEntry
+			side      string
+			amount    string
+			createdAt int64
+		)
+		if err := rows.Scan(&entry.ID, &entry.TransactionID, &entry.Account, &side, &amount, &entry.Currency, &createdAt); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if entry.Amount, err = decimal.NewFromString(amount); err != nil {
+			return nil, err
+		}
+		entry.Side = model.EntrySide(side)
+		entry.CreatedAt = time.Unix(0, createdAt)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+const entryColumns = `id, transaction_id, account, side, amount, currency, created_at`
+
+func (s *SQLiteStorage) GetEntriesByTransactionID(transactionID uint64) ([]model.LedgerEntry, error) {
+	rows, err := s.db.Query(`SELECT `+entryColumns+` FROM ledger_entries WHERE transaction_id = ? ORDER BY id`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+// TrialBalance 在同一個db transaction內讀取分錄與帳戶, 確保是一致的快照
+// 金額為decimal字串, 加總在go內完成避免sqlite浮點運算
+func (s *SQLiteStorage) TrialBalance() (*model.TrialBalance, error) {
+	var trial *model.TrialBalance
+	err := s.withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT ` + entryColumns + ` FROM ledger_entries`)
+		if err != nil {
+			return err
+		}
+		entries, err := scanEntries(rows)
+		if err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(`SELECT ` + accountColumns + ` FROM accounts`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var accounts []*model.Account
+		for rows.Next() {
+			account, err := scanAccount(rows)
+			if err != nil {
+				return err
+			}
+			accounts = append(accounts, account)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		trial = buildTrialBalance(entries, accounts)
+		return nil
+	})
+	return trial, err
+}
+
+func (s *SQLiteStorage) Begin(scope, key, fingerprint string, ttl time.Duration) (*model.IdempotencyRecord, error) {
+	var record *model.IdempotencyRecord
+	err := s.withTx(func(tx *sql.Tx) error {
+		now := time.Now()
+		if _, err := tx.Exec(`DELETE FROM idempotency_keys WHERE expires_at < ?`, now.UnixNano()); err != nil {
+			return err
+		}
+
+		var (
+			existing             model.IdempotencyRecord
+			completed            bool
+			createdAt, expiresAt int64
+		)
+		err := tx.QueryRow(`SELECT fingerprint, status_code, body, completed, created_at, expires_at
+			FROM idempotency_keys WHERE scope = ? AND key = ?`, scope, key).
+			Scan(&existing.Fingerprint, &existing.StatusCode, &existing.Body, &completed, &createdAt, &expiresAt)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_, err := tx.Exec(`INSERT INTO idempotency_keys (scope, key, fingerprint, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+				scope, key, fingerprint, now.UnixNano(), now.Add(ttl).UnixNano())
+			return err
+		case err != nil:
+			return err
+		}
+
+		if existing.Fingerprint != fingerprint {
+			return ErrIdempotencyKeyMismatch
+		}
+		if !completed {
+			return ErrIdempotencyKeyInProgress
+		}
+
+		existing.Scope, existing.Key, existing.Completed = scope, key, true
+		existing.CreatedAt = time.Unix(0, createdAt)
+		existing.ExpiresAt = time.Unix(0, expiresAt)
+		record = &existing
+		return nil
+	})
+	return record, err
+}
+
+func (s *SQLiteStorage) Complete(scope, key string, statusCode int, body []byte) error {
+	result, err := s.db.Exec(`UPDATE idempotency_keys SET status_code = ?, body = ?, completed = 1 WHERE scope = ? AND key = ?`,
+		statusCode, body, scope, key)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("idempotency key not found")
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) Release(scope, key string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE scope = ? AND key = ?`, scope, key)
+	return err
+}
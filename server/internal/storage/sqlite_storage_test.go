@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 重開db後資料仍在
+func TestSQLiteStoragePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bank.db")
+
+	s, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+
+	account := &model.Account{Name: "persist", Balance: decimal.NewFromFloat(100)}
+	require.NoError(t, s.CreateAccount(account))
+	require.NoError(t, s.Deposit(model.NewDeposit(account.ID, decimal.NewFromFloat(20.5), "trace-1")))
+	require.NoError(t, s.Close())
+
+	reopened, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	retrieved, err := reopened.GetAccountByID(account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "persist", retrieved.Name)
+	assert.True(t, decimal.NewFromFloat(120.5).Equal(retrieved.Balance))
+
+	transactions, err := reopened.GetTransactionsByAccountID(account.ID)
+	require.NoError(t, err)
+	// opening balance + deposit
+	require.Len(t, transactions, 2)
+
+	trial, err := reopened.TrialBalance()
+	require.NoError(t, err)
+	assert.True(t, trial.Balanced)
+}
+
+func TestNewStorage(t *testing.T) {
+	s, err := New(DriverMemory, Options{})
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryStorage{}, s)
+
+	s, err = New(DriverMemory, Options{Dir: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryStorage{}, s)
+	s.Close()
+
+	s, err = New(DriverSQLite, Options{Path: filepath.Join(t.TempDir(), "bank.db")})
+	require.NoError(t, err)
+	assert.IsType(t, &SQLiteStorage{}, s)
+	s.Close()
+
+	_, err = New("mysql", Options{})
+	assert.Error(t, err)
+}
+
+// 升級前寫入的交易由migration補上amount_minor, 金額條件照常生效
+func TestSQLiteAmountMinorBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bank.db")
+
+	s, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+	account := &model.Account{Name: "backfill", Balance: decimal.Zero}
+	require.NoError(t, s.CreateAccount(account))
+	amounts := []string{"7", "100.1", "100.25", "9007199254740993"}
+	ids := make([]uint64, len(amounts))
+	for i, amount := range amounts {
+		deposit := model.NewDeposit(account.ID, decimal.RequireFromString(amount), "")
+		require.NoError(t, s.Deposit(deposit))
+		ids[i] = deposit.ID
+	}
+	// 退回新增amount_minor之前的schema
+	_, err = s.db.Exec(fmt.Sprintf(`ALTER TABLE transactions DROP COLUMN amount_minor; PRAGMA user_version = %d`, len(migrations)-1))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	reopened, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	var minor []int64
+	rows, err := reopened.db.Query(`SELECT amount_minor FROM transactions ORDER BY id`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var value int64
+		require.NoError(t, rows.Scan(&value))
+		minor = append(minor, value)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []int64{7000, 100100, 100250, 9007199254740993000}, minor)
+
+	min, max := decimal.RequireFromString("100.1"), decimal.RequireFromString("100.25")
+	page, err := reopened.QueryTransactions(model.TransactionQuery{AccountID: account.ID, Filter: model.TransactionFilter{MinAmount: &min, MaxAmount: &max}})
+	require.NoError(t, err)
+	var got []uint64
+	for _, transaction := range page.Transactions {
+		got = append(got, transaction.ID)
+	}
+	assert.ElementsMatch(t, ids[1:3], got)
+}
+
+// 重開db時處理中的Idempotency-Key被放棄, 已完成的仍會重放
+func TestSQLiteDropsPendingIdempotencyKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bank.db")
+
+	s, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+	_, err = s.Begin("client", "completed", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.Complete("client", "completed", 201, []byte(`{"id":1}`)))
+	_, err = s.Begin("client", "in-progress", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	reopened, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	record, err := reopened.Begin("client", "completed", "fp", time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, 201, record.StatusCode)
+
+	record, err = reopened.Begin("client", "in-progress", "fp", time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
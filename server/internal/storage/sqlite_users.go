@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+const userColumns = `id, username, role, password_hash, created_at`
+
+func scanUser(row rowScanner) (*model.User, error) {
+	var (
+		user      model.User
+		createdAt int64
+	)
+	if err := row.Scan(&user.ID, &user.Username, &user.Role, &user.PasswordHash, &createdAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.ErrUserNotFound
+		}
+		return nil, err
+	}
+	user.CreatedAt = time.Unix(0, createdAt)
+	return &user, nil
+}
+
+// CreateUser 單一connection下先查再寫不會有併發註冊同一個username
+func (s *SQLiteStorage) CreateUser(user *model.User) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`, user.Username).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return model.ErrUsernameTaken
+		}
+
+		now := time.Now()
+		result, err := tx.Exec(`INSERT INTO users (username, role, password_hash, created_at) VALUES (?, ?, ?, ?)`,
+			user.Username, user.Role, user.PasswordHash, now.UnixNano())
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		user.ID = uint64(id)
+		user.CreatedAt = now
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) GetUserByID(id uint64) (*model.User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+func (s *SQLiteStorage) GetUserByUsername(username string) (*model.User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username))
+}
+
+func (s *SQLiteStorage) SetUserRole(id uint64, role model.Role) (*model.User, error) {
+	var user *model.User
+	err := s.withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return model.ErrUserNotFound
+		}
+		user, err = scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+		return err
+	})
+	return user, err
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStandingOrder(fromID, toID uint64, schedule model.Schedule, startAt time.Time) *model.StandingOrder {
+	return &model.StandingOrder{
+		FromAccountID: fromID,
+		ToAccountID:   toID,
+		Amount:        decimal.NewFromInt(100),
+		Currency:      "TWD",
+		Description:   "rent",
+		Schedule:      schedule,
+		Retry:         model.RetryPolicy{MaxRetries: 2, IntervalSeconds: 3600},
+		StartAt:       startAt,
+		TraceID:       "trace-standing-order",
+	}
+}
+
+func TestScheduleOccurrences(t *testing.T) {
+	at := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 30, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		schedule model.Schedule
+		start    time.Time
+		want     []time.Time
+	}{
+		{"daily", model.Schedule{Frequency: model.ScheduleDaily}, at(2026, 2, 27, 9),
+			[]time.Time{at(2026, 2, 27, 9), at(2026, 2, 28, 9), at(2026, 3, 1, 9)}},
+		{"weekly", model.Schedule{Frequency: model.ScheduleWeekly}, at(2026, 12, 25, 9),
+			[]time.Time{at(2026, 12, 25, 9), at(2027, 1, 1, 9), at(2027, 1, 8, 9)}},
+		{"monthly clamps to month end", model.Schedule{Frequency: model.ScheduleMonthly, DayOfMonth: 31}, at(2026, 1, 5, 9),
+			[]time.Time{at(2026, 1, 31, 9), at(2026, 2, 28, 9), at(2026, 3, 31, 9), at(2026, 4, 30, 9)}},
+		{"monthly day already passed", model.Schedule{Frequency: model.ScheduleMonthly, DayOfMonth: 5}, at(2026, 11, 20, 9),
+			[]time.Time{at(2026, 12, 5, 9), at(2027, 1, 5, 9)}},
+		{"monthly same day later time", model.Schedule{Frequency: model.ScheduleMonthly, DayOfMonth: 20}, at(2026, 11, 20, 9),
+			[]time.Time{at(2026, 11, 20, 9), at(2026, 12, 20, 9)}},
+		{"end of month leap year", model.Schedule{Frequency: model.ScheduleEndOfMonth}, at(2028, 1, 31, 18),
+			[]time.Time{at(2028, 1, 31, 18), at(2028, 2, 29, 18), at(2028, 3, 31, 18)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.schedule.Validate())
+			got := []time.Time{tt.schedule.First(tt.start)}
+			for len(got) < len(tt.want) {
+				next, ok := tt.schedule.Next(tt.start, got[len(got)-1])
+				require.True(t, ok)
+				got = append(got, next)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	once := model.Schedule{Frequency: model.ScheduleOnce}
+	assert.Equal(t, at(2026, 5, 1, 9), once.First(at(2026, 5, 1, 9)))
+	_, ok := once.Next(at(2026, 5, 1, 9), at(2026, 5, 1, 9))
+	assert.False(t, ok)
+
+	for _, invalid := range []model.Schedule{
+		{Frequency: "yearly"},
+		{Frequency: model.ScheduleMonthly},
+		{Frequency: model.ScheduleMonthly, DayOfMonth: 32},
+		{Frequency: model.ScheduleDaily, DayOfMonth: 3},
+	} {
+		assert.True(t, errors.Is(invalid.Validate(), model.ErrInvalidRequest), "%+v", invalid)
+	}
+}
+
+func TestStandingOrderRetryPolicy(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	order := newTestStandingOrder(1, 2, model.Schedule{Frequency: model.ScheduleMonthly, DayOfMonth: 1}, start)
+	order.EndAt = time.Date(2026, 4, 30, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, order.Start())
+	assert.True(t, order.Due(start))
+
+	// 可重試的失敗依間隔重試, 這一期不變
+	order.Fail(model.ErrInsufficientBalance, model.Retryable(model.ErrInsufficientBalance), start)
+	assert.Equal(t, model.StandingOrderActive, order.Status)
+	assert.Equal(t, start, order.DueAt)
+	assert.Equal(t, start.Add(time.Hour), order.NextRunAt)
+	assert.False(t, order.Due(start.Add(time.Minute)))
+
+	order.Fail(model.ErrInsufficientBalance, true, start.Add(time.Hour))
+	assert.Equal(t, 2, order.Attempts)
+	// 重試用完, 跳到下一期
+	order.Fail(model.ErrInsufficientBalance, true, start.Add(2*time.Hour))
+	assert.Equal(t, model.StandingOrderActive, order.Status)
+	assert.Equal(t, 0, order.Attempts)
+	assert.Equal(t, time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC), order.DueAt)
+	assert.Equal(t, order.DueAt, order.NextRunAt)
+
+	// 最後一期成功後超過EndAt, 排程結束
+	order.Succeed(order.DueAt)
+	assert.Equal(t, model.StandingOrderCompleted, order.Status)
+	assert.Equal(t, 1, order.Executions)
+	assert.True(t, order.NextRunAt.IsZero())
+	assert.False(t, order.Due(order.LastRunAt.AddDate(1, 0, 0)))
+
+	// 帳戶結清等錯誤重試也不會成功, 直接停止
+	closed := model.NewError(model.ErrAccountClosed, "account 1 is closed")
+	assert.False(t, model.Retryable(closed))
+	assert.True(t, model.Retryable(model.NewError(model.ErrLimitExceeded, "daily limit")))
+	assert.True(t, model.Retryable(errors.New("disk full")))
+
+	order = newTestStandingOrder(1, 2, model.Schedule{Frequency: model.ScheduleDaily}, start)
+	require.NoError(t, order.Start())
+	order.Fail(closed, model.Retryable(closed), start)
+	assert.Equal(t, model.StandingOrderFailed, order.Status)
+	assert.Equal(t, "account 1 is closed", order.LastError)
+	assert.False(t, order.Due(start.AddDate(0, 0, 1)))
+}
+
+func TestStandingOrderPauseResume(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	order := newTestStandingOrder(1, 2, model.Schedule{Frequency: model.ScheduleWeekly}, start)
+	require.NoError(t, order.Start())
+
+	require.NoError(t, order.Pause(start.Add(-time.Hour)))
+	assert.False(t, order.Due(start))
+	assert.True(t, errors.Is(order.Pause(start), model.ErrStandingOrderNotActive))
+
+	// 暫停期間已過的兩期不補執行
+	resumeAt := start.AddDate(0, 0, 10)
+	require.NoError(t, order.Resume(resumeAt))
+	assert.Equal(t, model.StandingOrderActive, order.Status)
+	assert.Equal(t, start.AddDate(0, 0, 14), order.DueAt)
+	assert.False(t, order.Due(resumeAt))
+
+	require.NoError(t, order.Cancel(resumeAt))
+	assert.Equal(t, model.StandingOrderCancelled, order.Status)
+	assert.True(t, errors.Is(order.Resume(resumeAt), model.ErrStandingOrderNotActive))
+	assert.True(t, errors.Is(order.Cancel(resumeAt), model.ErrStandingOrderNotActive))
+}
+
+func TestStandingOrderStorage(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		sourceID, payees := createBatchAccounts(t, storage, 1000, 2)
+		now := time.Now()
+
+		monthly := newTestStandingOrder(sourceID, payees[0], model.Schedule{Frequency: model.ScheduleMonthly, DayOfMonth: 31}, now.Add(time.Hour))
+		monthly.EndAt = now.AddDate(1, 0, 0)
+		require.NoError(t, monthly.Start())
+		require.NoError(t, storage.CreateStandingOrder(monthly))
+		assert.NotZero(t, monthly.ID)
+
+		once := newTestStandingOrder(sourceID, payees[1], model.Schedule{Frequency: model.ScheduleOnce}, now.Add(-time.Second))
+		require.NoError(t, once.Start())
+		require.NoError(t, storage.CreateStandingOrder(once))
+		assert.Equal(t, monthly.ID+1, once.ID)
+
+		got, err := storage.GetStandingOrder(monthly.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.StandingOrderActive, got.Status)
+		assert.Equal(t, monthly.Schedule, got.Schedule)
+		assert.Equal(t, monthly.Retry, got.Retry)
+		assert.True(t, monthly.DueAt.Equal(got.DueAt))
+		assert.True(t, monthly.EndAt.Equal(got.EndAt))
+		assert.True(t, got.LastRunAt.IsZero())
+		assert.True(t, got.Amount.Equal(decimal.NewFromInt(100)))
+		assert.Equal(t, "trace-standing-order", got.TraceID)
+
+		_, err = storage.GetStandingOrder(999)
+		assert.True(t, errors.Is(err, model.ErrStandingOrderNotFound))
+
+		orders, err := storage.GetStandingOrdersByAccountID(sourceID)
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		assert.Equal(t, monthly.ID, orders[0].ID)
+		orders, err = storage.GetStandingOrdersByAccountID(payees[0])
+		require.NoError(t, err)
+		assert.Empty(t, orders)
+
+		// 只有單次的已到期
+		due, err := storage.DueStandingOrders(now)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		assert.Equal(t, once.ID, due[0].ID)
+
+		transfer := model.NewTransfer(sourceID, payees[1], once.Amount, "trace-run")
+		require.NoError(t, storage.Transfer(transfer))
+		run := model.NewStandingOrderRun(once, transfer, nil, now, "trace-run")
+		once.Succeed(now)
+		require.NoError(t, storage.UpdateStandingOrder(once, run))
+
+		failed := model.NewStandingOrderRun(monthly, nil, model.ErrInsufficientBalance, now, "trace-failed")
+		monthly.Fail(model.ErrInsufficientBalance, true, now)
+		require.NoError(t, storage.UpdateStandingOrder(monthly, failed))
+
+		got, err = storage.GetStandingOrder(once.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.StandingOrderCompleted, got.Status)
+		assert.Equal(t, 1, got.Executions)
+		assert.True(t, got.NextRunAt.IsZero())
+
+		runs, err := storage.GetStandingOrderRuns(once.ID)
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.Equal(t, model.StandingOrderRunSucceeded, runs[0].Status)
+		require.NotNil(t, runs[0].TransactionID)
+		assert.Equal(t, transfer.ID, *runs[0].TransactionID)
+		assert.Equal(t, "trace-run", runs[0].TraceID)
+
+		runs, err = storage.GetStandingOrderRuns(monthly.ID)
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.Equal(t, model.StandingOrderRunFailed, runs[0].Status)
+		assert.Nil(t, runs[0].TransactionID)
+		assert.Equal(t, 1, runs[0].Attempt)
+		assert.Equal(t, model.ErrInsufficientBalance.Error(), runs[0].Error)
+
+		got, err = storage.GetStandingOrder(monthly.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, got.Attempts)
+		assert.Equal(t, model.ErrInsufficientBalance.Error(), got.LastError)
+		assert.True(t, monthly.NextRunAt.Equal(got.NextRunAt))
+
+		due, err = storage.DueStandingOrders(now)
+		require.NoError(t, err)
+		assert.Empty(t, due)
+		due, err = storage.DueStandingOrders(got.NextRunAt)
+		require.NoError(t, err)
+		assert.Len(t, due, 1)
+
+		_, err = storage.GetStandingOrderRuns(999)
+		assert.True(t, errors.Is(err, model.ErrStandingOrderNotFound))
+		missing := newTestStandingOrder(sourceID, payees[0], model.Schedule{Frequency: model.ScheduleOnce}, now)
+		missing.ID = 999
+		assert.True(t, errors.Is(storage.UpdateStandingOrder(missing, nil), model.ErrStandingOrderNotFound))
+	})
+}
+
+// TestStandingOrderReference 同一期的reference只會入帳一次, 重啟後可依reference找回轉帳
+func TestStandingOrderReference(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		sourceID, payees := createBatchAccounts(t, storage, 1000, 1)
+		order := newTestStandingOrder(sourceID, payees[0], model.Schedule{Frequency: model.ScheduleDaily}, time.Now().Add(time.Hour))
+		require.NoError(t, order.Start())
+		require.NoError(t, storage.CreateStandingOrder(order))
+
+		_, err := storage.GetTransactionByReference(order.Reference())
+		assert.ErrorIs(t, err, model.ErrTransactionNotFound)
+
+		transfer := model.NewTransfer(sourceID, payees[0], order.Amount, "trace-run")
+		transfer.Reference = order.Reference()
+		require.NoError(t, storage.Transfer(transfer))
+
+		duplicate := model.NewTransfer(sourceID, payees[0], order.Amount, "trace-retry")
+		duplicate.Reference = order.Reference()
+		assert.ErrorIs(t, storage.Transfer(duplicate), ErrDuplicateReference)
+		assertBalances(t, storage, sourceID, "900", "900")
+
+		got, err := storage.GetTransactionByReference(order.Reference())
+		require.NoError(t, err)
+		assert.Equal(t, transfer.ID, got.ID)
+		assert.Equal(t, order.Reference(), got.Reference)
+
+		// 下一期是不同的reference
+		order.Succeed(time.Now())
+		assert.NotEqual(t, transfer.Reference, order.Reference())
+	})
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mark 前後交易的入帳時間不會與回傳的時間相同
+func mark() time.Time {
+	time.Sleep(time.Millisecond)
+	now := time.Now()
+	time.Sleep(time.Millisecond)
+	return now
+}
+
+func statementOf(t *testing.T, storage Storage, accountID uint64, from, to time.Time) *model.Statement {
+	t.Helper()
+	account, history, err := storage.GetAccountHistory(accountID)
+	require.NoError(t, err)
+	statement, err := model.NewStatement(account, history, from, to)
+	require.NoError(t, err)
+	return statement
+}
+
+func TestStatement(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "statement", Balance: decimal.NewFromInt(100)}
+		require.NoError(t, storage.CreateAccount(account))
+		other := &model.Account{Name: "other", Balance: decimal.NewFromInt(500)}
+		require.NoError(t, storage.CreateAccount(other))
+		require.NoError(t, storage.Deposit(model.NewDeposit(account.ID, decimal.NewFromInt(50), "")))
+
+		from := mark()
+		require.NoError(t, storage.Withdraw(withFee(model.NewWithdraw(account.ID, decimal.NewFromInt(30), ""), account.ID, "5")))
+		require.NoError(t, storage.Transfer(model.NewTransfer(other.ID, account.ID, decimal.RequireFromString("12.5"), "")))
+		require.NoError(t, storage.Transfer(model.NewTransfer(account.ID, other.ID, decimal.NewFromInt(20), "")))
+		require.NoError(t, storage.Deposit(model.NewDeposit(account.ID, decimal.NewFromInt(8), "")))
+		to := mark()
+		require.NoError(t, storage.Withdraw(model.NewWithdraw(account.ID, decimal.NewFromInt(40), "")))
+
+		statement := statementOf(t, storage, account.ID, from, to)
+		assert.Equal(t, "TWD", statement.Currency)
+		assert.True(t, decimal.NewFromInt(150).Equal(statement.OpeningBalance), statement.OpeningBalance.String())
+		assert.True(t, decimal.RequireFromString("115.5").Equal(statement.ClosingBalance), statement.ClosingBalance.String())
+		assert.True(t, decimal.RequireFromString("20.5").Equal(statement.TotalCredit))
+		assert.True(t, decimal.NewFromInt(55).Equal(statement.TotalDebit))
+
+		wantLines := []struct {
+			typ             model.TransactionType
+			amount, running string
+		}{
+			{model.TransactionTypeWithdraw, "-30", "120"},
+			{model.TransactionTypeFee, "-5", "115"},
+			{model.TransactionTypeTransfer, "12.5", "127.5"},
+			{model.TransactionTypeTransfer, "-20", "107.5"},
+			{model.TransactionTypeDeposit, "8", "115.5"},
+		}
+		require.Len(t, statement.Lines, len(wantLines))
+		for i, want := range wantLines {
+			line := statement.Lines[i]
+			assert.Equal(t, want.typ, line.Transaction.Type, i)
+			assert.True(t, decimal.RequireFromString(want.amount).Equal(line.Amount), "line %d amount %s", i, line.Amount)
+			assert.True(t, decimal.RequireFromString(want.running).Equal(line.RunningBalance), "line %d running %s", i, line.RunningBalance)
+		}
+
+		totals := map[model.TransactionType]model.StatementTotal{}
+		for _, total := range statement.Totals {
+			totals[total.Type] = total
+		}
+		require.Len(t, totals, 4)
+		assert.Equal(t, 2, totals[model.TransactionTypeTransfer].Count)
+		assert.True(t, decimal.RequireFromString("12.5").Equal(totals[model.TransactionTypeTransfer].Credit))
+		assert.True(t, decimal.NewFromInt(20).Equal(totals[model.TransactionTypeTransfer].Debit))
+		assert.True(t, decimal.NewFromInt(5).Equal(totals[model.TransactionTypeFee].Debit))
+
+		// 從開戶到現在, 期末餘額即帳戶餘額
+		whole := statementOf(t, storage, account.ID, time.Time{}, time.Now())
+		assert.True(t, whole.OpeningBalance.IsZero())
+		assert.True(t, decimal.RequireFromString("75.5").Equal(whole.ClosingBalance), whole.ClosingBalance.String())
+		assert.Len(t, whole.Lines, 8)
+
+		// 期間內沒有交易
+		empty := statementOf(t, storage, account.ID, time.Now(), time.Now().Add(time.Hour))
+		assert.Empty(t, empty.Lines)
+		assert.True(t, empty.OpeningBalance.Equal(empty.ClosingBalance))
+
+		_, _, err := storage.GetAccountHistory(999)
+		assert.ErrorIs(t, err, model.ErrAccountNotFound)
+	})
+}
+
+func TestStatementUnreconciled(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		account := &model.Account{Name: "broken", Balance: decimal.NewFromInt(100)}
+		require.NoError(t, storage.CreateAccount(account))
+		// 只寫交易紀錄不異動餘額, 交易推算的餘額與帳戶餘額不符
+		require.NoError(t, storage.AddTransaction(model.NewDeposit(account.ID, decimal.NewFromInt(1), "")))
+
+		current, history, err := storage.GetAccountHistory(account.ID)
+		require.NoError(t, err)
+		_, err = model.NewStatement(current, history, time.Time{}, time.Now())
+		assert.ErrorIs(t, err, model.ErrStatementUnreconciled)
+	})
+}
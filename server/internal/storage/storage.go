@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	DriverMemory = "memory"
+	DriverSQLite = "sqlite"
+)
+
+// Storage 存儲層介面
+// service只依賴這個介面, 實作可切換 memory / sqlite
+type Storage interface {
+	CreateAccount(account *model.Account) error
+	GetAccountByID(id uint64) (*model.Account, error)
+	// UpdateAccountStatus 帳戶狀態轉換(凍結/解凍/結清), 驗證與寫入為同一個原子操作
+	UpdateAccountStatus(id uint64, status model.AccountStatus, reason string) (*model.Account, error)
+	// SetOverdraftLimit 設定透支額度, 餘額最低可到 -limit
+	SetOverdraftLimit(id uint64, limit decimal.Decimal) (*model.Account, error)
+	// SetAccountLimits 設定帳戶等級與個別限額, tier空字串代表維持目前等級
+	SetAccountLimits(id uint64, tier string, limits *model.Limits) (*model.Account, error)
+
+	// Deposit / Withdraw / Transfer 餘額異動與交易紀錄為同一個原子操作, 不會只成功一半
+	// 成功後transaction.ID會被回填
+	Deposit(transaction *model.Transaction) error
+	Withdraw(transaction *model.Transaction) error
+	Transfer(transaction *model.Transaction) error
+	// TransferBatch 批次轉帳全部成功或全部不異動, 失敗時回傳*model.BatchError指出第幾筆
+	// 涉及的帳戶依ID順序鎖定, 與單筆Transfer併發不會deadlock
+	TransferBatch(transactions []*model.Transaction) error
+	// GetOverdraftEvents 餘額跨越0時與交易一起寫入的透支進出事件, 依交易順序
+	GetOverdraftEvents(accountID uint64) ([]model.OverdraftEvent, error)
+
+	// 預授權: 圈存降低可用餘額(Account.Held)但不影響帳上餘額, Withdraw / Transfer 以可用餘額檢查
+	// CreateHold 成功後hold.ID會被回填
+	CreateHold(hold *model.Hold) error
+	GetHold(id uint64) (*model.Hold, error)
+	GetHoldsByAccountID(accountID uint64) ([]*model.Hold, error)
+	// CaptureHold 依transaction.HoldID請款, 可部分請款, hold, 提款交易與transaction.Fee為同一個原子操作
+	CaptureHold(transaction *model.Transaction) (*model.Hold, error)
+	ReleaseHold(id uint64) (*model.Hold, error)
+	// ExpireHolds 將已過期的active hold標記為expired, 回傳本次標記的hold
+	ExpireHolds(now time.Time) ([]*model.Hold, error)
+
+	// Reverse 依transaction.ReversalOf沖正原交易, 可部分沖正, 累計沖正金額不超過原交易
+	// 扣款帳戶可用餘額不足時失敗, 餘額異動與沖正交易為同一個原子操作
+	Reverse(transaction *model.Transaction) (*model.Reversal, error)
+
+	// 定期轉帳: 只保存排程與執行紀錄, 轉帳本身由service經AccountService.Transfer執行
+	// CreateStandingOrder 成功後order.ID會被回填
+	CreateStandingOrder(order *model.StandingOrder) error
+	// GetStandingOrder 不存在回傳model.ErrStandingOrderNotFound
+	GetStandingOrder(id uint64) (*model.StandingOrder, error)
+	// GetStandingOrdersByAccountID 由accountID轉出的定期轉帳, 依建立順序
+	GetStandingOrdersByAccountID(accountID uint64) ([]*model.StandingOrder, error)
+	// UpdateStandingOrder 覆寫排程狀態, run不為nil時與執行紀錄一起寫入
+	UpdateStandingOrder(order *model.StandingOrder, run *model.StandingOrderRun) error
+	// DueStandingOrders now時該執行的active定期轉帳, 依NextRunAt排序
+	DueStandingOrders(now time.Time) ([]*model.StandingOrder, error)
+	// GetStandingOrderRuns 執行紀錄, 依執行順序
+	GetStandingOrderRuns(orderID uint64) ([]*model.StandingOrderRun, error)
+
+	// 計息: 產品利率與計息慣例由service依設定傳入, 帳戶只記錄產品名稱與計息進度
+	// SetAccountProduct 指定計息產品, 第一次指定時從當天開始計息
+	SetAccountProduct(id uint64, product string) (*model.Account, error)
+	// GetInterestBearingAccounts 有指定計息產品的帳戶, 依ID排序
+	GetInterestBearingAccounts() ([]*model.Account, error)
+	// AccrueInterest 從帳戶已計息日的隔天逐日計息到through(含), 月底將累計利息入帳
+	// 日終餘額推算、計息進度、計息紀錄與利息交易為同一個原子操作, 已計息過的日子不會重算
+	AccrueInterest(accountID uint64, product model.Product, through time.Time) ([]model.InterestAccrual, error)
+	// GetInterestAccruals 計息紀錄, 依日期
+	GetInterestAccruals(accountID uint64) ([]model.InterestAccrual, error)
+
+	// AddTransaction 只寫入交易紀錄, 不異動餘額
+	AddTransaction(transaction *model.Transaction) error
+	// GetTransactionsByAccountID / GetAllTransactions 依交易ID(入帳順序)遞增排序
+	GetTransactionsByAccountID(accountID uint64) ([]*model.Transaction, error)
+	GetAllTransactions() ([]*model.Transaction, error)
+	// GetAccountHistory 帳戶與它的所有交易(依入帳順序), 讀取期間帳戶不會有新的異動, 供對帳單推算餘額
+	GetAccountHistory(accountID uint64) (*model.Account, []*model.Transaction, error)
+	// GetTransactionByID 不存在回傳model.ErrTransactionNotFound
+	GetTransactionByID(id uint64) (*model.Transaction, error)
+	// GetTransactionByReference 依Transaction.Reference查詢, 不存在回傳model.ErrTransactionNotFound
+	// 入帳時reference重複回傳ErrDuplicateReference
+	GetTransactionByReference(reference string) (*model.Transaction, error)
+	// QueryTransactions 透過帳戶索引做cursor分頁
+	QueryTransactions(query model.TransactionQuery) (*model.TransactionPage, error)
+
+	// GetEntriesByTransactionID 交易對應的借貸分錄
+	GetEntriesByTransactionID(transactionID uint64) ([]model.LedgerEntry, error)
+	// TrialBalance 試算: 借貸總額相等, 且客戶帳戶餘額與分錄一致
+	TrialBalance() (*model.TrialBalance, error)
+
+	// 使用者: username唯一, 重複時回傳model.ErrUsernameTaken
+	// CreateUser 成功後user.ID會被回填
+	CreateUser(user *model.User) error
+	// GetUserByID / GetUserByUsername 不存在回傳model.ErrUserNotFound
+	GetUserByID(id uint64) (*model.User, error)
+	GetUserByUsername(username string) (*model.User, error)
+	// SetUserRole 變更角色, 不存在回傳model.ErrUserNotFound
+	SetUserRole(id uint64, role model.Role) (*model.User, error)
+
+	// Close 釋放底層資源(db connection etc.)
+	Close() error
+}
+
+var (
+	_ Storage = (*MemoryStorage)(nil)
+	_ Storage = (*SQLiteStorage)(nil)
+)
+
+// Options
+// Path: sqlite db檔案位置
+// Dir: memory的WAL與snapshot目錄, 空字串代表純記憶體不落地
+// SnapshotInterval: memory定期snapshot間隔, 0代表只在Close時snapshot
+type Options struct {
+	Path             string
+	Dir              string
+	SnapshotInterval time.Duration
+}
+
+// New 依照driver建立對應的storage
+// driver: memory, sqlite
+func New(driver string, opts Options) (Storage, error) {
+	switch driver {
+	case "", DriverMemory:
+		if opts.Dir == "" {
+			return NewMemoryStorage(), nil
+		}
+		return OpenMemoryStorage(opts.Dir, opts.SnapshotInterval)
+	case DriverSQLite:
+		return NewSQLiteStorage(opts.Path)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", driver)
+	}
+}
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// normalizeQuery 補上預設limit與排序方向
+func normalizeQuery(query model.TransactionQuery) model.TransactionQuery {
+	if query.Limit <= 0 {
+		query.Limit = DefaultPageLimit
+	}
+	if query.Limit > MaxPageLimit {
+		query.Limit = MaxPageLimit
+	}
+	if query.Direction != model.SortAsc {
+		query.Direction = model.SortDesc
+	}
+	return query
+}
+
+// newTransactionPage transactions多查一筆(limit+1)用來判斷是否有下一頁
+func newTransactionPage(transactions []*model.Transaction, limit int) *model.TransactionPage {
+	page := &model.TransactionPage{Transactions: transactions}
+	if page.Transactions == nil {
+		page.Transactions = []*model.Transaction{}
+	}
+	if len(page.Transactions) > limit {
+		page.Transactions = page.Transactions[:limit]
+		page.NextCursor = model.EncodeCursor(page.Transactions[limit-1].ID)
+	}
+	return page
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// storageBackends 所有Storage實作共用同一套行為測試(conformance suite)
+var storageBackends = []struct {
+	name string
+	new  func(t *testing.T) Storage
+}{
+	{
+		name: DriverMemory,
+		new: func(t *testing.T) Storage {
+			return NewMemoryStorage()
+		},
+	},
+	{
+		name: DriverMemory + "-wal",
+		new: func(t *testing.T) Storage {
+			s, err := OpenMemoryStorage(t.TempDir(), 0)
+			if err != nil {
+				t.Fatalf("failed to open memory storage: %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	},
+	{
+		name: DriverSQLite,
+		new: func(t *testing.T) Storage {
+			s, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "bank.db"))
+			if err != nil {
+				t.Fatalf("failed to open sqlite storage: %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	},
+}
+
+// forEachStorage 對每個backend各跑一次fn
+func forEachStorage(t *testing.T, fn func(t *testing.T, storage Storage)) {
+	for _, backend := range storageBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			fn(t, backend.new(t))
+		})
+	}
+}
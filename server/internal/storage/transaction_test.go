@@ -8,65 +8,117 @@ import (
 
 // 追加tx
 func TestAddTransaction(t *testing.T) {
-	storage := NewMemoryStorage()
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		transaction := model.NewDeposit(1, decimal.NewFromInt(100), "trace-123")
 
-	transaction := model.NewDeposit(1, decimal.NewFromInt(100), "trace-123")
-
-	err := storage.AddTransaction(transaction)
-	if err != nil {
-		t.Fatalf("Failed to add transaction: %v", err)
-	}
+		err := storage.AddTransaction(transaction)
+		if err != nil {
+			t.Fatalf("Failed to add transaction: %v", err)
+		}
 
-	if transaction.ID == 0 {
-		t.Error("Transaction ID should be assigned")
-	}
+		if transaction.ID == 0 {
+			t.Error("Transaction ID should be assigned")
+		}
 
-	if transaction.ID != 1 {
-		t.Errorf("Expected transaction ID 1, got %d", transaction.ID)
-	}
+		if transaction.ID != 1 {
+			t.Errorf("Expected transaction ID 1, got %d", transaction.ID)
+		}
+	})
 }
 
 // get tx
 func TestGetTransactionsByAccountID(t *testing.T) {
-	storage := NewMemoryStorage()
-
-	deposit := model.NewDeposit(1, decimal.NewFromInt(100), "trace-1")
-	withdraw := model.NewWithdraw(1, decimal.NewFromInt(50), "trace-2")
-	transfer1 := model.NewTransfer(1, 2, decimal.NewFromInt(25), "trace-3")
-	transfer2 := model.NewTransfer(2, 1, decimal.NewFromInt(10), "trace-4")
-	unrelated := model.NewDeposit(3, decimal.NewFromInt(200), "trace-5")
-
-	storage.AddTransaction(deposit)
-	storage.AddTransaction(withdraw)
-	storage.AddTransaction(transfer1)
-	storage.AddTransaction(transfer2)
-	storage.AddTransaction(unrelated)
-
-	transactions, err := storage.GetTransactionsByAccountID(1)
-	if err != nil {
-		t.Fatalf("Failed to get transactions: %v", err)
-	}
-
-	expectedCount := 4
-	if len(transactions) != expectedCount {
-		t.Errorf("Expected %d transactions for account 1, got %d", expectedCount, len(transactions))
-	}
-
-	foundTypes := make(map[model.TransactionType]int)
-	for _, transaction := range transactions {
-		foundTypes[transaction.Type]++
-
-		// 不包含id: 1  error
-		if transaction.ToAccountID != 1 &&
-			(transaction.FromAccountID == nil || *transaction.FromAccountID != 1) {
-			t.Errorf("Transaction %d should involve account 1", transaction.ID)
-		}
-	}
-
-	// 檢查type
-	if foundTypes[model.TransactionTypeDeposit] != 1 ||
-		foundTypes[model.TransactionTypeWithdraw] != 1 ||
-		foundTypes[model.TransactionTypeTransfer] != 2 {
-		t.Errorf("Unexpected transaction type distribution: %v", foundTypes)
-	}
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		deposit := model.NewDeposit(1, decimal.NewFromInt(100), "trace-1")
+		withdraw := model.NewWithdraw(1, decimal.NewFromInt(50), "trace-2")
+		transfer1 := model.NewTransfer(1, 2, decimal.NewFromInt(25), "trace-3")
+		transfer2 := model.NewTransfer(2, 1, decimal.NewFromInt(10), "trace-4")
+		unrelated := model.NewDeposit(3, decimal.NewFromInt(200), "trace-5")
+
+		storage.AddTransaction(deposit)
+		storage.AddTransaction(withdraw)
+		storage.AddTransaction(transfer1)
+		storage.AddTransaction(transfer2)
+		storage.AddTransaction(unrelated)
+
+		transactions, err := storage.GetTransactionsByAccountID(1)
+		if err != nil {
+			t.Fatalf("Failed to get transactions: %v", err)
+		}
+
+		expectedCount := 4
+		if len(transactions) != expectedCount {
+			t.Errorf("Expected %d transactions for account 1, got %d", expectedCount, len(transactions))
+		}
+
+		foundTypes := make(map[model.TransactionType]int)
+		for _, transaction := range transactions {
+			foundTypes[transaction.Type]++
+
+			// 不包含id: 1  error
+			if transaction.ToAccountID != 1 &&
+				(transaction.FromAccountID == nil || *transaction.FromAccountID != 1) {
+				t.Errorf("Transaction %d should involve account 1", transaction.ID)
+			}
+		}
+
+		// 檢查type
+		if foundTypes[model.TransactionTypeDeposit] != 1 ||
+			foundTypes[model.TransactionTypeWithdraw] != 1 ||
+			foundTypes[model.TransactionTypeTransfer] != 2 {
+			t.Errorf("Unexpected transaction type distribution: %v", foundTypes)
+		}
+	})
+}
+
+// 存提轉成功才會有紀錄, 失敗不留紀錄
+func TestOperationsRecordTransaction(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		from := &model.Account{Name: "from", Balance: decimal.NewFromInt(100)}
+		to := &model.Account{Name: "to", Balance: decimal.Zero}
+		storage.CreateAccount(from)
+		storage.CreateAccount(to)
+
+		deposit := model.NewDeposit(from.ID, decimal.NewFromInt(50), "trace-1")
+		if err := storage.Deposit(deposit); err != nil {
+			t.Fatalf("Failed to deposit: %v", err)
+		}
+		withdraw := model.NewWithdraw(from.ID, decimal.NewFromInt(30), "trace-2")
+		if err := storage.Withdraw(withdraw); err != nil {
+			t.Fatalf("Failed to withdraw: %v", err)
+		}
+		transfer := model.NewTransfer(from.ID, to.ID, decimal.NewFromInt(20), "trace-3")
+		if err := storage.Transfer(transfer); err != nil {
+			t.Fatalf("Failed to transfer: %v", err)
+		}
+
+		if deposit.ID == 0 || withdraw.ID == 0 || transfer.ID == 0 {
+			t.Errorf("Transaction IDs should be assigned: %d %d %d", deposit.ID, withdraw.ID, transfer.ID)
+		}
+
+		// 失敗的操作
+		if err := storage.Withdraw(model.NewWithdraw(from.ID, decimal.NewFromInt(1000), "trace-4")); err == nil {
+			t.Error("Expected insufficient balance error")
+		}
+		if err := storage.Transfer(model.NewTransfer(from.ID, 999, decimal.NewFromInt(1), "trace-5")); err == nil {
+			t.Error("Expected destination account not found error")
+		}
+		if err := storage.Deposit(model.NewDeposit(999, decimal.NewFromInt(1), "trace-6")); err == nil {
+			t.Error("Expected account not found error")
+		}
+
+		transactions, err := storage.GetAllTransactions()
+		if err != nil {
+			t.Fatalf("Failed to get transactions: %v", err)
+		}
+		// opening balance + 存 + 提 + 轉
+		if len(transactions) != 4 {
+			t.Fatalf("Expected 4 transactions, got %d", len(transactions))
+		}
+
+		toTransactions, _ := storage.GetTransactionsByAccountID(to.ID)
+		if len(toTransactions) != 1 || toTransactions[0].TraceID != "trace-3" {
+			t.Errorf("Expected only the transfer for destination account, got %v", toTransactions)
+		}
+	})
 }
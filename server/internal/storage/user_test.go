@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsers(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s Storage) {
+		alice := &model.User{Username: "alice", Role: model.RoleCustomer, PasswordHash: "hash-a"}
+		require.NoError(t, s.CreateUser(alice))
+		assert.Equal(t, uint64(1), alice.ID)
+		assert.False(t, alice.CreatedAt.IsZero())
+
+		bob := &model.User{Username: "bob", Role: model.RoleCustomer, PasswordHash: "hash-b"}
+		require.NoError(t, s.CreateUser(bob))
+		assert.Equal(t, uint64(2), bob.ID)
+
+		err := s.CreateUser(&model.User{Username: "alice", PasswordHash: "other"})
+		assert.ErrorIs(t, err, model.ErrUsernameTaken)
+
+		user, err := s.GetUserByUsername("alice")
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, user.ID)
+		assert.Equal(t, "hash-a", user.PasswordHash)
+		assert.Equal(t, model.RoleCustomer, user.Role)
+		user, err = s.GetUserByID(bob.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "bob", user.Username)
+
+		_, err = s.GetUserByUsername("carol")
+		assert.ErrorIs(t, err, model.ErrUserNotFound)
+		_, err = s.GetUserByID(99)
+		assert.ErrorIs(t, err, model.ErrUserNotFound)
+
+		user, err = s.SetUserRole(bob.ID, model.RoleTeller)
+		require.NoError(t, err)
+		assert.Equal(t, model.RoleTeller, user.Role)
+		user, err = s.GetUserByUsername("bob")
+		require.NoError(t, err)
+		assert.Equal(t, model.RoleTeller, user.Role)
+		assert.Equal(t, "hash-b", user.PasswordHash)
+		_, err = s.SetUserRole(99, model.RoleAdmin)
+		assert.ErrorIs(t, err, model.ErrUserNotFound)
+
+		// 帳戶持有人隨帳戶保存
+		account := &model.Account{Name: "alice", OwnerID: alice.ID, Balance: decimal.NewFromInt(10)}
+		require.NoError(t, s.CreateAccount(account))
+		account, err = s.GetAccountByID(account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, account.OwnerID)
+	})
+}
+
+func TestMemoryStorageRecoversUsers(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateUser(&model.User{Username: "alice", PasswordHash: "hash-a"}))
+	require.NoError(t, s.Snapshot())
+	require.NoError(t, s.CreateUser(&model.User{Username: "bob", PasswordHash: "hash-b"}))
+	_, err = s.SetUserRole(1, model.RoleAdmin)
+	require.NoError(t, err)
+	crash(t, s)
+
+	// alice由snapshot載入, bob與角色變更由WAL重放
+	recovered, err := OpenMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	defer recovered.Close()
+	for id, username := range map[uint64]string{1: "alice", 2: "bob"} {
+		user, err := recovered.GetUserByUsername(username)
+		require.NoError(t, err)
+		assert.Equal(t, id, user.ID)
+	}
+	alice, err := recovered.GetUserByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, model.RoleAdmin, alice.Role)
+	carol := &model.User{Username: "carol", PasswordHash: "hash-c"}
+	require.NoError(t, recovered.CreateUser(carol))
+	assert.Equal(t, uint64(3), carol.ID)
+}
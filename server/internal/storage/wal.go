@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/kokp520/banking-system/server/internal/model"
+)
+
+// walOp MemoryStorage的異動種類
+type walOp string
+
+const (
+	walOpCreateAccount walOp = "create_account" // 開戶, 可能帶opening balance交易
+	walOpUpdateAccount walOp = "update_account" // 只異動帳戶, e.g. 狀態變更
+	walOpPost          walOp = "post"           // 存提轉, 交易+分錄+異動後的帳戶
+	walOpRecord        walOp = "record"         // AddTransaction, 只有交易紀錄
+	walOpHold          walOp = "hold"           // 預授權建立/解除/逾期, 只異動hold
+	walOpBatch         walOp = "batch"          // 批次轉帳, 多筆交易與異動後的帳戶一起套用
+	walOpStandingOrder walOp = "standing_order" // 定期轉帳建立/狀態異動, 可能帶一筆執行紀錄
+	walOpInterest      walOp = "interest"       // 計息, 計息紀錄+月底利息交易(Batch)+異動後的帳戶
+	walOpUser          walOp = "user"           // 新增使用者或變更角色
+	walOpIdempotency   walOp = "idempotency"    // Idempotency-Key佔用/完成(Idempotency)或放棄(ReleasedKeys)
+)
+
+// walRecord 一筆異動
+// Accounts / Holds / StandingOrders為異動後的完整狀態, 重放時直接覆蓋, 不重新計算餘額
+type walRecord struct {
+	LSN            uint64
+	Op             walOp
+	Accounts       []model.Account
+	Holds          []model.Hold
+	Transaction    *model.Transaction
+	Batch          []*model.Transaction
+	StandingOrders []model.StandingOrder
+	Runs           []model.StandingOrderRun
+	Accruals       []model.InterestAccrual
+	Users          []model.User
+	Idempotency    []model.IdempotencyRecord
+	// ReleasedKeys 只用Scope與Key
+	ReleasedKeys []model.IdempotencyRecord
+}
+
+// WAL檔案格式, 每筆紀錄:
+// [4 bytes payload長度][4 bytes payload CRC32-C][4 bytes header CRC32-C][payload(gob)]
+// header CRC涵蓋前8 bytes, 長度損毀時不會被誤判成寫到一半的payload; 皆為big endian
+const walHeaderSize = 12
+
+var walChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrWALCorrupted 紀錄損毀且不在檔尾, 不是寫到一半的crash能解釋的狀況
+var ErrWALCorrupted = errors.New("wal corrupted")
+
+// writeAheadLog append-only的異動紀錄, 每筆寫入後fsync
+// 呼叫端負責序列化寫入(MemoryStorage在transactionMutex內append)
+type writeAheadLog struct {
+	file *os.File
+	size int64  // 最後一筆完整紀錄的結尾
+	lsn  uint64 // 最後一筆紀錄的LSN
+	err  error  // 寫入失敗且無法回復到紀錄邊界時, 之後拒絕所有寫入
+}
+
+// openWAL 開啟WAL並重放LSN大於after的紀錄
+// 檔尾不完整或最後一筆payload checksum錯誤的紀錄(寫到一半crash)會被截斷
+func openWAL(path string, after uint64, replay func(walRecord)) (*writeAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &writeAheadLog{file: file, lsn: after}
+	if err := w.recover(after, replay); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *writeAheadLog) recover(after uint64, replay func(walRecord)) error {
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+
+	reader := io.NewSectionReader(w.file, 0, fileSize)
+	header := make([]byte, walHeaderSize)
+	var offset int64
+	for offset < fileSize {
+		if _, err := reader.ReadAt(header, offset); err != nil {
+			// header寫到一半
+			break
+		}
+		if crc32.Checksum(header[0:8], walChecksumTable) != binary.BigEndian.Uint32(header[8:12]) {
+			// header已完整寫入, 長度不可信時無法判斷後面是否還有紀錄
+			return fmt.Errorf("%w: header checksum mismatch at offset %d", ErrWALCorrupted, offset)
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		checksum := binary.BigEndian.Uint32(header[4:8])
+		end := offset + walHeaderSize + length
+		if end > fileSize {
+			// 長度已由header CRC確認, payload寫到一半
+			break
+		}
+
+		payload := make([]byte, length)
+		if _, err := reader.ReadAt(payload, offset+walHeaderSize); err != nil {
+			return err
+		}
+		if crc32.Checksum(payload, walChecksumTable) != checksum {
+			if end == fileSize {
+				// 最後一筆checksum不符, 視為寫到一半
+				break
+			}
+			return fmt.Errorf("%w: checksum mismatch at offset %d", ErrWALCorrupted, offset)
+		}
+
+		var record walRecord
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+			return fmt.Errorf("%w: decode record at offset %d: %v", ErrWALCorrupted, offset, err)
+		}
+		if record.LSN > after {
+			replay(record)
+			w.lsn = record.LSN
+		}
+		offset = end
+	}
+
+	if offset < fileSize {
+		if err := w.file.Truncate(offset); err != nil {
+			return err
+		}
+		if err := w.file.Sync(); err != nil {
+			return err
+		}
+	}
+	w.size = offset
+	_, err = w.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// append 寫入一筆紀錄並fsync, 回傳前紀錄已落地
+// 失敗時截回寫入前的位置, 記憶體狀態不應套用這筆異動
+func (w *writeAheadLog) append(record *walRecord) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	record.LSN = w.lsn + 1
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(record); err != nil {
+		return err
+	}
+
+	buf := make([]byte, walHeaderSize, walHeaderSize+payload.Len())
+	binary.BigEndian.PutUint32(buf[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload.Bytes(), walChecksumTable))
+	binary.BigEndian.PutUint32(buf[8:12], crc32.Checksum(buf[0:8], walChecksumTable))
+	buf = append(buf, payload.Bytes()...)
+
+	if _, err := w.file.Write(buf); err != nil {
+		return w.rollback(err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return w.rollback(err)
+	}
+
+	w.size += int64(len(buf))
+	w.lsn = record.LSN
+	return nil
+}
+
+// rollback 截掉寫到一半的紀錄, 截不掉時WAL進入錯誤狀態
+func (w *writeAheadLog) rollback(cause error) error {
+	if err := w.file.Truncate(w.size); err != nil {
+		w.err = fmt.Errorf("wal unusable after failed write: %v", cause)
+		return w.err
+	}
+	if _, err := w.file.Seek(w.size, io.SeekStart); err != nil {
+		w.err = fmt.Errorf("wal unusable after failed write: %v", cause)
+		return w.err
+	}
+	return cause
+}
+
+// reset snapshot落地後清空WAL, LSN延續
+func (w *writeAheadLog) reset() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.size = 0
+	return w.file.Sync()
+}
+
+func (w *writeAheadLog) close() error {
+	return w.file.Close()
+}
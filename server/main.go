@@ -1,19 +1,27 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/auth"
 	"github.com/kokp520/banking-system/server/internal/middleware"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/router"
 	"github.com/kokp520/banking-system/server/internal/storage"
 
 	"github.com/kokp520/banking-system/server/internal/handler"
 	"github.com/kokp520/banking-system/server/internal/service"
 	"github.com/kokp520/banking-system/server/pkg/config"
 	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/shopspring/decimal"
 
 	swaggerFiles "github.com/swaggo/files"     // swagger embed files
 	ginSwagger "github.com/swaggo/gin-swagger" // gin-swagger middleware
@@ -54,7 +62,7 @@ func main() {
 }
 
 // 可擴充性說明：
-// middleware：jwt、rate limit、cors etc.
+// middleware：rate limit、cors etc.
 // 依賴注入：DI, todo: unit test and integration test
 // restful api 原則
 func initRouter() *gin.Engine {
@@ -70,26 +78,286 @@ func initRouter() *gin.Engine {
 		})
 	})
 
-	memoryStorage := storage.NewMemoryStorage()
-	accountService := service.NewAccountService(memoryStorage)
+	store, err := storage.New(cfg.Storage.Driver, storage.Options{
+		Path:             cfg.Storage.Path,
+		Dir:              cfg.Storage.Dir,
+		SnapshotInterval: time.Duration(cfg.Storage.SnapshotInterval) * time.Second,
+	})
+	if err != nil {
+		log.Fatal("failed to init storage", err)
+	}
+	fxService, err := newFXService()
+	if err != nil {
+		log.Fatal("failed to init fx", err)
+	}
+	limitService, err := newLimitService(store)
+	if err != nil {
+		log.Fatal("failed to init limits", err)
+	}
+	feeService, err := newFeeService(store)
+	if err != nil {
+		log.Fatal("failed to init fees", err)
+	}
+	accountService := service.NewAccountService(store, service.WithFX(fxService), service.WithLimits(limitService), service.WithFees(feeService))
 	accountHandler := handler.NewAccountHandler(accountService)
+	ledgerHandler := handler.NewLedgerHandler(service.NewLedgerService(store))
+	fxHandler := handler.NewFXHandler(fxService)
+	limitHandler := handler.NewLimitHandler(limitService)
+	feeHandler := handler.NewFeeHandler(feeService)
+	statementHandler := handler.NewStatementHandler(service.NewStatementService(store, cfg.Statement.BIC))
+	reversalHandler := handler.NewReversalHandler(service.NewReversalService(store))
 
-	v1 := r.Group("/v1")
-	{
-		account := v1.Group("/account")
-		{
-			account.POST("", accountHandler.CreateAccount)
-			account.GET("/:id", accountHandler.GetAccount)
-			account.POST("/:id/deposit", accountHandler.Deposit)
-			account.POST("/:id/withdraw", accountHandler.Withdraw)
-			account.POST("/:id/transfer", accountHandler.Transfer)
-			account.GET("/:id/transactions", accountHandler.GetTransactions)
-		}
+	holdService := service.NewHoldService(store, time.Duration(cfg.Holds.DefaultTTL)*time.Second, service.WithHoldLimits(limitService), service.WithHoldFees(feeService))
+	holdHandler := handler.NewHoldHandler(holdService)
+	// 逾期的圈存到期即不計入可用餘額, 背景只負責把狀態標記為expired
+	if cfg.Holds.ExpiryInterval > 0 {
+		go holdService.RunExpiry(context.Background(), time.Duration(cfg.Holds.ExpiryInterval)*time.Second)
 	}
 
+	standingOrderService := service.NewStandingOrderService(store, accountService, model.RetryPolicy{
+		MaxRetries:      cfg.Scheduler.MaxRetries,
+		IntervalSeconds: cfg.Scheduler.RetryInterval,
+	})
+	standingOrderHandler := handler.NewStandingOrderHandler(standingOrderService)
+	if cfg.Scheduler.Interval > 0 {
+		go standingOrderService.RunScheduler(context.Background(), time.Duration(cfg.Scheduler.Interval)*time.Second)
+	}
+
+	interestService, err := newInterestService(store)
+	if err != nil {
+		log.Fatal("failed to init interest", err)
+	}
+	interestHandler := handler.NewInterestHandler(interestService)
+	if cfg.Interest.Interval > 0 {
+		go interestService.RunAccrualJob(context.Background(), time.Duration(cfg.Interest.Interval)*time.Second)
+	}
+
+	// 重試不會重複扣款, 帶Idempotency-Key的請求只執行一次
+	idempotencyStore := storage.NewIdempotencyStore(store)
+	idempotency := middleware.Idempotency(idempotencyStore, time.Duration(cfg.Idempotency.TTL)*time.Second)
+
+	// pain.001以MsgId防止重複匯入, 與Idempotency-Key共用同一個store
+	paymentHandler := handler.NewPaymentHandler(service.NewPaymentImportService(accountService, idempotencyStore,
+		time.Duration(cfg.Payments.DuplicateWindow)*time.Second, cfg.Statement.BIC))
+
+	jwt, err := newJWT()
+	if err != nil {
+		log.Fatal("failed to init auth", err)
+	}
+	userService := service.NewUserService(store, jwt)
+	if err := ensureAdmin(userService); err != nil {
+		log.Fatal("failed to create bootstrap admin", err)
+	}
+	userHandler := handler.NewUserHandler(userService)
+
+	router.RegisterV1(r, router.Handlers{
+		Account:       accountHandler,
+		Ledger:        ledgerHandler,
+		FX:            fxHandler,
+		Limit:         limitHandler,
+		Fee:           feeHandler,
+		Statement:     statementHandler,
+		Reversal:      reversalHandler,
+		Hold:          holdHandler,
+		StandingOrder: standingOrderHandler,
+		Interest:      interestHandler,
+		Payment:       paymentHandler,
+		User:          userHandler,
+	}, middleware.Auth(jwt, store), idempotency)
+
 	// Swagger UI
 	r.Static("/api", "./api")
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL(cfg.Swagger.ApiPath)))
 
 	return r
 }
+
+// ensureAdmin 依設定建立初始admin, 沒有設定密碼時略過
+func ensureAdmin(userService *service.UserService) error {
+	admin := cfg.Auth.BootstrapAdmin
+	password := admin.Password
+	if admin.PasswordEnv != "" {
+		password = os.Getenv(admin.PasswordEnv)
+	}
+	if password == "" {
+		return nil
+	}
+	return userService.EnsureAdmin(context.Background(), admin.Username, password)
+}
+
+// newFXService 依設定建立匯率服務, 有設定rates_file時啟動即載入
+func newFXService() (*service.FXService, error) {
+	rounding, err := model.ParseRoundingPolicy(cfg.FX.Rounding)
+	if err != nil {
+		return nil, err
+	}
+	fxService := service.NewFXService(service.FXConfig{
+		Spread:   decimal.New(cfg.FX.SpreadBps, -4),
+		QuoteTTL: time.Duration(cfg.FX.QuoteTTL) * time.Second,
+		Rounding: rounding,
+	})
+	if cfg.FX.RatesFile != "" {
+		if err := fxService.LoadRatesFile(context.Background(), cfg.FX.RatesFile); err != nil {
+			return nil, err
+		}
+	}
+	return fxService, nil
+}
+
+// newJWT 依設定載入簽章金鑰, active_key以外的金鑰只用來驗證輪替前簽發的token
+func newJWT() (*auth.JWT, error) {
+	keys := make([]auth.Key, 0, len(cfg.Auth.Keys))
+	for _, keyConfig := range cfg.Auth.Keys {
+		key := auth.Key{ID: keyConfig.ID, Algorithm: strings.ToUpper(keyConfig.Algorithm)}
+		switch {
+		case keyConfig.SecretEnv != "":
+			secret := os.Getenv(keyConfig.SecretEnv)
+			if secret == "" {
+				return nil, fmt.Errorf("jwt key %s: environment variable %s is not set", keyConfig.ID, keyConfig.SecretEnv)
+			}
+			key.Secret = []byte(secret)
+		case keyConfig.Secret != "":
+			key.Secret = []byte(keyConfig.Secret)
+		}
+		if keyConfig.PrivateKeyFile != "" {
+			data, err := os.ReadFile(keyConfig.PrivateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("jwt key %s: %w", keyConfig.ID, err)
+			}
+			if key.PrivateKey, err = auth.ParseRSAPrivateKey(data); err != nil {
+				return nil, fmt.Errorf("jwt key %s: %w", keyConfig.ID, err)
+			}
+		}
+		if keyConfig.PublicKeyFile != "" {
+			data, err := os.ReadFile(keyConfig.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("jwt key %s: %w", keyConfig.ID, err)
+			}
+			if key.PublicKey, err = auth.ParseRSAPublicKey(data); err != nil {
+				return nil, fmt.Errorf("jwt key %s: %w", keyConfig.ID, err)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return auth.NewJWT(auth.JWTConfig{
+		Keys:      keys,
+		ActiveKey: cfg.Auth.ActiveKey,
+		Issuer:    cfg.Auth.Issuer,
+		TTL:       time.Duration(cfg.Auth.TokenTTL) * time.Second,
+	})
+}
+
+// newLimitService 依設定建立各等級的限額
+func newLimitService(store storage.Storage) (*service.LimitService, error) {
+	tiers := make(map[string]model.Limits, len(cfg.Limits.Tiers))
+	for name, tier := range cfg.Limits.Tiers {
+		var limits model.Limits
+		for _, field := range []struct {
+			value string
+			dest  **decimal.Decimal
+		}{
+			{tier.PerTransaction, &limits.PerTransaction},
+			{tier.DailyAmount, &limits.DailyAmount},
+		} {
+			if field.value == "" {
+				continue
+			}
+			amount, err := decimal.NewFromString(field.value)
+			if err != nil {
+				return nil, fmt.Errorf("limits tier %s: %w", name, err)
+			}
+			if amount.IsPositive() {
+				*field.dest = &amount
+			}
+		}
+		if tier.DailyCount > 0 {
+			count := tier.DailyCount
+			limits.DailyCount = &count
+		}
+		tiers[name] = limits
+	}
+	return service.NewLimitService(store, service.LimitConfig{
+		Window: time.Duration(cfg.Limits.Window) * time.Second,
+		Tiers:  tiers,
+	}), nil
+}
+
+// newInterestService 依設定建立計息產品
+func newInterestService(store storage.Storage) (*service.InterestService, error) {
+	products := make(map[string]model.Product, len(cfg.Interest.Products))
+	for name, product := range cfg.Interest.Products {
+		rate, err := decimal.NewFromString(product.Rate)
+		if err != nil {
+			return nil, fmt.Errorf("interest product %s: %w", name, err)
+		}
+		products[name] = model.Product{Name: name, Rate: rate, DayCount: model.DayCount(strings.ToUpper(product.DayCount))}
+		if err := products[name].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return service.NewInterestService(store, products), nil
+}
+
+// newFeeService 依設定建立各操作的手續費
+func newFeeService(store storage.Storage) (*service.FeeService, error) {
+	schedules := make([]model.FeeSchedule, 0, len(cfg.Fees))
+	for operation, fee := range cfg.Fees {
+		schedule := model.FeeSchedule{
+			Operation: model.TransactionType(strings.ToLower(operation)),
+			Type:      model.FeeType(strings.ToLower(fee.Type)),
+		}
+		var err error
+		if schedule.Amount, err = parseFeeAmount(fee.Amount); err != nil {
+			return nil, fmt.Errorf("fees %s amount: %w", operation, err)
+		}
+		if schedule.Rate, err = parseFeeAmount(fee.Rate); err != nil {
+			return nil, fmt.Errorf("fees %s rate: %w", operation, err)
+		}
+		for _, field := range []struct {
+			value string
+			dest  **decimal.Decimal
+		}{
+			{fee.Min, &schedule.Min},
+			{fee.Max, &schedule.Max},
+		} {
+			if field.value == "" {
+				continue
+			}
+			amount, err := decimal.NewFromString(field.value)
+			if err != nil {
+				return nil, fmt.Errorf("fees %s: %w", operation, err)
+			}
+			*field.dest = &amount
+		}
+		for _, tierConfig := range fee.Tiers {
+			var tier model.FeeTier
+			if tierConfig.UpTo != "" {
+				upTo, err := decimal.NewFromString(tierConfig.UpTo)
+				if err != nil {
+					return nil, fmt.Errorf("fees %s tier: %w", operation, err)
+				}
+				tier.UpTo = &upTo
+			}
+			if tier.Amount, err = parseFeeAmount(tierConfig.Amount); err != nil {
+				return nil, fmt.Errorf("fees %s tier: %w", operation, err)
+			}
+			if tier.Rate, err = parseFeeAmount(tierConfig.Rate); err != nil {
+				return nil, fmt.Errorf("fees %s tier: %w", operation, err)
+			}
+			schedule.Tiers = append(schedule.Tiers, tier)
+		}
+		if err := schedule.Validate(); err != nil {
+			return nil, fmt.Errorf("fees %s: %w", operation, err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return service.NewFeeService(store, schedules), nil
+}
+
+// parseFeeAmount 空字串為0
+func parseFeeAmount(value string) (decimal.Decimal, error) {
+	if value == "" {
+		return decimal.Zero, nil
+	}
+	return decimal.NewFromString(value)
+}
@@ -5,9 +5,20 @@ import (
 )
 
 type Config struct {
-	Server  ServerConfig  `mapstructure:"server"`
-	Logger  LoggerConfig  `mapstructure:"logger"`
-	Swagger SwaggerConfig `mapstructure:"swagger"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Logger      LoggerConfig      `mapstructure:"logger"`
+	Swagger     SwaggerConfig     `mapstructure:"swagger"`
+	Storage     StorageConfig     `mapstructure:"storage"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	FX          FXConfig          `mapstructure:"fx"`
+	Holds       HoldsConfig       `mapstructure:"holds"`
+	Limits      LimitsConfig      `mapstructure:"limits"`
+	Scheduler   SchedulerConfig   `mapstructure:"scheduler"`
+	Interest    InterestConfig    `mapstructure:"interest"`
+	Fees        FeesConfig        `mapstructure:"fees"`
+	Statement   StatementConfig   `mapstructure:"statement"`
+	Payments    PaymentsConfig    `mapstructure:"payments"`
+	Auth        AuthConfig        `mapstructure:"auth"`
 }
 
 type ServerConfig struct {
@@ -28,6 +39,149 @@ type SwaggerConfig struct {
 	ApiPath string `mapstructure:"api_path"`
 }
 
+// StorageConfig
+// driver: memory, sqlite
+// path: sqlite db檔案位置
+// dir: memory的WAL與snapshot目錄, 空字串代表不落地
+// snapshot_interval: memory定期snapshot秒數
+type StorageConfig struct {
+	Driver           string `mapstructure:"driver"`
+	Path             string `mapstructure:"path"`
+	Dir              string `mapstructure:"dir"`
+	SnapshotInterval int    `mapstructure:"snapshot_interval"`
+}
+
+// IdempotencyConfig
+// ttl: Idempotency-Key保存秒數
+type IdempotencyConfig struct {
+	TTL int `mapstructure:"ttl"`
+}
+
+// FXConfig
+// rates_file: 啟動時載入的匯率表(JSON), 空字串代表只由管理API設定
+// spread_bps: 成交匯率相對中間價的價差, 1bps = 0.01%
+// quote_ttl: 報價有效秒數
+// rounding: 轉入金額捨入方式 down | half_up | half_even
+type FXConfig struct {
+	RatesFile string `mapstructure:"rates_file"`
+	SpreadBps int64  `mapstructure:"spread_bps"`
+	QuoteTTL  int    `mapstructure:"quote_ttl"`
+	Rounding  string `mapstructure:"rounding"`
+}
+
+// HoldsConfig
+// default_ttl: 預授權未指定到期時間時的保留秒數
+// expiry_interval: 標記逾期預授權的間隔秒數
+type HoldsConfig struct {
+	DefaultTTL     int `mapstructure:"default_ttl"`
+	ExpiryInterval int `mapstructure:"expiry_interval"`
+}
+
+// LimitsConfig 提款與轉出限額
+// window: 累計金額與筆數的滾動視窗秒數
+// tiers: 各帳戶等級的限額, 未指定等級的帳戶用standard
+type LimitsConfig struct {
+	Window int                        `mapstructure:"window"`
+	Tiers  map[string]LimitTierConfig `mapstructure:"tiers"`
+}
+
+// LimitTierConfig 金額為帳戶幣別, 空字串或0代表不限制
+type LimitTierConfig struct {
+	PerTransaction string `mapstructure:"per_transaction"`
+	DailyAmount    string `mapstructure:"daily_amount"`
+	DailyCount     int    `mapstructure:"daily_count"`
+}
+
+// SchedulerConfig
+// interval: 檢查到期定期轉帳的間隔秒數, 0代表不啟動背景排程
+// max_retries / retry_interval: 未指定重試規則的定期轉帳, 可重試失敗的重試次數與間隔秒數
+type SchedulerConfig struct {
+	Interval      int `mapstructure:"interval"`
+	MaxRetries    int `mapstructure:"max_retries"`
+	RetryInterval int `mapstructure:"retry_interval"`
+}
+
+// InterestConfig
+// interval: 檢查是否有未計息日子的間隔秒數, 0代表不啟動背景計息
+// products: 可指定給帳戶的計息產品
+type InterestConfig struct {
+	Interval int                              `mapstructure:"interval"`
+	Products map[string]InterestProductConfig `mapstructure:"products"`
+}
+
+// InterestProductConfig rate為年利率(0.015代表1.5%), day_count: ACT/365 | ACT/360 | 30/360
+type InterestProductConfig struct {
+	Rate     string `mapstructure:"rate"`
+	DayCount string `mapstructure:"day_count"`
+}
+
+// FeesConfig 提款與轉帳手續費, key為操作: withdraw | transfer, 未設定的操作不收費
+type FeesConfig map[string]FeeConfig
+
+// FeeConfig 金額為帳戶幣別, rate為費率(0.001代表0.1%)
+// type: flat(amount) | percentage(rate) | tiered(tiers)
+// min/max: 手續費上下限, 空字串代表不限制
+type FeeConfig struct {
+	Type   string          `mapstructure:"type"`
+	Amount string          `mapstructure:"amount"`
+	Rate   string          `mapstructure:"rate"`
+	Tiers  []FeeTierConfig `mapstructure:"tiers"`
+	Min    string          `mapstructure:"min"`
+	Max    string          `mapstructure:"max"`
+}
+
+// FeeTierConfig up_to為級距上限(含), 空字串代表沒有上限, 只能是最後一級
+type FeeTierConfig struct {
+	UpTo   string `mapstructure:"up_to"`
+	Amount string `mapstructure:"amount"`
+	Rate   string `mapstructure:"rate"`
+}
+
+// StatementConfig
+// bic: 匯出對帳單的銀行代碼, OFX的BANKID與camt.053的帳戶服務機構
+type StatementConfig struct {
+	BIC string `mapstructure:"bic"`
+}
+
+// PaymentsConfig
+// duplicate_window: pain.001的MsgId在這段秒數內不能重複匯入
+type PaymentsConfig struct {
+	DuplicateWindow int `mapstructure:"duplicate_window"`
+}
+
+// AuthConfig access token設定
+// issuer: token的iss
+// token_ttl: access token有效秒數
+// active_key: 簽發新token的金鑰id, 其他金鑰只用來驗證輪替前簽發的token
+// bootstrap_admin: 啟動時建立的初始admin, 其他角色由admin指派
+type AuthConfig struct {
+	Issuer         string               `mapstructure:"issuer"`
+	TokenTTL       int                  `mapstructure:"token_ttl"`
+	ActiveKey      string               `mapstructure:"active_key"`
+	Keys           []JWTKeyConfig       `mapstructure:"keys"`
+	BootstrapAdmin BootstrapAdminConfig `mapstructure:"bootstrap_admin"`
+}
+
+// BootstrapAdminConfig password或password_env(從環境變數讀取)為空時不建立
+// 使用者已存在時不變更其角色與密碼
+type BootstrapAdminConfig struct {
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password"`
+	PasswordEnv string `mapstructure:"password_env"`
+}
+
+// JWTKeyConfig algorithm: HS256 | RS256
+// HS256: secret或secret_env(從環境變數讀取), 至少32 bytes
+// RS256: private_key_file(PEM, 可簽章), 只驗證的舊金鑰可以只給public_key_file
+type JWTKeyConfig struct {
+	ID             string `mapstructure:"id"`
+	Algorithm      string `mapstructure:"algorithm"`
+	Secret         string `mapstructure:"secret"`
+	SecretEnv      string `mapstructure:"secret_env"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+}
+
 func Setup(f string) (*Config, error) {
 	viper.SetConfigName(f)
 	viper.SetConfigType("yaml")
@@ -46,6 +200,33 @@ func Setup(f string) (*Config, error) {
 
 	viper.SetDefault("swagger.api_path", "/api/api.yaml")
 
+	viper.SetDefault("storage.driver", "memory")
+	viper.SetDefault("storage.path", "data/bank.db")
+	viper.SetDefault("storage.dir", "")
+	viper.SetDefault("storage.snapshot_interval", 300)
+
+	viper.SetDefault("idempotency.ttl", 86400)
+
+	viper.SetDefault("fx.rates_file", "")
+	viper.SetDefault("fx.spread_bps", 25)
+	viper.SetDefault("fx.quote_ttl", 30)
+	viper.SetDefault("fx.rounding", "down")
+
+	viper.SetDefault("holds.default_ttl", 604800)
+	viper.SetDefault("holds.expiry_interval", 60)
+
+	viper.SetDefault("limits.window", 86400)
+
+	viper.SetDefault("scheduler.interval", 60)
+	viper.SetDefault("scheduler.max_retries", 3)
+	viper.SetDefault("scheduler.retry_interval", 3600)
+
+	viper.SetDefault("interest.interval", 3600)
+
+	viper.SetDefault("auth.issuer", "banking-system")
+	viper.SetDefault("auth.token_ttl", 3600)
+	viper.SetDefault("auth.bootstrap_admin.username", "admin")
+
 	if err := viper.ReadInConfig(); err != nil {
 		// 用viper內部的Error defind
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -13,29 +13,67 @@ type Response struct {
 }
 
 const (
-	CodeSuccess         = 200
-	InvalidParams       = 400
-	Unauthorized        = 401
-	Forbidden           = 403
-	NotFound            = 404
-	ServerError         = 500
-	UnknownError        = 1000
-	InsufficientBalance = 1001
-	AccountNotFound     = 1002
-	InvalidAmount       = 1003
+	CodeSuccess            = 200
+	InvalidParams          = 400
+	Unauthorized           = 401
+	Forbidden              = 403
+	NotFound               = 404
+	ServerError            = 500
+	UnknownError           = 1000
+	InsufficientBalance    = 1001
+	AccountNotFound        = 1002
+	InvalidAmount          = 1003
+	IdempotencyMismatch    = 1004
+	RequestInProgress      = 1005
+	AccountFrozen          = 1006
+	AccountClosed          = 1007
+	InvalidStatusChange    = 1008
+	BalanceNotZero         = 1009
+	UnsupportedCurrency    = 1010
+	CurrencyMismatch       = 1011
+	FXRateUnavailable      = 1012
+	QuoteNotFound          = 1013
+	QuoteExpired           = 1014
+	HoldNotFound           = 1015
+	HoldNotActive          = 1016
+	LimitExceeded          = 1017
+	TransactionNotFound    = 1018
+	AlreadyReversed        = 1019
+	StandingOrderNotFound  = 1020
+	StandingOrderNotActive = 1021
+	UsernameTaken          = 1022
 )
 
 var MsgFlags = map[int]string{
-	CodeSuccess:         "success",
-	InvalidParams:       "invalid parameters",
-	Unauthorized:        "unauthorized",
-	Forbidden:           "forbidden",
-	NotFound:            "not found",
-	ServerError:         "server error",
-	UnknownError:        "unknown error",
-	InsufficientBalance: "insufficient balance",
-	AccountNotFound:     "account not found",
-	InvalidAmount:       "invalid amount",
+	CodeSuccess:            "success",
+	InvalidParams:          "invalid parameters",
+	Unauthorized:           "unauthorized",
+	Forbidden:              "forbidden",
+	NotFound:               "not found",
+	ServerError:            "server error",
+	UnknownError:           "unknown error",
+	InsufficientBalance:    "insufficient balance",
+	AccountNotFound:        "account not found",
+	InvalidAmount:          "invalid amount",
+	IdempotencyMismatch:    "idempotency key reused with different payload",
+	RequestInProgress:      "request with the same idempotency key is in progress",
+	AccountFrozen:          "account is frozen",
+	AccountClosed:          "account is closed",
+	InvalidStatusChange:    "invalid account status transition",
+	BalanceNotZero:         "account balance must be zero to close",
+	UnsupportedCurrency:    "unsupported currency",
+	CurrencyMismatch:       "currency mismatch",
+	FXRateUnavailable:      "fx rate unavailable",
+	QuoteNotFound:          "fx quote not found",
+	QuoteExpired:           "fx quote expired",
+	HoldNotFound:           "hold not found",
+	HoldNotActive:          "hold is not active",
+	LimitExceeded:          "transaction limit exceeded",
+	TransactionNotFound:    "transaction not found",
+	AlreadyReversed:        "transaction already reversed",
+	StandingOrderNotFound:  "standing order not found",
+	StandingOrderNotActive: "standing order is not active",
+	UsernameTaken:          "username already taken",
 }
 
 func GetMsg(code int) string {
@@ -65,6 +103,15 @@ func BadRequest(c *gin.Context, message string) {
 	})
 }
 
+// Error 業務錯誤, 帶自訂http status與錯誤碼
+func Error(c *gin.Context, httpCode, code int, message string) {
+	c.JSON(httpCode, Response{
+		Code:    code,
+		Message: message,
+		Data:    nil,
+	})
+}
+
 func InternalError(c *gin.Context, message string) {
 	c.JSON(http.StatusInternalServerError, Response{
 		Code:    ServerError,
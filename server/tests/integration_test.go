@@ -2,18 +2,29 @@ package tests
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kokp520/banking-system/server/internal/auth"
 	"github.com/kokp520/banking-system/server/internal/handler"
+	"github.com/kokp520/banking-system/server/internal/middleware"
+	"github.com/kokp520/banking-system/server/internal/model"
+	"github.com/kokp520/banking-system/server/internal/router"
 	"github.com/kokp520/banking-system/server/internal/service"
 	"github.com/kokp520/banking-system/server/internal/storage"
 	"github.com/kokp520/banking-system/server/pkg/logger"
+	"github.com/kokp520/banking-system/server/pkg/response"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -26,8 +37,28 @@ func setupRouter() *gin.Engine {
 	logger.Init("info", "json", "")
 
 	memoryStorage := storage.NewMemoryStorage()
-	accountService := service.NewAccountService(memoryStorage)
+	fxService := service.NewFXService(service.FXConfig{Spread: decimal.New(25, -4), QuoteTTL: time.Minute})
+	limitService := newTestLimitService(memoryStorage, time.Hour)
+	accountService := service.NewAccountService(memoryStorage, service.WithFX(fxService), service.WithLimits(limitService))
 	accountHandler := handler.NewAccountHandler(accountService)
+	ledgerHandler := handler.NewLedgerHandler(service.NewLedgerService(memoryStorage))
+	fxHandler := handler.NewFXHandler(fxService)
+	holdHandler := handler.NewHoldHandler(service.NewHoldService(memoryStorage, time.Hour, service.WithHoldLimits(limitService)))
+	limitHandler := handler.NewLimitHandler(limitService)
+	reversalHandler := handler.NewReversalHandler(service.NewReversalService(memoryStorage))
+	standingOrderHandler := handler.NewStandingOrderHandler(
+		service.NewStandingOrderService(memoryStorage, accountService, model.RetryPolicy{MaxRetries: 1, IntervalSeconds: 3600}))
+
+	interestHandler := handler.NewInterestHandler(service.NewInterestService(memoryStorage, map[string]model.Product{
+		"savings": {Rate: decimal.RequireFromString("0.0365"), DayCount: model.DayCountAct365},
+		"Term":    {Rate: decimal.RequireFromString("0.032"), DayCount: model.DayCount30360},
+	}))
+
+	statementHandler := handler.NewStatementHandler(service.NewStatementService(memoryStorage, "KOKPTWTP"))
+
+	idempotencyStore := storage.NewIdempotencyStore(memoryStorage)
+	idempotency := middleware.Idempotency(idempotencyStore, time.Hour)
+	paymentHandler := handler.NewPaymentHandler(service.NewPaymentImportService(accountService, idempotencyStore, time.Hour, "KOKPTWTP"))
 
 	r := gin.New()
 	r.Use(gin.Recovery()) // 添加recovery中間件
@@ -35,17 +66,66 @@ func setupRouter() *gin.Engine {
 	{
 		account := v1.Group("/account")
 		{
-			account.POST("", accountHandler.CreateAccount)
+			account.POST("", idempotency, accountHandler.CreateAccount)
 			account.GET("/:id", accountHandler.GetAccount)
-			account.POST("/:id/deposit", accountHandler.Deposit)
-			account.POST("/:id/withdraw", accountHandler.Withdraw)
-			account.POST("/:id/transfer", accountHandler.Transfer)
+			account.POST("/:id/deposit", idempotency, accountHandler.Deposit)
+			account.POST("/:id/withdraw", idempotency, accountHandler.Withdraw)
+			account.POST("/:id/transfer", idempotency, accountHandler.Transfer)
+			account.POST("/:id/freeze", idempotency, accountHandler.FreezeAccount)
+			account.POST("/:id/unfreeze", idempotency, accountHandler.UnfreezeAccount)
+			account.POST("/:id/close", idempotency, accountHandler.CloseAccount)
+			account.GET("/:id/transactions", accountHandler.GetTransactions)
+			account.PUT("/:id/overdraft", accountHandler.SetOverdraftLimit)
+			account.GET("/:id/overdraft/events", accountHandler.GetOverdraftEvents)
+			account.GET("/:id/limits", limitHandler.GetLimits)
+			account.PUT("/:id/limits", limitHandler.SetLimits)
+			account.POST("/:id/holds", idempotency, holdHandler.PlaceHold)
+			account.GET("/:id/holds", holdHandler.GetHolds)
+			account.POST("/:id/standing-orders", idempotency, standingOrderHandler.CreateStandingOrder)
+			account.GET("/:id/standing-orders", standingOrderHandler.GetStandingOrders)
+			account.PUT("/:id/product", interestHandler.SetProduct)
+			account.GET("/:id/interest", interestHandler.GetAccruals)
+			account.GET("/:id/statement", statementHandler.GetStatement)
+			account.GET("/:id/statement/export", statementHandler.ExportStatement)
 		}
+
+		v1.GET("/transactions/:id/entries", ledgerHandler.GetEntries)
+		v1.POST("/transactions/:id/reverse", idempotency, reversalHandler.Reverse)
+		v1.POST("/transfers/batch", idempotency, accountHandler.TransferBatch)
+		v1.POST("/payments/pain001", paymentHandler.ImportPain001)
+		v1.GET("/holds/:id", holdHandler.GetHold)
+		v1.POST("/holds/:id/capture", idempotency, holdHandler.CaptureHold)
+		v1.POST("/holds/:id/release", idempotency, holdHandler.ReleaseHold)
+		v1.GET("/standing-orders/:id", standingOrderHandler.GetStandingOrder)
+		v1.GET("/standing-orders/:id/runs", standingOrderHandler.GetRuns)
+		v1.POST("/standing-orders/:id/pause", standingOrderHandler.Pause)
+		v1.POST("/standing-orders/:id/resume", standingOrderHandler.Resume)
+		v1.POST("/standing-orders/:id/cancel", standingOrderHandler.Cancel)
+		v1.GET("/ledger/trial-balance", ledgerHandler.TrialBalance)
+		v1.GET("/interest/products", interestHandler.GetProducts)
+
+		v1.GET("/fx/rates", fxHandler.GetRates)
+		v1.POST("/fx/quotes", fxHandler.CreateQuote)
+		v1.PUT("/admin/fx/rates", fxHandler.SetRates)
+		v1.POST("/admin/standing-orders/run", standingOrderHandler.RunDue)
+		v1.POST("/admin/interest/run", interestHandler.RunAccrual)
 	}
 
 	return r
 }
 
+// newTestLimitService standard不限制, 不影響其他測試; limited: 單筆100, 累計150, 3筆
+func newTestLimitService(store storage.Storage, window time.Duration) *service.LimitService {
+	perTransaction, daily, count := decimal.NewFromInt(100), decimal.NewFromInt(150), 3
+	return service.NewLimitService(store, service.LimitConfig{
+		Window: window,
+		Tiers: map[string]model.Limits{
+			model.DefaultTier: {},
+			"limited":         {PerTransaction: &perTransaction, DailyAmount: &daily, DailyCount: &count},
+		},
+	})
+}
+
 // TestCreateAccountAPI 測試創建帳戶API
 func TestCreateAccountAPI(t *testing.T) {
 	router := setupRouter()
@@ -158,7 +238,7 @@ func TestGetAccountAPI(t *testing.T) {
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 }
 
@@ -209,7 +289,7 @@ func TestDepositAPI(t *testing.T) {
 			requestBody: map[string]interface{}{
 				"amount": "50.00",
 			},
-			expectedStatus: http.StatusInternalServerError,
+			expectedStatus: http.StatusNotFound,
 			expectError:    true,
 		},
 	}
@@ -264,7 +344,7 @@ func TestWithdrawAPI(t *testing.T) {
 			requestBody: map[string]interface{}{
 				"amount": "200.00",
 			},
-			expectedStatus: http.StatusInternalServerError,
+			expectedStatus: http.StatusUnprocessableEntity,
 			expectError:    true,
 		},
 		{
@@ -334,7 +414,7 @@ func TestTransferAPI(t *testing.T) {
 				"to_account_id": toAccountID,
 				"amount":        "300.00",
 			},
-			expectedStatus: http.StatusInternalServerError,
+			expectedStatus: http.StatusUnprocessableEntity,
 			expectError:    true,
 		},
 	}
@@ -492,25 +572,2312 @@ func TestCompleteWorkflow(t *testing.T) {
 	}
 }
 
-func createTestAccount(t *testing.T, router *gin.Engine, name, initialBalance string) int {
-	createReq := map[string]interface{}{
-		"name":            name,
-		"initial_balance": initialBalance,
-	}
+// TestTrialBalanceAPI 存提轉後試算表必須平衡
+func TestTrialBalanceAPI(t *testing.T) {
+	router := setupRouter()
 
-	jsonBody, _ := json.Marshal(createReq)
-	req, _ := http.NewRequest("POST", "/v1/account", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
+	AID := createTestAccount(t, router, "A", "100.00")
+	BID := createTestAccount(t, router, "B", "0")
+
+	for _, call := range []struct {
+		path string
+		body map[string]interface{}
+	}{
+		{fmt.Sprintf("/v1/account/%d/deposit", AID), map[string]interface{}{"amount": "50.00"}},
+		{fmt.Sprintf("/v1/account/%d/withdraw", AID), map[string]interface{}{"amount": "20.00"}},
+		{fmt.Sprintf("/v1/account/%d/transfer", AID), map[string]interface{}{"to_account_id": BID, "amount": "30.00"}},
+	} {
+		jsonBody, _ := json.Marshal(call.body)
+		req, _ := http.NewRequest("POST", call.path, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
 
+	req, _ := http.NewRequest("GET", "/v1/ledger/trial-balance", nil)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
 
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, true, data["balanced"])
+	assert.Equal(t, data["total_debit"], data["total_credit"])
+	assert.Empty(t, data["mismatches"])
+
+	// 第一筆交易為A的opening balance, 借cash_in 貸customer
+	req, _ = http.NewRequest("GET", "/v1/transactions/1/entries", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
 	require.Equal(t, http.StatusOK, w.Code)
 
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	entries := response["data"].([]interface{})
+	require.Len(t, entries, 2)
+	assert.Equal(t, "system:cash_in", entries[0].(map[string]interface{})["account"])
+	assert.Equal(t, fmt.Sprintf("customer:%d", AID), entries[1].(map[string]interface{})["account"])
+}
+
+// TestIdempotencyKeyAPI 同一個Idempotency-Key重試不會重複轉帳
+func TestIdempotencyKeyAPI(t *testing.T) {
+	router := setupRouter()
+
+	fromID := createTestAccount(t, router, "From User", "100.00")
+	toID := createTestAccount(t, router, "To User", "0")
+
+	transfer := func(key, clientID, amount string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(map[string]interface{}{"to_account_id": toID, "amount": amount})
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/v1/account/%d/transfer", fromID), bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		req.Header.Set("Client-Id", clientID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := transfer("key-1", "client-a", "30.00")
+	require.Equal(t, http.StatusOK, first.Code)
+
+	// 重試: 回應相同且不再扣款
+	retry := transfer("key-1", "client-a", "30.00")
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, first.Body.String(), retry.Body.String())
+
+	// 同key不同payload
+	mismatch := transfer("key-1", "client-a", "10.00")
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+
+	// 不同client同一個key互不影響
+	other := transfer("key-1", "client-b", "10.00")
+	assert.Equal(t, http.StatusOK, other.Code)
+	assert.Empty(t, other.Header().Get("Idempotent-Replayed"))
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/account/%d", fromID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
 	var response map[string]interface{}
-	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "60.00", response["data"].(map[string]interface{})["balance"])
+}
+
+// TestIdempotencyKeyPanic handler panic後key被釋放, 同一個key重試會重新執行而不是409
+func TestIdempotencyKeyPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init("info", "json", "")
+
+	calls := 0
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.POST("/flaky", middleware.Idempotency(storage.NewIdempotencyStore(storage.NewMemoryStorage()), time.Hour), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		response.Success(c, gin.H{"calls": calls})
+	})
+	send := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/flaky", bytes.NewBufferString(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "key-panic")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, send().Code)
+	retry := send()
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Empty(t, retry.Header().Get("Idempotent-Replayed"))
+	replay := send()
+	assert.Equal(t, "true", replay.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 2, calls)
+}
+
+// TestGetTransactionsPaginationAPI cursor分頁讀完所有交易
+func TestGetTransactionsPaginationAPI(t *testing.T) {
+	router := setupRouter()
+
+	accountID := createTestAccount(t, router, "Paged User", "100.00")
+	for i := 0; i < 4; i++ {
+		jsonBody, _ := json.Marshal(map[string]interface{}{"amount": "1.00"})
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/v1/account/%d/deposit", accountID), bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	var ids []float64
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		url := fmt.Sprintf("/v1/account/%d/transactions?limit=2&direction=asc&cursor=%s", accountID, cursor)
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		data := response["data"].(map[string]interface{})
+		for _, transaction := range data["transactions"].([]interface{}) {
+			ids = append(ids, transaction.(map[string]interface{})["id"].(float64))
+		}
+
+		next, _ := data["next_cursor"].(string)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	// opening balance + 4筆存款, 依id遞增
+	require.Len(t, ids, 5)
+	for i := 1; i < len(ids); i++ {
+		assert.Greater(t, ids[i], ids[i-1])
+	}
+
+	for _, query := range []string{"limit=-1", "limit=1000", "direction=up", "cursor=not-a-cursor!"} {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/account/%d/transactions?%s", accountID, query), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestGetTransactionsFilterAPI(t *testing.T) {
+	router := setupRouter()
+
+	fromID := createTestAccount(t, router, "Filter From", "100.00")
+	toID := createTestAccount(t, router, "Filter To", "0")
+	otherID := createTestAccount(t, router, "Filter Other", "0")
+
+	post := func(url string, body map[string]interface{}) {
+		jsonBody, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	post(fmt.Sprintf("/v1/account/%d/transfer", fromID), map[string]interface{}{"to_account_id": toID, "amount": "25.00"})
+	post(fmt.Sprintf("/v1/account/%d/transfer", fromID), map[string]interface{}{"to_account_id": otherID, "amount": "5.00"})
+	post(fmt.Sprintf("/v1/account/%d/withdraw", fromID), map[string]interface{}{"amount": "1.00"})
+
+	get := func(query string) []interface{} {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/account/%d/transactions?%s", fromID, query), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response["data"].(map[string]interface{})["transactions"].([]interface{})
+	}
+
+	assert.Len(t, get("type=transfer"), 2)
+	assert.Len(t, get("type=deposit"), 1) // opening balance
+
+	transactions := get(fmt.Sprintf("counterparty_id=%d", toID))
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "25.00", transactions[0].(map[string]interface{})["amount"])
+
+	assert.Len(t, get("min_amount=5&max_amount=25"), 2)
+	today := time.Now().UTC().Format("2006-01-02")
+	assert.Len(t, get("from="+today+"&to="+today), 4)
+	assert.Empty(t, get("to=2000-01-01"))
+
+	for _, query := range []string{
+		"type=bonus",
+		"from=yesterday",
+		"from=2024-02-01&to=2024-01-01",
+		"min_amount=abc",
+		"min_amount=-1",
+		"min_amount=10&max_amount=1",
+		fmt.Sprintf("counterparty_id=%d", fromID),
+	} {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/account/%d/transactions?%s", fromID, query), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+// TestErrorCodesAPI 業務錯誤對應的http status與錯誤碼
+func TestErrorCodesAPI(t *testing.T) {
+	router := setupRouter()
+
+	fromID := createTestAccount(t, router, "Error From", "50.00")
+	toID := createTestAccount(t, router, "Error To", "0")
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           map[string]interface{}
+		expectedStatus int
+		expectedCode   float64
+	}{
+		{"get missing account", "GET", "/v1/account/9999", nil, http.StatusNotFound, response.AccountNotFound},
+		{"deposit to missing account", "POST", "/v1/account/9999/deposit", map[string]interface{}{"amount": "1.00"}, http.StatusNotFound, response.AccountNotFound},
+		{"withdraw from missing account", "POST", "/v1/account/9999/withdraw", map[string]interface{}{"amount": "1.00"}, http.StatusNotFound, response.AccountNotFound},
+		{"transfer from missing account", "POST", "/v1/account/9999/transfer", map[string]interface{}{"to_account_id": toID, "amount": "1.00"}, http.StatusNotFound, response.AccountNotFound},
+		{"transfer to missing account", "POST", fmt.Sprintf("/v1/account/%d/transfer", fromID), map[string]interface{}{"to_account_id": 9999, "amount": "1.00"}, http.StatusNotFound, response.AccountNotFound},
+		{"withdraw insufficient balance", "POST", fmt.Sprintf("/v1/account/%d/withdraw", fromID), map[string]interface{}{"amount": "50.01"}, http.StatusUnprocessableEntity, response.InsufficientBalance},
+		{"transfer insufficient balance", "POST", fmt.Sprintf("/v1/account/%d/transfer", fromID), map[string]interface{}{"to_account_id": toID, "amount": "100"}, http.StatusUnprocessableEntity, response.InsufficientBalance},
+		{"negative initial balance", "POST", "/v1/account", map[string]interface{}{"name": "negative", "initial_balance": "-1"}, http.StatusBadRequest, response.InvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body *bytes.Buffer
+			if tt.body != nil {
+				jsonBody, _ := json.Marshal(tt.body)
+				body = bytes.NewBuffer(jsonBody)
+			} else {
+				body = bytes.NewBuffer(nil)
+			}
+			req, _ := http.NewRequest(tt.method, tt.url, body)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			var resp map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedCode, resp["code"])
+			assert.NotEmpty(t, resp["message"])
+		})
+	}
+}
+
+// TestAccountStatusAPI 凍結/解凍/結清
+func TestAccountStatusAPI(t *testing.T) {
+	router := setupRouter()
+
+	accountID := createTestAccount(t, router, "Status User", "20.00")
+	otherID := createTestAccount(t, router, "Status Other", "0")
+
+	post := func(url string, body map[string]interface{}) (int, map[string]interface{}) {
+		jsonBody, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+	account := func(action string) string {
+		return fmt.Sprintf("/v1/account/%d/%s", accountID, action)
+	}
+
+	// 原因必填
+	code, _ := post(account("freeze"), map[string]interface{}{})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, resp := post(account("freeze"), map[string]interface{}{"reason": "card stolen"})
+	require.Equal(t, http.StatusOK, code)
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, "frozen", data["status"])
+	assert.Equal(t, "card stolen", data["status_reason"])
+
+	code, resp = post(account("freeze"), map[string]interface{}{"reason": "again"})
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, float64(response.InvalidStatusChange), resp["code"])
+
+	// 凍結: 可入帳不可轉出
+	code, _ = post(account("deposit"), map[string]interface{}{"amount": "5.00"})
+	assert.Equal(t, http.StatusOK, code)
+	code, resp = post(account("withdraw"), map[string]interface{}{"amount": "1.00"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.AccountFrozen), resp["code"])
+	code, resp = post(account("transfer"), map[string]interface{}{"to_account_id": otherID, "amount": "1.00"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.AccountFrozen), resp["code"])
+
+	// 有餘額不能結清
+	code, resp = post(account("close"), map[string]interface{}{"reason": "customer request"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.BalanceNotZero), resp["code"])
+
+	code, _ = post(account("unfreeze"), map[string]interface{}{"reason": "verified"})
+	require.Equal(t, http.StatusOK, code)
+	code, _ = post(account("transfer"), map[string]interface{}{"to_account_id": otherID, "amount": "25.00"})
+	require.Equal(t, http.StatusOK, code)
+
+	code, resp = post(account("close"), map[string]interface{}{"reason": "customer request"})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "closed", resp["data"].(map[string]interface{})["status"])
+
+	code, resp = post(account("deposit"), map[string]interface{}{"amount": "1.00"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.AccountClosed), resp["code"])
+
+	code, _ = post(fmt.Sprintf("/v1/account/%d/freeze", 9999), map[string]interface{}{"reason": "missing"})
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+// TestMultiCurrencyAPI 開戶幣別, 精度驗證與依幣別格式化輸出
+func TestMultiCurrencyAPI(t *testing.T) {
+	router := setupRouter()
+
+	post := func(url string, body map[string]interface{}) (int, map[string]interface{}) {
+		jsonBody, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+
+	code, resp := post("/v1/account", map[string]interface{}{"name": "yen", "currency": "JPY", "initial_balance": "1000"})
+	require.Equal(t, http.StatusOK, code)
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, "JPY", data["currency"])
+	assert.Equal(t, "1000", data["balance"])
+	jpyID := int(data["id"].(float64))
+
+	code, resp = post("/v1/account", map[string]interface{}{"name": "dinar", "currency": "kwd", "initial_balance": "1.5"})
+	require.Equal(t, http.StatusOK, code)
+	data = resp["data"].(map[string]interface{})
+	assert.Equal(t, "KWD", data["currency"])
+	assert.Equal(t, "1.500", data["balance"])
+	kwdID := int(data["id"].(float64))
+
+	usdCode, resp := post("/v1/account", map[string]interface{}{"name": "dollar", "currency": "USD"})
+	require.Equal(t, http.StatusOK, usdCode)
+	usdID := int(resp["data"].(map[string]interface{})["id"].(float64))
+
+	tests := []struct {
+		name           string
+		url            string
+		body           map[string]interface{}
+		expectedStatus int
+		expectedCode   float64
+	}{
+		{"unsupported currency", "/v1/account", map[string]interface{}{"name": "x", "currency": "XYZ"}, http.StatusBadRequest, response.UnsupportedCurrency},
+		{"initial balance precision", "/v1/account", map[string]interface{}{"name": "x", "currency": "JPY", "initial_balance": "1.5"}, http.StatusBadRequest, response.InvalidAmount},
+		{"jpy fractional deposit", fmt.Sprintf("/v1/account/%d/deposit", jpyID), map[string]interface{}{"amount": "10.5"}, http.StatusBadRequest, response.InvalidAmount},
+		{"usd three decimals", fmt.Sprintf("/v1/account/%d/deposit", usdID), map[string]interface{}{"amount": "1.005"}, http.StatusBadRequest, response.InvalidAmount},
+		{"deposit currency mismatch", fmt.Sprintf("/v1/account/%d/deposit", usdID), map[string]interface{}{"amount": "1", "currency": "JPY"}, http.StatusUnprocessableEntity, response.CurrencyMismatch},
+		{"cross currency transfer", fmt.Sprintf("/v1/account/%d/transfer", jpyID), map[string]interface{}{"to_account_id": usdID, "amount": "100"}, http.StatusUnprocessableEntity, response.CurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := post(tt.url, tt.body)
+			assert.Equal(t, tt.expectedStatus, code)
+			assert.Equal(t, tt.expectedCode, resp["code"])
+		})
+	}
+
+	code, _ = post(fmt.Sprintf("/v1/account/%d/deposit", kwdID), map[string]interface{}{"amount": "0.125", "currency": "KWD"})
+	require.Equal(t, http.StatusOK, code)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/account/%d/transactions?direction=asc", kwdID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	transactions := resp["data"].(map[string]interface{})["transactions"].([]interface{})
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "1.500", transactions[0].(map[string]interface{})["amount"])
+	assert.Equal(t, "0.125", transactions[1].(map[string]interface{})["amount"])
+	assert.Equal(t, "KWD", transactions[1].(map[string]interface{})["currency"])
+}
+
+func TestFXTransferAPI(t *testing.T) {
+	router := setupRouter()
+
+	send := func(method, url string, body interface{}) (int, map[string]interface{}) {
+		jsonBody, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+
+	code, resp := send("PUT", "/v1/admin/fx/rates", map[string]interface{}{
+		"rates": []map[string]interface{}{
+			{"base": "USD", "quote": "JPY", "rate": "151.20"},
+			{"base": "usd", "quote": "twd", "rate": "32.15"},
+		},
+	})
+	require.Equal(t, http.StatusOK, code)
+	rates := resp["data"].(map[string]interface{})["rates"].([]interface{})
+	require.Len(t, rates, 2)
+	assert.Equal(t, "USD", rates[0].(map[string]interface{})["base"])
+	assert.Equal(t, "JPY", rates[0].(map[string]interface{})["quote"])
+
+	code, _ = send("PUT", "/v1/admin/fx/rates", map[string]interface{}{
+		"rates": []map[string]interface{}{{"base": "USD", "quote": "USD", "rate": "1"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	_, resp = send("POST", "/v1/account", map[string]interface{}{"name": "dollar", "currency": "USD", "initial_balance": "100"})
+	usdID := int(resp["data"].(map[string]interface{})["id"].(float64))
+	_, resp = send("POST", "/v1/account", map[string]interface{}{"name": "yen", "currency": "JPY"})
+	jpyID := int(resp["data"].(map[string]interface{})["id"].(float64))
+	_, resp = send("POST", "/v1/account", map[string]interface{}{"name": "euro", "currency": "EUR"})
+	eurID := int(resp["data"].(map[string]interface{})["id"].(float64))
+
+	// 151.20 * (1 - 0.0025) = 150.822, 10.50 * 150.822 = 1583.631 無條件捨去到JPY整數
+	code, resp = send("POST", "/v1/fx/quotes", map[string]interface{}{"source_account_id": usdID, "source_currency": "USD", "destination_currency": "JPY", "amount": "10.50"})
+	require.Equal(t, http.StatusOK, code)
+	quote := resp["data"].(map[string]interface{})
+	assert.Equal(t, float64(usdID), quote["source_account_id"])
+	assert.Equal(t, "10.50", quote["source_amount"])
+	assert.Equal(t, "1583", quote["destination_amount"])
+	assert.Equal(t, "150.822", quote["rate"])
+	assert.Equal(t, "151.2", quote["mid_rate"])
+	assert.Equal(t, "down", quote["rounding"])
+	quoteID := quote["id"].(string)
+
+	transferURL := fmt.Sprintf("/v1/account/%d/transfer", usdID)
+	tests := []struct {
+		name           string
+		url            string
+		body           map[string]interface{}
+		expectedStatus int
+		expectedCode   float64
+	}{
+		{"no rate", "/v1/fx/quotes", map[string]interface{}{"source_account_id": usdID, "source_currency": "USD", "destination_currency": "GBP", "amount": "1"}, http.StatusUnprocessableEntity, response.FXRateUnavailable},
+		{"same currency quote", "/v1/fx/quotes", map[string]interface{}{"source_account_id": usdID, "source_currency": "USD", "destination_currency": "USD", "amount": "1"}, http.StatusBadRequest, response.InvalidParams},
+		{"quote without account", "/v1/fx/quotes", map[string]interface{}{"source_currency": "USD", "destination_currency": "JPY", "amount": "1"}, http.StatusBadRequest, response.InvalidParams},
+		{"quote for another account", fmt.Sprintf("/v1/account/%d/transfer", eurID), map[string]interface{}{"to_account_id": jpyID, "amount": "10.50", "quote_id": quoteID}, http.StatusBadRequest, response.InvalidParams},
+		{"unknown quote", transferURL, map[string]interface{}{"to_account_id": jpyID, "amount": "10.50", "quote_id": "missing"}, http.StatusNotFound, response.QuoteNotFound},
+		{"quote amount mismatch", transferURL, map[string]interface{}{"to_account_id": jpyID, "amount": "11", "quote_id": quoteID}, http.StatusBadRequest, response.InvalidParams},
+		{"quote currency mismatch", transferURL, map[string]interface{}{"to_account_id": eurID, "amount": "10.50", "quote_id": quoteID}, http.StatusUnprocessableEntity, response.CurrencyMismatch},
+		{"convert without rate", transferURL, map[string]interface{}{"to_account_id": eurID, "amount": "1", "convert": true}, http.StatusUnprocessableEntity, response.FXRateUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := send("POST", tt.url, tt.body)
+			assert.Equal(t, tt.expectedStatus, code)
+			assert.Equal(t, tt.expectedCode, resp["code"])
+		})
+	}
+
+	code, resp = send("POST", transferURL, map[string]interface{}{"to_account_id": jpyID, "amount": "10.50", "quote_id": quoteID})
+	require.Equal(t, http.StatusOK, code)
+	fx := resp["data"].(map[string]interface{})["fx"].(map[string]interface{})
+	assert.Equal(t, quoteID, fx["quote_id"])
+	assert.Equal(t, "1583", fx["destination_amount"])
+	assert.Equal(t, "JPY", fx["destination_currency"])
+
+	// 報價只能成交一次
+	code, resp = send("POST", transferURL, map[string]interface{}{"to_account_id": jpyID, "amount": "10.50", "quote_id": quoteID})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.QuoteExpired), resp["code"])
+
+	// 即時匯率, 反向報價以倒數計算
+	code, resp = send("POST", fmt.Sprintf("/v1/account/%d/transfer", jpyID), map[string]interface{}{"to_account_id": usdID, "amount": "1000", "convert": true})
+	require.Equal(t, http.StatusOK, code)
+	fx = resp["data"].(map[string]interface{})["fx"].(map[string]interface{})
+	assert.Equal(t, "6.59", fx["destination_amount"])
+	assert.Equal(t, "USD", fx["destination_currency"])
+
+	for id, balance := range map[int]string{usdID: "96.09", jpyID: "583"} {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/account/%d", id), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, balance, resp["data"].(map[string]interface{})["balance"])
+	}
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/account/%d/transactions?direction=asc", jpyID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	transactions := resp["data"].(map[string]interface{})["transactions"].([]interface{})
+	require.Len(t, transactions, 2)
+	first := transactions[0].(map[string]interface{})
+	assert.Equal(t, "10.50", first["amount"])
+	assert.Equal(t, "USD", first["currency"])
+	assert.Equal(t, "150.822", first["fx"].(map[string]interface{})["rate"])
+
+	req, _ = http.NewRequest("GET", "/v1/ledger/trial-balance", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, true, resp["data"].(map[string]interface{})["balanced"])
+}
+
+func TestFXQuoteExpiry(t *testing.T) {
+	logger.Init("info", "json", "")
+	fxService := service.NewFXService(service.FXConfig{QuoteTTL: time.Millisecond})
+	_, err := fxService.SetRates(context.Background(), []model.FXRate{
+		{Base: "USD", Quote: "TWD", Rate: decimal.RequireFromString("32.15")},
+	})
 	require.NoError(t, err)
 
-	data := response["data"].(map[string]interface{})
-	return int(data["id"].(float64))
+	quote, err := fxService.Quote(context.Background(), 1, "USD", "TWD", decimal.NewFromInt(10))
+	require.NoError(t, err)
+	assert.True(t, decimal.RequireFromString("321.50").Equal(quote.DestinationAmount))
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = fxService.Redeem(context.Background(), quote.ID, 1, "USD", "TWD", decimal.NewFromInt(10))
+	assert.ErrorIs(t, err, model.ErrQuoteExpired)
+}
+
+// TestFXQuoteBinding 報價只能由申請的使用者從申請的帳戶成交
+func TestFXQuoteBinding(t *testing.T) {
+	logger.Init("info", "json", "")
+	fxService := service.NewFXService(service.FXConfig{QuoteTTL: time.Minute})
+	_, err := fxService.SetRates(context.Background(), []model.FXRate{
+		{Base: "USD", Quote: "TWD", Rate: decimal.RequireFromString("32.15")},
+	})
+	require.NoError(t, err)
+	as := func(userID uint64) context.Context {
+		return auth.WithPrincipal(context.Background(), &auth.Principal{UserID: userID, Role: model.RoleCustomer})
+	}
+	amount := decimal.NewFromInt(10)
+
+	quote, err := fxService.Quote(as(1), 7, "USD", "TWD", amount)
+	require.NoError(t, err)
+
+	_, err = fxService.Redeem(as(2), quote.ID, 7, "USD", "TWD", amount)
+	assert.ErrorIs(t, err, model.ErrQuoteNotFound)
+	_, err = fxService.Redeem(context.Background(), quote.ID, 7, "USD", "TWD", amount)
+	assert.ErrorIs(t, err, model.ErrQuoteNotFound)
+	_, err = fxService.Redeem(as(1), quote.ID, 8, "USD", "TWD", amount)
+	assert.ErrorIs(t, err, model.ErrInvalidRequest)
+
+	redeemed, err := fxService.Redeem(as(1), quote.ID, 7, "USD", "TWD", amount)
+	require.NoError(t, err)
+	assert.Equal(t, quote.ID, redeemed.ID)
+}
+
+// TestHoldAPI 測試預授權圈存, 請款, 解除
+func TestHoldAPI(t *testing.T) {
+	router := setupRouter()
+	accountID := createTestAccount(t, router, "card holder", "100.00")
+
+	code, resp := sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/holds", accountID), map[string]interface{}{"amount": "60", "description": "hotel"})
+	require.Equal(t, http.StatusOK, code)
+	hold := resp["data"].(map[string]interface{})
+	assert.Equal(t, "active", hold["status"])
+	assert.Equal(t, "60.00", hold["remaining_amount"])
+	holdID := int(hold["id"].(float64))
+
+	account := getTestAccount(t, router, accountID)
+	assert.Equal(t, "100.00", account["balance"])
+	assert.Equal(t, "40.00", account["available_balance"])
+	assert.Equal(t, "60.00", account["held_balance"])
+
+	holdURL := fmt.Sprintf("/v1/holds/%d", holdID)
+	tests := []struct {
+		name           string
+		url            string
+		body           map[string]interface{}
+		expectedStatus int
+		expectedCode   float64
+	}{
+		{"withdraw above available", fmt.Sprintf("/v1/account/%d/withdraw", accountID), map[string]interface{}{"amount": "50"}, http.StatusUnprocessableEntity, response.InsufficientBalance},
+		{"hold above available", fmt.Sprintf("/v1/account/%d/holds", accountID), map[string]interface{}{"amount": "41"}, http.StatusUnprocessableEntity, response.InsufficientBalance},
+		{"hold expired already", fmt.Sprintf("/v1/account/%d/holds", accountID), map[string]interface{}{"amount": "1", "expires_at": time.Now().Add(-time.Minute)}, http.StatusBadRequest, response.InvalidParams},
+		{"hold unknown account", "/v1/account/9999/holds", map[string]interface{}{"amount": "1"}, http.StatusNotFound, response.AccountNotFound},
+		{"capture above remaining", holdURL + "/capture", map[string]interface{}{"amount": "61"}, http.StatusBadRequest, response.InvalidAmount},
+		{"capture unknown hold", "/v1/holds/9999/capture", map[string]interface{}{"amount": "1"}, http.StatusNotFound, response.HoldNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := sendJSON(t, router, "POST", tt.url, tt.body)
+			assert.Equal(t, tt.expectedStatus, code)
+			assert.Equal(t, tt.expectedCode, resp["code"])
+		})
+	}
+
+	// 部分請款
+	code, resp = sendJSON(t, router, "POST", holdURL+"/capture", map[string]interface{}{"amount": "25.50"})
+	require.Equal(t, http.StatusOK, code)
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, "active", data["hold"].(map[string]interface{})["status"])
+	assert.Equal(t, "34.50", data["hold"].(map[string]interface{})["remaining_amount"])
+	transaction := data["transaction"].(map[string]interface{})
+	assert.Equal(t, "withdraw", transaction["type"])
+	assert.Equal(t, float64(holdID), transaction["hold_id"])
+
+	account = getTestAccount(t, router, accountID)
+	assert.Equal(t, "74.50", account["balance"])
+	assert.Equal(t, "40.00", account["available_balance"])
+
+	code, resp = sendJSON(t, router, "POST", holdURL+"/release", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "released", resp["data"].(map[string]interface{})["status"])
+
+	account = getTestAccount(t, router, accountID)
+	assert.Equal(t, "74.50", account["balance"])
+	assert.Equal(t, "74.50", account["available_balance"])
+	assert.Equal(t, "0.00", account["held_balance"])
+
+	code, resp = sendJSON(t, router, "POST", holdURL+"/capture", nil)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, float64(response.HoldNotActive), resp["code"])
+
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("/v1/account/%d/holds", accountID), nil)
+	require.Equal(t, http.StatusOK, code)
+	holds := resp["data"].([]interface{})
+	require.Len(t, holds, 1)
+	assert.Equal(t, "25.50", holds[0].(map[string]interface{})["captured_amount"])
+}
+
+// TestHoldLimitsAPI 圈存時檢查限額並佔用額度, 在圈存金額內的請款不再檢查
+func TestHoldLimitsAPI(t *testing.T) {
+	router := setupRouter()
+	accountID := createTestAccount(t, router, "card holder", "1000")
+	holdsURL := fmt.Sprintf("/v1/account/%d/holds", accountID)
+	limitsURL := fmt.Sprintf("/v1/account/%d/limits", accountID)
+
+	// 在standard等級圈存, 改為limited後圈存中的金額已超過累計150
+	code, resp := sendJSON(t, router, "POST", holdsURL, map[string]interface{}{"amount": "300"})
+	require.Equal(t, http.StatusOK, code)
+	captureURL := fmt.Sprintf("/v1/holds/%d/capture", int(resp["data"].(map[string]interface{})["id"].(float64)))
+	code, _ = sendJSON(t, router, "PUT", limitsURL, map[string]interface{}{"tier": "limited"})
+	require.Equal(t, http.StatusOK, code)
+
+	code, resp = sendJSON(t, router, "GET", limitsURL, nil)
+	require.Equal(t, http.StatusOK, code)
+	usage := resp["data"].(map[string]interface{})
+	assert.Equal(t, "0.00", usage["used_amount"])
+	assert.Equal(t, "300.00", usage["held_amount"])
+	assert.Equal(t, "0.00", usage["remaining_amount"])
+	assert.Equal(t, float64(2), usage["remaining_count"])
+
+	code, resp = sendJSON(t, router, "POST", holdsURL, map[string]interface{}{"amount": "100.01"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.LimitExceeded), resp["code"])
+	code, resp = sendJSON(t, router, "POST", holdsURL, map[string]interface{}{"amount": "1"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.LimitExceeded), resp["code"])
+
+	// 已授權的金額可以請款, 即使超過單筆與累計限額
+	code, _ = sendJSON(t, router, "POST", captureURL, map[string]interface{}{"amount": "100"})
+	require.Equal(t, http.StatusOK, code)
+	code, _ = sendJSON(t, router, "POST", captureURL, nil)
+	require.Equal(t, http.StatusOK, code)
+
+	code, resp = sendJSON(t, router, "GET", limitsURL, nil)
+	require.Equal(t, http.StatusOK, code)
+	usage = resp["data"].(map[string]interface{})
+	assert.Equal(t, "300.00", usage["used_amount"])
+	assert.Equal(t, "0.00", usage["held_amount"])
+	account := getTestAccount(t, router, accountID)
+	assert.Equal(t, "700.00", account["balance"])
+	assert.Equal(t, "0.00", account["held_balance"])
+
+	// limited帳戶: 兩筆圈存合計不能超過累計150, 通過的圈存都能全額請款
+	code, resp = sendJSON(t, router, "POST", "/v1/account", map[string]interface{}{"name": "limited holder", "initial_balance": "1000", "tier": "limited"})
+	require.Equal(t, http.StatusOK, code)
+	limitedID := int(resp["data"].(map[string]interface{})["id"].(float64))
+	holdsURL = fmt.Sprintf("/v1/account/%d/holds", limitedID)
+
+	var captureURLs []string
+	for _, amount := range []string{"100", "50"} {
+		code, resp = sendJSON(t, router, "POST", holdsURL, map[string]interface{}{"amount": amount})
+		require.Equal(t, http.StatusOK, code)
+		captureURLs = append(captureURLs, fmt.Sprintf("/v1/holds/%d/capture", int(resp["data"].(map[string]interface{})["id"].(float64))))
+	}
+	code, resp = sendJSON(t, router, "POST", holdsURL, map[string]interface{}{"amount": "0.01"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.LimitExceeded), resp["code"])
+
+	for _, url := range captureURLs {
+		code, _ = sendJSON(t, router, "POST", url, nil)
+		require.Equal(t, http.StatusOK, code)
+	}
+	code, resp = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/withdraw", limitedID), map[string]interface{}{"amount": "0.01"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.LimitExceeded), resp["code"])
+	assert.Equal(t, "850.00", getTestAccount(t, router, limitedID)["balance"])
+}
+
+// TestOverdraftAPI 測試透支額度與透支事件
+func TestOverdraftAPI(t *testing.T) {
+	router := setupRouter()
+
+	code, resp := sendJSON(t, router, "POST", "/v1/account", map[string]interface{}{"name": "business", "initial_balance": "100", "overdraft_limit": "50"})
+	require.Equal(t, http.StatusOK, code)
+	accountID := int(resp["data"].(map[string]interface{})["id"].(float64))
+	assert.Equal(t, "50.00", resp["data"].(map[string]interface{})["overdraft_limit"])
+
+	code, resp = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/withdraw", accountID), map[string]interface{}{"amount": "151"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.InsufficientBalance), resp["code"])
+
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/withdraw", accountID), map[string]interface{}{"amount": "130"})
+	require.Equal(t, http.StatusOK, code)
+
+	account := getTestAccount(t, router, accountID)
+	assert.Equal(t, "-30.00", account["balance"])
+	assert.Equal(t, "20.00", account["available_balance"])
+	assert.Equal(t, "30.00", account["overdraft_used"])
+
+	tests := []struct {
+		name           string
+		id             int
+		body           map[string]interface{}
+		expectedStatus int
+		expectedCode   float64
+	}{
+		{"missing limit", accountID, map[string]interface{}{}, http.StatusBadRequest, response.InvalidParams},
+		{"negative limit", accountID, map[string]interface{}{"limit": "-1"}, http.StatusBadRequest, response.InvalidAmount},
+		{"limit precision", accountID, map[string]interface{}{"limit": "1.001"}, http.StatusBadRequest, response.InvalidAmount},
+		{"unknown account", 9999, map[string]interface{}{"limit": "1"}, http.StatusNotFound, response.AccountNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := sendJSON(t, router, "PUT", fmt.Sprintf("/v1/account/%d/overdraft", tt.id), tt.body)
+			assert.Equal(t, tt.expectedStatus, code)
+			assert.Equal(t, tt.expectedCode, resp["code"])
+		})
+	}
+
+	code, resp = sendJSON(t, router, "PUT", fmt.Sprintf("/v1/account/%d/overdraft", accountID), map[string]interface{}{"limit": "200"})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "170.00", resp["data"].(map[string]interface{})["available_balance"])
+
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/deposit", accountID), map[string]interface{}{"amount": "40"})
+	require.Equal(t, http.StatusOK, code)
+
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("/v1/account/%d/overdraft/events", accountID), nil)
+	require.Equal(t, http.StatusOK, code)
+	events := resp["data"].([]interface{})
+	require.Len(t, events, 2)
+	entered, exited := events[0].(map[string]interface{}), events[1].(map[string]interface{})
+	assert.Equal(t, "entered", entered["type"])
+	assert.Equal(t, "-30.00", entered["balance"])
+	assert.Equal(t, "50.00", entered["overdraft_limit"])
+	assert.Equal(t, "exited", exited["type"])
+	assert.Equal(t, "10.00", exited["balance"])
+	assert.Equal(t, "200.00", exited["overdraft_limit"])
+
+	code, resp = sendJSON(t, router, "GET", "/v1/account/9999/overdraft/events", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, float64(response.AccountNotFound), resp["code"])
+}
+
+// TestLimitsAPI 測試單筆, 累計金額與筆數限額
+func TestLimitsAPI(t *testing.T) {
+	router := setupRouter()
+
+	code, resp := sendJSON(t, router, "POST", "/v1/account", map[string]interface{}{"name": "limited", "initial_balance": "1000", "tier": "Limited"})
+	require.Equal(t, http.StatusOK, code)
+	accountID := int(resp["data"].(map[string]interface{})["id"].(float64))
+	assert.Equal(t, "limited", resp["data"].(map[string]interface{})["tier"])
+	otherID := createTestAccount(t, router, "other", "0")
+
+	code, resp = sendJSON(t, router, "POST", "/v1/account", map[string]interface{}{"name": "unknown", "tier": "gold"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, float64(response.InvalidParams), resp["code"])
+
+	withdrawURL := fmt.Sprintf("/v1/account/%d/withdraw", accountID)
+	transferURL := fmt.Sprintf("/v1/account/%d/transfer", accountID)
+	limitsURL := fmt.Sprintf("/v1/account/%d/limits", accountID)
+
+	code, resp = sendJSON(t, router, "POST", withdrawURL, map[string]interface{}{"amount": "100.01"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.LimitExceeded), resp["code"])
+
+	code, _ = sendJSON(t, router, "POST", withdrawURL, map[string]interface{}{"amount": "100"})
+	require.Equal(t, http.StatusOK, code)
+	// 存款與轉入不計入
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/deposit", accountID), map[string]interface{}{"amount": "500"})
+	require.Equal(t, http.StatusOK, code)
+
+	code, resp = sendJSON(t, router, "GET", limitsURL, nil)
+	require.Equal(t, http.StatusOK, code)
+	usage := resp["data"].(map[string]interface{})
+	assert.Equal(t, "limited", usage["tier"])
+	assert.Equal(t, "100.00", usage["used_amount"])
+	assert.Equal(t, float64(1), usage["used_count"])
+	assert.Equal(t, "50.00", usage["remaining_amount"])
+	assert.Equal(t, float64(2), usage["remaining_count"])
+	assert.Equal(t, "100.00", usage["limits"].(map[string]interface{})["per_transaction"])
+
+	code, resp = sendJSON(t, router, "POST", transferURL, map[string]interface{}{"to_account_id": otherID, "amount": "60"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.LimitExceeded), resp["code"])
+	code, _ = sendJSON(t, router, "POST", transferURL, map[string]interface{}{"to_account_id": otherID, "amount": "30"})
+	require.Equal(t, http.StatusOK, code)
+	code, _ = sendJSON(t, router, "POST", withdrawURL, map[string]interface{}{"amount": "10"})
+	require.Equal(t, http.StatusOK, code)
+
+	// 第4筆超過筆數限額
+	code, resp = sendJSON(t, router, "POST", withdrawURL, map[string]interface{}{"amount": "1"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.LimitExceeded), resp["code"])
+
+	// 個別限額覆蓋等級設定, 沒帶的欄位沿用等級
+	code, resp = sendJSON(t, router, "PUT", limitsURL, map[string]interface{}{"limits": map[string]interface{}{"daily_count": 10, "daily_amount": "500"}})
+	require.Equal(t, http.StatusOK, code)
+	usage = resp["data"].(map[string]interface{})
+	assert.Equal(t, "360.00", usage["remaining_amount"])
+	assert.Equal(t, float64(7), usage["remaining_count"])
+	assert.Equal(t, "100.00", usage["limits"].(map[string]interface{})["per_transaction"])
+	code, _ = sendJSON(t, router, "POST", withdrawURL, map[string]interface{}{"amount": "1"})
+	require.Equal(t, http.StatusOK, code)
+
+	// 改為不限制的等級並清除個別限額
+	code, resp = sendJSON(t, router, "PUT", limitsURL, map[string]interface{}{"tier": "standard"})
+	require.Equal(t, http.StatusOK, code)
+	usage = resp["data"].(map[string]interface{})
+	assert.Nil(t, usage["remaining_amount"])
+	assert.Nil(t, usage["remaining_count"])
+	code, _ = sendJSON(t, router, "POST", withdrawURL, map[string]interface{}{"amount": "500"})
+	require.Equal(t, http.StatusOK, code)
+
+	tests := []struct {
+		name           string
+		url            string
+		body           map[string]interface{}
+		expectedStatus int
+		expectedCode   float64
+	}{
+		{"unknown tier", limitsURL, map[string]interface{}{"tier": "gold"}, http.StatusBadRequest, response.InvalidParams},
+		{"negative limit", limitsURL, map[string]interface{}{"limits": map[string]interface{}{"per_transaction": "-1"}}, http.StatusBadRequest, response.InvalidParams},
+		{"negative count", limitsURL, map[string]interface{}{"limits": map[string]interface{}{"daily_count": -1}}, http.StatusBadRequest, response.InvalidParams},
+		{"unknown account", "/v1/account/9999/limits", map[string]interface{}{"tier": "limited"}, http.StatusNotFound, response.AccountNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := sendJSON(t, router, "PUT", tt.url, tt.body)
+			assert.Equal(t, tt.expectedStatus, code)
+			assert.Equal(t, tt.expectedCode, resp["code"])
+		})
+	}
+
+	code, resp = sendJSON(t, router, "GET", "/v1/account/9999/limits", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, float64(response.AccountNotFound), resp["code"])
+}
+
+// TestLimitRollingWindow 滾動視窗外的交易不再計入
+func TestLimitRollingWindow(t *testing.T) {
+	logger.Init("info", "json", "")
+	memoryStorage := storage.NewMemoryStorage()
+	limitService := newTestLimitService(memoryStorage, 50*time.Millisecond)
+	accountService := service.NewAccountService(memoryStorage, service.WithLimits(limitService))
+	ctx := context.Background()
+
+	account, err := accountService.CreateAccount(ctx, service.CreateAccountInput{Name: "limited", Tier: "limited", InitialBalance: decimal.NewFromInt(1000)})
+	require.NoError(t, err)
+	withdraw := service.WithdrawInput{Amount: decimal.NewFromInt(100)}
+	require.NoError(t, accountService.Withdraw(ctx, account.ID, withdraw))
+	assert.ErrorIs(t, accountService.Withdraw(ctx, account.ID, withdraw), model.ErrLimitExceeded)
+
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, accountService.Withdraw(ctx, account.ID, withdraw))
+}
+
+// TestLimitConcurrentWithdraw 同帳戶併發提款不會一起超過累計限額
+func TestLimitConcurrentWithdraw(t *testing.T) {
+	logger.Init("info", "json", "")
+	memoryStorage := storage.NewMemoryStorage()
+	accountService := service.NewAccountService(memoryStorage, service.WithLimits(newTestLimitService(memoryStorage, time.Hour)))
+	ctx := context.Background()
+
+	account, err := accountService.CreateAccount(ctx, service.CreateAccountInput{Name: "limited", Tier: "limited", InitialBalance: decimal.NewFromInt(1000)})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if accountService.Withdraw(ctx, account.ID, service.WithdrawInput{Amount: decimal.NewFromInt(40)}) == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 累計150, 3筆40元
+	assert.Equal(t, 3, succeeded)
+	retrieved, err := accountService.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(880).Equal(retrieved.Balance), retrieved.Balance.String())
+}
+
+func createTestAccount(t *testing.T, router *gin.Engine, name, initialBalance string) int {
+	createReq := map[string]interface{}{
+		"name":            name,
+		"initial_balance": initialBalance,
+	}
+
+	jsonBody, _ := json.Marshal(createReq)
+	req, _ := http.NewRequest("POST", "/v1/account", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+
+	data := response["data"].(map[string]interface{})
+	return int(data["id"].(float64))
+}
+
+// sendJSON 送出JSON請求, body為nil時不帶body
+func sendJSON(t *testing.T, router *gin.Engine, method, url string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	reader := bytes.NewBuffer(nil)
+	if body != nil {
+		jsonBody, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(jsonBody)
+	}
+	req, _ := http.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	return w.Code, resp
+}
+
+func getTestAccount(t *testing.T, router *gin.Engine, id int) map[string]interface{} {
+	t.Helper()
+	code, resp := sendJSON(t, router, "GET", fmt.Sprintf("/v1/account/%d", id), nil)
+	require.Equal(t, http.StatusOK, code)
+	return resp["data"].(map[string]interface{})
+}
+
+// latestTransactionID 帳戶最新一筆交易的ID
+func latestTransactionID(t *testing.T, router *gin.Engine, accountID int) int {
+	code, resp := sendJSON(t, router, "GET", fmt.Sprintf("/v1/account/%d/transactions?limit=1", accountID), nil)
+	require.Equal(t, http.StatusOK, code)
+	transactions := resp["data"].(map[string]interface{})["transactions"].([]interface{})
+	require.NotEmpty(t, transactions)
+	return int(transactions[0].(map[string]interface{})["id"].(float64))
+}
+
+// TestReverseAPI 測試沖正與部分退款
+func TestReverseAPI(t *testing.T) {
+	router := setupRouter()
+	payerID := createTestAccount(t, router, "payer", "100.00")
+	payeeID := createTestAccount(t, router, "payee", "0")
+
+	code, _ := sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/transfer", payerID), map[string]interface{}{"to_account_id": payeeID, "amount": "60"})
+	require.Equal(t, http.StatusOK, code)
+	transferID := latestTransactionID(t, router, payerID)
+	reverseURL := fmt.Sprintf("/v1/transactions/%d/reverse", transferID)
+
+	code, resp := sendJSON(t, router, "POST", reverseURL, map[string]interface{}{"amount": "20", "reason": "partial refund"})
+	require.Equal(t, http.StatusOK, code)
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, "20.00", data["refunded_amount"])
+	assert.Equal(t, "40.00", data["refundable_amount"])
+	reversal := data["reversal"].(map[string]interface{})
+	assert.Equal(t, "reversal", reversal["type"])
+	assert.Equal(t, float64(transferID), reversal["reversal_of"])
+	assert.Equal(t, float64(payeeID), reversal["from_account_id"])
+	assert.Equal(t, float64(payerID), reversal["to_account_id"])
+	assert.Equal(t, "partial refund", reversal["description"])
+	assert.Equal(t, float64(transferID), data["original"].(map[string]interface{})["id"])
+
+	assert.Equal(t, "60.00", getTestAccount(t, router, payerID)["balance"])
+	assert.Equal(t, "40.00", getTestAccount(t, router, payeeID)["balance"])
+
+	// 收款方已把錢轉走, 無法退回剩餘金額
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/withdraw", payeeID), map[string]interface{}{"amount": "30"})
+	require.Equal(t, http.StatusOK, code)
+	code, resp = sendJSON(t, router, "POST", reverseURL, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.InsufficientBalance), resp["code"])
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/deposit", payeeID), map[string]interface{}{"amount": "30"})
+	require.Equal(t, http.StatusOK, code)
+
+	depositID := latestTransactionID(t, router, payeeID)
+	withdrawID := func() int {
+		code, _ := sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/withdraw", payerID), map[string]interface{}{"amount": "1"})
+		require.Equal(t, http.StatusOK, code)
+		return latestTransactionID(t, router, payerID)
+	}()
+
+	tests := []struct {
+		name           string
+		url            string
+		body           map[string]interface{}
+		expectedStatus int
+		expectedCode   float64
+	}{
+		{"invalid id", "/v1/transactions/abc/reverse", nil, http.StatusBadRequest, response.InvalidParams},
+		{"unknown transaction", "/v1/transactions/9999/reverse", nil, http.StatusNotFound, response.TransactionNotFound},
+		{"non-positive amount", reverseURL, map[string]interface{}{"amount": "0"}, http.StatusBadRequest, response.InvalidParams},
+		{"above refundable", reverseURL, map[string]interface{}{"amount": "40.01"}, http.StatusBadRequest, response.InvalidAmount},
+		{"withdraw not reversible", fmt.Sprintf("/v1/transactions/%d/reverse", withdrawID), nil, http.StatusBadRequest, response.InvalidParams},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := sendJSON(t, router, "POST", tt.url, tt.body)
+			assert.Equal(t, tt.expectedStatus, code)
+			assert.Equal(t, tt.expectedCode, resp["code"])
+		})
+	}
+
+	// 不帶金額沖正剩餘全額, 之後不能再沖正
+	code, resp = sendJSON(t, router, "POST", reverseURL, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "0.00", resp["data"].(map[string]interface{})["refundable_amount"])
+	code, resp = sendJSON(t, router, "POST", reverseURL, nil)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, float64(response.AlreadyReversed), resp["code"])
+
+	// 存款沖正, 存入的款項已隨轉帳沖正退回, 補足餘額後才能沖正
+	depositURL := fmt.Sprintf("/v1/transactions/%d/reverse", depositID)
+	code, resp = sendJSON(t, router, "POST", depositURL, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.InsufficientBalance), resp["code"])
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/deposit", payeeID), map[string]interface{}{"amount": "30"})
+	require.Equal(t, http.StatusOK, code)
+	code, resp = sendJSON(t, router, "POST", depositURL, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Nil(t, resp["data"].(map[string]interface{})["reversal"].(map[string]interface{})["from_account_id"])
+	assert.Equal(t, "0.00", getTestAccount(t, router, payeeID)["balance"])
+	assert.Equal(t, "99.00", getTestAccount(t, router, payerID)["balance"])
+
+	code, resp = sendJSON(t, router, "GET", "/v1/ledger/trial-balance", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, resp["data"].(map[string]interface{})["balanced"])
+}
+
+// TestBatchTransferAPI 測試批次轉帳的atomic與best_effort
+func TestBatchTransferAPI(t *testing.T) {
+	router := setupRouter()
+	sourceID := createTestAccount(t, router, "payroll", "1000.00")
+	payees := []int{
+		createTestAccount(t, router, "employee a", "0"),
+		createTestAccount(t, router, "employee b", "0"),
+		createTestAccount(t, router, "employee c", "0"),
+	}
+	item := func(to int, amount string) map[string]interface{} {
+		return map[string]interface{}{"to_account_id": to, "amount": amount, "description": "salary"}
+	}
+
+	// 整批成功
+	code, resp := sendJSON(t, router, "POST", "/v1/transfers/batch", map[string]interface{}{
+		"from_account_id": sourceID,
+		"transfers":       []interface{}{item(payees[0], "300"), item(payees[1], "200"), item(payees[2], "100")},
+	})
+	require.Equal(t, http.StatusOK, code)
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, "atomic", data["mode"])
+	assert.Equal(t, float64(3), data["succeeded"])
+	items := data["items"].([]interface{})
+	require.Len(t, items, 3)
+	transaction := items[0].(map[string]interface{})["transaction"].(map[string]interface{})
+	assert.Equal(t, "salary", transaction["description"])
+	assert.Equal(t, "300.00", transaction["amount"])
+	assert.Equal(t, "400.00", getTestAccount(t, router, sourceID)["balance"])
+	assert.Equal(t, "200.00", getTestAccount(t, router, payees[1])["balance"])
+
+	// 累計超過餘額, 整批不執行
+	code, resp = sendJSON(t, router, "POST", "/v1/transfers/batch", map[string]interface{}{
+		"from_account_id": sourceID,
+		"transfers":       []interface{}{item(payees[0], "300"), item(payees[1], "101")},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.InsufficientBalance), resp["code"])
+	assert.Contains(t, resp["message"], "transfer 1")
+	assert.Equal(t, "400.00", getTestAccount(t, router, sourceID)["balance"])
+	assert.Equal(t, "300.00", getTestAccount(t, router, payees[0])["balance"])
+
+	// best_effort 回傳每筆結果, mode不分大小寫
+	code, resp = sendJSON(t, router, "POST", "/v1/transfers/batch", map[string]interface{}{
+		"mode":            "BEST_EFFORT",
+		"from_account_id": sourceID,
+		"transfers":       []interface{}{item(payees[0], "300"), item(9999, "1"), item(payees[1], "101"), item(payees[2], "99")},
+	})
+	require.Equal(t, http.StatusOK, code)
+	data = resp["data"].(map[string]interface{})
+	assert.Equal(t, "best_effort", data["mode"])
+	assert.Equal(t, float64(2), data["succeeded"])
+	assert.Equal(t, float64(2), data["failed"])
+	items = data["items"].([]interface{})
+	require.Len(t, items, 4)
+	for i, expected := range []struct {
+		status string
+		code   float64
+	}{{"succeeded", 0}, {"failed", response.AccountNotFound}, {"failed", response.InsufficientBalance}, {"succeeded", 0}} {
+		result := items[i].(map[string]interface{})
+		assert.Equal(t, float64(i), result["index"])
+		assert.Equal(t, expected.status, result["status"])
+		if expected.code != 0 {
+			assert.Equal(t, expected.code, result["error"].(map[string]interface{})["code"])
+			assert.Nil(t, result["transaction"])
+		}
+	}
+	assert.Equal(t, "1.00", getTestAccount(t, router, sourceID)["balance"])
+
+	// 限額逐筆累計: limited 每日3筆
+	limitedID := createTestAccount(t, router, "limited payroll", "1000.00")
+	code, _ = sendJSON(t, router, "PUT", fmt.Sprintf("/v1/account/%d/limits", limitedID), map[string]interface{}{"tier": "limited"})
+	require.Equal(t, http.StatusOK, code)
+	code, resp = sendJSON(t, router, "POST", "/v1/transfers/batch", map[string]interface{}{
+		"from_account_id": limitedID,
+		"transfers":       []interface{}{item(payees[0], "10"), item(payees[1], "10"), item(payees[2], "10"), item(payees[0], "10")},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.LimitExceeded), resp["code"])
+	assert.Contains(t, resp["message"], "transfer 3")
+	assert.Equal(t, "1000.00", getTestAccount(t, router, limitedID)["balance"])
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"empty batch", map[string]interface{}{"from_account_id": sourceID, "transfers": []interface{}{}}},
+		{"unknown mode", map[string]interface{}{"mode": "sometimes", "from_account_id": sourceID, "transfers": []interface{}{item(payees[0], "1")}}},
+		{"missing source", map[string]interface{}{"transfers": []interface{}{item(payees[0], "1")}}},
+		{"missing destination", map[string]interface{}{"from_account_id": sourceID, "transfers": []interface{}{map[string]interface{}{"amount": "1"}}}},
+		{"negative amount", map[string]interface{}{"from_account_id": sourceID, "transfers": []interface{}{item(payees[0], "-1")}}},
+		{"same account", map[string]interface{}{"from_account_id": sourceID, "transfers": []interface{}{item(sourceID, "1")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := sendJSON(t, router, "POST", "/v1/transfers/batch", tt.body)
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Equal(t, float64(response.InvalidParams), resp["code"])
+		})
+	}
+}
+
+// TestStandingOrderAPI 測試預約/定期轉帳的建立、執行、失敗重試與暫停取消
+func TestStandingOrderAPI(t *testing.T) {
+	router := setupRouter()
+	payerID := createTestAccount(t, router, "payer", "100.00")
+	payeeID := createTestAccount(t, router, "landlord", "0")
+	ordersURL := fmt.Sprintf("/v1/account/%d/standing-orders", payerID)
+	runDue := func() []interface{} {
+		code, resp := sendJSON(t, router, "POST", "/v1/admin/standing-orders/run", nil)
+		require.Equal(t, http.StatusOK, code)
+		return resp["data"].([]interface{})
+	}
+	getOrder := func(id int) map[string]interface{} {
+		code, resp := sendJSON(t, router, "GET", fmt.Sprintf("/v1/standing-orders/%d", id), nil)
+		require.Equal(t, http.StatusOK, code)
+		return resp["data"].(map[string]interface{})
+	}
+
+	// 未帶start_at立即到期
+	code, resp := sendJSON(t, router, "POST", ordersURL, map[string]interface{}{
+		"to_account_id": payeeID, "amount": "30", "schedule": map[string]interface{}{"frequency": "once"},
+	})
+	require.Equal(t, http.StatusOK, code)
+	once := resp["data"].(map[string]interface{})
+	onceID := int(once["id"].(float64))
+	assert.Equal(t, "active", once["status"])
+	assert.Equal(t, "30.00", once["amount"])
+	assert.NotNil(t, once["next_run_at"])
+
+	code, resp = sendJSON(t, router, "POST", ordersURL, map[string]interface{}{
+		"to_account_id": payeeID, "amount": "10", "description": "rent",
+		"schedule": map[string]interface{}{"frequency": "monthly", "day_of_month": 31},
+		"start_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+	})
+	require.Equal(t, http.StatusOK, code)
+	monthly := resp["data"].(map[string]interface{})
+	assert.Equal(t, float64(31), monthly["schedule"].(map[string]interface{})["day_of_month"])
+
+	runs := runDue()
+	require.Len(t, runs, 1)
+	run := runs[0].(map[string]interface{})
+	assert.Equal(t, "succeeded", run["status"])
+	assert.Equal(t, float64(onceID), run["standing_order_id"])
+	assert.NotEmpty(t, run["trace_id"])
+	assert.Equal(t, run["transaction_id"], float64(latestTransactionID(t, router, payerID)))
+	assert.Equal(t, "70.00", getTestAccount(t, router, payerID)["balance"])
+	assert.Equal(t, "30.00", getTestAccount(t, router, payeeID)["balance"])
+
+	once = getOrder(onceID)
+	assert.Equal(t, "completed", once["status"])
+	assert.Equal(t, float64(1), once["executions"])
+	assert.Nil(t, once["next_run_at"])
+	// 已完成的不會再執行
+	assert.Empty(t, runDue())
+
+	// 餘額不足: 記錄失敗並排定重試
+	code, resp = sendJSON(t, router, "POST", ordersURL, map[string]interface{}{
+		"to_account_id": payeeID, "amount": "100", "schedule": map[string]interface{}{"frequency": "daily"},
+	})
+	require.Equal(t, http.StatusOK, code)
+	dailyID := int(resp["data"].(map[string]interface{})["id"].(float64))
+	runs = runDue()
+	require.Len(t, runs, 1)
+	run = runs[0].(map[string]interface{})
+	assert.Equal(t, "failed", run["status"])
+	assert.Contains(t, run["error"], "insufficient balance")
+	assert.Nil(t, run["transaction_id"])
+	assert.Equal(t, "70.00", getTestAccount(t, router, payerID)["balance"])
+
+	daily := getOrder(dailyID)
+	assert.Equal(t, "active", daily["status"])
+	assert.Equal(t, float64(1), daily["attempts"])
+	assert.Contains(t, daily["last_error"], "insufficient balance")
+	assert.NotEqual(t, daily["due_at"], daily["next_run_at"])
+	// 重試時間未到
+	assert.Empty(t, runDue())
+
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("/v1/standing-orders/%d/runs", dailyID), nil)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, resp["data"].([]interface{}), 1)
+
+	code, resp = sendJSON(t, router, "GET", ordersURL, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp["data"].([]interface{}), 3)
+
+	// 暫停 / 恢復 / 取消
+	dailyURL := fmt.Sprintf("/v1/standing-orders/%d", dailyID)
+	code, resp = sendJSON(t, router, "POST", dailyURL+"/pause", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "paused", resp["data"].(map[string]interface{})["status"])
+	code, resp = sendJSON(t, router, "POST", dailyURL+"/pause", nil)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, float64(response.StandingOrderNotActive), resp["code"])
+	code, resp = sendJSON(t, router, "POST", dailyURL+"/resume", nil)
+	require.Equal(t, http.StatusOK, code)
+	// 暫停前這一期已過, 恢復後從下一期開始
+	resumed := resp["data"].(map[string]interface{})
+	assert.Equal(t, "active", resumed["status"])
+	assert.Equal(t, float64(0), resumed["attempts"])
+	assert.Empty(t, runDue())
+	code, resp = sendJSON(t, router, "POST", dailyURL+"/cancel", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "cancelled", resp["data"].(map[string]interface{})["status"])
+	code, _ = sendJSON(t, router, "POST", dailyURL+"/resume", nil)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, resp = sendJSON(t, router, "GET", "/v1/standing-orders/9999", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, float64(response.StandingOrderNotFound), resp["code"])
+
+	tests := []struct {
+		name   string
+		body   map[string]interface{}
+		status int
+		code   int
+	}{
+		{"unknown frequency", map[string]interface{}{"to_account_id": payeeID, "amount": "1", "schedule": map[string]interface{}{"frequency": "yearly"}},
+			http.StatusBadRequest, response.InvalidParams},
+		{"monthly without day", map[string]interface{}{"to_account_id": payeeID, "amount": "1", "schedule": map[string]interface{}{"frequency": "monthly"}},
+			http.StatusBadRequest, response.InvalidParams},
+		{"start in the past", map[string]interface{}{"to_account_id": payeeID, "amount": "1", "schedule": map[string]interface{}{"frequency": "once"},
+			"start_at": time.Now().Add(-time.Hour).Format(time.RFC3339)}, http.StatusBadRequest, response.InvalidParams},
+		{"negative retries", map[string]interface{}{"to_account_id": payeeID, "amount": "1", "schedule": map[string]interface{}{"frequency": "daily"},
+			"retry_policy": map[string]interface{}{"max_retries": -1}}, http.StatusBadRequest, response.InvalidParams},
+		{"same account", map[string]interface{}{"to_account_id": payerID, "amount": "1", "schedule": map[string]interface{}{"frequency": "once"}},
+			http.StatusBadRequest, response.InvalidParams},
+		{"unknown destination", map[string]interface{}{"to_account_id": 9999, "amount": "1", "schedule": map[string]interface{}{"frequency": "once"}},
+			http.StatusNotFound, response.AccountNotFound},
+		{"currency mismatch", map[string]interface{}{"to_account_id": payeeID, "amount": "1", "currency": "USD", "schedule": map[string]interface{}{"frequency": "once"}},
+			http.StatusUnprocessableEntity, response.CurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := sendJSON(t, router, "POST", ordersURL, tt.body)
+			assert.Equal(t, tt.status, code)
+			assert.Equal(t, float64(tt.code), resp["code"])
+		})
+	}
+}
+
+// TestStandingOrderCrashRecovery 轉帳已入帳但排程未寫回就crash時, 重新執行只補寫紀錄不會再付一次
+func TestStandingOrderCrashRecovery(t *testing.T) {
+	logger.Init("info", "json", "")
+	memoryStorage := storage.NewMemoryStorage()
+	accountService := service.NewAccountService(memoryStorage)
+	standingOrderService := service.NewStandingOrderService(memoryStorage, accountService, model.RetryPolicy{})
+	ctx := context.Background()
+
+	payer, err := accountService.CreateAccount(ctx, service.CreateAccountInput{Name: "payer", InitialBalance: decimal.NewFromInt(100)})
+	require.NoError(t, err)
+	payee, err := accountService.CreateAccount(ctx, service.CreateAccountInput{Name: "landlord"})
+	require.NoError(t, err)
+	order, err := standingOrderService.CreateStandingOrder(ctx, payer.ID, service.CreateStandingOrderInput{
+		ToAccountID: payee.ID, Amount: decimal.NewFromInt(30), Schedule: model.Schedule{Frequency: model.ScheduleOnce},
+	})
+	require.NoError(t, err)
+
+	// crash前已完成的轉帳
+	transfer, err := accountService.Transfer(ctx, service.TransferInput{
+		FromAccountID: payer.ID, ToAccountID: payee.ID, Amount: order.Amount, Reference: order.Reference(),
+	})
+	require.NoError(t, err)
+
+	runs, err := standingOrderService.RunDue(ctx, time.Now())
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, model.StandingOrderRunSucceeded, runs[0].Status)
+	require.NotNil(t, runs[0].TransactionID)
+	assert.Equal(t, transfer.ID, *runs[0].TransactionID)
+
+	got, err := memoryStorage.GetAccountByID(payer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "70", got.Balance.String())
+	order, err = standingOrderService.GetStandingOrder(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StandingOrderCompleted, order.Status)
+	assert.Equal(t, 1, order.Executions)
+}
+
+func TestInterestAPI(t *testing.T) {
+	router := setupRouter()
+	accountID := createTestAccount(t, router, "saver", "1000000")
+	productURL := fmt.Sprintf("/v1/account/%d/product", accountID)
+
+	code, resp := sendJSON(t, router, "GET", "/v1/interest/products", nil)
+	require.Equal(t, http.StatusOK, code)
+	products := resp["data"].([]interface{})
+	require.Len(t, products, 2)
+	savings := products[0].(map[string]interface{})
+	assert.Equal(t, "savings", savings["name"])
+	assert.Equal(t, "0.0365", savings["rate"])
+	assert.Equal(t, "ACT/365", savings["day_count"])
+	assert.Equal(t, "term", products[1].(map[string]interface{})["name"])
+
+	code, resp = sendJSON(t, router, "PUT", productURL, map[string]interface{}{"product": "gold"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, resp["message"], "available products: savings, term")
+	code, _ = sendJSON(t, router, "PUT", "/v1/account/999/product", map[string]interface{}{"product": "savings"})
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// 未指定產品前沒有計息進度
+	account := getTestAccount(t, router, accountID)
+	assert.NotContains(t, account, "accrued_through")
+	assert.NotContains(t, account, "product")
+
+	code, resp = sendJSON(t, router, "PUT", productURL, map[string]interface{}{"product": "Savings"})
+	require.Equal(t, http.StatusOK, code)
+	account = resp["data"].(map[string]interface{})
+	assert.Equal(t, "savings", account["product"])
+	assert.Equal(t, "0", account["accrued_interest"])
+	assert.Equal(t, time.Now().AddDate(0, 0, -1).Format(time.DateOnly), account["accrued_through"])
+
+	// 從當天開始計息, 今天還沒結束不會計息
+	code, resp = sendJSON(t, router, "POST", "/v1/admin/interest/run", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp["data"])
+
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("/v1/account/%d/interest", accountID), nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp["data"])
+	code, _ = sendJSON(t, router, "GET", "/v1/account/999/interest", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("/v1/account/%d/transactions?type=interest", accountID), nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp["data"].(map[string]interface{})["transactions"])
+}
+
+// setupFeeRouter 有設定手續費的router, 與setupRouter分開避免影響其他測試的餘額
+// withdraw: 每筆15; transfer: 0.1%, 最低1最高50
+func setupFeeRouter() *gin.Engine {
+	logger.Init("info", "json", "")
+
+	memoryStorage := storage.NewMemoryStorage()
+	minFee, maxFee := decimal.NewFromInt(1), decimal.NewFromInt(50)
+	feeService := service.NewFeeService(memoryStorage, []model.FeeSchedule{
+		{Operation: model.TransactionTypeWithdraw, Type: model.FeeTypeFlat, Amount: decimal.NewFromInt(15)},
+		{Operation: model.TransactionTypeTransfer, Type: model.FeeTypePercentage, Rate: decimal.RequireFromString("0.001"), Min: &minFee, Max: &maxFee},
+	})
+	accountHandler := handler.NewAccountHandler(service.NewAccountService(memoryStorage, service.WithFees(feeService)))
+	ledgerHandler := handler.NewLedgerHandler(service.NewLedgerService(memoryStorage))
+	feeHandler := handler.NewFeeHandler(feeService)
+	holdHandler := handler.NewHoldHandler(service.NewHoldService(memoryStorage, time.Hour, service.WithHoldFees(feeService)))
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	v1 := r.Group("/v1")
+	{
+		v1.POST("/account", accountHandler.CreateAccount)
+		v1.GET("/account/:id", accountHandler.GetAccount)
+		v1.POST("/account/:id/withdraw", accountHandler.Withdraw)
+		v1.POST("/account/:id/transfer", accountHandler.Transfer)
+		v1.GET("/account/:id/transactions", accountHandler.GetTransactions)
+		v1.GET("/account/:id/fees/quote", feeHandler.Quote)
+		v1.POST("/transfers/batch", accountHandler.TransferBatch)
+		v1.POST("/account/:id/holds", holdHandler.PlaceHold)
+		v1.POST("/holds/:id/capture", holdHandler.CaptureHold)
+		v1.GET("/fees", feeHandler.GetSchedules)
+		v1.GET("/ledger/trial-balance", ledgerHandler.TrialBalance)
+	}
+	return r
+}
+
+// TestFeeAPI 測試手續費試算與隨提款轉帳一起扣款
+func TestFeeAPI(t *testing.T) {
+	router := setupFeeRouter()
+	accountID := createTestAccount(t, router, "payer", "1000")
+	payeeID := createTestAccount(t, router, "payee", "0")
+	quoteURL := fmt.Sprintf("/v1/account/%d/fees/quote", accountID)
+
+	code, resp := sendJSON(t, router, "GET", "/v1/fees", nil)
+	require.Equal(t, http.StatusOK, code)
+	schedules := resp["data"].([]interface{})
+	require.Len(t, schedules, 2)
+	assert.Equal(t, "withdraw", schedules[0].(map[string]interface{})["operation"])
+	assert.Equal(t, "percentage", schedules[1].(map[string]interface{})["type"])
+
+	quotes := []struct {
+		operation, amount string
+		fee, total        string
+	}{
+		{"withdraw", "100", "15.00", "115.00"},
+		{"transfer", "20000", "20.00", "20020.00"},
+		{"transfer", "500", "1.00", "501.00"},
+		{"transfer", "100000", "50.00", "100050.00"},
+	}
+	for _, q := range quotes {
+		code, resp = sendJSON(t, router, "GET", fmt.Sprintf("%s?operation=%s&amount=%s", quoteURL, q.operation, q.amount), nil)
+		require.Equal(t, http.StatusOK, code, resp)
+		quote := resp["data"].(map[string]interface{})
+		assert.Equal(t, q.fee, quote["fee"], q)
+		assert.Equal(t, q.total, quote["total"], q)
+		assert.Equal(t, "TWD", quote["currency"])
+	}
+
+	errorCases := []struct {
+		url    string
+		status int
+	}{
+		{quoteURL + "?operation=deposit&amount=100", http.StatusBadRequest},
+		{quoteURL + "?operation=withdraw", http.StatusBadRequest},
+		{quoteURL + "?operation=withdraw&amount=0", http.StatusBadRequest},
+		{quoteURL + "?operation=withdraw&amount=1.001", http.StatusBadRequest},
+		{"/v1/account/999/fees/quote?operation=withdraw&amount=100", http.StatusNotFound},
+	}
+	for _, tt := range errorCases {
+		code, _ = sendJSON(t, router, "GET", tt.url, nil)
+		assert.Equal(t, tt.status, code, tt.url)
+	}
+	code, resp = sendJSON(t, router, "GET", quoteURL+"?operation=deposit&amount=100", nil)
+	assert.Contains(t, resp["message"], "available operations: withdraw, transfer")
+
+	// 試算不扣款
+	assert.Equal(t, "1000.00", getTestAccount(t, router, accountID)["balance"])
+
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/withdraw", accountID), map[string]interface{}{"amount": "100"})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "885.00", getTestAccount(t, router, accountID)["balance"])
+
+	code, resp = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/transfer", accountID),
+		map[string]interface{}{"to_account_id": payeeID, "amount": "500"})
+	require.Equal(t, http.StatusOK, code)
+	transfer := resp["data"].(map[string]interface{})
+	fee := transfer["fee"].(map[string]interface{})
+	assert.Equal(t, "fee", fee["type"])
+	assert.Equal(t, "1.00", fee["amount"])
+	assert.NotNil(t, fee["fee_for"])
+	assert.Equal(t, "384.00", getTestAccount(t, router, accountID)["balance"])
+	assert.Equal(t, "500.00", getTestAccount(t, router, payeeID)["balance"])
+
+	// 金額本身足夠, 加上手續費不足時整筆失敗
+	code, resp = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/withdraw", accountID), map[string]interface{}{"amount": "370"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.InsufficientBalance), resp["code"])
+	assert.Equal(t, "384.00", getTestAccount(t, router, accountID)["balance"])
+
+	// 批次轉帳每筆各自收費
+	code, resp = sendJSON(t, router, "POST", "/v1/transfers/batch", map[string]interface{}{
+		"from_account_id": accountID,
+		"transfers": []map[string]interface{}{
+			{"to_account_id": payeeID, "amount": "100"},
+			{"to_account_id": payeeID, "amount": "100"},
+		},
+	})
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, "182.00", getTestAccount(t, router, accountID)["balance"])
+
+	// 預授權請款是提款, 依withdraw收費; 手續費不能動用圈存的金額
+	code, resp = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/holds", accountID), map[string]interface{}{"amount": "170"})
+	require.Equal(t, http.StatusOK, code, resp)
+	captureURL := fmt.Sprintf("/v1/holds/%d/capture", int(resp["data"].(map[string]interface{})["id"].(float64)))
+	code, resp = sendJSON(t, router, "POST", captureURL, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, float64(response.InsufficientBalance), resp["code"])
+	code, resp = sendJSON(t, router, "POST", captureURL, map[string]interface{}{"amount": "100"})
+	require.Equal(t, http.StatusOK, code, resp)
+	capture := resp["data"].(map[string]interface{})["transaction"].(map[string]interface{})
+	assert.Equal(t, "15.00", capture["fee"].(map[string]interface{})["amount"])
+	assert.Equal(t, "67.00", getTestAccount(t, router, accountID)["balance"])
+
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("/v1/account/%d/transactions?type=fee", accountID), nil)
+	require.Equal(t, http.StatusOK, code)
+	fees := resp["data"].(map[string]interface{})["transactions"].([]interface{})
+	require.Len(t, fees, 5)
+	for _, f := range fees {
+		assert.NotNil(t, f.(map[string]interface{})["fee_for"])
+	}
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("/v1/account/%d/transactions?type=fee", payeeID), nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp["data"].(map[string]interface{})["transactions"])
+
+	code, resp = sendJSON(t, router, "GET", "/v1/ledger/trial-balance", nil)
+	require.Equal(t, http.StatusOK, code)
+	trial := resp["data"].(map[string]interface{})
+	assert.Equal(t, true, trial["balanced"])
+	for _, a := range trial["accounts"].([]interface{}) {
+		account := a.(map[string]interface{})
+		if account["account"] == model.SystemAccountFees {
+			assert.Equal(t, "33", account["credit"])
+		}
+	}
+}
+
+// TestStatementAPI 測試對帳單的期初期末餘額、每筆入帳後餘額與合計
+func TestStatementAPI(t *testing.T) {
+	router := setupRouter()
+	accountID := createTestAccount(t, router, "statement", "1000")
+	otherID := createTestAccount(t, router, "other", "0")
+	statementURL := fmt.Sprintf("/v1/account/%d/statement", accountID)
+
+	code, _ := sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/deposit", accountID), map[string]interface{}{"amount": "250.5"})
+	require.Equal(t, http.StatusOK, code)
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/withdraw", accountID), map[string]interface{}{"amount": "100"})
+	require.Equal(t, http.StatusOK, code)
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/transfer", accountID),
+		map[string]interface{}{"to_account_id": otherID, "amount": "300"})
+	require.Equal(t, http.StatusOK, code)
+
+	code, resp := sendJSON(t, router, "GET", statementURL, nil)
+	require.Equal(t, http.StatusOK, code, resp)
+	statement := resp["data"].(map[string]interface{})
+	assert.Equal(t, "TWD", statement["currency"])
+	assert.Equal(t, "0.00", statement["opening_balance"])
+	assert.Equal(t, "850.50", statement["closing_balance"])
+	assert.Equal(t, "1250.50", statement["total_credit"])
+	assert.Equal(t, "400.00", statement["total_debit"])
+	assert.Equal(t, getTestAccount(t, router, accountID)["balance"], statement["closing_balance"])
+
+	lines := statement["transactions"].([]interface{})
+	require.Len(t, lines, 4)
+	running := []string{"1000.00", "1250.50", "1150.50", "850.50"}
+	amounts := []string{"1000.00", "250.50", "-100.00", "-300.00"}
+	for i, l := range lines {
+		line := l.(map[string]interface{})
+		assert.Equal(t, amounts[i], line["amount"], i)
+		assert.Equal(t, running[i], line["running_balance"], i)
+	}
+	totals := statement["totals"].([]interface{})
+	require.Len(t, totals, 3)
+	deposit := totals[0].(map[string]interface{})
+	assert.Equal(t, "deposit", deposit["type"])
+	assert.Equal(t, float64(2), deposit["count"])
+	assert.Equal(t, "1250.50", deposit["credit"])
+
+	// 只給日期時to包含當天整天
+	today := time.Now().UTC().Format("2006-01-02")
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("%s?from=%s&to=%s", statementURL, today, today), nil)
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Len(t, resp["data"].(map[string]interface{})["transactions"], 4)
+
+	// from在to(預設為現在)之後
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("%s?from=%s", statementURL, tomorrow), nil)
+	assert.Equal(t, http.StatusBadRequest, code, resp)
+	// 期間之後的交易不計入期末餘額
+	code, resp = sendJSON(t, router, "GET", fmt.Sprintf("%s?to=%s", statementURL, time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")), nil)
+	require.Equal(t, http.StatusOK, code, resp)
+	statement = resp["data"].(map[string]interface{})
+	assert.Empty(t, statement["transactions"])
+	assert.Equal(t, "0.00", statement["closing_balance"])
+
+	errorCases := []struct {
+		url    string
+		status int
+	}{
+		{statementURL + "?from=yesterday", http.StatusBadRequest},
+		{statementURL + "?from=2024-02-01&to=2024-01-01", http.StatusBadRequest},
+		{"/v1/account/abc/statement", http.StatusBadRequest},
+		{"/v1/account/999/statement", http.StatusNotFound},
+	}
+	for _, tt := range errorCases {
+		code, _ = sendJSON(t, router, "GET", tt.url, nil)
+		assert.Equal(t, tt.status, code, tt.url)
+	}
+}
+
+// TestStatementExportAPI 測試對帳單匯出, 各格式內容由internal/export的golden file測試
+func TestStatementExportAPI(t *testing.T) {
+	router := setupRouter()
+	accountID := createTestAccount(t, router, "export", "1000")
+	otherID := createTestAccount(t, router, "other", "0")
+	exportURL := fmt.Sprintf("/v1/account/%d/statement/export", accountID)
+
+	code, _ := sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/transfer", accountID),
+		map[string]interface{}{"to_account_id": otherID, "amount": "120.5"})
+	require.Equal(t, http.StatusOK, code)
+	code, _ = sendJSON(t, router, "POST", fmt.Sprintf("/v1/account/%d/deposit", accountID), map[string]interface{}{"amount": "20"})
+	require.Equal(t, http.StatusOK, code)
+	balance := getTestAccount(t, router, accountID)["balance"]
+
+	download := func(url string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	today := time.Now().Format("20060102")
+
+	w := download(exportURL + "?format=csv")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, fmt.Sprintf(`attachment; filename="statement-%d-%s-%s.csv"`, accountID, today, today),
+		w.Header().Get("Content-Disposition"))
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, "transfer", records[2][3])
+	assert.Equal(t, fmt.Sprint(otherID), records[2][5])
+	assert.Equal(t, "-120.50", records[2][6])
+	assert.Equal(t, balance, records[3][8])
+
+	w = download(exportURL + "?format=ofx")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-ofx", w.Header().Get("Content-Type"))
+	var ofx struct {
+		Currency     string   `xml:"BANKMSGSRSV1>STMTTRNRS>STMTRS>CURDEF"`
+		Amounts      []string `xml:"BANKMSGSRSV1>STMTTRNRS>STMTRS>BANKTRANLIST>STMTTRN>TRNAMT"`
+		LedgerAmount string   `xml:"BANKMSGSRSV1>STMTTRNRS>STMTRS>LEDGERBAL>BALAMT"`
+	}
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &ofx))
+	assert.Equal(t, "TWD", ofx.Currency)
+	assert.Equal(t, []string{"1000.00", "-120.50", "20.00"}, ofx.Amounts)
+	assert.Equal(t, balance, ofx.LedgerAmount)
+
+	w = download(exportURL + "?format=camt053")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".xml")
+	var camt struct {
+		Balances []struct {
+			Code   string `xml:"Tp>CdOrPrtry>Cd"`
+			Amount string `xml:"Amt"`
+		} `xml:"BkToCstmrStmt>Stmt>Bal"`
+		Entries []string `xml:"BkToCstmrStmt>Stmt>Ntry>CdtDbtInd"`
+	}
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &camt))
+	require.Len(t, camt.Balances, 2)
+	assert.Equal(t, "0.00", camt.Balances[0].Amount)
+	assert.Equal(t, "CLBD", camt.Balances[1].Code)
+	assert.Equal(t, balance, camt.Balances[1].Amount)
+	assert.Equal(t, []string{"CRDT", "DBIT", "CRDT"}, camt.Entries)
+
+	w = download(exportURL + "?format=mt940")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".sta")
+	mt940 := w.Body.String()
+	assert.Contains(t, mt940, fmt.Sprintf(":25:KOKPTWTP/%d\r\n", accountID))
+	assert.Contains(t, mt940, ":60F:C"+time.Now().Format("060102")+"TWD0,00\r\n")
+	assert.Equal(t, 3, strings.Count(mt940, ":61:"))
+	assert.Contains(t, mt940, "D120,50NTRF")
+	assert.Contains(t, mt940, ":62F:C"+time.Now().Format("060102")+"TWD"+strings.Replace(balance.(string), ".", ",", 1)+"\r\n-\r\n")
+
+	errorCases := []struct {
+		url    string
+		status int
+	}{
+		{exportURL, http.StatusBadRequest},
+		{exportURL + "?format=pdf", http.StatusBadRequest},
+		{exportURL + "?format=csv&from=2024-02-01&to=2024-01-01", http.StatusBadRequest},
+		{"/v1/account/999/statement/export?format=csv", http.StatusNotFound},
+	}
+	for _, tt := range errorCases {
+		code, _ = sendJSON(t, router, "GET", tt.url, nil)
+		assert.Equal(t, tt.status, code, tt.url)
+	}
+	_, resp := sendJSON(t, router, "GET", exportURL+"?format=pdf", nil)
+	assert.Contains(t, resp["message"], "available formats: csv, ofx, camt053")
+}
+
+// pain001 產生pain.001, payments為貸方帳號與金額
+func pain001(msgID string, debtorID int, payments ...[2]string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"><CstmrCdtTrfInitn>
+<GrpHdr><MsgId>%s</MsgId><CreDtTm>2024-03-25T09:00:00</CreDtTm><NbOfTxs>%d</NbOfTxs></GrpHdr>
+<PmtInf><PmtInfId>%s-1</PmtInfId><PmtMtd>TRF</PmtMtd><ReqdExctnDt>2024-03-25</ReqdExctnDt>
+<DbtrAcct><Id><Othr><Id>%d</Id></Othr></Id></DbtrAcct>`, msgID, len(payments), msgID, debtorID)
+	for i, p := range payments {
+		fmt.Fprintf(&b, `<CdtTrfTxInf><PmtId><EndToEndId>E2E-%d</EndToEndId></PmtId><Amt><InstdAmt Ccy="TWD">%s</InstdAmt></Amt>
+<CdtrAcct><Id><Othr><Id>%s</Id></Othr></Id></CdtrAcct><RmtInf><Ustrd>Invoice %d</Ustrd></RmtInf></CdtTrfTxInf>`, i+1, p[1], p[0], i+1)
+	}
+	b.WriteString("</PmtInf></CstmrCdtTrfInitn></Document>")
+	return b.String()
+}
+
+func TestPain001ImportAPI(t *testing.T) {
+	router := setupRouter()
+	debtorID := createTestAccount(t, router, "payer", "1000")
+	creditorID := createTestAccount(t, router, "payee", "0")
+
+	upload := func(body, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/v1/payments/pain001", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	type report struct {
+		Status  string   `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts>GrpSts"`
+		Reason  string   `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts>StsRsnInf>Rsn>Cd"`
+		TxSts   []string `xml:"CstmrPmtStsRpt>OrgnlPmtInfAndSts>TxInfAndSts>TxSts"`
+		Reasons []string `xml:"CstmrPmtStsRpt>OrgnlPmtInfAndSts>TxInfAndSts>StsRsnInf>Rsn>Cd"`
+	}
+	creditor := fmt.Sprint(creditorID)
+	file := pain001("PAY-1", debtorID, [2]string{creditor, "300"}, [2]string{creditor, "900"}, [2]string{"999", "10"})
+
+	// 第二筆餘額不足, 第三筆貸方帳戶不存在, 各筆互不影響
+	w := upload(file, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), `filename="pain002-`)
+	var r report
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &r), w.Body.String())
+	assert.Equal(t, "PART", r.Status)
+	assert.Equal(t, []string{"ACSC", "RJCT", "RJCT"}, r.TxSts)
+	assert.Equal(t, []string{"AM04", "AC03"}, r.Reasons)
+	assert.Equal(t, "700.00", getTestAccount(t, router, debtorID)["balance"])
+	assert.Equal(t, "300.00", getTestAccount(t, router, creditorID)["balance"])
+
+	// 相同MsgId不再執行
+	w = upload(file, "application/json")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data model.PaymentImport `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, model.PaymentStatusRejected, resp.Data.Status)
+	assert.Equal(t, "DU01", resp.Data.Reason)
+	assert.Equal(t, "700.00", getTestAccount(t, router, debtorID)["balance"])
+
+	w = upload(pain001("PAY-2", debtorID, [2]string{creditor, "200"}), "application/json")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, model.PaymentStatusSettled, resp.Data.Status)
+	require.Len(t, resp.Data.PaymentInfos, 1)
+	payment := resp.Data.PaymentInfos[0].Payments[0]
+	require.NotNil(t, payment.Transaction)
+	assert.Equal(t, "Invoice 1", payment.Transaction.Description)
+
+	// NbOfTxs不符整份退回, 不執行任何付款
+	invalid := strings.Replace(pain001("PAY-3", debtorID, [2]string{creditor, "100"}), "<NbOfTxs>1</NbOfTxs>", "<NbOfTxs>2</NbOfTxs>", 1)
+	w = upload(invalid, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	r = report{}
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &r))
+	assert.Equal(t, "RJCT", r.Status)
+	assert.Equal(t, "AM18", r.Reason)
+	assert.Empty(t, r.TxSts)
+	assert.Equal(t, "500.00", getTestAccount(t, router, debtorID)["balance"])
+
+	for _, body := range []string{"", "<Document>", "not xml"} {
+		w = upload(body, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+// setupAuthRouter 啟用登入驗證的router, 以router.RegisterV1註冊與main相同的路由與權限
+// 與setupRouter分開, 其他測試不需帶token
+func setupAuthRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger.Init("info", "json", "")
+
+	memoryStorage := storage.NewMemoryStorage()
+	jwt, err := auth.NewJWT(auth.JWTConfig{
+		Keys:      []auth.Key{{ID: "test", Algorithm: auth.HS256, Secret: []byte("integration-test-secret-0123456789")}},
+		ActiveKey: "test",
+		Issuer:    "banking-system",
+		TTL:       time.Hour,
+	})
+	require.NoError(t, err)
+	fxService := service.NewFXService(service.FXConfig{Spread: decimal.New(25, -4), QuoteTTL: time.Minute})
+	limitService := newTestLimitService(memoryStorage, time.Hour)
+	feeService := service.NewFeeService(memoryStorage, nil)
+	accountService := service.NewAccountService(memoryStorage, service.WithFX(fxService), service.WithLimits(limitService), service.WithFees(feeService))
+	userService := service.NewUserService(memoryStorage, jwt)
+	require.NoError(t, userService.EnsureAdmin(context.Background(), "admin", "admin-password"))
+	idempotencyStore := storage.NewIdempotencyStore(memoryStorage)
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	router.RegisterV1(r, router.Handlers{
+		Account:   handler.NewAccountHandler(accountService),
+		Ledger:    handler.NewLedgerHandler(service.NewLedgerService(memoryStorage)),
+		FX:        handler.NewFXHandler(fxService),
+		Limit:     handler.NewLimitHandler(limitService),
+		Fee:       handler.NewFeeHandler(feeService),
+		Statement: handler.NewStatementHandler(service.NewStatementService(memoryStorage, "KOKPTWTP")),
+		Reversal:  handler.NewReversalHandler(service.NewReversalService(memoryStorage)),
+		Hold: handler.NewHoldHandler(service.NewHoldService(memoryStorage, time.Hour,
+			service.WithHoldLimits(limitService), service.WithHoldFees(feeService))),
+		StandingOrder: handler.NewStandingOrderHandler(
+			service.NewStandingOrderService(memoryStorage, accountService, model.RetryPolicy{MaxRetries: 1, IntervalSeconds: 3600})),
+		Interest: handler.NewInterestHandler(service.NewInterestService(memoryStorage, map[string]model.Product{
+			"savings": {Rate: decimal.RequireFromString("0.0365"), DayCount: model.DayCountAct365},
+		})),
+		Payment: handler.NewPaymentHandler(service.NewPaymentImportService(accountService, idempotencyStore, time.Hour, "KOKPTWTP")),
+		User:    handler.NewUserHandler(userService),
+	}, middleware.Auth(jwt, memoryStorage), middleware.Idempotency(idempotencyStore, time.Hour))
+	return r
+}
+
+// sendAuthJSON 帶Bearer token送出JSON請求, token為空字串時不帶Authorization
+func sendAuthJSON(t *testing.T, router *gin.Engine, token, method, url string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	reader := bytes.NewBuffer(nil)
+	if body != nil {
+		jsonBody, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(jsonBody)
+	}
+	req, _ := http.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestAuthAPI 測試註冊登入, 以及只能操作自己的帳戶
+func TestAuthAPI(t *testing.T) {
+	router := setupAuthRouter(t)
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+		return resp
+	}
+	login := func(username, password string) string {
+		w := sendAuthJSON(t, router, "", "POST", "/v1/auth/login", map[string]string{"username": username, "password": password})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		data := decode(w)["data"].(map[string]interface{})
+		assert.Equal(t, "Bearer", data["token_type"])
+		return data["access_token"].(string)
+	}
+
+	w := sendAuthJSON(t, router, "", "POST", "/v1/users", map[string]string{"username": "Alice", "password": "alice-password"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	user := decode(w)["data"].(map[string]interface{})
+	assert.Equal(t, "alice", user["username"])
+	assert.NotContains(t, user, "password_hash")
+
+	// username不分大小寫, 重複註冊409
+	w = sendAuthJSON(t, router, "", "POST", "/v1/users", map[string]string{"username": "ALICE", "password": "another-password"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, float64(response.UsernameTaken), decode(w)["code"])
+	w = sendAuthJSON(t, router, "", "POST", "/v1/users", map[string]string{"username": "bob", "password": "short"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = sendAuthJSON(t, router, "", "POST", "/v1/users", map[string]string{"username": "bob", "password": "bob-password"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// 帳號不存在與密碼錯誤回應相同
+	for _, credentials := range [][2]string{{"alice", "wrong-password"}, {"nobody", "alice-password"}} {
+		w = sendAuthJSON(t, router, "", "POST", "/v1/auth/login", map[string]string{"username": credentials[0], "password": credentials[1]})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "invalid username or password", decode(w)["message"])
+	}
+
+	alice, bob := login("alice", "alice-password"), login("Bob", "bob-password")
+
+	// 沒有token或token無效
+	for _, token := range []string{"", "not-a-token", alice[:len(alice)-2] + "xx"} {
+		w = sendAuthJSON(t, router, token, "POST", "/v1/account", map[string]string{"name": "anonymous"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code, token)
+		assert.Equal(t, float64(response.Unauthorized), decode(w)["code"])
+		assert.Equal(t, `Bearer realm="banking"`, w.Header().Get("WWW-Authenticate"))
+	}
+
+	w = sendAuthJSON(t, router, alice, "GET", "/v1/users/me", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, user["id"], decode(w)["data"].(map[string]interface{})["id"])
+
+	createAccount := func(token, name string) int {
+		w := sendAuthJSON(t, router, token, "POST", "/v1/account", map[string]string{"name": name, "initial_balance": "1000"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return int(decode(w)["data"].(map[string]interface{})["id"].(float64))
+	}
+	aliceAccount, bobAccount := createAccount(alice, "alice"), createAccount(bob, "bob")
+
+	w = sendAuthJSON(t, router, alice, "GET", fmt.Sprintf("/v1/account/%d", aliceAccount), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, user["id"], decode(w)["data"].(map[string]interface{})["owner_id"])
+
+	// bob不能查詢或操作alice的帳戶
+	for _, request := range []struct {
+		method, url string
+		body        interface{}
+	}{
+		{"GET", fmt.Sprintf("/v1/account/%d", aliceAccount), nil},
+		{"GET", fmt.Sprintf("/v1/account/%d/transactions", aliceAccount), nil},
+		{"POST", fmt.Sprintf("/v1/account/%d/deposit", aliceAccount), map[string]string{"amount": "10"}},
+		{"POST", fmt.Sprintf("/v1/account/%d/withdraw", aliceAccount), map[string]string{"amount": "10"}},
+		{"POST", fmt.Sprintf("/v1/account/%d/transfer", aliceAccount), map[string]interface{}{"to_account_id": bobAccount, "amount": "10"}},
+	} {
+		w = sendAuthJSON(t, router, bob, request.method, request.url, request.body)
+		assert.Equal(t, http.StatusForbidden, w.Code, request.url)
+		assert.Equal(t, float64(response.Forbidden), decode(w)["code"])
+	}
+	w = sendAuthJSON(t, router, alice, "GET", fmt.Sprintf("/v1/account/%d", aliceAccount), nil)
+	assert.Equal(t, "1000.00", decode(w)["data"].(map[string]interface{})["balance"])
+
+	// 轉入別人的帳戶不需是擁有者, 雙方都可以查詢這筆交易的分錄
+	w = sendAuthJSON(t, router, bob, "POST", fmt.Sprintf("/v1/account/%d/transfer", bobAccount), map[string]interface{}{"to_account_id": aliceAccount, "amount": "100"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = sendAuthJSON(t, router, alice, "GET", fmt.Sprintf("/v1/account/%d/transactions?limit=1", aliceAccount), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	transactions := decode(w)["data"].(map[string]interface{})["transactions"].([]interface{})
+	require.Len(t, transactions, 1)
+	transactionID := int(transactions[0].(map[string]interface{})["id"].(float64))
+	for _, token := range []string{alice, bob} {
+		w = sendAuthJSON(t, router, token, "GET", fmt.Sprintf("/v1/transactions/%d/entries", transactionID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// alice自己帳戶的存款與bob無關
+	w = sendAuthJSON(t, router, alice, "POST", "/v1/account", map[string]string{"name": "carol"})
+	require.Equal(t, http.StatusOK, w.Code)
+	carolAccount := int(decode(w)["data"].(map[string]interface{})["id"].(float64))
+	w = sendAuthJSON(t, router, alice, "POST", fmt.Sprintf("/v1/account/%d/deposit", carolAccount), map[string]string{"amount": "5"})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = sendAuthJSON(t, router, alice, "GET", fmt.Sprintf("/v1/account/%d/transactions?limit=1", carolAccount), nil)
+	depositID := int(decode(w)["data"].(map[string]interface{})["transactions"].([]interface{})[0].(map[string]interface{})["id"].(float64))
+	w = sendAuthJSON(t, router, bob, "GET", fmt.Sprintf("/v1/transactions/%d/entries", depositID), nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// TestRBACAPI 測試角色權限: teller可替任何人存提款, auditor唯讀, admin管理帳戶與角色
+func TestRBACAPI(t *testing.T) {
+	router := setupAuthRouter(t)
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+		return resp
+	}
+	data := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		return decode(w)["data"].(map[string]interface{})
+	}
+	login := func(username, password string) string {
+		w := sendAuthJSON(t, router, "", "POST", "/v1/auth/login", map[string]string{"username": username, "password": password})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return data(w)["access_token"].(string)
+	}
+	register := func(username string) int {
+		w := sendAuthJSON(t, router, "", "POST", "/v1/users", map[string]string{"username": username, "password": username + "-password"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "customer", data(w)["role"])
+		return int(data(w)["id"].(float64))
+	}
+
+	admin := login("admin", "admin-password")
+	w := sendAuthJSON(t, router, admin, "GET", "/v1/users/me", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "admin", data(w)["role"])
+	adminID := int(data(w)["id"].(float64))
+
+	aliceID, tellerID, auditorID := register("alice"), register("teller"), register("auditor")
+	alice := login("alice", "alice-password")
+	// 變更角色前登入, 已簽發的token也套用新角色
+	teller, auditor := login("teller", "teller-password"), login("auditor", "auditor-password")
+
+	// 只有admin可以變更角色, 角色需為已定義的值, 不能變更自己的角色
+	setRole := func(token string, id int, role string) *httptest.ResponseRecorder {
+		return sendAuthJSON(t, router, token, "PUT", fmt.Sprintf("/v1/admin/users/%d/role", id), map[string]string{"role": role})
+	}
+	w = setRole(alice, aliceID, "admin")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, float64(response.Forbidden), decode(w)["code"])
+	assert.Equal(t, http.StatusBadRequest, setRole(admin, tellerID, "superuser").Code)
+	assert.Equal(t, http.StatusBadRequest, setRole(admin, adminID, "customer").Code)
+	assert.Equal(t, http.StatusNotFound, setRole(admin, 99, "teller").Code)
+	w = setRole(admin, tellerID, "Teller")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "teller", data(w)["role"])
+	require.Equal(t, http.StatusOK, setRole(admin, auditorID, "auditor").Code)
+
+	w = sendAuthJSON(t, router, alice, "POST", "/v1/account", map[string]string{"name": "alice", "initial_balance": "1000"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	aliceAccount := int(data(w)["id"].(float64))
+
+	// 只有admin可以替其他使用者開戶
+	w = sendAuthJSON(t, router, alice, "POST", "/v1/account", map[string]interface{}{"name": "bob", "owner_id": tellerID})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendAuthJSON(t, router, admin, "POST", "/v1/account", map[string]interface{}{"name": "alice savings", "owner_id": aliceID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, float64(aliceID), data(w)["owner_id"])
+	w = sendAuthJSON(t, router, admin, "POST", "/v1/account", map[string]interface{}{"name": "nobody", "owner_id": 99})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// teller可替任何人存提款, 但不能轉出或查詢別人的帳戶
+	w = sendAuthJSON(t, router, teller, "POST", fmt.Sprintf("/v1/account/%d/deposit", aliceAccount), map[string]string{"amount": "50"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = sendAuthJSON(t, router, teller, "POST", fmt.Sprintf("/v1/account/%d/withdraw", aliceAccount), map[string]string{"amount": "20"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = sendAuthJSON(t, router, teller, "POST", fmt.Sprintf("/v1/account/%d/transfer", aliceAccount), map[string]interface{}{"to_account_id": aliceAccount + 1, "amount": "10"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendAuthJSON(t, router, teller, "GET", fmt.Sprintf("/v1/account/%d", aliceAccount), nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 只有teller與admin可以沖正, alice不能自行扣回存入自己帳戶的款項
+	w = sendAuthJSON(t, router, alice, "GET", fmt.Sprintf("/v1/account/%d/transactions?type=deposit", aliceAccount), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	// 依新到舊排列, 第一筆是teller的存款, 第二筆是開戶餘額
+	deposits := data(w)["transactions"].([]interface{})
+	require.Len(t, deposits, 2)
+	reverseURL := fmt.Sprintf("/v1/transactions/%d/reverse", int(deposits[0].(map[string]interface{})["id"].(float64)))
+	w = sendAuthJSON(t, router, alice, "POST", reverseURL, map[string]string{"amount": "10"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, decode(w)["message"], "role customer is not allowed to transaction:reverse")
+	w = sendAuthJSON(t, router, teller, "POST", reverseURL, map[string]string{"amount": "10", "reason": "counter error"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = sendAuthJSON(t, router, admin, "POST", reverseURL, map[string]string{"amount": "10"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// auditor可查詢所有帳戶與試算表, 不能異動
+	w = sendAuthJSON(t, router, auditor, "GET", fmt.Sprintf("/v1/account/%d", aliceAccount), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1010.00", data(w)["balance"])
+	w = sendAuthJSON(t, router, auditor, "GET", fmt.Sprintf("/v1/account/%d/transactions", aliceAccount), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendAuthJSON(t, router, auditor, "GET", "/v1/ledger/trial-balance", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	for _, request := range []struct {
+		method, url string
+		body        interface{}
+	}{
+		{"POST", "/v1/account", map[string]string{"name": "auditor"}},
+		{"POST", fmt.Sprintf("/v1/account/%d/deposit", aliceAccount), map[string]string{"amount": "10"}},
+		{"POST", fmt.Sprintf("/v1/account/%d/freeze", aliceAccount), map[string]string{"reason": "audit"}},
+		{"POST", reverseURL, map[string]string{"amount": "1"}},
+		{"PUT", fmt.Sprintf("/v1/admin/users/%d/role", aliceID), map[string]string{"role": "admin"}},
+	} {
+		w = sendAuthJSON(t, router, auditor, request.method, request.url, request.body)
+		assert.Equal(t, http.StatusForbidden, w.Code, request.url)
+		assert.Contains(t, decode(w)["message"], "role auditor is not allowed to")
+	}
+
+	// customer不能管理帳戶或查詢試算表, admin可以管理任何帳戶但不能動用別人的資金
+	for _, request := range []struct {
+		method, url string
+		body        interface{}
+	}{
+		{"POST", fmt.Sprintf("/v1/account/%d/freeze", aliceAccount), map[string]string{"reason": "audit"}},
+		{"PUT", fmt.Sprintf("/v1/account/%d/overdraft", aliceAccount), map[string]string{"limit": "100"}},
+		{"GET", "/v1/ledger/trial-balance", nil},
+	} {
+		w = sendAuthJSON(t, router, alice, request.method, request.url, request.body)
+		assert.Equal(t, http.StatusForbidden, w.Code, request.url)
+	}
+	w = sendAuthJSON(t, router, admin, "PUT", fmt.Sprintf("/v1/account/%d/overdraft", aliceAccount), map[string]string{"limit": "100"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = sendAuthJSON(t, router, admin, "POST", fmt.Sprintf("/v1/account/%d/withdraw", aliceAccount), map[string]string{"amount": "10"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendAuthJSON(t, router, admin, "POST", fmt.Sprintf("/v1/account/%d/freeze", aliceAccount), map[string]string{"reason": "audit"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 降級立即生效, 不需等token過期
+	require.Equal(t, http.StatusOK, setRole(admin, tellerID, "customer").Code)
+	w = sendAuthJSON(t, router, teller, "POST", fmt.Sprintf("/v1/account/%d/deposit", aliceAccount), map[string]string{"amount": "1"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendAuthJSON(t, router, teller, "POST", reverseURL, map[string]string{"amount": "1"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendAuthJSON(t, router, teller, "GET", "/v1/users/me", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "customer", data(w)["role"])
+}
+
+// TestRBACRoutes 每個需要權限的路由, 沒有該權限的角色都回傳403, 沒帶token回傳401
+// 表格需涵蓋router.RegisterV1註冊的所有路由, 新增路由時需一併補上
+func TestRBACRoutes(t *testing.T) {
+	engine := setupAuthRouter(t)
+	login := func(username, password string) string {
+		w := sendAuthJSON(t, engine, "", "POST", "/v1/auth/login", map[string]string{"username": username, "password": password})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp["data"].(map[string]interface{})["access_token"].(string)
+	}
+	admin := login("admin", "admin-password")
+	tokens := map[model.Role]string{model.RoleAdmin: admin}
+	for _, role := range []model.Role{model.RoleCustomer, model.RoleTeller, model.RoleAuditor} {
+		username := string(role)
+		w := sendAuthJSON(t, engine, "", "POST", "/v1/users", map[string]string{"username": username, "password": username + "-password"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		userID := int(resp["data"].(map[string]interface{})["id"].(float64))
+		if role != model.RoleCustomer {
+			w = sendAuthJSON(t, engine, admin, "PUT", fmt.Sprintf("/v1/admin/users/%d/role", userID), map[string]string{"role": username})
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+		tokens[role] = login(username, username+"-password")
+	}
+
+	// permission為空字串代表登入即可使用
+	routes := []struct {
+		method, path string
+		permission   auth.Permission
+	}{
+		{"GET", "/v1/users/me", ""},
+		{"POST", "/v1/account", auth.AccountCreate},
+		{"GET", "/v1/account/:id", auth.AccountRead},
+		{"POST", "/v1/account/:id/deposit", auth.AccountDeposit},
+		{"POST", "/v1/account/:id/withdraw", auth.AccountWithdraw},
+		{"POST", "/v1/account/:id/transfer", auth.AccountTransfer},
+		{"POST", "/v1/account/:id/freeze", auth.AccountManage},
+		{"POST", "/v1/account/:id/unfreeze", auth.AccountManage},
+		{"POST", "/v1/account/:id/close", auth.AccountManage},
+		{"GET", "/v1/account/:id/transactions", auth.AccountRead},
+		{"GET", "/v1/account/:id/statement", auth.AccountRead},
+		{"GET", "/v1/account/:id/statement/export", auth.AccountRead},
+		{"PUT", "/v1/account/:id/overdraft", auth.AccountManage},
+		{"GET", "/v1/account/:id/overdraft/events", auth.AccountRead},
+		{"GET", "/v1/account/:id/limits", auth.AccountRead},
+		{"PUT", "/v1/account/:id/limits", auth.AccountManage},
+		{"GET", "/v1/account/:id/fees/quote", auth.AccountRead},
+		{"POST", "/v1/account/:id/holds", auth.AccountTransfer},
+		{"GET", "/v1/account/:id/holds", auth.AccountRead},
+		{"POST", "/v1/account/:id/standing-orders", auth.AccountTransfer},
+		{"GET", "/v1/account/:id/standing-orders", auth.AccountRead},
+		{"PUT", "/v1/account/:id/product", auth.AccountManage},
+		{"GET", "/v1/account/:id/interest", auth.AccountRead},
+		{"GET", "/v1/transactions/:id/entries", auth.AccountRead},
+		{"POST", "/v1/transactions/:id/reverse", auth.TransactionReverse},
+		{"POST", "/v1/transfers/batch", auth.AccountTransfer},
+		{"POST", "/v1/payments/pain001", auth.AccountTransfer},
+		{"GET", "/v1/holds/:id", auth.AccountRead},
+		{"POST", "/v1/holds/:id/capture", auth.AccountTransfer},
+		{"POST", "/v1/holds/:id/release", auth.AccountTransfer},
+		{"GET", "/v1/standing-orders/:id", auth.AccountRead},
+		{"GET", "/v1/standing-orders/:id/runs", auth.AccountRead},
+		{"POST", "/v1/standing-orders/:id/pause", auth.AccountTransfer},
+		{"POST", "/v1/standing-orders/:id/resume", auth.AccountTransfer},
+		{"POST", "/v1/standing-orders/:id/cancel", auth.AccountTransfer},
+		{"GET", "/v1/ledger/trial-balance", auth.LedgerRead},
+		{"GET", "/v1/interest/products", ""},
+		{"GET", "/v1/fees", ""},
+		{"GET", "/v1/fx/rates", ""},
+		{"POST", "/v1/fx/quotes", auth.AccountTransfer},
+		{"PUT", "/v1/admin/fx/rates", auth.SystemManage},
+		{"POST", "/v1/admin/standing-orders/run", auth.SystemManage},
+		{"POST", "/v1/admin/interest/run", auth.SystemManage},
+		{"PUT", "/v1/admin/users/:id/role", auth.SystemManage},
+	}
+
+	// 不需token的註冊與登入以外, 表格與實際註冊的路由一致
+	public := map[string]bool{"POST /v1/users": true, "POST /v1/auth/login": true}
+	registered := map[string]bool{}
+	for _, route := range engine.Routes() {
+		if key := route.Method + " " + route.Path; !public[key] {
+			registered[key] = true
+		}
+	}
+	listed := map[string]bool{}
+	for _, route := range routes {
+		listed[route.method+" "+route.path] = true
+	}
+	assert.Equal(t, registered, listed)
+
+	for _, route := range routes {
+		url := strings.ReplaceAll(route.path, ":id", "1")
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			w := sendAuthJSON(t, engine, "", route.method, url, nil)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+			if route.permission == "" {
+				return
+			}
+			for role, token := range tokens {
+				if auth.Evaluate(&auth.Principal{Role: role}, route.permission) != auth.ScopeNone {
+					continue
+				}
+				w := sendAuthJSON(t, engine, token, route.method, url, nil)
+				assert.Equal(t, http.StatusForbidden, w.Code, role)
+				assert.Contains(t, w.Body.String(), fmt.Sprintf("role %s is not allowed to %s", role, route.permission), role)
+			}
+		})
+	}
+}
+
+// TestPain001MessageIDPerUser MsgId只在同一個使用者內判斷重複, 不同使用者可以使用相同的MsgId
+func TestPain001MessageIDPerUser(t *testing.T) {
+	engine := setupAuthRouter(t)
+	data := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+		return resp["data"].(map[string]interface{})
+	}
+	upload := func(token, body string) model.PaymentImport {
+		req, _ := http.NewRequest("POST", "/v1/payments/pain001", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Data model.PaymentImport `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data
+	}
+
+	type customer struct {
+		token            string
+		debtor, creditor int
+	}
+	var customers []customer
+	for _, username := range []string{"alice", "bob"} {
+		w := sendAuthJSON(t, engine, "", "POST", "/v1/users", map[string]string{"username": username, "password": username + "-password"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = sendAuthJSON(t, engine, "", "POST", "/v1/auth/login", map[string]string{"username": username, "password": username + "-password"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		c := customer{token: data(w)["access_token"].(string)}
+		w = sendAuthJSON(t, engine, c.token, "POST", "/v1/account", map[string]string{"name": username, "initial_balance": "1000"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		c.debtor = int(data(w)["id"].(float64))
+		w = sendAuthJSON(t, engine, c.token, "POST", "/v1/account", map[string]string{"name": username + " savings"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		c.creditor = int(data(w)["id"].(float64))
+		customers = append(customers, c)
+	}
+
+	for _, c := range customers {
+		result := upload(c.token, pain001("SHARED-1", c.debtor, [2]string{fmt.Sprint(c.creditor), "100"}))
+		assert.Equal(t, model.PaymentStatusSettled, result.Status)
+	}
+	// 同一個使用者重送仍視為重複
+	for _, c := range customers {
+		result := upload(c.token, pain001("SHARED-1", c.debtor, [2]string{fmt.Sprint(c.creditor), "100"}))
+		assert.Equal(t, model.PaymentStatusRejected, result.Status)
+		assert.Equal(t, "DU01", result.Reason)
+
+		w := sendAuthJSON(t, engine, c.token, "GET", fmt.Sprintf("/v1/account/%d", c.debtor), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "900.00", data(w)["balance"])
+	}
 }